@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-clix/cli"
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func configCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "config <command>",
+		Short: "manage the contexts of the configuration file",
+	}
+	cmd.AddCommand(
+		useContextCmd(),
+		currentContextCmd(),
+		listContextsCmd(),
+		setConfigCmd(),
+		getConfigCmd(),
+	)
+	return cmd
+}
+
+func useContextCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "use-context <name>",
+		Short: "make a context the current one",
+		Args:  cli.ArgsExact(1),
+	}
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		if err := contexts.UseContext(args[0]); err != nil {
+			return err
+		}
+		if err := contexts.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to context %q\n", args[0])
+		return nil
+	}
+	return cmd
+}
+
+func currentContextCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "current-context",
+		Short: "print the name of the current context",
+		Args:  cli.ArgsNone(),
+	}
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		if contexts.CurrentContext == "" {
+			return fmt.Errorf("No current context set")
+		}
+		fmt.Println(contexts.CurrentContext)
+		return nil
+	}
+	return cmd
+}
+
+func listContextsCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "list-contexts",
+		Short: "list the contexts, marking the current one with *",
+		Args:  cli.ArgsNone(),
+	}
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		for _, name := range contexts.ContextNames() {
+			current := " "
+			if name == contexts.CurrentContext {
+				current = "*"
+			}
+			fmt.Println(current, name)
+		}
+		return nil
+	}
+	return cmd
+}
+
+func setConfigCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "set <key> [<value>]",
+		Short: "set a field of a context, e.g. grafana.url",
+		Args:  cli.ArgsAny(),
+	}
+	contextName := cmd.Flags().String("context", "", "context to set the field of, created if needed. Defaults to the current context")
+	fromEnv := cmd.Flags().String("from-env", "", "environment variable to read the value from when the context is used, e.g. to keep secrets out of the file")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("Expected a key and a value, received %d argument(s)", len(args))
+		}
+		var value string
+		switch {
+		case len(args) == 2 && *fromEnv != "":
+			return fmt.Errorf("Either a value or --from-env can be given, not both")
+		case len(args) == 2:
+			value = args[1]
+		case *fromEnv != "":
+			value = "${" + *fromEnv + "}"
+		default:
+			return fmt.Errorf("Either a value or --from-env is required")
+		}
+		contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		name, err := contextOrCurrent(contexts, *contextName)
+		if err != nil {
+			return err
+		}
+		if err := contexts.Set(name, args[0], value); err != nil {
+			return err
+		}
+		return contexts.Save()
+	}
+	return cmd
+}
+
+func getConfigCmd() *cli.Command {
+	cmd := &cli.Command{
+		Use:   "get <key>",
+		Short: "print a field of a context, as written in the configuration file",
+		Args:  cli.ArgsExact(1),
+	}
+	contextName := cmd.Flags().String("context", "", "context to get the field of. Defaults to the current context")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		contexts, err := loadContexts()
+		if err != nil {
+			return err
+		}
+		name, err := contextOrCurrent(contexts, *contextName)
+		if err != nil {
+			return err
+		}
+		value, err := contexts.Get(name, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	}
+	return cmd
+}
+
+// contextOrCurrent returns the name of a context, or of the current one if
+// none is given
+func contextOrCurrent(contexts *grizzly.ContextConfig, name string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	if contexts.CurrentContext == "" {
+		return "", fmt.Errorf("No current context set, use --context")
+	}
+	return contexts.CurrentContext, nil
+}
+
+// loadContexts reads the configuration file holding contexts
+func loadContexts() (*grizzly.ContextConfig, error) {
+	path, err := grizzly.DefaultContextConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return grizzly.LoadContextConfig(path)
+}
+
+// contextInstances returns the Grafana instances of the context a command
+// uses, restricted to those named if any
+func contextInstances(cmd *cli.Command, names []string) ([]grizzly.Instance, error) {
+	contexts, err := loadContexts()
+	if err != nil {
+		return nil, err
+	}
+	contextName, err := cmd.Flags().GetString("context")
+	if err != nil {
+		return nil, err
+	}
+	instances, err := contexts.Instances(contextName)
+	if err != nil || len(names) == 0 {
+		return instances, err
+	}
+	selected := []grizzly.Instance{}
+	for _, name := range names {
+		found := false
+		for _, instance := range instances {
+			if instance.Name == name {
+				selected = append(selected, instance)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("No Grafana instance named %q in the context", name)
+		}
+	}
+	return selected, nil
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/fatih/color"
 	"github.com/go-clix/cli"
+	"github.com/grafana/grizzly/pkg/execplugin"
+	"github.com/grafana/grizzly/pkg/generic"
 	"github.com/grafana/grizzly/pkg/grafana"
 	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/grafana/grizzly/pkg/loki"
 	"github.com/grafana/grizzly/pkg/prometheus"
 )
 
@@ -13,6 +22,9 @@ import (
 // To be overwritten at build time
 var Version = "dev"
 
+// runContext is the context of the command run, canceled on interrupt
+var runContext = context.Background()
+
 func main() {
 	log.SetFlags(0)
 
@@ -27,34 +39,176 @@ func main() {
 		log.Fatalln(err)
 	}
 
+	// follow https://no-color.org, as colors corrupt CI logs and redirects
+	if os.Getenv("NO_COLOR") != "" {
+		color.NoColor = true
+	}
+
+	logger := &grizzly.Logger{Level: grizzly.LogInfo}
+	httpOpts := grizzly.DefaultHTTPOpts()
 	config := grizzly.Config{
-		Registry: registry,
-		Notifier: grizzly.Notifier{},
+		Registry:     registry,
+		Notifier:     grizzly.Notifier{Logger: logger},
+		Jsonnet:      &grizzly.JsonnetOpts{},
+		Overrides:    &grizzly.Overrides{},
+		Transformers: &grizzly.Transformers{},
 	}
 	// workflow commands
-	rootCmd.AddCommand(
+	commands := []*cli.Command{
 		getCmd(config),
+		deleteCmd(config),
 		listCmd(config),
 		showCmd(config),
 		diffCmd(config),
+		validateCmd(config),
 		applyCmd(config),
+		pruneCmd(config),
+		rollbackCmd(config),
 		watchCmd(config),
+		serveCmd(config),
+		reconcileCmd(config),
+		serverCmd(config),
 		listenCmd(config),
 		exportCmd(config),
+		terraformCmd(config),
+		importCmd(config),
 		previewCmd(config),
 		providersCmd(config),
-	)
+	}
+	// commands grouped under grr snapshots, configured as workflow commands
+	snapshotCommands := []*cli.Command{
+		listSnapshotsCmd(config),
+		cleanupSnapshotsCmd(config),
+	}
+	for _, cmd := range append(commands, snapshotCommands...) {
+		logFlags(cmd, logger)
+		httpFlags(cmd, &httpOpts)
+		contextName := cmd.Flags().String("context", "", "context of the configuration file to use, rather than the current one")
+		// configure endpoints, the client requests are sent with and
+		// tracing, once flags are parsed
+		run := cmd.Run
+		cmd.Run = func(cmd *cli.Command, args []string) error {
+			contexts, err := loadContexts()
+			if err != nil {
+				return err
+			}
+			environment, err := grizzly.FindEnvironment(args)
+			if err != nil {
+				return err
+			}
+			if environment != nil {
+				// the context of the environment is also that of
+				// --instance
+				name := environment.Configure(contexts, *contextName)
+				if err := cmd.Flags().Set("context", name); err != nil {
+					return err
+				}
+				config.Jsonnet.SetDefaults(environment.JsonnetOpts())
+			}
+			if err := contexts.Setenv(*contextName, config.Notifier); err != nil {
+				return err
+			}
+			config.Jsonnet.SetDefaults(contexts.Jsonnet(*contextName))
+			*config.Overrides = contexts.Overrides(*contextName)
+			*config.Transformers = contexts.Transformers()
+			if err := contexts.ConfigureHandlers(*contextName, &config.Registry); err != nil {
+				return err
+			}
+			grizzly.ConfigureHTTP(httpOpts, logger)
+			if err := grizzly.ConfigureTracing(Version); err != nil {
+				return err
+			}
+			ctx, stop := interruptContext()
+			defer stop()
+			span := grizzly.StartSpan("grr " + cmd.Name())
+			runContext = grizzly.ContextWithSpan(ctx, span)
+			err = run(cmd, args)
+			span.End(err)
+			if flushErr := grizzly.FlushTracing(); flushErr != nil {
+				config.Notifier.Logf(grizzly.LogWarn, "%v", flushErr)
+			}
+			return err
+		}
+		cmd.Flags().BoolVar(&color.NoColor, "no-color", color.NoColor, "disable colored output")
+	}
+	rootCmd.AddCommand(commands...)
+	rootCmd.AddCommand(configCmd(), snapshotsCmd(snapshotCommands...))
 
 	// Run!
 	if err := rootCmd.Execute(); err != nil {
-		log.Fatalln(err)
+		log.Println(err)
+		os.Exit(exitCode(err))
 	}
 }
 
+// logFlags adds the flags configuring logging to a command
+func logFlags(cmd *cli.Command, logger *grizzly.Logger) {
+	cmd.Flags().Var(&logger.Level, "log-level", "minimum level of log messages: debug, info, warn or error")
+	cmd.Flags().BoolVar(&logger.JSON, "log-json", false, "write log messages as JSON")
+}
+
+// httpFlags adds the flags configuring requests to endpoints to a command
+func httpFlags(cmd *cli.Command, opts *grizzly.HTTPOpts) {
+	cmd.Flags().DurationVar(&opts.ConnectTimeout, "connect-timeout", opts.ConnectTimeout, "time allowed to connect to an endpoint, 0 for no limit")
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", opts.Timeout, "time allowed for an endpoint to respond to a request, 0 for no limit")
+	cmd.Flags().IntVar(&opts.Retry.Attempts, "retry-attempts", opts.Retry.Attempts, "times requests failing transiently, e.g. with 429 or 503, are sent at most")
+	cmd.Flags().DurationVar(&opts.Retry.Backoff, "retry-backoff", opts.Retry.Backoff, "time waited before retrying a request, doubling with each retry")
+}
+
+// interruptContext returns a context canceled on interrupt or termination, so
+// that commands stop cleanly, aborting their requests. A second signal exits
+// right away.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// exitCode distinguishes failures that left some resources changed, so that
+// pipelines can react to them
+func exitCode(err error) int {
+	var partial grizzly.PartialApplyErr
+	if errors.As(err, &partial) {
+		return 2
+	}
+	return 1
+}
+
 // GetProviderRegistry registers all known providers
 func GetProviderRegistry() (grizzly.Registry, error) {
 	registry := grizzly.NewProviderRegistry()
 	registry.RegisterProvider(&grafana.Provider{})
 	registry.RegisterProvider(&prometheus.Provider{})
+	registry.RegisterProvider(&loki.Provider{})
+	contexts, err := loadContexts()
+	if err != nil {
+		return registry, err
+	}
+	generics, err := generic.NewProvider(registry, contexts.Handlers)
+	if err != nil {
+		return registry, err
+	}
+	if len(generics.GetHandlers()) > 0 {
+		registry.RegisterProvider(generics)
+	}
+	plugins, err := execplugin.Discover(registry)
+	if err != nil {
+		return registry, err
+	}
+	if len(plugins.GetHandlers()) > 0 {
+		registry.RegisterProvider(plugins)
+	}
 	return registry, nil
 }
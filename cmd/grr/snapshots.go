@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/go-clix/cli"
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func snapshotsCmd(commands ...*cli.Command) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "snapshots <command>",
+		Short: "manage the snapshots created as previews",
+	}
+	cmd.AddCommand(commands...)
+	return cmd
+}
+
+func listSnapshotsCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "list",
+		Short: "list the snapshots created as previews",
+		Args:  cli.ArgsNone(),
+	}
+	output := cmd.Flags().StringP("output", "o", "", "output results in a machine-readable format, json or yaml")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		config.Output = *output
+		return grizzly.ListSnapshots(runContext, config)
+	}
+	return cmd
+}
+
+func cleanupSnapshotsCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "cleanup",
+		Short: "delete the snapshots created as previews that have expired",
+		Args:  cli.ArgsNone(),
+	}
+	olderThan := cmd.Flags().Duration("older-than", 0, "also delete snapshots created longer ago than this, e.g. 168h, whether expired or not")
+	dryRun := cmd.Flags().Bool("dry-run", false, "list the snapshots that would be deleted, without deleting them")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		return grizzly.CleanupSnapshots(runContext, config, &grizzly.SnapshotCleanupOpts{
+			OlderThan: *olderThan,
+			DryRun:    *dryRun,
+		})
+	}
+	return cmd
+}
@@ -2,8 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/go-clix/cli"
 	"github.com/grafana/grizzly/pkg/grizzly"
@@ -11,27 +18,54 @@ import (
 
 func getCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "get <resource-type>.<resource-uid>",
-		Short: "retrieve resource",
-		Args:  cli.ArgsExact(1),
+		Use:   "get <resource-type>/<resource-uid>|<resource-type>...",
+		Short: "retrieve resources, or all resources of a type",
+		Args:  argsFiles(),
 	}
+	output := cmd.Flags().StringP("output", "o", "", "output results in a machine-readable format, json or yaml")
+	outputDir := cmd.Flags().String("output-dir", "", "write resources to files in this directory, as grr export does, rather than to stdout")
+	filenameTemplate := cmd.Flags().String("template", grizzly.DefaultExportTemplate, "Go template for the path of each resource written to --output-dir, as for grr export")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		uid := args[0]
-		return grizzly.Get(config, uid)
+		config.Output = *output
+		if config.Output != "" && *outputDir != "" {
+			return fmt.Errorf("--output cannot be combined with --output-dir")
+		}
+		return grizzly.Get(runContext, config, args, &grizzly.GetOpts{
+			OutputDir:        *outputDir,
+			FilenameTemplate: *filenameTemplate,
+		})
+	}
+	return cmd
+}
+
+func deleteCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "delete <resource-type> <resource-uid>",
+		Short: "delete resource from endpoint",
+		Args:  cli.ArgsExact(2),
+	}
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		return grizzly.Delete(runContext, config, args[0], args[1])
 	}
 	return cmd
 }
 
 func listCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "list <jsonnet-file>",
-		Short: "list resource keys from file",
-		Args:  cli.ArgsExact(1),
+		Use:   "list <jsonnet-file>... | <resource-type>",
+		Short: "list resource keys from file, or resources of a type from endpoint",
+		Args:  argsFiles(),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
+	stateFile := cmd.Flags().String("state-file", "", "show which remote resources were applied, as recorded in this file")
+	output := cmd.Flags().StringP("output", "o", "", "output results in a machine-readable format, json or yaml")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		jsonnetFile := args[0]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		config.Output = *output
+		if isResourceType(config, args[0]) {
+			config.StateFile = *stateFile
+			return grizzly.ListRemote(runContext, config, args[0])
+		}
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
 		if err != nil {
 			return err
 		}
@@ -41,16 +75,106 @@ func listCmd(config grizzly.Config) *cli.Command {
 	return cmd
 }
 
+// parseFlags adds the flags selecting the resources to parse, and
+// parameterizing Jsonnet, to a command
+func parseFlags(cmd *cli.Command, config grizzly.Config) *grizzly.ParseOpts {
+	jsonnetFlags(cmd, config.Jsonnet)
+	opts := &grizzly.ParseOpts{}
+	cmd.Flags().StringSliceVarP(&opts.Targets, "target", "t", nil, "resources to target, by <kind>/<uid>. Accepts glob patterns, e.g. dashboard/*")
+	cmd.Flags().StringSliceVar(&opts.Excludes, "exclude", nil, "resources to exclude, by <kind>/<uid>. Accepts glob patterns")
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "resources to select by their labels, e.g. team=payments,tier!=critical")
+	cmd.Flags().BoolVar(&opts.InterpolateEnv, "interpolate-env", false, "replace references to environment variables in resources, e.g. ${VAR}")
+	cmd.Flags().BoolVar(&opts.Strict, "strict", false, "fail on paths of the Jsonnet output no handler consumes, rather than skipping them")
+	cmd.Flags().StringVar(&opts.TankaEnvironment, "tanka-env", "", "inline Tanka environment to parse, by name, if Jsonnet evaluates to several")
+	cmd.Flags().BoolVar(&opts.RequireUIDs, "require-uids", false, "fail unless dashboards and datasources declare a UID, rather than leave Grafana to generate one")
+	cmd.Flags().StringVar(&opts.UIDPattern, "uid-pattern", "", "regular expression declared UIDs must match, e.g. ^team-[a-z0-9-]+$. Implies --require-uids")
+	return opts
+}
+
+// jsonnetFlags adds the flags setting the import paths, external variables and
+// top-level arguments of Jsonnet to a command, as the jsonnet and tk commands name them
+func jsonnetFlags(cmd *cli.Command, opts *grizzly.JsonnetOpts) {
+	cmd.Flags().StringArrayVarP(&opts.JPath, "jpath", "J", nil, "add a directory imports are searched in. The right-most takes precedence")
+	cmd.Flags().VarP(&varsFlag{&opts.ExtStr}, "ext-str", "V", "set a Jsonnet external variable, as <name>=<value>, or <name> to read it from the environment")
+	cmd.Flags().Var(&varsFlag{&opts.ExtCode}, "ext-code", "set a Jsonnet external variable to Jsonnet code, as <name>=<code>")
+	cmd.Flags().VarP(&varsFlag{&opts.TLAStr}, "tla-str", "A", "set a Jsonnet top-level argument, as <name>=<value>, or <name> to read it from the environment")
+	cmd.Flags().Var(&varsFlag{&opts.TLACode}, "tla-code", "set a Jsonnet top-level argument to Jsonnet code, as <name>=<code>")
+}
+
+// varsFlag is a repeatable flag setting named values, as <name>=<value>. A
+// name alone reads the value from the environment variable of that name.
+type varsFlag struct {
+	vars *map[string]string
+}
+
+func (f *varsFlag) Set(s string) error {
+	name, value := s, ""
+	if i := strings.Index(s, "="); i >= 0 {
+		name, value = s[:i], s[i+1:]
+	} else {
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", name)
+		}
+		value = env
+	}
+	if name == "" {
+		return fmt.Errorf("expected <name>=<value>, got %q", s)
+	}
+	if *f.vars == nil {
+		*f.vars = map[string]string{}
+	}
+	(*f.vars)[name] = value
+	return nil
+}
+
+func (f *varsFlag) String() string {
+	if f.vars == nil || len(*f.vars) == 0 {
+		return ""
+	}
+	names := []string{}
+	for name := range *f.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func (f *varsFlag) Type() string {
+	return "name=value"
+}
+
+// argsFiles checks that at least one file is given, predicting files
+func argsFiles() cli.Arguments {
+	return cli.Args{
+		Validator: cli.ValidateFunc(func(args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("accepts at least 1 arg, received 0")
+			}
+			return nil
+		}),
+		Predictor: cli.PredictAny(),
+	}
+}
+
+// isResourceType identifies an argument naming a resource type rather than a file
+func isResourceType(config grizzly.Config, arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	_, err := config.Registry.GetHandler(arg)
+	return err == nil
+}
+
 func showCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "show <jsonnet-file>",
+		Use:   "show <jsonnet-file>...",
 		Short: "render Jsonnet as json",
-		Args:  cli.ArgsExact(1),
+		Args:  argsFiles(),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		jsonnetFile := args[0]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
 		if err != nil {
 			return err
 		}
@@ -61,43 +185,236 @@ func showCmd(config grizzly.Config) *cli.Command {
 
 func diffCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "diff <jsonnet-file>",
+		Use:   "diff <jsonnet-file>...",
 		Short: "compare Jsonnet resources with endpoint(s)",
-		Args:  cli.ArgsExact(1),
+		Args:  argsFiles(),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
+	stateFile := cmd.Flags().String("state-file", "", "merge with remote resources using the configuration last applied, recorded in this file")
+	output := cmd.Flags().StringP("output", "o", "", "output results in a machine-readable format, json or yaml")
+	format := cmd.Flags().String("format", grizzly.DiffFormatText, "how to render differences, text or markdown, e.g. to comment on pull requests")
+	fromRef := cmd.Flags().String("from-ref", "", "compare with the resources rendered at this Git reference, rather than with endpoint(s)")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		jsonnetFile := args[0]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		if *output != "" && cmd.Flags().Changed("format") {
+			return fmt.Errorf("--format and --output cannot be used together")
+		}
+		config.Output = *output
+		if *fromRef != "" {
+			return grizzly.DiffRef(runContext, config, args, *fromRef, parseOpts, &grizzly.DiffOpts{Format: *format})
+		}
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
+		if err != nil {
+			return err
+		}
+		config.StateFile = *stateFile
+		return grizzly.Diff(runContext, config, resources, &grizzly.DiffOpts{Format: *format})
+	}
+	return cmd
+}
+
+func validateCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "validate <jsonnet-file>...",
+		Short: "check rendered resources before they are pushed",
+		Args:  argsFiles(),
+	}
+	parseOpts := parseFlags(cmd, config)
+	checkReferences := checkReferencesFlag(cmd)
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if err := checkMode("--check-references", *checkReferences); err != nil {
+			return err
+		}
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
 		if err != nil {
 			return err
 		}
-		return grizzly.Diff(config, resources)
+		return grizzly.Validate(runContext, config, resources, &grizzly.ValidateOpts{CheckReferences: *checkReferences})
 	}
 	return cmd
 }
 
+// checkReferencesFlag adds the flag checking the references of resources to
+// others before they are pushed to a command
+func checkReferencesFlag(cmd *cli.Command) *string {
+	return cmd.Flags().String("check-references", "", "check the datasources dashboards refer to exist locally or remotely, and either warn or fail if not")
+}
+
+// checkMode checks the mode of a check is either warn or fail, if set
+func checkMode(flag, mode string) error {
+	switch mode {
+	case "", grizzly.HealthCheckWarn, grizzly.HealthCheckFail:
+		return nil
+	}
+	return fmt.Errorf("%s must be %s or %s", flag, grizzly.HealthCheckWarn, grizzly.HealthCheckFail)
+}
+
+// checkPrune refuses to prune resources filtered out, as they would be deleted
+func checkPrune(prune bool, opts *grizzly.ParseOpts) error {
+	if prune && (len(opts.Targets) > 0 || len(opts.Excludes) > 0 || opts.Selector != "") {
+		return fmt.Errorf("--prune cannot be combined with --target, --exclude or --selector")
+	}
+	return nil
+}
+
 func applyCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "apply <jsonnet-file>",
+		Use:   "apply <jsonnet-file>...",
 		Short: "render Jsonnet and push dashboard(s) to Grafana",
-		Args:  cli.ArgsExact(1),
+		Args:  argsFiles(),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
+	annotate := cmd.Flags().Bool("annotate", false, "record a deployment annotation in Grafana once applied")
+	commit := cmd.Flags().String("commit", "", "commit to mention in the deployment annotation. Defaults to the current git commit")
+	lint := cmd.Flags().Bool("lint", false, "check dashboards for common mistakes before applying")
+	prune := cmd.Flags().Bool("prune", false, "delete remote resources that are no longer present in the Jsonnet")
+	stateFile := cmd.Flags().String("state-file", "", "merge with remote resources using the configuration last applied, recorded in this file")
+	healthCheck := cmd.Flags().String("health-check", "", "check applied datasources can connect once applied, and either warn or fail if not")
+	checkReferences := checkReferencesFlag(cmd)
+	yes := cmd.Flags().BoolP("yes", "y", false, "skip the confirmation before overwriting resources changed remotely, or deleting resources")
+	output := cmd.Flags().StringP("output", "o", "", "output results in a machine-readable format, json or yaml")
+	parallel := cmd.Flags().Int("parallel", 1, "number of resources of a kind to push at once")
+	continueOnError := cmd.Flags().Bool("continue-on-error", false, "apply every resource possible rather than stopping at the first failure, then report the failures")
+	secrets := cmd.Flags().StringSlice("secrets", nil, "SOPS-encrypted files of secrets to merge into resources as they are pushed")
+	instanceNames := cmd.Flags().StringSlice("instance", nil, "apply to these Grafana instances of the context only, rather than all of them")
+	mark := cmd.Flags().Bool("mark", false, "mark resources as managed by grizzly, refusing to overwrite unmarked ones and only pruning marked ones")
+	adopt := cmd.Flags().Bool("adopt", false, "with --mark, mark existing resources that are not marked yet, rather than refusing to overwrite them")
+	force := cmd.Flags().Bool("force", false, "overwrite dashboards changed remotely since last applied, as recorded in the --state-file, rather than refusing to")
+	backupDir := cmd.Flags().String("backup-dir", "", "back remote resources up to this directory before overwriting or deleting them, see grr rollback")
+	auditLog := cmd.Flags().StringArray("audit-log", nil, "record the apply to this audit log: a file, an s3:// prefix or grafana. May be repeated")
+	notify := cmd.Flags().StringArray("notify", nil, "post a summary of the apply to this Slack or generic webhook. May be repeated")
+	notifyOn := cmd.Flags().String("notify-on", grizzly.NotifyAlways, "when to notify: always, changes or failures")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		jsonnetFile := args[0]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		config.Output = *output
+		if *parallel < 1 {
+			return fmt.Errorf("--parallel must be at least 1")
+		}
+		if err := checkPrune(*prune, parseOpts); err != nil {
+			return err
+		}
+		if err := checkMode("--health-check", *healthCheck); err != nil {
+			return err
+		}
+		if err := checkMode("--check-references", *checkReferences); err != nil {
+			return err
+		}
+		switch *notifyOn {
+		case grizzly.NotifyAlways, grizzly.NotifyChanges, grizzly.NotifyFailures:
+		default:
+			return fmt.Errorf("--notify-on must be %s, %s or %s", grizzly.NotifyAlways, grizzly.NotifyChanges, grizzly.NotifyFailures)
+		}
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
+		if err != nil {
+			return err
+		}
+		opts := &grizzly.ApplyOpts{
+			Annotate:        *annotate,
+			Commit:          *commit,
+			Lint:            *lint,
+			Prune:           *prune,
+			AutoApprove:     *yes,
+			HealthCheck:     *healthCheck,
+			CheckReferences: *checkReferences,
+			Parallel:        *parallel,
+			ContinueOnError: *continueOnError,
+			SecretsFiles:    *secrets,
+			Mark:            *mark,
+			Adopt:           *adopt,
+			Force:           *force,
+			BackupDir:       *backupDir,
+			AuditLog:        *auditLog,
+			Notify:          *notify,
+			NotifyOn:        *notifyOn,
+		}
+		if opts.Adopt && !opts.Mark {
+			return fmt.Errorf("--adopt requires --mark")
+		}
+		if (opts.Annotate || len(opts.AuditLog) > 0 || len(opts.Notify) > 0) && opts.Commit == "" {
+			opts.Commit = gitCommit()
+		}
+		config.StateFile = *stateFile
+		instances, err := contextInstances(cmd, *instanceNames)
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(instances) > 1:
+			if config.Output != "" {
+				return fmt.Errorf("--output cannot be used when applying to several Grafana instances, select one with --instance")
+			}
+			return grizzly.ApplyInstances(runContext, config, resources, opts, instances)
+		case len(instances) == 1:
+			if err := instances[0].Setenv(); err != nil {
+				return err
+			}
+			config.StateFile = instances[0].StateFile(config.StateFile)
+		case len(*instanceNames) > 0:
+			return fmt.Errorf("--instance requires a context with Grafana instances")
+		}
+		return grizzly.Apply(runContext, config, resources, opts)
+	}
+	return cmd
+}
+
+func pruneCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "prune <jsonnet-file>...",
+		Short: "delete remote resources that are no longer present in the Jsonnet",
+		Args:  argsFiles(),
+	}
+	autoApprove := cmd.Flags().Bool("auto-approve", false, "skip the confirmation before deleting resources")
+	stateFile := cmd.Flags().String("state-file", "", "only delete resources recorded as applied in this file")
+	mark := cmd.Flags().Bool("mark", false, "only delete resources marked as managed by grizzly")
+	backupDir := cmd.Flags().String("backup-dir", "", "back remote resources up to this directory before deleting them, see grr rollback")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		resources, err := grizzly.ParseFiles(config, args, &grizzly.ParseOpts{})
 		if err != nil {
 			return err
 		}
-		return grizzly.Apply(config, resources)
+		config.StateFile = *stateFile
+		opts := &grizzly.PruneOpts{
+			AutoApprove: *autoApprove,
+			Mark:        *mark,
+			BackupDir:   *backupDir,
+		}
+		return grizzly.Prune(runContext, config, resources, opts)
 	}
 	return cmd
 }
 
+func rollbackCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "rollback <kind>/<uid>",
+		Short: "restore a resource to its backup, taken by grr apply --backup-dir",
+		Args:  cli.ArgsExact(1),
+	}
+	backupDir := cmd.Flags().String("backup-dir", "", "directory resources were backed up to")
+	version := cmd.Flags().String("version", "", "restore the backup whose name starts with this, rather than the latest one")
+	yes := cmd.Flags().BoolP("yes", "y", false, "skip the confirmation before restoring the backup")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if *backupDir == "" {
+			return fmt.Errorf("--backup-dir is required")
+		}
+		opts := &grizzly.RollbackOpts{
+			Version:     *version,
+			AutoApprove: *yes,
+		}
+		return grizzly.Rollback(runContext, config, *backupDir, args[0], opts)
+	}
+	return cmd
+}
+
+// gitCommit returns the abbreviated commit of the current git checkout, if any
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
 type jsonnetWatchParser struct {
 	jsonnetFile string
-	targets     []string
+	opts        *grizzly.ParseOpts
 }
 
 func (p *jsonnetWatchParser) Name() string {
@@ -105,7 +422,7 @@ func (p *jsonnetWatchParser) Name() string {
 }
 
 func (p *jsonnetWatchParser) Parse(config grizzly.Config) (grizzly.Resources, error) {
-	return grizzly.Parse(config, p.jsonnetFile, p.targets)
+	return grizzly.Parse(config, p.jsonnetFile, p.opts)
 
 }
 func watchCmd(config grizzly.Config) *cli.Command {
@@ -114,20 +431,155 @@ func watchCmd(config grizzly.Config) *cli.Command {
 		Short: "watch for file changes and apply",
 		Args:  cli.ArgsExact(2),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
+	debounce := cmd.Flags().Duration("debounce", 500*time.Millisecond, "how long to wait for changes to settle before evaluating Jsonnet")
+	preview := cmd.Flags().Bool("preview", false, "preview changed resources rather than applying them")
+	metricsAddress := cmd.Flags().String("metrics-address", "", "address to serve Prometheus metrics on, e.g. :9090")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		parser := &jsonnetWatchParser{
+			jsonnetFile: args[1],
+			opts:        parseOpts,
+		}
+		watchDir := args[0]
+		opts := &grizzly.WatchOpts{
+			Debounce:       *debounce,
+			Preview:        *preview,
+			MetricsAddress: *metricsAddress,
+		}
+
+		return grizzly.Watch(runContext, config, watchDir, parser, opts)
+
+	}
+	return cmd
+}
+
+func serveCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "serve <dir-to-watch> <jsonnet-file>",
+		Short: "preview resources as files change, and serve an index of the previews",
+		Args:  cli.ArgsExact(2),
+	}
+	parseOpts := parseFlags(cmd, config)
+	address := cmd.Flags().StringP("address", "a", "localhost:8080", "address to serve the index of previews on")
+	debounce := cmd.Flags().Duration("debounce", 500*time.Millisecond, "how long to wait for changes to settle before evaluating Jsonnet")
+	expires := cmd.Flags().IntP("expires", "e", 0, "when previews should expire. Default 0 (never)")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		parser := &jsonnetWatchParser{
 			jsonnetFile: args[1],
-			targets:     *targets,
+			opts:        parseOpts,
 		}
 		watchDir := args[0]
+		opts := &grizzly.ServeOpts{
+			Address:        *address,
+			Debounce:       *debounce,
+			ExpiresSeconds: *expires,
+		}
 
-		return grizzly.Watch(config, watchDir, parser)
+		return grizzly.Serve(runContext, config, watchDir, parser, opts)
+	}
+	return cmd
+}
 
+func reconcileCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "reconcile <jsonnet-file>",
+		Short: "continuously apply resources, pulled from a Git repository if given",
+		Args:  cli.ArgsExact(1),
+	}
+	parseOpts := parseFlags(cmd, config)
+	address := cmd.Flags().StringP("address", "a", ":8080", "address to serve health and metrics on")
+	interval := cmd.Flags().Duration("interval", time.Minute, "how long to wait between reconciliations")
+	repo := cmd.Flags().String("git-repo", "", "Git repository to pull resources from, the jsonnet file being relative to it")
+	ref := cmd.Flags().String("git-ref", "", "branch or tag of the Git repository to follow, its default branch if empty")
+	dir := cmd.Flags().String("git-dir", "", "where to clone the Git repository, a temporary directory if empty")
+	prune := cmd.Flags().Bool("prune", false, "delete remote resources that are no longer present locally")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if *interval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+		if err := checkPrune(*prune, parseOpts); err != nil {
+			return err
+		}
+		opts := &grizzly.ReconcileOpts{
+			Address:  *address,
+			Interval: *interval,
+			Repo:     *repo,
+			Ref:      *ref,
+			Dir:      *dir,
+			Prune:    *prune,
+		}
+		jsonnetFile, cleanup, err := gitJsonnetFile(args[0], opts.Repo, &opts.Dir)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		parser := &jsonnetWatchParser{
+			jsonnetFile: jsonnetFile,
+			opts:        parseOpts,
+		}
+		return grizzly.Reconcile(runContext, config, parser, opts)
 	}
 	return cmd
 }
 
+func serverCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "server <jsonnet-file>",
+		Short: "apply resources whenever a Git webhook is received",
+		Args:  cli.ArgsExact(1),
+	}
+	parseOpts := parseFlags(cmd, config)
+	address := cmd.Flags().StringP("address", "a", ":8080", "address to receive webhooks on")
+	secret := cmd.Flags().String("secret", os.Getenv("GRIZZLY_WEBHOOK_SECRET"), "secret webhooks are signed with, defaults to $GRIZZLY_WEBHOOK_SECRET")
+	repo := cmd.Flags().String("git-repo", "", "Git repository to pull resources from, the jsonnet file being relative to it")
+	ref := cmd.Flags().String("git-ref", "", "branch or tag of the Git repository to follow, its default branch if empty")
+	dir := cmd.Flags().String("git-dir", "", "where to clone the Git repository, a temporary directory if empty")
+	prune := cmd.Flags().Bool("prune", false, "delete remote resources that are no longer present locally")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		if err := checkPrune(*prune, parseOpts); err != nil {
+			return err
+		}
+		opts := &grizzly.WebhookOpts{
+			Address: *address,
+			Secret:  *secret,
+			Repo:    *repo,
+			Ref:     *ref,
+			Dir:     *dir,
+			Prune:   *prune,
+		}
+		jsonnetFile, cleanup, err := gitJsonnetFile(args[0], opts.Repo, &opts.Dir)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		parser := &jsonnetWatchParser{
+			jsonnetFile: jsonnetFile,
+			opts:        parseOpts,
+		}
+		return grizzly.ServeWebhooks(runContext, config, parser, opts)
+	}
+	return cmd
+}
+
+// gitJsonnetFile returns the path of a jsonnet file within the clone of a Git
+// repository, if one is given, cloned to a temporary directory unless dir is
+// set
+func gitJsonnetFile(jsonnetFile, repo string, dir *string) (string, func(), error) {
+	if repo == "" {
+		return jsonnetFile, func() {}, nil
+	}
+	cleanup := func() {}
+	if *dir == "" {
+		tmp, err := ioutil.TempDir("", "grizzly-git")
+		if err != nil {
+			return "", nil, err
+		}
+		cleanup = func() { os.RemoveAll(tmp) }
+		*dir = filepath.Join(tmp, "repo")
+	}
+	return filepath.Join(*dir, jsonnetFile), cleanup, nil
+}
+
 func listenCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
 		Use:   "listen <uid-to-watch> <output-file>",
@@ -137,53 +589,135 @@ func listenCmd(config grizzly.Config) *cli.Command {
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		uid := args[0]
 		filename := args[1]
-		return grizzly.Listen(config, uid, filename)
+		return grizzly.Listen(runContext, config, uid, filename)
 	}
 	return cmd
 }
 
 func previewCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
-		Use:   "preview <jsonnet-file>",
+		Use:   "preview <jsonnet-file>...",
 		Short: "upload a snapshot to preview the rendered file",
-		Args:  cli.ArgsAny(),
+		Args:  argsFiles(),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
-	cmd.Flags().IntP("expires", "e", 0, "when the preview should expire. Default 0 (never)")
+	parseOpts := parseFlags(cmd, config)
+	expires := cmd.Flags().StringP("expires", "e", "", "when the preview should expire, in seconds or as a duration, e.g. 24h. Defaults to never, or to GRAFANA_SNAPSHOT_EXPIRES")
+	lint := cmd.Flags().Bool("lint", false, "check dashboards for common mistakes before previewing")
+	report := cmd.Flags().String("report", "", "file to write a report of preview links to, or - for stdout")
+	reportFormat := cmd.Flags().String("report-format", "json", "format of the report, json or yaml")
+	imageDir := cmd.Flags().String("image-dir", "", "directory to save images of the previews of changed dashboards to, rendered by the Grafana image renderer")
+	imageWidth := cmd.Flags().Int("image-width", 1000, "width of rendered images, in pixels")
+	imageHeight := cmd.Flags().Int("image-height", -1, "height of rendered images, in pixels, -1 for the whole dashboard")
+	open := cmd.Flags().Bool("open", false, "open the previews in the default browser")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		jsonnetFile := args[0]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		resources, err := grizzly.ParseFiles(config, args, parseOpts)
 		if err != nil {
 			return err
 		}
-		e, err := cmd.Flags().GetInt("expires")
+		if !cmd.Flags().Changed("expires") {
+			// the context, if any, is only in the environment by now
+			*expires = os.Getenv("GRAFANA_SNAPSHOT_EXPIRES")
+		}
+		e, err := parseExpires(*expires)
 		if err != nil {
 			return err
 		}
 		opts := &grizzly.PreviewOpts{
 			ExpiresSeconds: e,
+			Lint:           *lint,
+			Report:         *report,
+			ReportFormat:   *reportFormat,
+			ImageDir:       *imageDir,
+			ImageWidth:     *imageWidth,
+			ImageHeight:    *imageHeight,
+			Open:           *open,
 		}
 
-		return grizzly.Preview(config, resources, opts)
+		return grizzly.Preview(runContext, config, resources, opts)
 	}
 	return cmd
 }
 
+// parseExpires parses the expiry of previews, in seconds or as a duration
+func parseExpires(expires string) (int, error) {
+	if expires == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(expires); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(expires)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid expiry %q, expected seconds or a duration, e.g. 24h", expires)
+	}
+	return int(d.Seconds()), nil
+}
+
 func exportCmd(config grizzly.Config) *cli.Command {
 	cmd := &cli.Command{
 		Use:   "export <jsonnet-file> <dashboard-dir>",
 		Short: "render Jsonnet and save to a directory",
 		Args:  cli.ArgsExact(2),
 	}
-	targets := cmd.Flags().StringSliceP("target", "t", nil, "resources to target")
+	parseOpts := parseFlags(cmd, config)
+	filenameTemplate := cmd.Flags().String("template", grizzly.DefaultExportTemplate, "Go template for the path of each resource, given its .Kind, .Folder, .FolderTitle, .UID, .Filename and .Extension")
+	format := cmd.Flags().String("format", "files", "format to export resources in: files, provisioning for Grafana's file provisioning, or configmap for the sidecar of Grafana in Kubernetes")
+	provisioningDir := cmd.Flags().String("provisioning-dir", grizzly.DefaultProvisioningDir, "path of the provisioning directory on the Grafana server, for the provisioning format")
+	namespace := cmd.Flags().String("namespace", "", "namespace of the ConfigMaps, for the configmap format")
+	folderAnnotation := cmd.Flags().String("folder-annotation", grizzly.DefaultFolderAnnotation, "annotation the sidecar reads the folder of ConfigMaps from, for the configmap format")
 	cmd.Run = func(cmd *cli.Command, args []string) error {
 		jsonnetFile := args[0]
 		dashboardDir := args[1]
-		resources, err := grizzly.Parse(config, jsonnetFile, *targets)
+		resources, err := grizzly.Parse(config, jsonnetFile, parseOpts)
 		if err != nil {
 			return err
 		}
-		return grizzly.Export(config, dashboardDir, resources)
+		opts := &grizzly.ExportOpts{
+			FilenameTemplate: *filenameTemplate,
+			Format:           *format,
+			ProvisioningDir:  *provisioningDir,
+			Namespace:        *namespace,
+			FolderAnnotation: *folderAnnotation,
+		}
+		return grizzly.Export(config, dashboardDir, resources, opts)
+	}
+	return cmd
+}
+
+func terraformCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "terraform <jsonnet-file> <terraform-dir>",
+		Short: "render Jsonnet as Terraform configuration for the Grafana provider",
+		Args:  cli.ArgsExact(2),
+	}
+	parseOpts := parseFlags(cmd, config)
+	imports := cmd.Flags().Bool("import", false, "add import blocks, adopting resources already in Grafana rather than creating them")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		resources, err := grizzly.Parse(config, args[0], parseOpts)
+		if err != nil {
+			return err
+		}
+		return grizzly.ExportTerraform(config, args[1], resources, *imports)
+	}
+	return cmd
+}
+
+func importCmd(config grizzly.Config) *cli.Command {
+	cmd := &cli.Command{
+		Use:   "import <resource-type> <resource-uid>",
+		Short: "retrieve resource from endpoint and write Jsonnet for it",
+		Args:  cli.ArgsExact(2),
+	}
+	dir := cmd.Flags().StringP("output", "o", "", "directory to write to. Defaults to the current directory")
+	embed := cmd.Flags().Bool("embed", false, "write the resource as JSON, imported by the Jsonnet, rather than converting it")
+	grafonnet := cmd.Flags().Bool("grafonnet", false, "convert the resource to grafonnet, for dashboards")
+	cmd.Run = func(cmd *cli.Command, args []string) error {
+		opts := &grizzly.ImportOpts{
+			Dir:       *dir,
+			Embed:     *embed,
+			Grafonnet: *grafonnet,
+		}
+		return grizzly.Import(runContext, config, args[0], args[1], opts)
 	}
 	return cmd
 }
@@ -195,14 +729,20 @@ func providersCmd(config grizzly.Config) *cli.Command {
 		Args:  cli.ArgsExact(0),
 	}
 	cmd.Run = func(cmd *cli.Command, args []string) error {
-		f := "%s\t%s\t%s\n"
+		f := "%s\t%s\t%s\t%s\n"
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
 
-		fmt.Fprintf(w, f, "PROVIDER", "HANDLER", "JSON PATH")
+		fmt.Fprintf(w, f, "PROVIDER", "HANDLER", "JSON PATH", "STATUS")
 		for _, provider := range config.Registry.Providers {
 			for _, handler := range provider.GetHandlers() {
+				status := "enabled"
+				if !config.Registry.Enabled(handler) {
+					status = "disabled"
+				} else if c, ok := handler.(grizzly.ConfiguredHandler); ok && c.Configured() != nil {
+					status = "unconfigured"
+				}
 				for _, path := range handler.GetJSONPaths() {
-					fmt.Fprintf(w, f, provider.GetName(), handler.GetName(), "/"+path)
+					fmt.Fprintf(w, f, provider.GetName(), handler.GetName(), "/"+path, status)
 				}
 			}
 		}
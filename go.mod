@@ -4,21 +4,25 @@ go 1.13
 
 require (
 	github.com/centrifugal/centrifuge-go v0.6.2
-	github.com/cortexproject/cortex v1.2.0
+	github.com/cortexproject/cortex v1.2.1-0.20200803161316-7014ff11ed70
 	github.com/fatih/color v1.9.0
 	github.com/gdamore/tcell v1.3.0
 	github.com/go-clix/cli v0.1.0
+	github.com/go-kit/kit v0.10.0
 	github.com/google/go-jsonnet v0.15.1-0.20200331184325-4f4aa80dd785
+	github.com/grafana/loki v1.6.1
 	github.com/kr/pretty v0.2.0
-	github.com/kylelemons/godebug v1.1.0
 	github.com/malcolmholmes/grizzly v0.0.1
 	github.com/mitchellh/mapstructure v1.3.3
-	github.com/prometheus/prometheus v1.8.2-0.20200622142935-153f859b7499
+	github.com/pmezard/go-difflib v1.0.0
+	github.com/prometheus/alertmanager v0.21.0
+	github.com/prometheus/common v0.10.0
+	github.com/prometheus/prometheus v1.8.2-0.20200727090838-6f296594a852
 	github.com/rivo/tview v0.0.0-20200818120338-53d50e499bf9
-	golang.org/x/crypto v0.0.0-20200422194213-44a606286825
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	gopkg.in/fsnotify.v1 v1.4.7
 	gopkg.in/yaml.v2 v2.3.0
-	gopkg.in/yaml.v3 v3.0.0-20200603094226-e3079894b1e8
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
 
 replace k8s.io/client-go => k8s.io/client-go v0.18.3
@@ -0,0 +1,253 @@
+package execplugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// Operations plugins are requested to run
+const (
+	operationGet    = "get"
+	operationApply  = "apply"
+	operationDiff   = "diff"
+	operationDelete = "delete"
+)
+
+// Request is written to the stdin of a plugin
+type Request struct {
+	Operation string `json:"operation"`
+	Kind      string `json:"kind"`
+	UID       string `json:"uid"`
+	// Resource is the resource to apply or normalise
+	Resource interface{} `json:"resource,omitempty"`
+	// Existing is the remote resource an apply overwrites, if any
+	Existing interface{} `json:"existing,omitempty"`
+}
+
+// Response is read from the stdout of a plugin
+type Response struct {
+	// Resource is the resource got, or normalised
+	Resource interface{} `json:"resource,omitempty"`
+	// NotFound reports that the resource to get does not exist
+	NotFound bool `json:"notFound,omitempty"`
+	// Unsupported reports that the plugin does not implement the operation
+	Unsupported bool   `json:"unsupported,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Handler is a Grizzly Handler running a plugin executable
+type Handler struct {
+	kind string
+	path string
+
+	mu sync.Mutex
+	// unsupported are the optional operations the plugin does not implement
+	unsupported map[string]bool
+}
+
+// NewHandler returns a handler of a kind, running the plugin at path
+func NewHandler(kind, path string) *Handler {
+	return &Handler{
+		kind:        kind,
+		path:        path,
+		unsupported: map[string]bool{},
+	}
+}
+
+// GetName returns the kind the plugin handles
+func (h *Handler) GetName() string {
+	return h.kind
+}
+
+// GetFullName returns the name of the plugin handler
+func (h *Handler) GetFullName() string {
+	return "plugin." + h.kind
+}
+
+// GetJSONPaths returns paths within Jsonnet output that this plugin will consume
+func (h *Handler) GetJSONPaths() []string {
+	return []string{h.kind}
+}
+
+// GetExtension returns the file name extension of the resources
+func (h *Handler) GetExtension() string {
+	return "json"
+}
+
+func (h *Handler) newResource(uid string, detail interface{}) grizzly.Resource {
+	return grizzly.Resource{
+		UID:      uid,
+		Filename: uid,
+		Handler:  h,
+		Detail:   detail,
+		JSONPath: h.kind,
+	}
+}
+
+// Parse parses resources by name
+func (h *Handler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	msi, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must hold %s resources by name", path, h.kind)
+	}
+	resources := grizzly.ResourceList{}
+	for name, detail := range msi {
+		resource := h.newResource(name, detail)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare normalises a resource for comparison, if the plugin supports it
+func (h *Handler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	response, err := h.run(context.Background(), Request{
+		Operation: operationDiff,
+		UID:       resource.UID,
+		Resource:  resource.Detail,
+	})
+	if err == nil && !response.Unsupported && response.Resource != nil {
+		resource.Detail = response.Resource
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *Handler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves a resource from the plugin, by UID
+func (h *Handler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	return h.GetRemote(ctx, UID)
+}
+
+// GetRepresentation renders a resource as JSON
+func (h *Handler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves a resource from the plugin as JSON
+func (h *Handler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves a resource from the plugin
+func (h *Handler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	response, err := h.run(ctx, Request{Operation: operationGet, UID: uid})
+	if err != nil {
+		return nil, err
+	}
+	if response.NotFound {
+		return nil, grizzly.ErrNotFound
+	}
+	if response.Unsupported || response.Resource == nil {
+		return nil, fmt.Errorf("Plugin %s returned no %s for %s", h.path, h.kind, uid)
+	}
+	resource := h.newResource(uid, response.Resource)
+	return &resource, nil
+}
+
+// Add pushes a new resource with the plugin
+func (h *Handler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return h.apply(ctx, resource, nil)
+}
+
+// Update pushes a resource over an existing one with the plugin
+func (h *Handler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return h.apply(ctx, resource, existing.Detail)
+}
+
+func (h *Handler) apply(ctx context.Context, resource grizzly.Resource, existing interface{}) error {
+	response, err := h.run(ctx, Request{
+		Operation: operationApply,
+		UID:       resource.UID,
+		Resource:  resource.Detail,
+		Existing:  existing,
+	})
+	if err != nil {
+		return err
+	}
+	if response.Unsupported {
+		return fmt.Errorf("Plugin %s does not support applying", h.path)
+	}
+	return nil
+}
+
+// Delete removes a resource with the plugin, if it supports it
+func (h *Handler) Delete(ctx context.Context, UID string) error {
+	response, err := h.run(ctx, Request{Operation: operationDelete, UID: UID})
+	if err != nil {
+		return err
+	}
+	if response.Unsupported {
+		return fmt.Errorf("Plugin %s does not support deleting", h.path)
+	}
+	return nil
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *Handler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
+
+// run runs an operation with the plugin. Optional operations found
+// unsupported are not requested again.
+func (h *Handler) run(ctx context.Context, request Request) (*Response, error) {
+	optional := request.Operation == operationDiff || request.Operation == operationDelete
+	h.mu.Lock()
+	unsupported := h.unsupported[request.Operation]
+	h.mu.Unlock()
+	if unsupported {
+		return &Response{Unsupported: true}, nil
+	}
+
+	request.Kind = h.kind
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, h.path)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("Error running plugin %s: %v", h.path, err)
+		}
+		return nil, fmt.Errorf("Plugin %s failed to %s %s/%s: %s", h.path, request.Operation, h.kind, request.UID, strings.TrimSpace(stderr.String()))
+	}
+
+	response := &Response{}
+	if strings.TrimSpace(stdout.String()) != "" {
+		if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+			return nil, fmt.Errorf("Invalid response from plugin %s to %s: %v", h.path, request.Operation, err)
+		}
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("Plugin %s failed to %s %s/%s: %s", h.path, request.Operation, h.kind, request.UID, response.Error)
+	}
+	if response.Unsupported && optional {
+		h.mu.Lock()
+		h.unsupported[request.Operation] = true
+		h.mu.Unlock()
+	}
+	return response, nil
+}
@@ -0,0 +1,78 @@
+package execplugin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestGetRemote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("plugins are shell scripts")
+	}
+	tests := []struct {
+		Name   string
+		Script string
+		Color  string
+		Err    string
+	}{
+		{
+			Name:   "found",
+			Script: `echo '{"resource": {"color": "red"}}'`,
+			Color:  "red",
+		},
+		{
+			Name:   "not found",
+			Script: `echo '{"notFound": true}'`,
+			Err:    grizzly.ErrNotFound.Error(),
+		},
+		{
+			Name:   "error",
+			Script: `echo '{"error": "unauthorized"}'`,
+			Err:    "Plugin %s failed to get widget/a: unauthorized",
+		},
+		{
+			Name:   "failure",
+			Script: `echo boom >&2; exit 1`,
+			Err:    "Plugin %s failed to get widget/a: boom",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "grizzly-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, executablePrefix+"widget")
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\ncat > /dev/null\n"+test.Script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		resource, err := NewHandler("widget", path).GetRemote(context.Background(), "a")
+		if test.Err != "" {
+			expected := test.Err
+			if strings.Contains(expected, "%s") {
+				expected = fmt.Sprintf(expected, path)
+			}
+			if err == nil || err.Error() != expected {
+				t.Errorf("Expected error %q, got %v", expected, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		color := resource.Detail.(map[string]interface{})["color"]
+		if color != test.Color {
+			t.Errorf("Expected color %q, got %v", test.Color, color)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package execplugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Plugins add handlers for systems grizzly knows nothing about, e.g. internal
+ * ones, without forking it. A plugin is an executable on the PATH named
+ * grizzly-handler-<kind>, handling the resources of that kind, found at the
+ * <kind> path of the Jsonnet, by name.
+ *
+ * For each operation, the plugin is run with a JSON request on its stdin, and
+ * writes a JSON response to its stdout, see Request and Response. The
+ * operations are:
+ *
+ *   - get: returns the remote resource with the given UID, or notFound
+ *   - apply: pushes a resource, given the existing one if any
+ *   - diff: normalises a resource, local or remote, for comparison, e.g.
+ *     dropping fields generated by the system
+ *   - delete: removes the remote resource with the given UID
+ *
+ * Plugins must implement get and apply, and may answer other operations as
+ * unsupported. Errors are reported with the error field, or by exiting with a
+ * non-zero status, and a message on stderr. Plugins inherit the environment,
+ * from which they read their own configuration and credentials.
+ */
+
+// executablePrefix prefixes the names of plugins
+const executablePrefix = "grizzly-handler-"
+
+// Provider holds the handlers of the plugins found
+type Provider struct {
+	handlers []grizzly.Handler
+}
+
+// GetName returns the name of the plugins provider
+func (p *Provider) GetName() string {
+	return "plugins"
+}
+
+// GetHandlers returns a handler per plugin
+func (p *Provider) GetHandlers() []grizzly.Handler {
+	return p.handlers
+}
+
+// Discover finds the plugins on the PATH. A plugin named after a handler of
+// the registry is rejected, rather than shadowing it.
+func Discover(registry grizzly.Registry) (*Provider, error) {
+	provider := &Provider{}
+	found := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			// missing directories are common on the PATH
+			continue
+		}
+		for _, file := range files {
+			kind, ok := pluginKind(file)
+			if !ok || found[kind] {
+				// the first on the PATH wins, as when running it
+				continue
+			}
+			if _, exists := registry.HandlerByName[kind]; exists {
+				return nil, fmt.Errorf("Plugin %s conflicts with the built-in %s handler", filepath.Join(dir, file.Name()), kind)
+			}
+			found[kind] = true
+			provider.handlers = append(provider.handlers, NewHandler(kind, filepath.Join(dir, file.Name())))
+		}
+	}
+	sort.Slice(provider.handlers, func(i, j int) bool {
+		return provider.handlers[i].GetName() < provider.handlers[j].GetName()
+	})
+	return provider, nil
+}
+
+// pluginKind returns the kind a file on the PATH handles, if it is a plugin
+func pluginKind(file os.FileInfo) (string, bool) {
+	name := file.Name()
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	} else if file.Mode()&0111 == 0 {
+		return "", false
+	}
+	if !file.Mode().IsRegular() && file.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	kind := strings.TrimPrefix(name, executablePrefix)
+	if kind == name || kind == "" {
+		return "", false
+	}
+	return kind, true
+}
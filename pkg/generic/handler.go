@@ -0,0 +1,250 @@
+package generic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// Handler is a Grizzly Handler for resources behind a JSON API
+type Handler struct {
+	config grizzly.GenericHandlerConfig
+	uid    []string
+	get    *template.Template
+	put    *template.Template
+	delete *template.Template
+}
+
+// NewHandler returns a handler of resources as configured
+func NewHandler(config grizzly.GenericHandlerConfig) (*Handler, error) {
+	if config.Kind == "" {
+		return nil, fmt.Errorf("A kind is required")
+	}
+	if config.Get == "" || config.Put == "" {
+		return nil, fmt.Errorf("Handler %s requires get and put endpoints", config.Kind)
+	}
+	if config.Path == "" {
+		config.Path = config.Kind
+	}
+	h := &Handler{
+		config: config,
+		uid:    fieldPath(config.UID),
+	}
+	var err error
+	if h.get, err = parseEndpoint("get", config.Get); err != nil {
+		return nil, err
+	}
+	if h.put, err = parseEndpoint("put", config.Put); err != nil {
+		return nil, err
+	}
+	if h.delete, err = parseEndpoint("delete", config.Delete); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// GetName returns the kind of the resources handled
+func (h *Handler) GetName() string {
+	return h.config.Kind
+}
+
+// GetFullName returns the name of the handler
+func (h *Handler) GetFullName() string {
+	return "generic." + h.config.Kind
+}
+
+// GetJSONPaths returns paths within Jsonnet output that this handler will consume
+func (h *Handler) GetJSONPaths() []string {
+	return []string{h.config.Path}
+}
+
+// GetExtension returns the file name extension of the resources
+func (h *Handler) GetExtension() string {
+	return "json"
+}
+
+func (h *Handler) newResource(uid string, detail interface{}) grizzly.Resource {
+	return grizzly.Resource{
+		UID:      uid,
+		Filename: uid,
+		Handler:  h,
+		Detail:   detail,
+		JSONPath: h.config.Path,
+	}
+}
+
+// Parse parses resources by name, identified by their UID field if
+// configured
+func (h *Handler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	msi, ok := i.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must hold %s resources by name", path, h.config.Kind)
+	}
+	resources := grizzly.ResourceList{}
+	for name, detail := range msi {
+		uid := name
+		if h.uid != nil {
+			v, ok := lookupField(detail, h.uid)
+			if !ok || fmt.Sprint(v) == "" {
+				return nil, fmt.Errorf("%s %s has no %s", h.config.Kind, name, h.config.UID)
+			}
+			uid = fmt.Sprint(v)
+		}
+		resource := h.newResource(uid, detail)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes the fields set by the API from a resource
+func (h *Handler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	for _, field := range h.config.IgnoreFields {
+		deleteField(resource.Detail, fieldPath(field))
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *Handler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves a resource from the API, by UID
+func (h *Handler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	return h.GetRemote(ctx, UID)
+}
+
+// GetRepresentation renders a resource as JSON
+func (h *Handler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves a resource from the API as JSON
+func (h *Handler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves a resource from the API
+func (h *Handler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	var detail interface{}
+	if err := h.request(ctx, http.MethodGet, h.get, uid, nil, &detail); err != nil {
+		return nil, err
+	}
+	resource := h.newResource(uid, detail)
+	return &resource, nil
+}
+
+// Add pushes a new resource to the API
+func (h *Handler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return h.request(ctx, http.MethodPut, h.put, resource.UID, resource.Detail, nil)
+}
+
+// Update pushes a resource over an existing one
+func (h *Handler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return h.request(ctx, http.MethodPut, h.put, resource.UID, resource.Detail, nil)
+}
+
+// Delete removes a resource from the API, if a delete endpoint is configured
+func (h *Handler) Delete(ctx context.Context, UID string) error {
+	if h.delete == nil {
+		return fmt.Errorf("Handler %s has no delete endpoint", h.config.Kind)
+	}
+	return h.request(ctx, http.MethodDelete, h.delete, UID, nil, nil)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *Handler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
+
+// endpoint renders the URL of a resource
+func (h *Handler) endpoint(t *template.Template, uid string) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, struct{ UID string }{url.PathEscape(uid)}); err != nil {
+		return "", err
+	}
+	endpoint, err := grizzly.Interpolate(buf.String())
+	if err != nil {
+		return "", fmt.Errorf("Error expanding the %s endpoint of %s: %v", t.Name(), h.config.Kind, err)
+	}
+	return endpoint, nil
+}
+
+// request sends a request about a resource, decoding the response into out,
+// if given. ErrNotFound is returned on 404.
+func (h *Handler) request(ctx context.Context, method string, t *template.Template, uid string, body, out interface{}) error {
+	endpoint, err := h.endpoint(t, uid)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for name, value := range h.config.Headers {
+		value, err := grizzly.Interpolate(value)
+		if err != nil {
+			return fmt.Errorf("Error expanding header %s of %s: %v", name, h.config.Kind, err)
+		}
+		req.Header.Set(name, value)
+	}
+	client := grizzly.HTTPClient()
+	if h.config.EnvPrefix != "" {
+		if err := grizzly.SetAuthFromEnv(req, h.config.EnvPrefix, ""); err != nil {
+			return err
+		}
+		client = grizzly.HTTPClientFromEnv(h.config.EnvPrefix)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("%s %s/%s: %s: %s", method, h.config.Kind, uid, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("Error decoding %s/%s: %v", h.config.Kind, uid, err)
+	}
+	return nil
+}
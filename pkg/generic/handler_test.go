@@ -0,0 +1,74 @@
+package generic
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Name      string
+		UID       string
+		Resources map[string]interface{}
+		Keys      []string
+		Err       string
+	}{
+		{
+			Name: "by name",
+			Resources: map[string]interface{}{
+				"api": map[string]interface{}{"status": "ok"},
+			},
+			Keys: []string{"component/api"},
+		},
+		{
+			Name: "by field",
+			UID:  "$.meta.name",
+			Resources: map[string]interface{}{
+				"api": map[string]interface{}{"meta": map[string]interface{}{"name": "api-x"}},
+			},
+			Keys: []string{"component/api-x"},
+		},
+		{
+			Name: "missing field",
+			UID:  "meta.name",
+			Resources: map[string]interface{}{
+				"api": map[string]interface{}{"status": "ok"},
+			},
+			Err: "component api has no meta.name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		h, err := NewHandler(grizzly.GenericHandlerConfig{
+			Kind: "component",
+			UID:  test.UID,
+			Get:  "http://localhost/{{.UID}}",
+			Put:  "http://localhost/{{.UID}}",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		resources, err := h.Parse("component", test.Resources)
+		if test.Err != "" {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("Expected error %q, got %v", test.Err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		keys := []string{}
+		for key := range resources {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if strings.Join(keys, ",") != strings.Join(test.Keys, ",") {
+			t.Errorf("Expected resources %v, got %v", test.Keys, keys)
+		}
+	}
+}
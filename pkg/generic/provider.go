@@ -0,0 +1,111 @@
+package generic
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Generic handlers manage resources behind simple JSON APIs without writing
+ * Go code, as configured in the handlers of the configuration file:
+ *
+ *   handlers:
+ *     - kind: component
+ *       path: statuspageComponents
+ *       uid: $.name
+ *       get: ${STATUSPAGE_URL}/components/{{.UID}}
+ *       put: ${STATUSPAGE_URL}/components/{{.UID}}
+ *       delete: ${STATUSPAGE_URL}/components/{{.UID}}
+ *       env-prefix: STATUSPAGE
+ *       ignore-fields: [id, updatedAt]
+ *
+ * Resources are fetched with GET, and pushed whole with PUT, whether they
+ * exist or not. A 404 means a resource does not exist yet.
+ */
+
+// Provider holds the generic handlers configured
+type Provider struct {
+	handlers []grizzly.Handler
+}
+
+// GetName returns the name of the generic provider
+func (p *Provider) GetName() string {
+	return "generic"
+}
+
+// GetHandlers returns a handler per configuration
+func (p *Provider) GetHandlers() []grizzly.Handler {
+	return p.handlers
+}
+
+// NewProvider returns the handlers configured. A handler of the kind of a
+// handler of the registry is rejected, rather than shadowing it.
+func NewProvider(registry grizzly.Registry, configs []grizzly.GenericHandlerConfig) (*Provider, error) {
+	provider := &Provider{}
+	kinds := map[string]bool{}
+	for i, config := range configs {
+		handler, err := NewHandler(config)
+		if err != nil {
+			return nil, fmt.Errorf("Error configuring handler %d: %v", i+1, err)
+		}
+		if _, exists := registry.HandlerByName[config.Kind]; exists || kinds[config.Kind] {
+			return nil, fmt.Errorf("Handler %s is configured twice, or conflicts with a built-in handler", config.Kind)
+		}
+		kinds[config.Kind] = true
+		provider.handlers = append(provider.handlers, handler)
+	}
+	return provider, nil
+}
+
+// parseEndpoint parses the template of an endpoint, if set
+func parseEndpoint(name, endpoint string) (*template.Template, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s endpoint: %v", name, err)
+	}
+	return t, nil
+}
+
+// fieldPath splits a field given as a path, e.g. $.metadata.name or
+// metadata.name
+func fieldPath(field string) []string {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+// lookupField returns the field of a resource at a path
+func lookupField(v interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// deleteField removes the field of a resource at a path, if any
+func deleteField(v interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	parent, ok := lookupField(v, path[:len(path)-1])
+	if !ok {
+		return
+	}
+	if m, ok := parent.(map[string]interface{}); ok {
+		delete(m, path[len(path)-1])
+	}
+}
@@ -0,0 +1,86 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// deployAnnotationTags are attached to every deployment annotation, so that
+// dashboards can show them via an annotation query filtered by tags
+var deployAnnotationTags = []string{"grizzly", "deploy"}
+
+// auditAnnotationTags are attached to every annotation of the audit log
+var auditAnnotationTags = []string{"grizzly", "audit"}
+
+// Annotation encapsulates an organisation-wide Grafana annotation
+type Annotation struct {
+	Time int64    `json:"time"`
+	Tags []string `json:"tags"`
+	Text string   `json:"text"`
+}
+
+func postAnnotation(ctx context.Context, endpoint *grizzly.Endpoint, annotation Annotation) error {
+	return requestJSON(ctx, endpoint, "POST", "api/annotations", annotation, nil)
+}
+
+// newDeployAnnotation describes a successful apply of the given resources
+func newDeployAnnotation(resources grizzly.Resources, commit string) Annotation {
+	count := 0
+	for _, resourceList := range resources {
+		count += len(resourceList)
+	}
+	text := fmt.Sprintf("Deployed by grizzly (%d resources)", count)
+	if commit != "" {
+		text = fmt.Sprintf("Deployed by grizzly, commit %s (%d resources)", commit, count)
+	}
+	tags := append([]string{}, deployAnnotationTags...)
+	if commit != "" {
+		tags = append(tags, "commit:"+commit)
+	}
+	return Annotation{
+		Time: time.Now().UnixNano() / int64(time.Millisecond),
+		Tags: tags,
+		Text: text,
+	}
+}
+
+// newAuditAnnotation describes an apply for the audit log: who applied which
+// changes, with their diffs
+func newAuditAnnotation(record grizzly.AuditRecord) Annotation {
+	var text strings.Builder
+	fmt.Fprintf(&text, "Applied by %s", record.User)
+	if record.Host != "" {
+		fmt.Fprintf(&text, " on %s", record.Host)
+	}
+	if record.Commit != "" {
+		fmt.Fprintf(&text, ", commit %s", record.Commit)
+	}
+	fmt.Fprintf(&text, " (%d changes)", len(record.Changes))
+	if record.Error != "" {
+		fmt.Fprintf(&text, ", failed: %s", record.Error)
+	}
+	for _, change := range record.Changes {
+		fmt.Fprintf(&text, "\n%s %s", change.Resource, change.Action)
+	}
+	for _, change := range record.Changes {
+		if change.Diff != "" {
+			fmt.Fprintf(&text, "\n\n%s", strings.TrimSuffix(change.Diff, "\n"))
+		}
+	}
+	tags := append([]string{}, auditAnnotationTags...)
+	if record.Commit != "" {
+		tags = append(tags, "commit:"+record.Commit)
+	}
+	if record.Error != "" {
+		tags = append(tags, "failed")
+	}
+	return Annotation{
+		Time: record.Time.UnixNano() / int64(time.Millisecond),
+		Tags: tags,
+		Text: text.String(),
+	}
+}
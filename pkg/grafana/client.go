@@ -0,0 +1,113 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// requestJSON sends a request to the Grafana API, encoding body (if any) as JSON
+// and decoding the response into out (if provided). A 404 is reported as
+// grizzly.ErrNotFound.
+func requestJSON(ctx context.Context, endpoint *grizzly.Endpoint, method, urlPath string, body, out interface{}) error {
+	grafanaURL, err := getGrafanaURL(endpoint, urlPath)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewBuffer(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, grafanaURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-type", "application/json")
+
+	resp, err := doGrafana(endpoint, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		var r struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(data, &r); err == nil && r.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, urlPath, resp.Status, r.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, urlPath, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return grizzly.APIErr{Err: err, Body: data}
+	}
+	return nil
+}
+
+// grafanaGet sends a GET request to Grafana, as http.Client.Get does
+func grafanaGet(ctx context.Context, endpoint *grizzly.Endpoint, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return doGrafana(endpoint, req)
+}
+
+// pushErr returns the error of a response to pushing a resource, if any.
+// Conflicts, 409 and 412 responses, wrap grizzly.ErrConflict, as the resource
+// changed remotely and may be pushed again, unless Grafana reports another
+// reason, e.g. a dashboard with the same title in the folder.
+func pushErr(resp *http.Response, uid string) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		var r struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return fmt.Errorf("Failed to decode actual error (%s): %s", resp.Status, err)
+		}
+		if r.Status != "" && r.Status != "version-mismatch" {
+			return fmt.Errorf("Error while applying '%s' to Grafana: %s", uid, r.Message)
+		}
+		return fmt.Errorf("Error while applying '%s' to Grafana: %s: %w", uid, r.Message, grizzly.ErrConflict)
+	}
+	return fmt.Errorf("Non-200 response from Grafana while applying '%s': %s", resp.Status, uid)
+}
+
+// grafanaPost sends a POST request to Grafana, as http.Client.Post does
+func grafanaPost(ctx context.Context, endpoint *grizzly.Endpoint, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return doGrafana(endpoint, req)
+}
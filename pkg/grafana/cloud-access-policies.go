@@ -0,0 +1,289 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Access policies are managed via the Grafana Cloud API rather than a Grafana
+ * instance, authenticated with a Cloud access policy token that has the
+ * accesspolicies:read/write scopes.
+ *
+ * Policies are matched by name within the region given by GRAFANA_CLOUD_REGION.
+ * Tokens are listed by name under the policy they belong to. Missing tokens are
+ * created, and their secret is written to a file in GRAFANA_CLOUD_TOKENS_DIR,
+ * as the API never returns it again. It is never printed, so that it ends up
+ * neither in CI logs nor in machine-readable output. Tokens are never deleted
+ * by grizzly.
+ */
+
+const cloudAPIURL = "https://grafana.com/api"
+
+// accessPolicyServerFields are generated by Grafana Cloud and never part of local resources
+var accessPolicyServerFields = []string{"id", "orgId", "createdAt", "updatedAt", "status"}
+
+// AccessPolicy encapsulates a Grafana Cloud access policy and the names of its tokens
+type AccessPolicy map[string]interface{}
+
+// UID retrieves the UID from an access policy
+func (p *AccessPolicy) UID() string {
+	name, ok := (*p)["name"]
+	if !ok {
+		return ""
+	}
+	return name.(string)
+}
+
+// tokenNames returns the names of the tokens belonging to a policy
+func (p *AccessPolicy) tokenNames() []string {
+	names := []string{}
+	switch tokens := (*p)["tokens"].(type) {
+	case []interface{}:
+		for _, token := range tokens {
+			names = append(names, fmt.Sprint(token))
+		}
+	case []string:
+		names = append(names, tokens...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks the name of the policy and of its tokens can name the files
+// their secrets are saved to
+func (p *AccessPolicy) validate() []error {
+	errs := []error{}
+	if strings.ContainsAny(p.UID(), `/\`) {
+		errs = append(errs, fmt.Errorf("name: must not contain / or \\"))
+	}
+	for _, name := range p.tokenNames() {
+		if strings.ContainsAny(name, `/\`) {
+			errs = append(errs, fmt.Errorf("tokens: %s must not contain / or \\", name))
+		}
+	}
+	return errs
+}
+
+// withoutTokens returns the policy as expected by the API
+func (p *AccessPolicy) withoutTokens() AccessPolicy {
+	policy := AccessPolicy{}
+	for k, v := range *p {
+		if k != "tokens" {
+			policy[k] = v
+		}
+	}
+	return policy
+}
+
+func getCloudURL(endpoint *grizzly.Endpoint, urlPath string, query url.Values) (string, error) {
+	region, exists := os.LookupEnv("GRAFANA_CLOUD_REGION")
+	if !exists {
+		return "", fmt.Errorf("Require GRAFANA_CLOUD_REGION and GRAFANA_CLOUD_TOKEN (optionally GRAFANA_CLOUD_API_URL)")
+	}
+	base, exists := os.LookupEnv("GRAFANA_CLOUD_API_URL")
+	if !exists {
+		base = cloudAPIURL
+	}
+	if endpoint != nil {
+		base = endpoint.URL
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("region", region)
+	return fmt.Sprintf("%s/%s?%s", strings.TrimSuffix(base, "/"), urlPath, query.Encode()), nil
+}
+
+func requestCloud(ctx context.Context, endpoint *grizzly.Endpoint, method, urlPath string, query url.Values, body, out interface{}) error {
+	cloudURL, err := getCloudURL(endpoint, urlPath, query)
+	if err != nil {
+		return err
+	}
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewBuffer(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+os.Getenv("GRAFANA_CLOUD_TOKEN"))
+	req.Header.Add("Content-type", "application/json")
+
+	resp, err := endpoint.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("Non-200 response from Grafana Cloud: %s: %s", resp.Status, string(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return grizzly.APIErr{Err: err, Body: data}
+	}
+	return nil
+}
+
+type cloudToken struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+func getAccessPolicyTokens(ctx context.Context, endpoint *grizzly.Endpoint, policyID string) ([]cloudToken, error) {
+	var tokens struct {
+		Items []cloudToken `json:"items"`
+	}
+	query := url.Values{"accessPolicyId": {policyID}}
+	if err := requestCloud(ctx, endpoint, "GET", "v1/tokens", query, nil, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens.Items, nil
+}
+
+// getRemoteAccessPolicy retrieves an access policy, along with the names of its tokens
+func getRemoteAccessPolicy(ctx context.Context, endpoint *grizzly.Endpoint, name string) (*AccessPolicy, error) {
+	var policies struct {
+		Items []AccessPolicy `json:"items"`
+	}
+	query := url.Values{"name": {name}}
+	if err := requestCloud(ctx, endpoint, "GET", "v1/accesspolicies", query, nil, &policies); err != nil {
+		return nil, err
+	}
+	for _, policy := range policies.Items {
+		if policy.UID() != name {
+			continue
+		}
+		tokens, err := getAccessPolicyTokens(ctx, endpoint, fmt.Sprint(policy["id"]))
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, token := range tokens {
+			names = append(names, token.Name)
+		}
+		sort.Strings(names)
+		policy["tokens"] = names
+		return &policy, nil
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+func postAccessPolicy(ctx context.Context, endpoint *grizzly.Endpoint, policy AccessPolicy) error {
+	var created AccessPolicy
+	if err := requestCloud(ctx, endpoint, "POST", "v1/accesspolicies", nil, policy.withoutTokens(), &created); err != nil {
+		return fmt.Errorf("Error while applying access policy '%s': %v", policy.UID(), err)
+	}
+	return createAccessPolicyTokens(ctx, endpoint, fmt.Sprint(created["id"]), policy, nil)
+}
+
+func updateAccessPolicy(ctx context.Context, endpoint *grizzly.Endpoint, existing, policy AccessPolicy) error {
+	id, ok := policy["id"].(string)
+	if !ok {
+		return fmt.Errorf("Access policy %s requires an ID to update", policy.UID())
+	}
+	body := policy.withoutTokens()
+	delete(body, "id")
+	if err := requestCloud(ctx, endpoint, "POST", "v1/accesspolicies/"+id, nil, body, nil); err != nil {
+		return fmt.Errorf("Error while applying access policy '%s': %v", policy.UID(), err)
+	}
+	return createAccessPolicyTokens(ctx, endpoint, id, policy, existing.tokenNames())
+}
+
+// deleteAccessPolicy removes an access policy by name. Grafana Cloud removes
+// its tokens along with it.
+func deleteAccessPolicy(ctx context.Context, endpoint *grizzly.Endpoint, name string) error {
+	policy, err := getRemoteAccessPolicy(ctx, endpoint, name)
+	if err != nil {
+		return err
+	}
+	id := fmt.Sprint((*policy)["id"])
+	if err := requestCloud(ctx, endpoint, "DELETE", "v1/accesspolicies/"+id, nil, nil, nil); err != nil {
+		return fmt.Errorf("Error while deleting access policy '%s': %v", name, err)
+	}
+	return nil
+}
+
+// createAccessPolicyTokens creates the tokens of a policy that do not exist
+// yet. The file each secret is saved to is created first, so that no token is
+// created whose secret could not be saved.
+func createAccessPolicyTokens(ctx context.Context, endpoint *grizzly.Endpoint, policyID string, policy AccessPolicy, existing []string) error {
+	exists := map[string]bool{}
+	for _, name := range existing {
+		exists[name] = true
+	}
+	for _, name := range policy.tokenNames() {
+		if exists[name] {
+			continue
+		}
+		file, err := createTokenFile(policy, name)
+		if err != nil {
+			return err
+		}
+		body := map[string]string{
+			"accessPolicyId": policyID,
+			"name":           name,
+		}
+		var token cloudToken
+		if err := requestCloud(ctx, endpoint, "POST", "v1/tokens", nil, body, &token); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return fmt.Errorf("Error creating token %s for access policy %s: %v", name, policy.UID(), err)
+		}
+		_, err = file.WriteString(token.Token)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("Token %s for access policy %s was created, but could not be saved: %v", name, policy.UID(), err)
+		}
+	}
+	return nil
+}
+
+// createTokenFile creates the file in GRAFANA_CLOUD_TOKENS_DIR the secret of
+// a token is saved to, readable only by its owner. Existing files are never
+// overwritten.
+func createTokenFile(policy AccessPolicy, name string) (*os.File, error) {
+	dir, ok := os.LookupEnv("GRAFANA_CLOUD_TOKENS_DIR")
+	if !ok || dir == "" {
+		return nil, fmt.Errorf("Token %s for access policy %s would be lost: set GRAFANA_CLOUD_TOKENS_DIR to the directory created tokens are saved to", name, policy.UID())
+	}
+	if errs := policy.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("Token %s for access policy %s cannot be saved: %v", name, policy.UID(), errs[0])
+	}
+	path := filepath.Join(dir, policy.UID()+"-"+name+".token")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Token %s for access policy %s cannot be saved, so was not created: %v", name, policy.UID(), err)
+	}
+	return file, nil
+}
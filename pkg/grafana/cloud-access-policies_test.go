@@ -0,0 +1,98 @@
+package grafana
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestCreateAccessPolicyTokens(t *testing.T) {
+	tests := map[string]struct {
+		policy   AccessPolicy
+		noDir    bool
+		existing string
+		saved    string
+		err      string
+		created  int
+	}{
+		"saved": {
+			policy:  AccessPolicy{"name": "ci", "tokens": []string{"deploy"}},
+			saved:   "ci-deploy.token",
+			created: 1,
+		},
+		"no directory": {
+			policy: AccessPolicy{"name": "ci", "tokens": []string{"deploy"}},
+			noDir:  true,
+			err:    "Token deploy for access policy ci would be lost",
+		},
+		"file exists": {
+			policy:   AccessPolicy{"name": "ci", "tokens": []string{"deploy"}},
+			existing: "ci-deploy.token",
+			err:      "Token deploy for access policy ci cannot be saved, so was not created",
+		},
+		"policy name escaping the directory": {
+			policy: AccessPolicy{"name": "../ci", "tokens": []string{"deploy"}},
+			err:    "Token deploy for access policy ../ci cannot be saved: name: must not contain / or \\",
+		},
+		"token name escaping the directory": {
+			policy: AccessPolicy{"name": "ci", "tokens": []string{`..\deploy`}},
+			err:    `Token ..\deploy for access policy ci cannot be saved: tokens: ..\deploy must not contain / or \`,
+		},
+	}
+	os.Setenv("GRAFANA_CLOUD_REGION", "us")
+	defer os.Unsetenv("GRAFANA_CLOUD_REGION")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKENS_DIR")
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		created := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			created++
+			w.Write([]byte(`{"id": "1", "name": "deploy", "token": "glc_secret"}`))
+		}))
+		dir, err := ioutil.TempDir("", "grizzly")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.noDir {
+			os.Unsetenv("GRAFANA_CLOUD_TOKENS_DIR")
+		} else {
+			os.Setenv("GRAFANA_CLOUD_TOKENS_DIR", dir)
+		}
+		if test.existing != "" {
+			if err := ioutil.WriteFile(filepath.Join(dir, test.existing), []byte("glc_earlier"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		endpoint := &grizzly.Endpoint{URL: server.URL, Client: server.Client()}
+		err = createAccessPolicyTokens(context.Background(), endpoint, "1", test.policy, nil)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error creating tokens: %v", err)
+		}
+		if created != test.created {
+			t.Errorf("Expected %d token(s) created, got: %d", test.created, created)
+		}
+		if test.saved != "" {
+			path := filepath.Join(dir, test.saved)
+			if token, err := ioutil.ReadFile(path); err != nil || string(token) != "glc_secret" {
+				t.Errorf("Expected the secret to be saved, got: %q, %v", token, err)
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().Perm() != 0600 {
+				t.Errorf("Expected the secret to be readable by its owner only, got: %v", info.Mode())
+			}
+		}
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,161 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// AccessPolicyHandler is a Grizzly Provider for Grafana Cloud access policies
+type AccessPolicyHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewAccessPolicyHandler returns configuration defining a new Grafana Provider
+func NewAccessPolicyHandler(endpoint *grizzly.Endpoint) *AccessPolicyHandler {
+	return &AccessPolicyHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *AccessPolicyHandler) GetName() string {
+	return "cloud-access-policy"
+}
+
+// GetFullName returns the name for this provider
+func (h *AccessPolicyHandler) GetFullName() string {
+	return "grafana.cloud-access-policy"
+}
+
+const accessPoliciesPath = "grafanaCloudAccessPolicies"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *AccessPolicyHandler) GetJSONPaths() []string {
+	return []string{
+		accessPoliciesPath,
+	}
+}
+
+// GetExtension returns the file name extension for an access policy
+func (h *AccessPolicyHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana Cloud is not configured, if it is not
+func (h *AccessPolicyHandler) Configured() error {
+	_, err := getCloudURL(h.endpoint, "", nil)
+	return err
+}
+
+func (h *AccessPolicyHandler) newAccessPolicyResource(path, filename string, policy AccessPolicy) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      policy.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   policy,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *AccessPolicyHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		policy := AccessPolicy{}
+		err := mapstructure.Decode(v, &policy)
+		if err != nil {
+			return nil, err
+		}
+		policy["tokens"] = policy.tokenNames()
+		resource := h.newAccessPolicyResource(path, k, policy)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Validate checks an access policy, and its tokens, can be applied
+func (h *AccessPolicyHandler) Validate(resource grizzly.Resource) []error {
+	policy, ok := resource.Detail.(AccessPolicy)
+	if !ok {
+		return nil
+	}
+	return policy.validate()
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *AccessPolicyHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	for _, field := range accessPolicyServerFields {
+		delete(resource.Detail.(AccessPolicy), field)
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *AccessPolicyHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	resource.Detail.(AccessPolicy)["id"] = existing.Detail.(AccessPolicy)["id"]
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *AccessPolicyHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	policy, err := getRemoteAccessPolicy(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving access policy %s: %v", UID, err)
+	}
+	resource := h.newAccessPolicyResource(accessPoliciesPath, "", *policy)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *AccessPolicyHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves an access policy as JSON
+func (h *AccessPolicyHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves an access policy as a Resource
+func (h *AccessPolicyHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	policy, err := getRemoteAccessPolicy(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newAccessPolicyResource(accessPoliciesPath, "", *policy)
+	return &resource, nil
+}
+
+// Add pushes a new access policy, and its tokens, to Grafana Cloud
+func (h *AccessPolicyHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postAccessPolicy(ctx, h.endpoint, resource.Detail.(AccessPolicy))
+}
+
+// Update pushes an access policy to Grafana Cloud, creating any missing tokens
+func (h *AccessPolicyHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return updateAccessPolicy(ctx, h.endpoint, existing.Detail.(AccessPolicy), resource.Detail.(AccessPolicy))
+}
+
+// Delete removes an access policy, along with its tokens, from Grafana Cloud
+func (h *AccessPolicyHandler) Delete(ctx context.Context, UID string) error {
+	return deleteAccessPolicy(ctx, h.endpoint, UID)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *AccessPolicyHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
@@ -1,33 +1,111 @@
 package grafana
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
 )
 
-func getGrafanaURL(urlPath string) (string, error) {
+// grafanaClient returns the client requests to Grafana are sent with, using
+// the TLS options set by GRAFANA_TLS_* environment variables, and
+// authenticating requests
+func grafanaClient() *http.Client {
+	client := *grizzly.HTTPClientFromEnv("GRAFANA")
+	client.Transport = grafanaAuthTransport{next: client.Transport}
+	return &client
+}
+
+// grafanaAuthTransport sets the Authorization header of requests to Grafana,
+// so that credentials are not part of URLs, which end up in logs and errors,
+// and the organization requests apply to
+type grafanaAuthTransport struct {
+	next http.RoundTripper
+}
+
+func (t grafanaAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	setGrafanaHeaders(req)
+	return t.next.RoundTrip(req)
+}
+
+// setGrafanaHeaders authenticates a request to Grafana, unless it already
+// is, and selects the organization it applies to
+func setGrafanaHeaders(req *http.Request) {
+	if auth := grafanaAuthorization(); auth != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+	// GRAFANA_ORG_ID selects the organization requests apply to
+	if orgID := os.Getenv("GRAFANA_ORG_ID"); orgID != "" {
+		req.Header.Set("X-Grafana-Org-Id", orgID)
+	}
+}
+
+// doGrafana sends a request to Grafana, with the endpoint injected if any,
+// or as configured by environment variables. Credentials set by environment
+// variables are sent either way, unless the headers of the endpoint set them.
+func doGrafana(endpoint *grizzly.Endpoint, req *http.Request) (*http.Response, error) {
+	if endpoint == nil {
+		return grafanaClient().Do(req)
+	}
+	setGrafanaHeaders(req)
+	return endpoint.Do(req)
+}
+
+// grafanaAuthorization returns the Authorization header authenticating with
+// Grafana. GRAFANA_TOKEN is sent as a bearer token, e.g. an API key or service
+// account token, or as the password of GRAFANA_USER if set. Credentials in
+// GRAFANA_URL are still supported, using basic auth.
+func grafanaAuthorization() string {
+	if token, exists := os.LookupEnv("GRAFANA_TOKEN"); exists {
+		if user := os.Getenv("GRAFANA_USER"); user != "" {
+			return basicAuth(user, token)
+		}
+		return "Bearer " + token
+	}
+	u, err := url.Parse(os.Getenv("GRAFANA_URL"))
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return basicAuth(u.User.Username(), password)
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func getGrafanaURL(endpoint *grizzly.Endpoint, urlPath string) (string, error) {
+	if endpoint != nil {
+		return endpoint.JoinURL(urlPath)
+	}
 	if grafanaURL, exists := os.LookupEnv("GRAFANA_URL"); exists {
 		u, err := url.Parse(grafanaURL)
 		if err != nil {
 			return "", err
 		}
-		u.Path = path.Join(u.Path, urlPath)
-		if token, exists := os.LookupEnv("GRAFANA_TOKEN"); exists {
-			user, exists := os.LookupEnv("GRAFANA_USER")
-			if !exists {
-				user = "api_key"
-			}
-			u.User = url.UserPassword(user, token)
+		rel, err := url.Parse(urlPath)
+		if err != nil {
+			return "", err
 		}
+		u.Path = path.Join(u.Path, rel.Path)
+		u.RawQuery = rel.RawQuery
+		// credentials are sent by grafanaClient
+		u.User = nil
 		return u.String(), nil
 	}
 	return "", fmt.Errorf("Require GRAFANA_URL (optionally GRAFANA_TOKEN & GRAFANA_USER")
 }
 
-func getWSGrafanaURL(urlPath string) (string, string, error) {
+func getWSGrafanaURL(endpoint *grizzly.Endpoint, urlPath string) (string, string, error) {
 	grafanaURL, exists := os.LookupEnv("GRAFANA_URL")
+	if endpoint != nil {
+		grafanaURL, exists = endpoint.URL, true
+	}
 	if !exists {
 		return "", "", fmt.Errorf("Require GRAFANA_URL (optionally GRAFANA_TOKEN if auth required) for websocket actions")
 	}
@@ -0,0 +1,298 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ * Dashboards can be imported as grafonnet (github.com/grafana/grafonnet-lib)
+ * rather than as a JSON blob. The dashboard, rows, common panel types,
+ * Prometheus targets and template variables are converted to calls to their
+ * grafonnet constructors. Fields that the constructors do not cover are merged
+ * onto the constructed object, so that nothing set in the dashboard is lost.
+ * Fields that are not set are left to grafonnet defaults, so the result is
+ * worth checking with `grr diff`.
+ */
+
+// grafonnetLocals lists the grafonnet locals that converted code may use, in
+// the order they are declared
+var grafonnetLocals = []string{"dashboard", "row", "graphPanel", "statPanel", "singlestat", "tablePanel", "text", "prometheus", "template"}
+
+// grafonnetPanels maps panel types to grafonnet constructors, and whether these
+// take a datasource
+var grafonnetPanels = map[string]struct {
+	local      string
+	datasource bool
+}{
+	"graph":      {"graphPanel", true},
+	"stat":       {"statPanel", true},
+	"singlestat": {"singlestat", true},
+	"table":      {"tablePanel", true},
+	"text":       {"text", false},
+}
+
+var (
+	grafonnetGraphTooltips = map[float64]string{0: "default", 1: "shared_crosshair", 2: "shared_tooltip"}
+	grafonnetHides         = map[float64]string{0: "", 1: "label", 2: "variable"}
+	grafonnetRefreshes     = map[float64]string{0: "never", 1: "load", 2: "time"}
+)
+
+// grafonnetArg is a named argument of a grafonnet call
+type grafonnetArg struct {
+	name  string
+	value string
+}
+
+// grafonnetWriter converts dashboard JSON to grafonnet, tracking the locals used
+type grafonnetWriter struct {
+	used map[string]bool
+}
+
+// dashboardToGrafonnet converts a dashboard to grafonnet, returning the locals
+// it needs and the expression rendering it
+func dashboardToGrafonnet(board Dashboard) (string, string) {
+	g := &grafonnetWriter{used: map[string]bool{}}
+	body := g.dashboard(board)
+	locals := []string{"local grafana = import 'grafonnet/grafana.libsonnet';"}
+	for _, local := range grafonnetLocals {
+		if g.used[local] {
+			locals = append(locals, fmt.Sprintf("local %s = grafana.%s;", local, local))
+		}
+	}
+	return strings.Join(locals, "\n"), body
+}
+
+func (g *grafonnetWriter) dashboard(board Dashboard) string {
+	rest := copyObject(board)
+	for _, field := range append(dashboardServerFields, folderNameField) {
+		delete(rest, field)
+	}
+	title := take(rest, "title")
+	args := g.args(rest, "uid", "description", "tags", "editable", "timezone", "refresh", "schemaVersion")
+	if v, ok := rest["graphTooltip"].(float64); ok && grafonnetGraphTooltips[v] != "" {
+		args = append(args, grafonnetArg{"graphTooltip", literal(grafonnetGraphTooltips[v])})
+		delete(rest, "graphTooltip")
+	}
+	if t, ok := rest["time"].(map[string]interface{}); ok && len(t) == 2 && t["from"] != nil && t["to"] != nil {
+		args = append(args, grafonnetArg{"time_from", literal(t["from"])}, grafonnetArg{"time_to", literal(t["to"])})
+		delete(rest, "time")
+	}
+	code := g.call("dashboard", []string{literal(title)}, args)
+
+	if templating, ok := rest["templating"].(map[string]interface{}); ok && len(templating) == 1 {
+		variables, _ := templating["list"].([]interface{})
+		templates := []string{}
+		for _, v := range variables {
+			templates = append(templates, g.variable(v))
+		}
+		if len(templates) > 0 {
+			code += fmt.Sprintf("\n.addTemplates([\n%s,\n])", strings.Join(templates, ",\n"))
+		}
+		delete(rest, "templating")
+	}
+	if annotations, ok := rest["annotations"].(map[string]interface{}); ok && len(annotations) == 1 {
+		list, _ := annotations["list"].([]interface{})
+		for _, a := range list {
+			code += fmt.Sprintf("\n.addAnnotation(%s)", literal(a))
+		}
+		delete(rest, "annotations")
+	}
+	if panels, ok := rest["panels"].([]interface{}); ok {
+		code += g.addPanels(panels)
+		delete(rest, "panels")
+	}
+	return g.merge(code, rest)
+}
+
+// addPanels renders the chained calls adding panels, with their grid positions
+func (g *grafonnetWriter) addPanels(panels []interface{}) string {
+	code := ""
+	for _, p := range panels {
+		panel, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panel = copyObject(panel)
+		gridPos, hasGridPos := panel["gridPos"]
+		delete(panel, "gridPos")
+		if hasGridPos {
+			code += fmt.Sprintf("\n.addPanel(\n%s,\ngridPos=%s,\n)", g.panel(panel), literal(gridPos))
+		} else {
+			code += fmt.Sprintf("\n.addPanel(\n%s,\n)", g.panel(panel))
+		}
+	}
+	return code
+}
+
+func (g *grafonnetWriter) panel(panel map[string]interface{}) string {
+	rest := copyObject(panel)
+	delete(rest, "id")
+	typ, _ := rest["type"].(string)
+	if typ == "row" {
+		delete(rest, "type")
+		title := take(rest, "title")
+		args := []grafonnetArg{{"title", literal(title)}}
+		if collapsed, ok := rest["collapsed"].(bool); ok {
+			args = append(args, grafonnetArg{"collapse", literal(collapsed)})
+			delete(rest, "collapsed")
+		}
+		code := g.call("row", nil, args)
+		if panels, ok := rest["panels"].([]interface{}); ok {
+			code += g.addPanels(panels)
+			delete(rest, "panels")
+		}
+		return g.merge(code, rest)
+	}
+	constructor, ok := grafonnetPanels[typ]
+	if !ok {
+		return literal(rest)
+	}
+	delete(rest, "type")
+	title := take(rest, "title")
+	args := g.args(rest, "description")
+	if _, isString := rest["datasource"].(string); isString && constructor.datasource {
+		args = append(args, g.args(rest, "datasource")...)
+	}
+	code := g.call(constructor.local, []string{literal(title)}, args)
+	if targets, ok := rest["targets"].([]interface{}); ok && len(targets) > 0 {
+		converted := []string{}
+		for i, t := range targets {
+			converted = append(converted, g.target(t, i))
+		}
+		code += fmt.Sprintf("\n.addTargets([\n%s,\n])", strings.Join(converted, ",\n"))
+		delete(rest, "targets")
+	}
+	return g.merge(code, rest)
+}
+
+// target converts a Prometheus target. grafonnet assigns refIds in order, so
+// only refIds that differ are kept.
+func (g *grafonnetWriter) target(t interface{}, i int) string {
+	target, ok := t.(map[string]interface{})
+	if !ok {
+		return literal(t)
+	}
+	rest := copyObject(target)
+	if refID, ok := rest["refId"].(string); ok && refID == string(rune('A'+i)) {
+		delete(rest, "refId")
+	}
+	if _, ok := rest["expr"].(string); !ok {
+		return literal(rest)
+	}
+	expr := take(rest, "expr")
+	args := g.args(rest, "legendFormat", "format", "interval", "intervalFactor", "instant", "hide", "datasource")
+	return g.merge(g.call("prometheus.target", []string{literal(expr)}, args), rest)
+}
+
+// variable converts a template variable. Only their definition is converted,
+// not their current state.
+func (g *grafonnetWriter) variable(v interface{}) string {
+	variable, ok := v.(map[string]interface{})
+	if !ok {
+		return literal(v)
+	}
+	name := literal(variable["name"])
+	named := func(fields ...string) []grafonnetArg {
+		args := g.args(variable, fields...)
+		if hide, ok := variable["hide"].(float64); ok && hide != 0 {
+			args = append(args, grafonnetArg{"hide", literal(grafonnetHides[hide])})
+		}
+		return args
+	}
+	switch variable["type"] {
+	case "query":
+		args := named("label", "regex", "includeAll", "multi", "sort", "allValues")
+		if refresh, ok := variable["refresh"].(float64); ok {
+			args = append(args, grafonnetArg{"refresh", literal(grafonnetRefreshes[refresh])})
+		}
+		return g.call("template.new", []string{name, literal(variable["datasource"]), literal(variable["query"])}, args)
+	case "datasource":
+		return g.call("template.datasource", []string{name, literal(variable["query"]), literal(currentValue(variable))}, named("label", "regex"))
+	case "custom":
+		return g.call("template.custom", []string{name, literal(variable["query"]), literal(currentValue(variable))}, named("label", "includeAll", "multi", "allValues"))
+	}
+	return literal(variable)
+}
+
+// args takes the given fields that are set from an object, as named arguments
+func (g *grafonnetWriter) args(obj map[string]interface{}, fields ...string) []grafonnetArg {
+	args := []grafonnetArg{}
+	for _, field := range fields {
+		if v, ok := obj[field]; ok && v != nil {
+			args = append(args, grafonnetArg{field, literal(v)})
+			delete(obj, field)
+		}
+	}
+	return args
+}
+
+// call renders a call to a grafonnet constructor, e.g. `graphPanel.new(...)`
+func (g *grafonnetWriter) call(fn string, positional []string, args []grafonnetArg) string {
+	local := strings.SplitN(fn, ".", 2)[0]
+	g.used[local] = true
+	if !strings.Contains(fn, ".") {
+		fn += ".new"
+	}
+	params := append([]string{}, positional...)
+	for _, arg := range args {
+		params = append(params, arg.name+"="+arg.value)
+	}
+	if len(params) == 0 {
+		return fn + "()"
+	}
+	return fmt.Sprintf("%s(\n%s,\n)", fn, strings.Join(params, ",\n"))
+}
+
+// merge keeps the fields that were not converted, by merging them onto the
+// constructed object
+func (g *grafonnetWriter) merge(code string, rest map[string]interface{}) string {
+	if len(rest) == 0 {
+		return code
+	}
+	keys := []string{}
+	for k := range rest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := []string{}
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s: %s", literal(k), literal(rest[k])))
+	}
+	return fmt.Sprintf("%s\n+ {\n%s,\n}", code, strings.Join(fields, ",\n"))
+}
+
+// currentValue returns the value a variable is currently set to, if a string
+func currentValue(variable map[string]interface{}) interface{} {
+	current, _ := variable["current"].(map[string]interface{})
+	if value, ok := current["value"].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// take removes a field from an object, returning its value
+func take(obj map[string]interface{}, field string) interface{} {
+	v := obj[field]
+	delete(obj, field)
+	return v
+}
+
+func copyObject(obj map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{}
+	for k, v := range obj {
+		c[k] = v
+	}
+	return c
+}
+
+// literal renders a JSON value as Jsonnet, JSON being valid Jsonnet
+func literal(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
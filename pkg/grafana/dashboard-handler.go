@@ -1,12 +1,13 @@
 package grafana
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
-	"github.com/kylelemons/godebug/diff"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -15,16 +16,23 @@ import (
  * This will be removed from the JSON, and if no folder exists, a dashboard folder
  * will be created with UID and title matching your `folderName`.
  *
+ * Nested folders are named by path, e.g. "Team A/Payments": the folder with
+ * UID "Team A", and the folder titled "Payments" within it. Missing folders of
+ * the path are created, and dashboards moved between folders are diffed as a
+ * change of their `folderName`.
+ *
  * Alternatively, create a `grafanaDashboardFolder` root element in your Jsonnet. This
  * value will be used as a folder name for all of your dashboards.
  */
 
 // DashboardHandler is a Grizzly Provider for Grafana dashboards
-type DashboardHandler struct{}
+type DashboardHandler struct {
+	endpoint *grizzly.Endpoint
+}
 
 // NewDashboardHandler returns configuration defining a new Grafana Provider
-func NewDashboardHandler() *DashboardHandler {
-	return &DashboardHandler{}
+func NewDashboardHandler(endpoint *grizzly.Endpoint) *DashboardHandler {
+	return &DashboardHandler{endpoint: endpoint}
 }
 
 // GetName returns the name for this provider
@@ -55,6 +63,12 @@ func (h *DashboardHandler) GetExtension() string {
 	return "json"
 }
 
+// Configured returns why Grafana is not configured, if it is not
+func (h *DashboardHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
 func (h *DashboardHandler) newDashboardResource(path, uid, filename string, board Dashboard) grizzly.Resource {
 	resource := grizzly.Resource{
 		UID:      uid,
@@ -96,113 +110,109 @@ func (h *DashboardHandler) Parse(path string, i interface{}) (grizzly.ResourceLi
 			return nil, err
 		}
 		resource := h.newDashboardResource(path, board.UID(), k, board)
-		key := resource.Key()
-		resources[key] = resource
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
 	}
 	return resources, nil
 }
 
-// Diff compares local resources with remote equivalents and output result
-func (h *DashboardHandler) Diff(notifier grizzly.Notifier, resources grizzly.ResourceList) error {
-	dashboardFolder := "general"
-	dashboardFolderResource, ok := resources[dashboardFolderPath]
-	if ok {
-		dashboardFolder = dashboardFolderResource.Filename
-	}
-	for _, resource := range resources {
-		if resource.JSONPath == dashboardFolderPath {
-			continue
-		}
-		resource = dashboardWithFolderSet(resource, dashboardFolder)
-		local, err := resource.GetRepresentation()
-		if err != nil {
-			return nil
-		}
-		resource = *h.Unprepare(resource)
-		uid := resource.UID
-		remote, err := h.GetRemote(resource.UID)
-		if err == grizzly.ErrNotFound {
-			notifier.NotFound(resource)
-			continue
-		}
-		if err != nil {
-			return fmt.Errorf("Error retrieving resource from %s %s: %v", resource.Kind(), uid, err)
-		}
-		remote = h.Unprepare(*remote)
-		remoteRepresentation, err := (*remote).GetRepresentation()
-		if err != nil {
-			return err
-		}
+// Detect recognises dashboards in plain files, e.g. exported from Grafana, by
+// their title and panels or schema version
+func (h *DashboardHandler) Detect(document map[string]interface{}) bool {
+	_, hasPanels := document["panels"]
+	_, hasSchemaVersion := document["schemaVersion"]
+	_, hasTitle := document["title"]
+	return hasTitle && (hasPanels || hasSchemaVersion)
+}
 
-		if local == remoteRepresentation {
-			notifier.NoChanges(resource)
-		} else {
-			difference := diff.Diff(remoteRepresentation, local)
-			notifier.HasChanges(resource, difference)
-		}
+// Validate checks a dashboard against the dashboard schema
+func (h *DashboardHandler) Validate(resource grizzly.Resource) []error {
+	board, ok := resource.Detail.(Dashboard)
+	if !ok {
+		return nil
 	}
-	return nil
+	return validateDashboard(board)
 }
 
-// Apply local resources to remote endpoint
-func (h *DashboardHandler) Apply(notifier grizzly.Notifier, resources grizzly.ResourceList) error {
-	dashboardFolder := "general"
-	dashboardFolderResource, ok := resources[dashboardFolderPath]
-	if ok {
-		dashboardFolder = dashboardFolderResource.Filename
+// Lint checks a dashboard for common mistakes
+func (h *DashboardHandler) Lint(resource grizzly.Resource) []error {
+	board, ok := resource.Detail.(Dashboard)
+	if !ok {
+		return nil
 	}
-	for _, resource := range resources {
+	return lintDashboard(board)
+}
+
+// PrepareList sets the folder of dashboards from the folder setting, if they
+// do not set their own, and drops the setting
+func (h *DashboardHandler) PrepareList(resources grizzly.ResourceList) grizzly.ResourceList {
+	prepared := grizzly.ResourceList{}
+	for key, resource := range resources {
 		if resource.JSONPath == dashboardFolderPath {
 			continue
 		}
-		existingResource, err := h.GetRemote(resource.UID)
-		if err == grizzly.ErrNotFound {
-			err := h.Add(resource)
-			if err != nil {
-				return err
-			}
-			notifier.Added(resource)
-			continue
-		} else if err != nil {
-			return err
-		}
-		resource = dashboardWithFolderSet(resource, dashboardFolder)
-		resourceRepresentation, err := resource.GetRepresentation()
-		if err != nil {
-			return err
-		}
-		resource = *h.Prepare(*existingResource, resource)
-		existingResource = h.Unprepare(*existingResource)
-		existingResourceRepresentation, err := existingResource.GetRepresentation()
-		if err != nil {
-			return nil
-		}
-		if resourceRepresentation == existingResourceRepresentation {
-			notifier.NoChanges(resource)
-		} else {
-			err = h.Update(*existingResource, resource)
-			if err != nil {
-				return err
-			}
-			notifier.Updated(resource)
-		}
+		prepared[key] = dashboardWithFolderSet(resource, h.GetFolder(resource, resources))
 	}
-	return nil
+	return prepared
 }
 
 // Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
 func (h *DashboardHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	if board, ok := resource.Detail.(Dashboard); ok {
+		for _, field := range dashboardServerFields {
+			delete(board, field)
+		}
+		unmarkDashboard(board)
+	}
 	return &resource
 }
 
-// Prepare gets a resource ready for dispatch to the remote endpoint
+// Mark tags a dashboard as managed by grizzly
+func (h *DashboardHandler) Mark(resource grizzly.Resource, source string) grizzly.Resource {
+	if board, ok := resource.Detail.(Dashboard); ok {
+		markDashboard(board, source)
+	}
+	return resource
+}
+
+// Marked reports whether a dashboard is tagged as managed by grizzly
+func (h *DashboardHandler) Marked(resource grizzly.Resource) bool {
+	board, ok := resource.Detail.(Dashboard)
+	return ok && dashboardMarked(board)
+}
+
+// DeclaredUID returns the UID a dashboard declares, Grafana generating one if
+// empty
+func (h *DashboardHandler) DeclaredUID(resource grizzly.Resource) string {
+	uid, _ := newDashboard(resource)["uid"].(string)
+	return uid
+}
+
+// Version returns the version of a remote dashboard, which Grafana increments
+// each time it is saved
+func (h *DashboardHandler) Version(resource grizzly.Resource) int {
+	version, _ := newDashboard(resource)["version"].(float64)
+	return int(version)
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint, with the
+// version of the remote dashboard it replaces
 func (h *DashboardHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	board := Dashboard{}
+	for k, v := range newDashboard(resource) {
+		board[k] = v
+	}
+	if version, ok := newDashboard(existing)["version"]; ok {
+		board["version"] = version
+	}
+	resource.Detail = board
 	return &resource
 }
 
 // GetByUID retrieves JSON for a resource from an endpoint, by UID
-func (h *DashboardHandler) GetByUID(UID string) (*grizzly.Resource, error) {
-	board, err := getRemoteDashboard(UID)
+func (h *DashboardHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	board, err := getRemoteDashboard(ctx, h.endpoint, UID)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving dashboard %s: %v", UID, err)
 	}
@@ -220,8 +230,8 @@ func (h *DashboardHandler) GetRepresentation(uid string, resource grizzly.Resour
 }
 
 // GetRemoteRepresentation retrieves a dashboard as JSON
-func (h *DashboardHandler) GetRemoteRepresentation(uid string) (string, error) {
-	board, err := getRemoteDashboard(uid)
+func (h *DashboardHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	board, err := getRemoteDashboard(ctx, h.endpoint, uid)
 
 	if err != nil {
 		return "", err
@@ -229,9 +239,9 @@ func (h *DashboardHandler) GetRemoteRepresentation(uid string) (string, error) {
 	return board.toJSON()
 }
 
-// GetRemote retrieves a dashboard as a resource
-func (h *DashboardHandler) GetRemote(uid string) (*grizzly.Resource, error) {
-	board, err := getRemoteDashboard(uid)
+// GetRemote retrieves a dashboard as a resource, along with its version
+func (h *DashboardHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	board, err := getVersionedDashboard(ctx, h.endpoint, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -240,41 +250,256 @@ func (h *DashboardHandler) GetRemote(uid string) (*grizzly.Resource, error) {
 }
 
 // Add pushes a new dashboard to Grafana via the API
-func (h *DashboardHandler) Add(resource grizzly.Resource) error {
+func (h *DashboardHandler) Add(ctx context.Context, resource grizzly.Resource) error {
 	board := newDashboard(resource)
 
-	if err := postDashboard(board); err != nil {
+	if err := postDashboard(ctx, h.endpoint, board); err != nil {
 		return err
 	}
 	return nil
 }
 
 // Update pushes a dashboard to Grafana via the API
-func (h *DashboardHandler) Update(existing, resource grizzly.Resource) error {
+func (h *DashboardHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
 	board := newDashboard(resource)
 
-	return postDashboard(board)
+	return postDashboard(ctx, h.endpoint, board)
+}
+
+// Delete removes a dashboard from Grafana via the API
+func (h *DashboardHandler) Delete(ctx context.Context, UID string) error {
+	return deleteDashboard(ctx, h.endpoint, UID)
+}
+
+// ListRemote retrieves the dashboards of all folders that local dashboards are
+// pushed to
+func (h *DashboardHandler) ListRemote(ctx context.Context, resources grizzly.ResourceList) (grizzly.ResourceList, error) {
+	folders := map[string]bool{}
+	for _, resource := range resources {
+		if resource.JSONPath == dashboardFolderPath {
+			continue
+		}
+		folders[h.GetFolder(resource, resources)] = true
+	}
+	remote := grizzly.ResourceList{}
+	for folder := range folders {
+		folderID, err := getFolderID(ctx, h.endpoint, folder)
+		if err == grizzly.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		hits, err := searchDashboards(ctx, h.endpoint, folderID)
+		if err != nil {
+			return nil, err
+		}
+		// hits are named after the folder searched, which is nested, or
+		// has its UID as name
+		folderName := folder
+		if isGeneralFolder(folder) {
+			folderName = ""
+		}
+		for _, hit := range hits {
+			board := Dashboard{
+				"uid":           hit.UID,
+				"title":         hit.Title,
+				folderNameField: folderName,
+			}
+			if len(hit.Tags) > 0 {
+				tags := []interface{}{}
+				for _, tag := range hit.Tags {
+					tags = append(tags, tag)
+				}
+				board["tags"] = tags
+			}
+			resource := h.newDashboardResource(dashboardsPath, hit.UID, "", board)
+			remote[resource.Key()] = resource
+		}
+	}
+	return remote, nil
+}
+
+// ListAll retrieves a summary of all dashboards in Grafana
+func (h *DashboardHandler) ListAll(ctx context.Context) ([]grizzly.ResourceSummary, error) {
+	hits, err := searchDashboards(ctx, h.endpoint, -1)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []grizzly.ResourceSummary{}
+	for _, hit := range hits {
+		folder := hit.FolderTitle
+		if folder == "" {
+			folder = "General"
+		}
+		summaries = append(summaries, grizzly.ResourceSummary{UID: hit.UID, Title: hit.Title, Folder: folder})
+	}
+	return summaries, nil
+}
+
+// GetFolder returns the folder a dashboard is pushed to
+func (h *DashboardHandler) GetFolder(resource grizzly.Resource, resources grizzly.ResourceList) string {
+	if board, ok := resource.Detail.(Dashboard); ok {
+		if folder, ok := board[folderNameField].(string); ok {
+			return folder
+		}
+	}
+	if dashboardFolderResource, ok := resources[dashboardFolderPath]; ok {
+		return dashboardFolderResource.Filename
+	}
+	return "general"
+}
+
+// GetFolderTitle returns the title of the folder of a dashboard. Folders are
+// created titled after their UID, and remote dashboards carry the title of
+// their folder, so only the General folder is titled differently. Nested
+// folders are titled by their path.
+func (h *DashboardHandler) GetFolderTitle(resource grizzly.Resource, resources grizzly.ResourceList) string {
+	switch folder := h.GetFolder(resource, resources); folder {
+	case "", "0", "general":
+		return "General"
+	default:
+		return folder
+	}
+}
+
+// Terraform renders a dashboard as a grafana_dashboard reading its JSON from a
+// file, and its folder as a grafana_folder
+func (h *DashboardHandler) Terraform(resource grizzly.Resource, resources grizzly.ResourceList) ([]grizzly.TerraformResource, error) {
+	board := dashboardWithoutFolder(resource)
+	j, err := board.toJSON()
+	if err != nil {
+		return nil, err
+	}
+	name := grizzly.TerraformName(resource.UID)
+	file := "dashboards/" + name + ".json"
+	dashboard := grizzly.TerraformResource{
+		Type: "grafana_dashboard",
+		Name: name,
+		Attributes: map[string]interface{}{
+			"config_json": grizzly.TerraformExpr(fmt.Sprintf(`file("${path.module}/%s")`, file)),
+		},
+		ImportID: resource.UID,
+		Files:    map[string]string{file: j},
+	}
+	folderUID := h.GetFolder(resource, resources)
+	if isGeneralFolder(folderUID) {
+		return []grizzly.TerraformResource{dashboard}, nil
+	}
+	// folders are created as grizzly creates them, titled after their UID
+	folder := grizzly.TerraformResource{
+		Type: "grafana_folder",
+		Name: grizzly.TerraformName(folderUID),
+		Attributes: map[string]interface{}{
+			"uid":   folderUID,
+			"title": folderUID,
+		},
+		ImportID: folderUID,
+	}
+	dashboard.Attributes["folder"] = grizzly.TerraformExpr(folder.Address() + ".uid")
+	return []grizzly.TerraformResource{folder, dashboard}, nil
+}
+
+// dashboardsProvisioningDir holds the JSON of provisioned dashboards, by
+// folder, relative to the provisioning directory
+const dashboardsProvisioningDir = "dashboards/grizzly"
+
+// Provision returns the JSON of dashboards, by folder, and the provider
+// provisioning them, creating folders after the directories
+func (h *DashboardHandler) Provision(resources grizzly.ResourceList, provisioningDir string) (map[string]string, error) {
+	files := map[string]string{}
+	for _, resource := range resources {
+		if resource.JSONPath == dashboardFolderPath {
+			continue
+		}
+		folder := h.GetFolder(resource, resources)
+		if isGeneralFolder(folder) {
+			folder = ""
+		}
+		board := dashboardWithoutFolder(resource)
+		j, err := board.toJSON()
+		if err != nil {
+			return nil, err
+		}
+		files[path.Join(dashboardsProvisioningDir, folder, resource.UID+".json")] = j
+	}
+	provider, err := provisioningYAML("providers", []interface{}{map[string]interface{}{
+		"name":           "grizzly",
+		"type":           "file",
+		"allowUiUpdates": false,
+		"options": map[string]interface{}{
+			"path":                      path.Join(provisioningDir, dashboardsProvisioningDir),
+			"foldersFromFilesStructure": true,
+		},
+	}})
+	if err != nil {
+		return nil, err
+	}
+	files["dashboards/grizzly.yaml"] = provider
+	return files, nil
+}
+
+// ConfigMapLabel returns the label the sidecar of Grafana finds dashboards by
+func (h *DashboardHandler) ConfigMapLabel() string {
+	return "grafana_dashboard"
+}
+
+// ConfigMapData returns the JSON of a dashboard, and its folder
+func (h *DashboardHandler) ConfigMapData(resource grizzly.Resource, resources grizzly.ResourceList) (string, string, string, error) {
+	board := dashboardWithoutFolder(resource)
+	j, err := board.toJSON()
+	if err != nil {
+		return "", "", "", err
+	}
+	folder := h.GetFolder(resource, resources)
+	if isGeneralFolder(folder) {
+		folder = ""
+	}
+	return resource.UID + ".json", j, folder, nil
+}
+
+// ToGrafonnet converts a dashboard to grafonnet
+func (h *DashboardHandler) ToGrafonnet(resource grizzly.Resource) (string, string, error) {
+	locals, body := dashboardToGrafonnet(newDashboard(resource))
+	return locals, body, nil
 }
 
 // Preview renders Jsonnet then pushes them to the endpoint if previews are possible
-func (h *DashboardHandler) Preview(resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+func (h *DashboardHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
 	if resource.JSONPath == dashboardFolderPath {
 		return nil
 	}
 	board := newDashboard(resource)
-	s, err := postSnapshot(board, opts)
+	s, err := postSnapshot(ctx, h.endpoint, board, opts)
 	if err != nil {
 		return err
 	}
-	notifier.Info(&resource, "view: "+s.URL)
-	notifier.Error(&resource, "delete: "+s.DeleteURL)
+	notifier.Previewed(resource, s.URL, s.DeleteURL)
 	if opts.ExpiresSeconds > 0 {
 		notifier.Warn(&resource, fmt.Sprintf("Previews will expire and be deleted automatically in %d seconds\n", opts.ExpiresSeconds))
 	}
 	return nil
 }
 
+// RenderPreview renders the snapshot previewing a dashboard as a PNG image
+func (h *DashboardHandler) RenderPreview(ctx context.Context, url string, opts *grizzly.PreviewOpts) ([]byte, error) {
+	key, err := snapshotKey(url)
+	if err != nil {
+		return nil, err
+	}
+	return renderSnapshot(ctx, h.endpoint, key, opts)
+}
+
+// ListSnapshots lists the snapshots created as previews of dashboards
+func (h *DashboardHandler) ListSnapshots(ctx context.Context) ([]grizzly.Snapshot, error) {
+	return listSnapshots(ctx, h.endpoint)
+}
+
+// DeleteSnapshot deletes a snapshot created as a preview, by key
+func (h *DashboardHandler) DeleteSnapshot(ctx context.Context, key string) error {
+	return deleteSnapshot(ctx, h.endpoint, key)
+}
+
 // Listen watches a resource and updates local file on changes
-func (h *DashboardHandler) Listen(notifier grizzly.Notifier, UID, filename string) error {
-	return watchDashboard(notifier, UID, filename)
+func (h *DashboardHandler) Listen(ctx context.Context, notifier grizzly.Notifier, UID, filename string) error {
+	return watchDashboard(ctx, h.endpoint, notifier, UID, filename)
 }
@@ -0,0 +1,132 @@
+package grafana
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+ * Dashboards can be linted for common mistakes, in the style of the Grafana
+ * dashboard linter. Rules are disabled for a whole dashboard, or for a single
+ * panel, by listing their names in a `lintDisable` field, e.g.
+ * `lintDisable: ['target-rate-interval-rule']`. Grafana keeps such fields as
+ * part of the dashboard JSON.
+ */
+
+const lintDisableField = "lintDisable"
+
+// lintRule checks either a dashboard as a whole, or each of its panels
+type lintRule struct {
+	name      string
+	dashboard func(board Dashboard) []string
+	panel     func(panel map[string]interface{}) []string
+}
+
+var lintRules = []lintRule{
+	{name: "template-datasource-rule", dashboard: lintTemplateDatasource},
+	{name: "panel-datasource-rule", panel: lintPanelDatasource},
+	{name: "panel-title-rule", panel: lintPanelTitle},
+	{name: "target-rate-interval-rule", panel: lintTargetRateInterval},
+}
+
+// lintDashboard applies all lint rules that are not disabled to a dashboard
+func lintDashboard(board Dashboard) []error {
+	errs := []error{}
+	disabled := lintDisabled(board)
+	for _, rule := range lintRules {
+		if disabled[rule.name] || rule.dashboard == nil {
+			continue
+		}
+		for _, msg := range rule.dashboard(board) {
+			errs = append(errs, fmt.Errorf("%s: %s", rule.name, msg))
+		}
+	}
+	eachPanel(board, "", func(path string, panel map[string]interface{}) {
+		panelDisabled := lintDisabled(panel)
+		for _, rule := range lintRules {
+			if disabled[rule.name] || panelDisabled[rule.name] || rule.panel == nil {
+				continue
+			}
+			for _, msg := range rule.panel(panel) {
+				errs = append(errs, fmt.Errorf("%s: %s: %s", path, rule.name, msg))
+			}
+		}
+	})
+	return errs
+}
+
+// lintDisabled returns the rules disabled on a dashboard or panel
+func lintDisabled(obj map[string]interface{}) map[string]bool {
+	disabled := map[string]bool{}
+	if names, ok := obj[lintDisableField].([]interface{}); ok {
+		for _, name := range names {
+			disabled[fmt.Sprint(name)] = true
+		}
+	}
+	return disabled
+}
+
+// eachPanel calls fn for each panel, including those within collapsed rows
+func eachPanel(obj map[string]interface{}, path string, fn func(path string, panel map[string]interface{})) {
+	panels, _ := obj["panels"].([]interface{})
+	for i, p := range panels {
+		panel, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panelPath := fmt.Sprintf("%s[%d]", join(path, "panels"), i)
+		if panel["type"] == "row" {
+			eachPanel(panel, panelPath, fn)
+			continue
+		}
+		fn(panelPath, panel)
+	}
+}
+
+func lintTemplateDatasource(board Dashboard) []string {
+	templating, _ := board["templating"].(map[string]interface{})
+	variables, _ := templating["list"].([]interface{})
+	for _, v := range variables {
+		if variable, ok := v.(map[string]interface{}); ok && variable["type"] == "datasource" {
+			return nil
+		}
+	}
+	return []string{"dashboard has no datasource template variable"}
+}
+
+func lintPanelDatasource(panel map[string]interface{}) []string {
+	datasource := panel["datasource"]
+	if obj, ok := datasource.(map[string]interface{}); ok {
+		datasource = obj["uid"]
+	}
+	name, ok := datasource.(string)
+	if !ok || strings.HasPrefix(name, "$") {
+		return nil
+	}
+	return []string{fmt.Sprintf("datasource should be a template variable, got %s", name)}
+}
+
+func lintPanelTitle(panel map[string]interface{}) []string {
+	if title, _ := panel["title"].(string); strings.TrimSpace(title) == "" {
+		return []string{"panel has no title"}
+	}
+	return nil
+}
+
+var rateRangeRegexp = regexp.MustCompile(`\b(rate|irate|increase)\s*\([^\[\]]*\[([^\]]*)\]`)
+
+func lintTargetRateInterval(panel map[string]interface{}) []string {
+	msgs := []string{}
+	targets, _ := panel["targets"].([]interface{})
+	for i, t := range targets {
+		target, _ := t.(map[string]interface{})
+		expr, _ := target["expr"].(string)
+		for _, match := range rateRangeRegexp.FindAllStringSubmatch(expr, -1) {
+			if match[2] != "$__rate_interval" {
+				msgs = append(msgs, fmt.Sprintf("targets[%d]: %s() should use $__rate_interval, got [%s]", i, match[1], match[2]))
+			}
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,133 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Dashboards refer to datasources by uid, or by name in older dashboards. A
+ * datasource that exists neither in the Jsonnet nor in Grafana renders as
+ * "datasource not found", which is caught before dashboards are pushed.
+ * Template variables, e.g. $datasource, and Grafana's built-in datasources
+ * are not checked.
+ */
+
+// builtinDatasources are the datasources every Grafana has, by uid or name
+var builtinDatasources = map[string]bool{
+	"grafana":         true,
+	"-- Grafana --":   true,
+	"-- Mixed --":     true,
+	"-- Dashboard --": true,
+	"default":         true,
+}
+
+// datasourceRef is a reference of a dashboard to a datasource
+type datasourceRef struct {
+	path string
+	ref  string
+}
+
+// dashboardDatasourceRefs returns the datasources a dashboard refers to from
+// its panels, their targets, its template variables and annotations
+func dashboardDatasourceRefs(board Dashboard) []datasourceRef {
+	refs := []datasourceRef{}
+	add := func(path string, obj map[string]interface{}) {
+		if ref := datasourceRefID(obj["datasource"]); ref != "" {
+			refs = append(refs, datasourceRef{path: join(path, "datasource"), ref: ref})
+		}
+	}
+	eachPanel(board, "", func(path string, panel map[string]interface{}) {
+		add(path, panel)
+		targets, _ := panel["targets"].([]interface{})
+		for i, t := range targets {
+			if target, ok := t.(map[string]interface{}); ok {
+				add(fmt.Sprintf("%s.targets[%d]", path, i), target)
+			}
+		}
+	})
+	for _, field := range []string{"templating", "annotations"} {
+		obj, _ := board[field].(map[string]interface{})
+		list, _ := obj["list"].([]interface{})
+		for i, item := range list {
+			if item, ok := item.(map[string]interface{}); ok {
+				add(fmt.Sprintf("%s.list[%d]", field, i), item)
+			}
+		}
+	}
+	return refs
+}
+
+// datasourceRefID returns the uid or name a datasource field refers to, or an
+// empty string if it refers to a template variable, a built-in datasource or
+// the default one
+func datasourceRefID(datasource interface{}) string {
+	if obj, ok := datasource.(map[string]interface{}); ok {
+		if obj["type"] == "datasource" || obj["type"] == "grafana" {
+			return ""
+		}
+		datasource = obj["uid"]
+	}
+	ref, _ := datasource.(string)
+	if strings.HasPrefix(ref, "$") || builtinDatasources[ref] {
+		return ""
+	}
+	return ref
+}
+
+// CheckReferences returns the datasources dashboards refer to that exist
+// neither among the resources given nor in Grafana, by dashboard key. Grafana
+// is only asked for its datasources if some are not in the Jsonnet.
+func (h *DashboardHandler) CheckReferences(ctx context.Context, resourceList grizzly.ResourceList, resources grizzly.Resources) (map[string][]error, error) {
+	known := map[string]bool{}
+	for handler, sources := range resources {
+		if _, ok := handler.(*DatasourceHandler); !ok {
+			continue
+		}
+		for _, resource := range sources {
+			known[resource.UID] = true
+			if uid, ok := resource.Detail.(Datasource)["uid"].(string); ok {
+				known[uid] = true
+			}
+		}
+	}
+
+	missing := map[string][]datasourceRef{}
+	for key, resource := range resourceList {
+		board, ok := resource.Detail.(Dashboard)
+		if !ok {
+			continue
+		}
+		for _, ref := range dashboardDatasourceRefs(board) {
+			if !known[ref.ref] {
+				missing[key] = append(missing[key], ref)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	sources, err := listDatasources(ctx, h.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing datasources: %v", err)
+	}
+	for _, source := range sources {
+		known[source.UID()] = true
+		if uid, ok := source["uid"].(string); ok {
+			known[uid] = true
+		}
+	}
+	broken := map[string][]error{}
+	for key, refs := range missing {
+		for _, ref := range refs {
+			if !known[ref.ref] {
+				broken[key] = append(broken[key], fmt.Errorf("%s: datasource %s not found", ref.path, ref.ref))
+			}
+		}
+	}
+	return broken, nil
+}
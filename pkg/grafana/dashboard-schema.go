@@ -0,0 +1,220 @@
+package grafana
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+ * Dashboards are checked against the parts of the Grafana dashboard JSON schema
+ * that Grafana relies on: the types of well known fields, and the structure of
+ * panels, their targets and grid positions, templating and annotations. Unknown
+ * fields are left alone, as plugins define their own panel options. Problems are
+ * reported by JSON path, e.g. `panels[2].targets[0].refId`.
+ */
+
+var templateVariableTypes = []string{"query", "custom", "constant", "datasource", "interval", "textbox", "adhoc"}
+
+// dashboardSchema collects the problems found in a dashboard
+type dashboardSchema struct {
+	errs []error
+}
+
+func (s *dashboardSchema) errorf(path, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if path != "" {
+		msg = path + ": " + msg
+	}
+	s.errs = append(s.errs, errors.New(msg))
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// field returns a field of an object if it has one of the given types. Fields
+// that are missing are reported if required.
+func (s *dashboardSchema) field(obj map[string]interface{}, path, key string, required bool, types ...string) (interface{}, bool) {
+	v, exists := obj[key]
+	if !exists {
+		if required {
+			s.errorf(path, "missing required field %s", key)
+		}
+		return nil, false
+	}
+	typ := jsonType(v)
+	for _, t := range types {
+		if t == typ {
+			return v, true
+		}
+	}
+	s.errorf(join(path, key), "expected %s, got %s", orList(types), typ)
+	return nil, false
+}
+
+// eachObject calls fn, in order, for the elements of an array field that are
+// objects, with their path
+func (s *dashboardSchema) eachObject(obj map[string]interface{}, path, key string, fn func(path string, obj map[string]interface{})) {
+	v, ok := s.field(obj, path, key, false, "array")
+	if !ok {
+		return
+	}
+	for i, elem := range v.([]interface{}) {
+		elemPath := fmt.Sprintf("%s[%d]", join(path, key), i)
+		if m, ok := elem.(map[string]interface{}); ok {
+			fn(elemPath, m)
+		} else {
+			s.errorf(elemPath, "expected object, got %s", jsonType(elem))
+		}
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func orList(items []string) string {
+	s := items[0]
+	for i, item := range items[1:] {
+		if i == len(items)-2 {
+			s += " or " + item
+		} else {
+			s += ", " + item
+		}
+	}
+	return s
+}
+
+// validateDashboard checks a dashboard against the dashboard schema
+func validateDashboard(board Dashboard) []error {
+	s := &dashboardSchema{}
+	s.field(board, "", "uid", true, "string")
+	if title, ok := s.field(board, "", "title", true, "string"); ok && title == "" {
+		s.errorf("title", "must not be empty")
+	}
+	s.field(board, "", "schemaVersion", false, "number")
+	s.field(board, "", "editable", false, "boolean")
+	s.field(board, "", "refresh", false, "string", "boolean")
+	if tags, ok := s.field(board, "", "tags", false, "array"); ok {
+		for i, tag := range tags.([]interface{}) {
+			if _, ok := tag.(string); !ok {
+				s.errorf(fmt.Sprintf("tags[%d]", i), "expected string, got %s", jsonType(tag))
+			}
+		}
+	}
+	if t, ok := s.field(board, "", "time", false, "object"); ok {
+		s.field(t.(map[string]interface{}), "time", "from", true, "string")
+		s.field(t.(map[string]interface{}), "time", "to", true, "string")
+	}
+	s.validatePanels(board, "")
+	s.validateList(board, "templating", s.validateVariable)
+	s.validateList(board, "annotations", s.validateAnnotation)
+	sortErrors(s.errs)
+	return s.errs
+}
+
+// validateList checks the `list` of a templating or annotations object
+func (s *dashboardSchema) validateList(board Dashboard, key string, validate func(path string, obj map[string]interface{}, names map[string]string)) {
+	v, ok := s.field(board, "", key, false, "object")
+	if !ok {
+		return
+	}
+	names := map[string]string{}
+	s.eachObject(v.(map[string]interface{}), key, "list", func(path string, obj map[string]interface{}) {
+		validate(path, obj, names)
+	})
+}
+
+// validatePanels checks the panels of a dashboard, or of a collapsed row
+func (s *dashboardSchema) validatePanels(obj map[string]interface{}, path string) {
+	s.eachObject(obj, path, "panels", func(panelPath string, panel map[string]interface{}) {
+		typ, _ := s.field(panel, panelPath, "type", true, "string")
+		s.field(panel, panelPath, "id", false, "number")
+		s.field(panel, panelPath, "title", false, "string")
+		s.field(panel, panelPath, "datasource", false, "string", "null", "object")
+		if gridPos, ok := s.field(panel, panelPath, "gridPos", false, "object"); ok {
+			s.validateGridPos(gridPos.(map[string]interface{}), join(panelPath, "gridPos"))
+		}
+		refIDs := map[string]string{}
+		s.eachObject(panel, panelPath, "targets", func(targetPath string, target map[string]interface{}) {
+			refID, ok := s.field(target, targetPath, "refId", false, "string")
+			if !ok {
+				return
+			}
+			if other, exists := refIDs[refID.(string)]; exists {
+				s.errorf(join(targetPath, "refId"), "duplicate refId %s, also used by %s", refID, other)
+			}
+			refIDs[refID.(string)] = targetPath
+		})
+		if typ == "row" {
+			s.validatePanels(panel, panelPath)
+		}
+	})
+}
+
+// validateGridPos checks that a panel fits the 24 column grid
+func (s *dashboardSchema) validateGridPos(gridPos map[string]interface{}, path string) {
+	values := map[string]float64{}
+	for _, key := range []string{"h", "w", "x", "y"} {
+		if v, ok := s.field(gridPos, path, key, true, "number"); ok {
+			values[key] = v.(float64)
+			if values[key] < 0 {
+				s.errorf(join(path, key), "must not be negative")
+			}
+		}
+	}
+	if values["w"] > 24 || values["x"]+values["w"] > 24 {
+		s.errorf(path, "panel exceeds the grid width of 24 (x=%v, w=%v)", values["x"], values["w"])
+	}
+}
+
+// validateVariable checks a template variable
+func (s *dashboardSchema) validateVariable(path string, variable map[string]interface{}, names map[string]string) {
+	if name, ok := s.field(variable, path, "name", true, "string"); ok {
+		if other, exists := names[name.(string)]; exists {
+			s.errorf(join(path, "name"), "duplicate variable %s, also defined by %s", name, other)
+		}
+		names[name.(string)] = path
+	}
+	if typ, ok := s.field(variable, path, "type", true, "string"); ok {
+		for _, t := range templateVariableTypes {
+			if t == typ {
+				return
+			}
+		}
+		s.errorf(join(path, "type"), "unknown variable type %s, expected %s", typ, orList(templateVariableTypes))
+	}
+}
+
+// validateAnnotation checks an annotation query
+func (s *dashboardSchema) validateAnnotation(path string, annotation map[string]interface{}, names map[string]string) {
+	s.field(annotation, path, "name", true, "string")
+	s.field(annotation, path, "enable", false, "boolean")
+	s.field(annotation, path, "datasource", false, "string", "null", "object")
+}
+
+// sortErrors orders errors by message, and so by path
+func sortErrors(errs []error) {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+}
@@ -1,6 +1,7 @@
 package grafana
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,6 +14,9 @@ import (
 )
 
 type eventHandler struct {
+	// ctx is the context of the listen, dashboards are retrieved with
+	ctx      context.Context
+	endpoint *grizzly.Endpoint
 	filename string
 	url      string
 	stop     bool
@@ -57,7 +61,7 @@ func (h *eventHandler) OnPublish(sub *centrifuge.Subscription, e centrifuge.Publ
 	if response.Action != "saved" {
 		h.notifier.Warn(nil, fmt.Sprintf("Unknown action received: %s", string(e.Data)))
 	}
-	dashboard, err := getRemoteDashboard(response.UID)
+	dashboard, err := getRemoteDashboard(h.ctx, h.endpoint, response.UID)
 	if err != nil {
 		h.notifier.Error(nil, fmt.Sprintf("Error: %s", err))
 		return
@@ -82,14 +86,16 @@ func (h *eventHandler) WaitForStop() {
 		}
 	}
 }
-func watchDashboard(notifier grizzly.Notifier, UID, filename string) error {
-	wsURL, token, err := getWSGrafanaURL("live/ws?format=json")
+func watchDashboard(ctx context.Context, endpoint *grizzly.Endpoint, notifier grizzly.Notifier, UID, filename string) error {
+	wsURL, token, err := getWSGrafanaURL(endpoint, "live/ws?format=json")
 	if err != nil {
 		return err
 	}
 
 	c := centrifuge.New(wsURL, centrifuge.DefaultConfig())
 	handler := &eventHandler{
+		ctx:      ctx,
+		endpoint: endpoint,
 		filename: filename,
 		url:      wsURL,
 		notifier: notifier,
@@ -130,5 +136,6 @@ func watchDashboard(notifier grizzly.Notifier, UID, filename string) error {
 
 	go handler.WaitForStop()
 	// Run until CTRL+C.
-	select {}
+	<-ctx.Done()
+	return c.Close()
 }
@@ -2,25 +2,47 @@ package grafana
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 )
 
 const folderNameField = "folderName"
 
+// folderMutex serialises finding or creating folders
+var folderMutex sync.Mutex
+
+// dashboardServerFields are set by Grafana when a dashboard is saved
+var dashboardServerFields = []string{"id", "version", "iteration"}
+
 // getRemoteDashboard retrieves a dashboard object from Grafana
-func getRemoteDashboard(uid string) (*Dashboard, error) {
-	grafanaURL, err := getGrafanaURL("api/dashboards/uid/" + uid)
+func getRemoteDashboard(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*Dashboard, error) {
+	board, err := getVersionedDashboard(ctx, endpoint, uid)
 	if err != nil {
 		return nil, err
 	}
+	delete(*board, "version")
+	return board, nil
+}
 
-	resp, err := http.Get(grafanaURL)
+// getVersionedDashboard retrieves a dashboard object from Grafana, along with
+// its version
+func getVersionedDashboard(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*Dashboard, error) {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/dashboards/uid/"+uid)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := grafanaGet(ctx, endpoint, grafanaURL)
 	if err != nil {
 		return nil, err
 	}
@@ -45,19 +67,62 @@ func getRemoteDashboard(uid string) (*Dashboard, error) {
 		return nil, grizzly.APIErr{Err: err, Body: data}
 	}
 	delete(d.Dashboard, "id")
-	delete(d.Dashboard, "version")
-	d.Dashboard[folderNameField] = d.Meta.FolderTitle
+	folderName, err := folderPath(ctx, endpoint, d.Meta.FolderUID, d.Meta.FolderTitle)
+	if err != nil {
+		return nil, err
+	}
+	d.Dashboard[folderNameField] = folderName
 	return &d.Dashboard, nil
 }
 
-func postDashboard(board Dashboard) error {
-	grafanaURL, err := getGrafanaURL("api/dashboards/db")
+// deleteDashboard removes a dashboard from Grafana
+func deleteDashboard(ctx context.Context, endpoint *grizzly.Endpoint, uid string) error {
+	return requestJSON(ctx, endpoint, "DELETE", "api/dashboards/uid/"+uid, nil, nil)
+}
+
+// dashboardSearchLimit is the number of dashboards requested per search page
+const dashboardSearchLimit = 1000
+
+// DashboardSearchHit is a dashboard found by the Grafana search API
+type DashboardSearchHit struct {
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	FolderUID   string   `json:"folderUid"`
+	FolderTitle string   `json:"folderTitle"`
+	Tags        []string `json:"tags"`
+}
+
+// searchDashboards lists the dashboards within a folder, or within all folders
+// if folderID is negative, requesting as many pages as needed
+func searchDashboards(ctx context.Context, endpoint *grizzly.Endpoint, folderID int64) ([]DashboardSearchHit, error) {
+	hits := []DashboardSearchHit{}
+	for page := 1; ; page++ {
+		query := url.Values{}
+		query.Set("type", "dash-db")
+		query.Set("limit", strconv.Itoa(dashboardSearchLimit))
+		query.Set("page", strconv.Itoa(page))
+		if folderID >= 0 {
+			query.Set("folderIds", strconv.FormatInt(folderID, 10))
+		}
+		var pageHits []DashboardSearchHit
+		if err := requestJSON(ctx, endpoint, "GET", "api/search?"+query.Encode(), nil, &pageHits); err != nil {
+			return nil, err
+		}
+		hits = append(hits, pageHits...)
+		if len(pageHits) < dashboardSearchLimit {
+			return hits, nil
+		}
+	}
+}
+
+func postDashboard(ctx context.Context, endpoint *grizzly.Endpoint, board Dashboard) error {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/dashboards/db")
 	if err != nil {
 		return err
 	}
 
 	folderUID := board.folderUID()
-	folderID, err := findOrCreateFolder(folderUID)
+	folderID, err := findOrCreateFolder(ctx, endpoint, folderUID)
 	if err != nil {
 		return err
 	}
@@ -65,33 +130,21 @@ func postDashboard(board Dashboard) error {
 	wrappedBoard := DashboardWrapper{
 		Dashboard: board,
 		FolderID:  folderID,
-		Overwrite: true,
+		// dashboards replacing a remote version are only saved if that
+		// version is still the latest
+		Overwrite: board["version"] == nil,
 	}
 	wrappedJSON, err := wrappedBoard.toJSON()
-
-	resp, err := http.Post(grafanaURL, "application/json", bytes.NewBufferString(wrappedJSON))
 	if err != nil {
 		return err
 	}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		break
-	case http.StatusPreconditionFailed:
-		d := json.NewDecoder(resp.Body)
-		var r struct {
-			Message string `json:"message"`
-		}
-		if err := d.Decode(&r); err != nil {
-			return fmt.Errorf("Failed to decode actual error (412 Precondition failed): %s", err)
-		}
-		fmt.Println(wrappedJSON)
-		return fmt.Errorf("Error while applying '%s' to Grafana: %s", board.UID(), r.Message)
-	default:
-		return fmt.Errorf("Non-200 response from Grafana while applying '%s': %s", resp.Status, board.UID())
+	resp, err := grafanaPost(ctx, endpoint, grafanaURL, "application/json", bytes.NewBufferString(wrappedJSON))
+	if err != nil {
+		return err
 	}
-
-	return nil
+	defer resp.Body.Close()
+	return pushErr(resp, board.UID())
 }
 
 // SnapshotResp encapsulates the response to a snapshot request
@@ -102,19 +155,22 @@ type SnapshotResp struct {
 	URL       string `json:"url"`
 }
 
-func postSnapshot(board Dashboard, opts *grizzly.PreviewOpts) (*SnapshotResp, error) {
+func postSnapshot(ctx context.Context, endpoint *grizzly.Endpoint, board Dashboard, opts *grizzly.PreviewOpts) (*SnapshotResp, error) {
 
-	url, err := getGrafanaURL("api/snapshots")
+	url, err := getGrafanaURL(endpoint, "api/snapshots")
 	if err != nil {
 		return nil, err
 	}
 	type SnapshotReq struct {
 		Dashboard map[string]interface{} `json:"dashboard"`
+		Name      string                 `json:"name"`
 		Expires   int                    `json:"expires,omitempty"`
 	}
 
+	title, _ := board["title"].(string)
 	sr := &SnapshotReq{
 		Dashboard: board,
+		Name:      snapshotNamePrefix + title,
 	}
 
 	if opts.ExpiresSeconds > 0 {
@@ -126,7 +182,7 @@ func postSnapshot(board Dashboard, opts *grizzly.PreviewOpts) (*SnapshotResp, er
 		return nil, err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(bs))
+	resp, err := grafanaPost(ctx, endpoint, url, "application/json", bytes.NewBuffer(bs))
 	if err != nil {
 		return nil, err
 	}
@@ -191,6 +247,23 @@ func dashboardWithFolderSet(resource grizzly.Resource, dashboardFolder string) g
 	return resource
 }
 
+// dashboardWithoutFolder returns a dashboard without the folder grizzly sets,
+// for Grafana to read as is
+func dashboardWithoutFolder(resource grizzly.Resource) Dashboard {
+	board := Dashboard{}
+	for k, v := range newDashboard(resource) {
+		if k != folderNameField {
+			board[k] = v
+		}
+	}
+	return board
+}
+
+// isGeneralFolder identifies the folder UIDs standing for the General folder
+func isGeneralFolder(UID string) bool {
+	return UID == "" || UID == "0" || UID == "general"
+}
+
 // DashboardWrapper adds wrapper to a dashboard JSON. Caters both for Grafana's POST
 // API as well as GET which require different JSON.
 type DashboardWrapper struct {
@@ -199,6 +272,7 @@ type DashboardWrapper struct {
 	Overwrite bool      `json:"overwrite"`
 	Meta      struct {
 		FolderID    int64  `json:"folderId"`
+		FolderUID   string `json:"folderUid"`
 		FolderTitle string `json:"folderTitle"`
 	} `json:"meta"`
 }
@@ -210,7 +284,6 @@ func (d *DashboardWrapper) UID() string {
 
 // toJSON returns JSON expected by Grafana API
 func (d *DashboardWrapper) toJSON() (string, error) {
-	d.Overwrite = true
 	j, err := json.MarshalIndent(d, "", "  ")
 	if err != nil {
 		return "", err
@@ -220,9 +293,12 @@ func (d *DashboardWrapper) toJSON() (string, error) {
 
 // Folder encapsulates a dashboard folder object from the Grafana API
 type Folder struct {
-	ID    int64  `json:"id"`
-	UID   string `json:"uid"`
-	Title string `json:"title"`
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	ParentUID string `json:"parentUid,omitempty"`
+	// Parents are the folders a nested folder is within, outermost first
+	Parents []Folder `json:"parents,omitempty"`
 }
 
 // toJSON returns JSON expected by Grafana API
@@ -234,62 +310,131 @@ func (f *Folder) toJSON() (string, error) {
 	return string(j), nil
 }
 
-func findOrCreateFolder(UID string) (int64, error) {
-	if UID == "0" || UID == "" {
+// folderPathSeparator separates the top level folder from the titles of the
+// folders nested within it in the folder name of a dashboard, e.g.
+// "team-a/Payments"
+const folderPathSeparator = "/"
+
+// folderPath returns the folder name of a remote dashboard, as resolveFolder
+// reads it: the UID of its top level folder, followed by the titles of the
+// folders nested within it
+func folderPath(ctx context.Context, endpoint *grizzly.Endpoint, UID, title string) (string, error) {
+	if UID == "" {
+		return title, nil
+	}
+	var folder Folder
+	if err := requestJSON(ctx, endpoint, "GET", "api/folders/"+UID, nil, &folder); err != nil {
+		return "", fmt.Errorf("Error retrieving folder %s: %v", UID, err)
+	}
+	if len(folder.Parents) == 0 {
+		return folder.UID, nil
+	}
+	names := []string{folder.Parents[0].UID}
+	for _, parent := range folder.Parents[1:] {
+		names = append(names, parent.Title)
+	}
+	return strings.Join(append(names, folder.Title), folderPathSeparator), nil
+}
+
+// getFolderID retrieves the ID of an existing folder, 0 being the General folder
+func getFolderID(ctx context.Context, endpoint *grizzly.Endpoint, name string) (int64, error) {
+	if name == "0" || name == "" {
 		return 0, nil
 	}
-	grafanaURL, err := getGrafanaURL("api/folders/" + UID)
+	folder, err := resolveFolder(ctx, endpoint, name, false)
 	if err != nil {
 		return 0, err
 	}
-	resp, err := http.Get(grafanaURL)
+	return folder.ID, nil
+}
+
+func findOrCreateFolder(ctx context.Context, endpoint *grizzly.Endpoint, name string) (int64, error) {
+	if name == "0" || name == "" {
+		return 0, nil
+	}
+	// dashboards applied in parallel must not race to create their folder
+	folderMutex.Lock()
+	defer folderMutex.Unlock()
+	folder, err := resolveFolder(ctx, endpoint, name, true)
 	if err != nil {
 		return 0, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return 0, err
+	return folder.ID, nil
+}
+
+// resolveFolder finds the folder a folder name stands for. The first element
+// of the name is the UID of a top level folder, and any further elements the
+// titles of the folders nested within it. Missing folders are created if
+// create is set, titled after their UID at the top level.
+func resolveFolder(ctx context.Context, endpoint *grizzly.Endpoint, name string, create bool) (*Folder, error) {
+	titles := strings.Split(name, folderPathSeparator)
+	folder := &Folder{}
+	err := requestJSON(ctx, endpoint, "GET", "api/folders/"+titles[0], nil, folder)
+	if err == grizzly.ErrNotFound && create {
+		folder, err = createFolder(ctx, endpoint, Folder{UID: titles[0], Title: titles[0]})
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, title := range titles[1:] {
+		child, err := getChildFolder(ctx, endpoint, folder.UID, title)
+		if err == grizzly.ErrNotFound && create {
+			child, err = createFolder(ctx, endpoint, Folder{Title: title, ParentUID: folder.UID})
 		}
-		var folder Folder
-		if err := json.Unmarshal([]byte(string(body)), &folder); err != nil {
-			return 0, err
+		if err != nil {
+			return nil, err
 		}
-		return folder.ID, nil
-
-	} else if resp.StatusCode == 404 {
-		return createFolder(UID)
-
-	} else {
-		return 0, fmt.Errorf("Getting folder %s returned error %d", UID, resp.StatusCode)
+		folder = child
 	}
+	return folder, nil
 }
 
-func createFolder(UID string) (int64, error) {
-	grafanaURL, err := getGrafanaURL("api/folders")
-	if err != nil {
-		return 0, err
+// getChildFolder retrieves a folder nested within another, by title
+func getChildFolder(ctx context.Context, endpoint *grizzly.Endpoint, parentUID, title string) (*Folder, error) {
+	query := url.Values{}
+	query.Set("parentUid", parentUID)
+	query.Set("limit", "1000")
+	var children []Folder
+	if err := requestJSON(ctx, endpoint, "GET", "api/folders?"+query.Encode(), nil, &children); err != nil {
+		return nil, err
 	}
-	folder := Folder{
-		UID:   UID,
-		Title: UID,
+	for _, child := range children {
+		if child.Title == title {
+			return &child, nil
+		}
 	}
+	return nil, grizzly.ErrNotFound
+}
 
+func createFolder(ctx context.Context, endpoint *grizzly.Endpoint, folder Folder) (*Folder, error) {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/folders")
+	if err != nil {
+		return nil, err
+	}
 	folderJSON, err := folder.toJSON()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	resp, err := http.Post(grafanaURL, "application/json", bytes.NewBufferString(folderJSON))
+	resp, err := grafanaPost(ctx, endpoint, grafanaURL, "application/json", bytes.NewBufferString(folderJSON))
 	if err != nil {
-		return 0, err
-	} else if resp.StatusCode >= 400 {
-		return 0, fmt.Errorf("Non-200 response from Grafana while applying folder %s: %s", UID, resp.Status)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("Non-200 response from Grafana while applying folder %s: %s", folder.Title, resp.Status)
 	}
 	body, err := ioutil.ReadAll(resp.Body)
-	if err := json.Unmarshal([]byte(string(body)), &folder); err != nil {
-		return 0, err
+	if err != nil {
+		return nil, err
 	}
-
-	return folder.ID, nil
+	created := &Folder{}
+	if err := json.Unmarshal(body, created); err != nil {
+		return nil, err
+	}
+	// Grafana without nested folders ignores the parent, and creates the
+	// folder at the top level
+	if folder.ParentUID != "" && created.ParentUID != folder.ParentUID {
+		return nil, fmt.Errorf("Folder %s was not created within folder %s, are nested folders enabled in Grafana?", folder.Title, folder.ParentUID)
+	}
+	return created, nil
 }
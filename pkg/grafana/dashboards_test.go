@@ -0,0 +1,1169 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grafanatest"
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestValidateDashboard(t *testing.T) {
+	tests := map[string]struct {
+		dashboard string
+		errs      []string
+	}{
+		"valid": {
+			dashboard: `{
+				"uid": "prod-overview", "title": "Production Overview", "tags": ["prod"],
+				"time": {"from": "now-6h", "to": "now"},
+				"panels": [
+					{"type": "graph", "gridPos": {"h": 8, "w": 12, "x": 12, "y": 0}, "targets": [{"refId": "A"}, {"refId": "B"}]},
+					{"type": "row", "collapsed": true, "panels": [{"type": "stat", "datasource": null}]}
+				],
+				"templating": {"list": [{"name": "cluster", "type": "query"}]},
+				"annotations": {"list": [{"name": "Deploys", "enable": true}]}
+			}`,
+		},
+		"missing fields": {
+			dashboard: `{"title": ""}`,
+			errs: []string{
+				"missing required field uid",
+				"title: must not be empty",
+			},
+		},
+		"invalid panels": {
+			dashboard: `{
+				"uid": "prod-overview", "title": "Production Overview",
+				"panels": [
+					{"type": "graph", "gridPos": {"h": 8, "w": 12, "x": 18, "y": 0}, "targets": [{"refId": "A"}, {"refId": "A"}]},
+					{"title": 1},
+					{"type": "row", "panels": ["graph"]}
+				]
+			}`,
+			errs: []string{
+				"panels[0].gridPos: panel exceeds the grid width of 24 (x=18, w=12)",
+				"panels[0].targets[1].refId: duplicate refId A, also used by panels[0].targets[0]",
+				"panels[1].title: expected string, got number",
+				"panels[1]: missing required field type",
+				"panels[2].panels[0]: expected object, got string",
+			},
+		},
+		"invalid templating": {
+			dashboard: `{
+				"uid": "prod-overview", "title": "Production Overview",
+				"templating": {"list": [{"name": "cluster", "type": "query"}, {"name": "cluster", "type": "dropdown"}]}
+			}`,
+			errs: []string{
+				"templating.list[1].name: duplicate variable cluster, also defined by templating.list[0]",
+				"templating.list[1].type: unknown variable type dropdown, expected query, custom, constant, datasource, interval, textbox or adhoc",
+			},
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		board := Dashboard{}
+		if err := json.Unmarshal([]byte(test.dashboard), &board); err != nil {
+			t.Fatalf("Invalid test dashboard: %s", err)
+		}
+		errs := validateDashboard(board)
+		if len(errs) != len(test.errs) {
+			t.Errorf("Expected %d errors, got: %v", len(test.errs), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != test.errs[i] {
+				t.Errorf("Expected error %q, got: %q", test.errs[i], err)
+			}
+		}
+	}
+}
+
+func TestLintDashboard(t *testing.T) {
+	tests := map[string]struct {
+		dashboard string
+		errs      []string
+	}{
+		"clean": {
+			dashboard: `{
+				"templating": {"list": [{"name": "datasource", "type": "datasource"}]},
+				"panels": [{"type": "graph", "title": "Requests", "datasource": "$datasource", "targets": [{"expr": "sum(rate(requests_total[$__rate_interval]))"}]}]
+			}`,
+		},
+		"problems": {
+			dashboard: `{
+				"panels": [
+					{"type": "graph", "datasource": "Prometheus", "targets": [{"expr": "sum(rate(requests_total{job=\"api\"}[5m])) / sum(increase(errors_total[1h]))"}]},
+					{"type": "row", "panels": [{"type": "stat", "title": "Errors", "datasource": {"uid": "prom"}}]}
+				]
+			}`,
+			errs: []string{
+				"template-datasource-rule: dashboard has no datasource template variable",
+				"panels[0]: panel-datasource-rule: datasource should be a template variable, got Prometheus",
+				"panels[0]: panel-title-rule: panel has no title",
+				"panels[0]: target-rate-interval-rule: targets[0]: rate() should use $__rate_interval, got [5m]",
+				"panels[0]: target-rate-interval-rule: targets[0]: increase() should use $__rate_interval, got [1h]",
+				"panels[1].panels[0]: panel-datasource-rule: datasource should be a template variable, got prom",
+			},
+		},
+		"disabled rules": {
+			dashboard: `{
+				"lintDisable": ["template-datasource-rule"],
+				"panels": [
+					{"type": "graph", "lintDisable": ["panel-title-rule", "target-rate-interval-rule"], "targets": [{"expr": "rate(requests_total[5m])"}]},
+					{"type": "graph", "targets": [{"expr": "rate(requests_total[5m])"}]}
+				]
+			}`,
+			errs: []string{
+				"panels[1]: panel-title-rule: panel has no title",
+				"panels[1]: target-rate-interval-rule: targets[0]: rate() should use $__rate_interval, got [5m]",
+			},
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		board := Dashboard{}
+		if err := json.Unmarshal([]byte(test.dashboard), &board); err != nil {
+			t.Fatalf("Invalid test dashboard: %s", err)
+		}
+		errs := lintDashboard(board)
+		if len(errs) != len(test.errs) {
+			t.Errorf("Expected %d problems, got: %v", len(test.errs), errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != test.errs[i] {
+				t.Errorf("Expected problem %q, got: %q", test.errs[i], err)
+			}
+		}
+	}
+}
+
+func TestMergeDashboard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	h := NewDashboardHandler(nil)
+	resource := func(detail string) grizzly.Resource {
+		board := Dashboard{}
+		if err := json.Unmarshal([]byte(detail), &board); err != nil {
+			t.Fatalf("Invalid test dashboard: %s", err)
+		}
+		return grizzly.Resource{UID: "board", Handler: h, Detail: board}
+	}
+	remote := resource(`{"id": 12, "version": 3, "uid": "board", "title": "Old", "tags": ["ui"], "timezone": "utc", "time": {"from": "now-6h", "to": "now"}}`)
+
+	state, err := grizzly.LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Record(resource(`{"uid": "board", "title": "Old", "tags": ["ui"], "time": {"from": "now-6h", "to": "now"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	state, err = grizzly.LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := state.Merge(h, remote, resource(`{"uid": "board", "title": "New", "time": {"from": "now-1h"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := resource(`{"uid": "board", "title": "New", "timezone": "utc", "time": {"from": "now-1h"}}`)
+	if !reflect.DeepEqual(merged.Detail, expected.Detail) {
+		t.Errorf("Expected merged dashboard %v, got: %v", expected.Detail, merged.Detail)
+	}
+	if board := remote.Detail.(Dashboard); board["id"] != float64(12) {
+		t.Errorf("Expected remote dashboard to be left unchanged, got: %v", board)
+	}
+}
+
+func TestSearchDashboards(t *testing.T) {
+	total := dashboardSearchLimit + 10
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		query := r.URL.Query()
+		if r.URL.Path != "/api/search" || query.Get("folderIds") != "3" {
+			t.Errorf("Unexpected request: %s", r.URL)
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		hits := []DashboardSearchHit{}
+		for i := (page - 1) * dashboardSearchLimit; i < total && i < page*dashboardSearchLimit; i++ {
+			hits = append(hits, DashboardSearchHit{UID: fmt.Sprintf("board-%d", i)})
+		}
+		json.NewEncoder(w).Encode(hits)
+	}))
+	defer server.Close()
+
+	hits, err := searchDashboards(context.Background(), &grizzly.Endpoint{URL: server.URL}, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != total || requests != 2 {
+		t.Errorf("Expected %d dashboards in 2 requests, got %d in %d", total, len(hits), requests)
+	}
+	if last := hits[len(hits)-1].UID; last != fmt.Sprintf("board-%d", total-1) {
+		t.Errorf("Expected last dashboard board-%d, got: %s", total-1, last)
+	}
+}
+
+func TestDashboardToGrafonnet(t *testing.T) {
+	board := Dashboard{}
+	err := json.Unmarshal([]byte(`{
+		"id": 3, "uid": "board", "title": "Board", "graphTooltip": 2, "style": "light",
+		"templating": {"list": [{"name": "job", "type": "query", "datasource": "$datasource", "query": "label_values(job)", "refresh": 1, "hide": 2}]},
+		"panels": [
+			{"id": 1, "type": "graph", "title": "Requests", "datasource": "$datasource", "gridPos": {"h": 8, "w": 12, "x": 0, "y": 0},
+			 "targets": [{"expr": "up", "refId": "A"}, {"expr": "down", "refId": "C"}]},
+			{"id": 2, "type": "piechart", "title": "Pie"}
+		]
+	}`), &board)
+	if err != nil {
+		t.Fatalf("Invalid test dashboard: %s", err)
+	}
+	locals, body := dashboardToGrafonnet(board)
+	expectedLocals := `local grafana = import 'grafonnet/grafana.libsonnet';
+local dashboard = grafana.dashboard;
+local graphPanel = grafana.graphPanel;
+local prometheus = grafana.prometheus;
+local template = grafana.template;`
+	if locals != expectedLocals {
+		t.Errorf("Expected locals:\n%s\ngot:\n%s", expectedLocals, locals)
+	}
+	expectedBody := `dashboard.new(
+"Board",
+uid="board",
+graphTooltip="shared_tooltip",
+)
+.addTemplates([
+template.new(
+"job",
+"$datasource",
+"label_values(job)",
+hide="variable",
+refresh="load",
+),
+])
+.addPanel(
+graphPanel.new(
+"Requests",
+datasource="$datasource",
+)
+.addTargets([
+prometheus.target(
+"up",
+),
+prometheus.target(
+"down",
+)
++ {
+"refId": "C",
+},
+]),
+gridPos={"h":8,"w":12,"x":0,"y":0},
+)
+.addPanel(
+{"title":"Pie","type":"piechart"},
+)
++ {
+"style": "light",
+}`
+	if body != expectedBody {
+		t.Errorf("Expected grafonnet:\n%s\ngot:\n%s", expectedBody, body)
+	}
+}
+
+func TestOverwritesDashboard(t *testing.T) {
+	h := NewDashboardHandler(nil)
+	resource := func(detail string) grizzly.Resource {
+		board := Dashboard{}
+		if err := json.Unmarshal([]byte(detail), &board); err != nil {
+			t.Fatalf("Invalid test dashboard: %s", err)
+		}
+		return grizzly.Resource{UID: "board", Handler: h, Detail: board}
+	}
+	state, err := grizzly.LoadState(filepath.Join(os.TempDir(), "unused.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Record(resource(`{"uid": "board", "title": "Old", "tags": ["team"]}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Name     string
+		Remote   string
+		Local    string
+		Expected bool
+	}{
+		{
+			Name:   "unchanged remotely",
+			Remote: `{"id": 12, "version": 3, "uid": "board", "title": "Old", "tags": ["team"]}`,
+			Local:  `{"uid": "board", "title": "New", "tags": ["team"]}`,
+		},
+		{
+			Name:   "field added remotely",
+			Remote: `{"id": 12, "version": 4, "uid": "board", "title": "Old", "tags": ["team"], "timezone": "utc"}`,
+			Local:  `{"uid": "board", "title": "New", "tags": ["team"]}`,
+		},
+		{
+			Name:     "applied field changed remotely",
+			Remote:   `{"id": 12, "version": 4, "uid": "board", "title": "Edited", "tags": ["team"]}`,
+			Local:    `{"uid": "board", "title": "New", "tags": ["team"]}`,
+			Expected: true,
+		},
+		{
+			Name:   "applied field changed to local value",
+			Remote: `{"id": 12, "version": 4, "uid": "board", "title": "New", "tags": ["team"]}`,
+			Local:  `{"uid": "board", "title": "New", "tags": ["team"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		overwrites, err := state.Overwrites(h, resource(test.Remote), resource(test.Local))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overwrites != test.Expected {
+			t.Errorf("Expected overwrites %t, got %t", test.Expected, overwrites)
+		}
+	}
+}
+
+func TestMarkDashboard(t *testing.T) {
+	h := NewDashboardHandler(nil)
+	tests := map[string]struct {
+		dashboard  string
+		wasMarked  bool
+		marked     string
+		unprepared string
+	}{
+		"no tags": {
+			dashboard:  `{"uid": "board"}`,
+			marked:     `{"uid": "board", "tags": ["managed-by:grizzly", "grizzly-source:main.jsonnet"]}`,
+			unprepared: `{"uid": "board"}`,
+		},
+		"tags": {
+			dashboard:  `{"uid": "board", "tags": ["prod"]}`,
+			marked:     `{"uid": "board", "tags": ["prod", "managed-by:grizzly", "grizzly-source:main.jsonnet"]}`,
+			unprepared: `{"uid": "board", "tags": ["prod"]}`,
+		},
+		"marked from another source": {
+			dashboard:  `{"uid": "board", "tags": ["grizzly-source:old.jsonnet", "prod", "managed-by:grizzly"]}`,
+			wasMarked:  true,
+			marked:     `{"uid": "board", "tags": ["prod", "managed-by:grizzly", "grizzly-source:main.jsonnet"]}`,
+			unprepared: `{"uid": "board", "tags": ["prod"]}`,
+		},
+	}
+	for name, test := range tests {
+		t.Logf("Running test case, %q...", name)
+		parse := func(detail string) Dashboard {
+			board := Dashboard{}
+			if err := json.Unmarshal([]byte(detail), &board); err != nil {
+				t.Fatalf("Invalid test dashboard: %s", err)
+			}
+			return board
+		}
+		resource := grizzly.Resource{UID: "board", Handler: h, Detail: parse(test.dashboard)}
+		if h.Marked(resource) != test.wasMarked {
+			t.Errorf("Expected %s to be marked: %v", test.dashboard, test.wasMarked)
+		}
+		marked := h.Mark(resource, "main.jsonnet")
+		if expected := parse(test.marked); !reflect.DeepEqual(marked.Detail, expected) {
+			t.Errorf("Expected marked dashboard %v, got: %v", expected, marked.Detail)
+		}
+		if !h.Marked(marked) {
+			t.Errorf("Expected %v to be marked", marked.Detail)
+		}
+		if expected, unprepared := parse(test.unprepared), h.Unprepare(marked); !reflect.DeepEqual(unprepared.Detail, expected) {
+			t.Errorf("Expected unprepared dashboard %v, got: %v", expected, unprepared.Detail)
+		}
+	}
+}
+
+func TestDashboardHandlerApply(t *testing.T) {
+	tests := map[string]struct {
+		existing  map[string]interface{}
+		dashboard Dashboard
+		fail      int
+		err       string
+		folder    string
+	}{
+		"add to a new folder": {
+			dashboard: Dashboard{"uid": "board", "title": "Board", folderNameField: "team"},
+			folder:    "team",
+		},
+		"add to the general folder": {
+			dashboard: Dashboard{"uid": "board", "title": "Board"},
+			folder:    "",
+		},
+		"update": {
+			existing:  map[string]interface{}{"uid": "board", "title": "Old"},
+			dashboard: Dashboard{"uid": "board", "title": "Board", folderNameField: "team"},
+			folder:    "team",
+		},
+		"add to a nested folder": {
+			dashboard: Dashboard{"uid": "board", "title": "Board", folderNameField: "team/Payments"},
+			folder:    "payments",
+		},
+		"move to a nested folder": {
+			existing:  map[string]interface{}{"uid": "board", "title": "Old"},
+			dashboard: Dashboard{"uid": "board", "title": "Board", folderNameField: "team/Payments"},
+			folder:    "payments",
+		},
+		"conflict": {
+			dashboard: Dashboard{"uid": "board", "title": "Board"},
+			fail:      http.StatusPreconditionFailed,
+			err:       "Error while applying 'board' to Grafana: A dashboard with the same name in the folder already exists: conflict",
+		},
+		"server error": {
+			dashboard: Dashboard{"uid": "board", "title": "Board"},
+			fail:      http.StatusInternalServerError,
+			err:       "Non-200 response from Grafana while applying '500 Internal Server Error': board",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		h := NewDashboardHandler(server.Endpoint())
+		ctx := context.Background()
+		server.AddFolder("team", "team")
+		server.AddNestedFolder("team", "payments", "Payments")
+		if test.existing != nil {
+			server.AddDashboard("team", test.existing)
+		}
+		if test.fail != 0 {
+			server.Fail("POST", "/api/dashboards/db", test.fail, "A dashboard with the same name in the folder already exists")
+		}
+
+		resource := h.newDashboardResource(dashboardsPath, "board", "", test.dashboard)
+		existing, err := h.GetRemote(ctx, "board")
+		switch {
+		case err == grizzly.ErrNotFound:
+			err = h.Add(ctx, resource)
+		case err == nil:
+			err = h.Update(ctx, *existing, resource)
+		}
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error applying dashboard: %v", err)
+		}
+		board, folder, ok := server.Dashboard("board")
+		if !ok || board["title"] != "Board" || folder != test.folder {
+			t.Errorf("Expected dashboard Board in folder %q, got: %v in %q", test.folder, board, folder)
+		}
+		remote, err := h.GetRemote(ctx, "board")
+		if err != nil {
+			t.Errorf("Unexpected error retrieving dashboard: %v", err)
+		} else if title := remote.Detail.(Dashboard)["title"]; title != "Board" {
+			t.Errorf("Expected title Board, got: %v", title)
+		}
+		server.Close()
+	}
+}
+
+func TestApplyNestedFolders(t *testing.T) {
+	server := grafanatest.NewServer()
+	defer server.Close()
+	// folder names start with the UID of the top level folder, not its title
+	server.AddFolder("team", "Team A")
+	client, err := grizzly.NewClient(grizzly.ClientOpts{
+		Providers: []grizzly.Provider{&Provider{Grafana: server.Endpoint()}},
+		Output:    ioutil.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := client.Registry().GetHandler("dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	resources := func(folder string) grizzly.Resources {
+		resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+			"board.json": map[string]interface{}{"uid": "board", "title": "Board", folderNameField: folder},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return grizzly.Resources{handler: resourceList}
+	}
+
+	for _, folder := range []string{"team", "team/Payments/EU", "team/Checkout"} {
+		if err := client.Diff(ctx, resources(folder), nil); err != nil && err != grizzly.ErrChangesDetected {
+			t.Fatalf("Unexpected error diffing: %v", err)
+		}
+		if err := client.Apply(ctx, resources(folder), &grizzly.ApplyOpts{AutoApprove: true}); err != nil {
+			t.Fatalf("Unexpected error applying to %s: %v", folder, err)
+		}
+		remote, err := handler.GetRemote(ctx, "board")
+		if err != nil {
+			t.Fatalf("Unexpected error retrieving dashboard: %v", err)
+		}
+		if name := remote.Detail.(Dashboard)[folderNameField]; name != folder {
+			t.Errorf("Expected dashboard in folder %s, got: %v", folder, name)
+		}
+		if err := client.Diff(ctx, resources(folder), nil); err != nil {
+			t.Errorf("Expected no changes once applied to %s, got: %v", folder, err)
+		}
+	}
+	if err := client.Diff(ctx, resources("team/Payments"), nil); err != grizzly.ErrChangesDetected {
+		t.Errorf("Expected a move between folders to be detected, got: %v", err)
+	}
+}
+
+func TestDashboardHandlerRemote(t *testing.T) {
+	server := grafanatest.NewServer()
+	defer server.Close()
+	h := NewDashboardHandler(server.Endpoint())
+	ctx := context.Background()
+	server.AddFolder("team", "Team")
+	server.AddDashboard("team", map[string]interface{}{"uid": "a", "title": "A", "tags": []string{"prod"}})
+	server.AddDashboard("", map[string]interface{}{"uid": "b", "title": "B"})
+
+	if _, err := h.GetRemote(ctx, "missing"); err != grizzly.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	if err := h.Delete(ctx, "missing"); err != grizzly.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting, got: %v", err)
+	}
+
+	local := h.newDashboardResource(dashboardsPath, "a", "", Dashboard{"uid": "a", folderNameField: "team"})
+	remote, err := h.ListRemote(ctx, grizzly.ResourceList{local.Key(): local})
+	if err != nil {
+		t.Fatalf("Unexpected error listing dashboards: %v", err)
+	}
+	if len(remote) != 1 {
+		t.Errorf("Expected the dashboard of folder team only, got: %v", remote)
+	}
+	for _, resource := range remote {
+		if tags := resource.Detail.(Dashboard)["tags"]; !reflect.DeepEqual(tags, []interface{}{"prod"}) {
+			t.Errorf("Expected tags [prod], got: %v", tags)
+		}
+	}
+	summaries, err := h.ListAll(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error listing all dashboards: %v", err)
+	}
+	expected := []grizzly.ResourceSummary{{UID: "a", Title: "A", Folder: "Team"}, {UID: "b", Title: "B", Folder: "General"}}
+	if !reflect.DeepEqual(summaries, expected) {
+		t.Errorf("Expected %v, got: %v", expected, summaries)
+	}
+
+	if err := h.Delete(ctx, "a"); err != nil {
+		t.Errorf("Unexpected error deleting dashboard: %v", err)
+	}
+	if _, _, ok := server.Dashboard("a"); ok {
+		t.Errorf("Expected dashboard a to be deleted")
+	}
+}
+
+func TestApplyReferences(t *testing.T) {
+	tests := map[string]struct {
+		datasource Datasource
+		target     string
+		expected   string
+	}{
+		"uid assigned by grafana": {
+			datasource: Datasource{"name": "loki-prod", "type": "loki", "url": "http://loki:3100"},
+			target:     "${datasource:loki-prod}",
+			expected:   "generated-1",
+		},
+		"uid set": {
+			datasource: Datasource{"name": "loki-prod", "type": "loki", "url": "http://loki:3100", "uid": "logs"},
+			target:     "${datasource:loki-prod}",
+			expected:   "logs",
+		},
+		"reference to a dashboard": {
+			datasource: Datasource{"name": "loki-prod", "type": "loki", "url": "http://loki:3100"},
+			target:     "/d/${dashboard:logs}",
+			expected:   "/d/logs",
+		},
+		"template variable": {
+			datasource: Datasource{"name": "loki-prod", "type": "loki", "url": "http://loki:3100"},
+			target:     "${servers:csv}",
+			expected:   "${servers:csv}",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		var output bytes.Buffer
+		client, err := grizzly.NewClient(grizzly.ClientOpts{
+			Providers: []grizzly.Provider{&Provider{Grafana: server.Endpoint()}},
+			Output:    &output,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources := grizzly.Resources{}
+		for kind, detail := range map[string]map[string]interface{}{
+			"datasource": {"loki-prod": map[string]interface{}(test.datasource)},
+			"dashboard": {"logs.json": map[string]interface{}{
+				"uid": "logs", "title": "Logs",
+				"panels": []interface{}{map[string]interface{}{"type": "logs", "datasource": map[string]interface{}{"uid": test.target}}},
+			}},
+		} {
+			handler, err := client.Registry().GetHandler(kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resources[handler], err = handler.Parse(handler.GetJSONPaths()[0], detail)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := client.Apply(context.Background(), resources, &grizzly.ApplyOpts{AutoApprove: true}); err != nil {
+			t.Fatalf("Unexpected error applying: %v", err)
+		}
+		model, _, ok := server.Dashboard("logs")
+		if !ok {
+			t.Fatalf("Expected dashboard logs to be applied")
+		}
+		panel := model["panels"].([]interface{})[0].(map[string]interface{})
+		if uid := panel["datasource"].(map[string]interface{})["uid"]; uid != test.expected {
+			t.Errorf("Expected datasource %s, got: %v", test.expected, uid)
+		}
+		output.Reset()
+		client.Diff(context.Background(), resources, nil)
+		if !strings.Contains(output.String(), "grafanaDashboards/logs no differences") {
+			t.Errorf("Expected no differences in the dashboard once applied, got: %s", output.String())
+		}
+		server.Close()
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	server := grafanatest.NewServer()
+	defer server.Close()
+	server.AddDatasource(Datasource{"name": "Remote", "type": "prometheus", "uid": "remote"})
+	h := NewDashboardHandler(server.Endpoint())
+	sources := NewDatasourceHandler(server.Endpoint())
+	resources := grizzly.Resources{
+		sources: grizzly.ResourceList{
+			"datasource/loki": sources.newDatasourceResource(datasourcesPath, "loki", "", Datasource{"name": "loki", "type": "loki", "uid": "logs"}),
+		},
+	}
+
+	tests := map[string]struct {
+		dashboard string
+		errs      []string
+	}{
+		"local and remote datasources": {
+			dashboard: `{"panels": [
+				{"type": "logs", "datasource": {"type": "loki", "uid": "logs"}},
+				{"type": "stat", "datasource": "loki"},
+				{"type": "row", "panels": [{"type": "graph", "datasource": {"uid": "remote"}, "targets": [{"datasource": "Remote"}]}]}
+			]}`,
+		},
+		"template variables and built-in datasources": {
+			dashboard: `{
+				"panels": [{"type": "graph", "datasource": "$datasource"}, {"type": "stat", "datasource": "${datasource:loki}"}, {"type": "text", "datasource": null}],
+				"annotations": {"list": [{"name": "Annotations & Alerts", "datasource": {"type": "grafana", "uid": "-- Grafana --"}}]}
+			}`,
+		},
+		"missing datasources": {
+			dashboard: `{
+				"panels": [{"type": "graph", "datasource": {"uid": "prom"}, "targets": [{"datasource": {"uid": "logs"}}, {"datasource": {"uid": "tempo"}}]}],
+				"templating": {"list": [{"name": "job", "type": "query", "datasource": "Prometheus"}]}
+			}`,
+			errs: []string{
+				"panels[0].datasource: datasource prom not found",
+				"panels[0].targets[1].datasource: datasource tempo not found",
+				"templating.list[0].datasource: datasource Prometheus not found",
+			},
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		board := Dashboard{}
+		if err := json.Unmarshal([]byte(test.dashboard), &board); err != nil {
+			t.Fatalf("Invalid dashboard: %v", err)
+		}
+		resource := h.newDashboardResource(dashboardsPath, "board", "board.json", board)
+		broken, err := h.CheckReferences(context.Background(), grizzly.ResourceList{resource.Key(): resource}, resources)
+		if err != nil {
+			t.Fatalf("Unexpected error checking references: %v", err)
+		}
+		errs := []string{}
+		for _, err := range broken[resource.Key()] {
+			errs = append(errs, err.Error())
+		}
+		if len(errs) != len(test.errs) || len(errs) > 0 && !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("Expected %v, got %v", test.errs, errs)
+		}
+	}
+}
+
+func TestParseDuplicateDashboards(t *testing.T) {
+	h := NewDashboardHandler(nil)
+	_, err := h.Parse(dashboardsPath, map[string]interface{}{
+		"api.json":      map[string]interface{}{"uid": "overview", "title": "API"},
+		"overview.json": map[string]interface{}{"uid": "overview", "title": "Overview"},
+	})
+	expected := "dashboard/overview is defined twice, at grafanaDashboards.api.json and grafanaDashboards.overview.json"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got: %v", expected, err)
+	}
+}
+
+func TestApplyContinueOnError(t *testing.T) {
+	tests := map[string]struct {
+		continueOnError bool
+		applied         int
+		report          bool
+	}{
+		"stop at the first failure": {
+			continueOnError: false,
+			applied:         0,
+		},
+		"continue on error": {
+			continueOnError: true,
+			applied:         1,
+			report:          true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		server.Fail("POST", "/api/dashboards/db", http.StatusInternalServerError, "Internal error")
+		var output bytes.Buffer
+		client, err := grizzly.NewClient(grizzly.ClientOpts{
+			Providers: []grizzly.Provider{&Provider{Grafana: server.Endpoint()}},
+			Output:    &output,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler, err := client.Registry().GetHandler("dashboard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+			"api.json":      map[string]interface{}{"uid": "api", "title": "API"},
+			"overview.json": map[string]interface{}{"uid": "overview", "title": "Overview"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = client.Apply(context.Background(), grizzly.Resources{handler: resourceList}, &grizzly.ApplyOpts{AutoApprove: true, ContinueOnError: test.continueOnError})
+		if err == nil {
+			t.Fatalf("Expected an error applying")
+		}
+		applied := 0
+		for _, uid := range []string{"api", "overview"} {
+			if _, _, ok := server.Dashboard(uid); ok {
+				applied++
+			}
+		}
+		if applied != test.applied {
+			t.Errorf("Expected %d dashboard(s) applied, got: %d", test.applied, applied)
+		}
+		if report := strings.Contains(output.String(), "1 resource(s) failed to apply:"); report != test.report {
+			t.Errorf("Expected report %v, got: %s", test.report, output.String())
+		}
+		server.Close()
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	tests := map[string]struct {
+		conflicts int
+		err       bool
+	}{
+		"retried": {
+			conflicts: 1,
+		},
+		"too many conflicts": {
+			conflicts: 4,
+			err:       true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		if err := server.AddDashboard("", map[string]interface{}{"uid": "board", "title": "Old"}); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < test.conflicts; i++ {
+			server.Fail("POST", "/api/dashboards/db", http.StatusPreconditionFailed, "The dashboard has been changed by someone else")
+		}
+		client, err := grizzly.NewClient(grizzly.ClientOpts{
+			Providers: []grizzly.Provider{&Provider{Grafana: server.Endpoint()}},
+			Output:    ioutil.Discard,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler, err := client.Registry().GetHandler("dashboard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+			"board.json": map[string]interface{}{"uid": "board", "title": "New"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = client.Apply(context.Background(), grizzly.Resources{handler: resourceList}, &grizzly.ApplyOpts{AutoApprove: true})
+		if test.err {
+			if !errors.Is(err, grizzly.ErrConflict) {
+				t.Errorf("Expected a conflict, got: %v", err)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error applying: %v", err)
+		}
+		model, _, _ := server.Dashboard("board")
+		if model["title"] != "New" {
+			t.Errorf("Expected title New, got: %v", model["title"])
+		}
+		server.Close()
+	}
+}
+
+func TestApplyChangedRemotely(t *testing.T) {
+	tests := map[string]struct {
+		changed bool
+		force   bool
+		err     string
+	}{
+		"unchanged": {},
+		"changed remotely": {
+			changed: true,
+			err:     "dashboard/board was changed remotely since last applied (version 2, last applied 1), overwrite it with --force",
+		},
+		"forced": {
+			changed: true,
+			force:   true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		dir, err := ioutil.TempDir("", "grizzly")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := grafanatest.NewServer()
+		client, err := grizzly.NewClient(grizzly.ClientOpts{
+			Providers: []grizzly.Provider{&Provider{Grafana: server.Endpoint()}},
+			Output:    ioutil.Discard,
+			StateFile: filepath.Join(dir, "state.json"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler, err := client.Registry().GetHandler("dashboard")
+		if err != nil {
+			t.Fatal(err)
+		}
+		apply := func(title string, opts *grizzly.ApplyOpts) error {
+			resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+				"board.json": map[string]interface{}{"uid": "board", "title": title},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return client.Apply(context.Background(), grizzly.Resources{handler: resourceList}, opts)
+		}
+
+		if err := apply("Applied", &grizzly.ApplyOpts{AutoApprove: true}); err != nil {
+			t.Fatalf("Unexpected error applying: %v", err)
+		}
+		if test.changed {
+			if err := server.AddDashboard("", map[string]interface{}{"uid": "board", "title": "Hotfix"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err = apply("Updated", &grizzly.ApplyOpts{AutoApprove: true, Force: test.force})
+		model, _, _ := server.Dashboard("board")
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			if model["title"] != "Hotfix" {
+				t.Errorf("Expected the remote change to be kept, got title: %v", model["title"])
+			}
+		} else {
+			if err != nil {
+				t.Errorf("Unexpected error applying: %v", err)
+			}
+			if model["title"] != "Updated" {
+				t.Errorf("Expected title Updated, got: %v", model["title"])
+			}
+		}
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// reconcileTestParser parses the resources of a tree once, canceling the
+// reconciliation when parsed again
+type reconcileTestParser struct {
+	resources grizzly.Resources
+	cancel    context.CancelFunc
+	parsed    int
+}
+
+func (p *reconcileTestParser) Name() string {
+	return "tree"
+}
+
+func (p *reconcileTestParser) Parse(config grizzly.Config) (grizzly.Resources, error) {
+	p.parsed++
+	if p.parsed > 1 {
+		p.cancel()
+		return nil, context.Canceled
+	}
+	return p.resources, nil
+}
+
+func TestReconcilePrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := grafanatest.NewServer()
+	defer server.Close()
+	registry := grizzly.NewProviderRegistry()
+	if err := registry.RegisterProvider(&Provider{Grafana: server.Endpoint()}); err != nil {
+		t.Fatal(err)
+	}
+	config := grizzly.Config{Registry: registry, StateFile: filepath.Join(dir, "state.json")}
+	handler, err := registry.GetHandler("dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(files map[string]interface{}) grizzly.Resources {
+		resourceList, err := handler.Parse(dashboardsPath, files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return grizzly.Resources{handler: resourceList}
+	}
+	kept := map[string]interface{}{"uid": "kept", "title": "Kept"}
+	removed := map[string]interface{}{"uid": "removed", "title": "Removed"}
+	err = grizzly.Apply(context.Background(), config, parse(map[string]interface{}{
+		"kept.json": kept, "removed.json": removed,
+	}), &grizzly.ApplyOpts{AutoApprove: true})
+	if err != nil {
+		t.Fatalf("Unexpected error applying: %v", err)
+	}
+
+	// only removing a resource from the tree leaves nothing else drifted
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	parser := &reconcileTestParser{resources: parse(map[string]interface{}{"kept.json": kept}), cancel: cancel}
+	err = grizzly.Reconcile(ctx, config, parser, &grizzly.ReconcileOpts{
+		Address:  "127.0.0.1:0",
+		Interval: time.Millisecond,
+		Prune:    true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error reconciling: %v", err)
+	}
+	if _, _, ok := server.Dashboard("removed"); ok {
+		t.Errorf("Expected the dashboard removed from the tree to be deleted")
+	}
+	if _, _, ok := server.Dashboard("kept"); !ok {
+		t.Errorf("Expected the dashboard in the tree to be kept")
+	}
+}
+
+func TestApplyInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	eu := grafanatest.NewServer()
+	defer eu.Close()
+	us := grafanatest.NewServer()
+	defer us.Close()
+	// the dashboard of us is at a later version than the one applied to eu
+	for _, title := range []string{"Created", "Edited"} {
+		if err := us.AddDashboard("", map[string]interface{}{"uid": "board", "title": title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := grizzly.NewProviderRegistry()
+	if err := registry.RegisterProvider(&Provider{}); err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(dir, "state.json")
+	config := grizzly.Config{Registry: registry, StateFile: stateFile}
+	handler, err := registry.GetHandler("dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+		"board.json": map[string]interface{}{"uid": "board", "title": "Applied"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := []grizzly.Instance{
+		{Name: "eu", Env: map[string]string{"GRAFANA_URL": eu.URL}},
+		{Name: "us", Env: map[string]string{"GRAFANA_URL": us.URL}},
+	}
+	err = grizzly.ApplyInstances(context.Background(), config, grizzly.Resources{handler: resourceList}, &grizzly.ApplyOpts{AutoApprove: true}, instances)
+	if err != nil {
+		t.Fatalf("Unexpected error applying: %v", err)
+	}
+	for _, instance := range instances {
+		state, err := grizzly.LoadState(instance.StateFile(stateFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := state.LastApplied["dashboard/board"]; !ok {
+			t.Errorf("Expected the state of %s to record the dashboard", instance.Name)
+		}
+	}
+	if model, _, _ := us.Dashboard("board"); model["title"] != "Applied" {
+		t.Errorf("Expected us to be applied to, got title: %v", model["title"])
+	}
+}
+
+func TestParseRequireUIDs(t *testing.T) {
+	tests := map[string]struct {
+		opts grizzly.ParseOpts
+		err  string
+	}{
+		"not required": {},
+		"required": {
+			opts: grizzly.ParseOpts{RequireUIDs: true},
+			err: `2 resource(s) without a stable UID:
+  dashboard grafanaDashboards.random.json declares no UID
+  datasource grafanaDatasources.prometheus.json declares no UID`,
+		},
+		"pattern": {
+			opts: grizzly.ParseOpts{UIDPattern: "^team-"},
+			err: `3 resource(s) without a stable UID:
+  dashboard grafanaDashboards.overview.json declares UID "overview", not matching ^team-
+  dashboard grafanaDashboards.random.json declares no UID
+  datasource grafanaDatasources.prometheus.json declares no UID`,
+		},
+		"invalid pattern": {
+			opts: grizzly.ParseOpts{UIDPattern: "team-("},
+			err:  "Invalid UID pattern \"team-(\": error parsing regexp: missing closing ): `team-(`",
+		},
+	}
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "resources.json")
+	err = ioutil.WriteFile(file, []byte(`{
+  "grafanaDashboards": {
+    "overview.json": {"uid": "overview", "title": "Overview"},
+    "payments.json": {"uid": "team-payments", "title": "Payments"},
+    "random.json": {"title": "Random"}
+  },
+  "grafanaDatasources": {
+    "prometheus.json": {"name": "Prometheus", "type": "prometheus"},
+    "loki.json": {"name": "Loki", "type": "loki", "uid": "team-loki"}
+  }
+}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := grizzly.NewProviderRegistry()
+	if err := registry.RegisterProvider(&Provider{}); err != nil {
+		t.Fatal(err)
+	}
+	config := grizzly.Config{Registry: registry}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		opts := test.opts
+		_, err := grizzly.Parse(config, file, &opts)
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error parsing: %v", err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Expected error %q, got: %v", test.err, err)
+		}
+	}
+}
+
+func TestParseFilesDuplicates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"api.json":      `{"grafanaDashboardFolder": "team", "grafanaDashboards": {"api.json": {"uid": "overview", "title": "API"}}}`,
+		"overview.json": `{"grafanaDashboardFolder": "team", "grafanaDashboards": {"overview.json": {"uid": "overview", "title": "Overview"}}}`,
+		"payments.json": `{"grafanaDashboardFolder": "team", "grafanaDashboards": {"payments.json": {"uid": "payments", "title": "Payments"}}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := map[string]struct {
+		files []string
+		err   string
+	}{
+		"same folder in several files": {
+			files: []string{"api.json", "payments.json"},
+		},
+		"same dashboard in several files": {
+			files: []string{"api.json", "overview.json"},
+			err: fmt.Sprintf("dashboard/overview is defined twice, at grafanaDashboards.api.json in %s and grafanaDashboards.overview.json in %s",
+				filepath.Join(dir, "api.json"), filepath.Join(dir, "overview.json")),
+		},
+	}
+	registry := grizzly.NewProviderRegistry()
+	if err := registry.RegisterProvider(&Provider{}); err != nil {
+		t.Fatal(err)
+	}
+	config := grizzly.Config{Registry: registry}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		paths := []string{}
+		for _, file := range test.files {
+			paths = append(paths, filepath.Join(dir, file))
+		}
+		_, err := grizzly.ParseFiles(config, paths, &grizzly.ParseOpts{})
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error parsing: %v", err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Expected error %q, got: %v", test.err, err)
+		}
+	}
+}
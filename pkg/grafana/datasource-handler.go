@@ -1,19 +1,24 @@
 package grafana
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 	"github.com/mitchellh/mapstructure"
 )
 
 // DatasourceHandler is a Grizzly Provider for Grafana datasources
-type DatasourceHandler struct{}
+type DatasourceHandler struct {
+	endpoint *grizzly.Endpoint
+}
 
 // NewDatasourceHandler returns configuration defining a new Grafana Provider
-func NewDatasourceHandler() *DatasourceHandler {
-	return &DatasourceHandler{}
+func NewDatasourceHandler(endpoint *grizzly.Endpoint) *DatasourceHandler {
+	return &DatasourceHandler{endpoint: endpoint}
 }
 
 // GetName returns the name for this provider
@@ -40,6 +45,12 @@ func (h *DatasourceHandler) GetExtension() string {
 	return "json"
 }
 
+// Configured returns why Grafana is not configured, if it is not
+func (h *DatasourceHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
 func (h *DatasourceHandler) newDatasourceResource(path, uid, filename string, source Datasource) grizzly.Resource {
 	resource := grizzly.Resource{
 		UID:      uid,
@@ -57,45 +68,88 @@ func (h *DatasourceHandler) Parse(path string, i interface{}) (grizzly.ResourceL
 	msi := i.(map[string]interface{})
 	for k, v := range msi {
 		source := Datasource{}
-		source["basicAuth"] = false
-		source["basicAuthPassword"] = ""
-		source["basicAuthUser"] = ""
-		source["database"] = ""
-		source["orgId"] = 1
-		source["password"] = ""
-		source["secureJsonFields"] = map[string]interface{}{}
-		source["typeLogoUrl"] = ""
-		source["user"] = ""
-		source["withCredentials"] = false
-		source["readOnly"] = false
-
 		err := mapstructure.Decode(v, &source)
 		if err != nil {
 			return nil, err
 		}
 		resource := h.newDatasourceResource(path, source.UID(), k, source)
-		key := resource.Key()
-		resources[key] = resource
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
 	}
 	return resources, nil
 }
 
+// DeclaredUID returns the UID a datasource declares, which dashboards refer to
+// it by, Grafana generating one if empty. Grizzly keys datasources by name
+// rather than by this UID.
+func (h *DatasourceHandler) DeclaredUID(resource grizzly.Resource) string {
+	source, ok := resource.Detail.(Datasource)
+	if !ok {
+		return ""
+	}
+	uid, _ := source["uid"].(string)
+	return uid
+}
+
+// Validate checks that a datasource has the fields its type requires
+func (h *DatasourceHandler) Validate(resource grizzly.Resource) []error {
+	source, ok := resource.Detail.(Datasource)
+	if !ok {
+		return nil
+	}
+	return validateDatasource(source)
+}
+
 // Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
 func (h *DatasourceHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
-	h.delete(resource, "version")
-	h.delete(resource, "id")
+	source := resource.Detail.(Datasource)
+	for _, field := range datasourceIgnoredFields {
+		h.delete(resource, field)
+	}
+	for field, value := range datasourceDefaults {
+		if source[field] == value {
+			h.delete(resource, field)
+		}
+	}
+	unmarkDatasource(source)
+	if jsonData, ok := source["jsonData"].(map[string]interface{}); ok && len(jsonData) == 0 {
+		h.delete(resource, "jsonData")
+	}
 	return &resource
 }
 
-// Prepare gets a resource ready for dispatch to the remote endpoint
+// Prepare gets a resource ready for dispatch to the remote endpoint. Secrets
+// already set in Grafana are kept, unless new values are set.
 func (h *DatasourceHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
-	resource.Detail.(Datasource)["id"] = existing.Detail.(Datasource)["id"]
+	source := newDatasource(resource)
+	source["id"] = existing.Detail.(Datasource)["id"]
+	source["version"] = existing.Detail.(Datasource)["version"]
+	keepSecureFields(source, newDatasource(existing))
 	return &resource
 }
 
+// Mark sets the jsonData fields marking a datasource as managed by grizzly
+func (h *DatasourceHandler) Mark(resource grizzly.Resource, source string) grizzly.Resource {
+	markDatasource(resource.Detail.(Datasource), source)
+	return resource
+}
+
+// Marked reports whether a datasource is marked as managed by grizzly
+func (h *DatasourceHandler) Marked(resource grizzly.Resource) bool {
+	return datasourceMarked(resource.Detail.(Datasource))
+}
+
+// ReferenceID returns the uid dashboards refer to a datasource by, unless it
+// is left for Grafana to assign
+func (h *DatasourceHandler) ReferenceID(resource grizzly.Resource) string {
+	uid, _ := resource.Detail.(Datasource)["uid"].(string)
+	return uid
+}
+
 // GetByUID retrieves JSON for a resource from an endpoint, by UID
-func (h *DatasourceHandler) GetByUID(UID string) (*grizzly.Resource, error) {
-	source, err := getRemoteDatasource(UID)
+func (h *DatasourceHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	source, err := getRemoteDatasource(ctx, h.endpoint, UID)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving datasource %s: %v", UID, err)
 	}
@@ -113,8 +167,8 @@ func (h *DatasourceHandler) GetRepresentation(uid string, resource grizzly.Resou
 }
 
 // GetRemoteRepresentation retrieves a datasource as JSON
-func (h *DatasourceHandler) GetRemoteRepresentation(uid string) (string, error) {
-	source, err := getRemoteDatasource(uid)
+func (h *DatasourceHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	source, err := getRemoteDatasource(ctx, h.endpoint, uid)
 	if err != nil {
 		return "", err
 	}
@@ -122,8 +176,8 @@ func (h *DatasourceHandler) GetRemoteRepresentation(uid string) (string, error)
 }
 
 // GetRemote retrieves a datasource as a Resource
-func (h *DatasourceHandler) GetRemote(uid string) (*grizzly.Resource, error) {
-	source, err := getRemoteDatasource(uid)
+func (h *DatasourceHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	source, err := getRemoteDatasource(ctx, h.endpoint, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -132,20 +186,180 @@ func (h *DatasourceHandler) GetRemote(uid string) (*grizzly.Resource, error) {
 }
 
 // Add pushes a datasource to Grafana via the API
-func (h *DatasourceHandler) Add(resource grizzly.Resource) error {
-	return postDatasource(newDatasource(resource))
+func (h *DatasourceHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postDatasource(ctx, h.endpoint, newDatasource(resource))
 }
 
 // Update pushes a datasource to Grafana via the API
-func (h *DatasourceHandler) Update(existing, resource grizzly.Resource) error {
-	return putDatasource(newDatasource(resource))
+func (h *DatasourceHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return putDatasource(ctx, h.endpoint, newDatasource(resource))
+}
+
+// Delete removes a datasource from Grafana via the API
+func (h *DatasourceHandler) Delete(ctx context.Context, UID string) error {
+	return deleteDatasource(ctx, h.endpoint, UID)
+}
+
+// ListRemote retrieves all datasources from Grafana, as datasources are not
+// grouped in any way
+func (h *DatasourceHandler) ListRemote(ctx context.Context, resources grizzly.ResourceList) (grizzly.ResourceList, error) {
+	sources, err := listDatasources(ctx, h.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	remote := grizzly.ResourceList{}
+	for _, source := range sources {
+		resource := h.newDatasourceResource(datasourcesPath, source.UID(), "", source)
+		remote[resource.Key()] = resource
+	}
+	return remote, nil
+}
+
+// ListAll retrieves a summary of all datasources in Grafana
+func (h *DatasourceHandler) ListAll(ctx context.Context) ([]grizzly.ResourceSummary, error) {
+	sources, err := listDatasources(ctx, h.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []grizzly.ResourceSummary{}
+	for _, source := range sources {
+		summaries = append(summaries, grizzly.ResourceSummary{UID: source.UID(), Title: source.UID()})
+	}
+	return summaries, nil
 }
 
-// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
-func (h *DatasourceHandler) Preview(resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
-	return grizzly.ErrNotImplemented
+// Preview validates a datasource, then runs its health check against a
+// temporary copy in Grafana, where its plugin supports health checks
+func (h *DatasourceHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	source := newDatasource(resource)
+	if errs := validateDatasource(source); len(errs) > 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("Datasource %s is invalid: %s", resource.UID, strings.Join(msgs, "; "))
+	}
+	msg, err := testDatasource(ctx, h.endpoint, source)
+	if err == grizzly.ErrNotImplemented {
+		notifier.NotSupported(resource, "health checks")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Datasource %s: %v", resource.UID, err)
+	}
+	notifier.Info(&resource, "health check passed: "+msg)
+	return nil
 }
 
 func (h *DatasourceHandler) delete(resource grizzly.Resource, key string) {
 	delete(resource.Detail.(Datasource), key)
 }
+
+// checkDatasourcesHealth runs the health check of each applied datasource,
+// warning about those that fail or, in fail mode, returning an error
+func checkDatasourcesHealth(ctx context.Context, endpoint *grizzly.Endpoint, notifier grizzly.Notifier, resources grizzly.Resources, mode string) error {
+	failed := []string{}
+	for handler, resourceList := range resources {
+		if _, ok := handler.(*DatasourceHandler); !ok {
+			continue
+		}
+		for _, resource := range resourceList {
+			msg, err := checkDatasourceHealth(ctx, endpoint, resource.UID)
+			switch {
+			case err == grizzly.ErrNotImplemented:
+				notifier.NotSupported(resource, "health checks")
+			case err != nil && mode == grizzly.HealthCheckFail:
+				notifier.Error(&resource, err.Error())
+				failed = append(failed, resource.UID)
+			case err != nil:
+				notifier.Warn(&resource, err.Error())
+			default:
+				notifier.Info(&resource, "health check passed: "+msg)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("Datasources failed their health checks: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkDatasourceHealth runs the health check of a datasource in Grafana, by name
+func checkDatasourceHealth(ctx context.Context, endpoint *grizzly.Endpoint, name string) (string, error) {
+	source, err := getRemoteDatasource(ctx, endpoint, name)
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving datasource %s: %v", name, err)
+	}
+	uid, _ := (*source)["uid"].(string)
+	return datasourceHealth(ctx, endpoint, uid)
+}
+
+// datasourceTerraformFields maps the fields of datasources to the arguments of
+// grafana_data_source
+var datasourceTerraformFields = map[string]string{
+	"name":          "name",
+	"type":          "type",
+	"uid":           "uid",
+	"url":           "url",
+	"access":        "access_mode",
+	"isDefault":     "is_default",
+	"basicAuth":     "basic_auth_enabled",
+	"basicAuthUser": "basic_auth_username",
+	"database":      "database_name",
+	"user":          "username",
+}
+
+// Terraform renders a datasource as a grafana_data_source. Its secureJsonData
+// is left out, to keep secrets out of Terraform configuration.
+func (h *DatasourceHandler) Terraform(resource grizzly.Resource, resources grizzly.ResourceList) ([]grizzly.TerraformResource, error) {
+	source := resource.Detail.(Datasource)
+	attributes := map[string]interface{}{}
+	for field, argument := range datasourceTerraformFields {
+		if v, ok := source[field]; ok && v != datasourceDefaults[field] {
+			attributes[argument] = v
+		}
+	}
+	if jsonData, ok := source["jsonData"].(map[string]interface{}); ok && len(jsonData) > 0 {
+		encoded, err := grizzly.TerraformJSON(jsonData)
+		if err != nil {
+			return nil, err
+		}
+		attributes["json_data_encoded"] = encoded
+	}
+	// the Grafana provider imports datasources by UID
+	uid, _ := source["uid"].(string)
+	return []grizzly.TerraformResource{{
+		Type:       "grafana_data_source",
+		Name:       grizzly.TerraformName(resource.UID),
+		Attributes: attributes,
+		ImportID:   uid,
+	}}, nil
+}
+
+// Provision returns the provisioning file of datasources, with their
+// secureJsonData
+func (h *DatasourceHandler) Provision(resources grizzly.ResourceList, provisioningDir string) (map[string]string, error) {
+	names := []string{}
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	datasources := []interface{}{}
+	for _, name := range names {
+		source := Datasource{}
+		for k, v := range resources[name].Detail.(Datasource) {
+			source[k] = v
+		}
+		for _, field := range datasourceIgnoredFields {
+			if field != "secureJsonData" {
+				delete(source, field)
+			}
+		}
+		datasources = append(datasources, source)
+	}
+	file, err := provisioningYAML("datasources", datasources)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"datasources/grizzly.yaml": file}, nil
+}
@@ -2,23 +2,26 @@ package grafana
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 )
 
 // getRemoteDatasource retrieves a datasource object from Grafana
-func getRemoteDatasource(uid string) (*Datasource, error) {
-	grafanaURL, err := getGrafanaURL("api/datasources/name/" + uid)
+func getRemoteDatasource(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*Datasource, error) {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/datasources/name/"+uid)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Get(grafanaURL)
+	resp, err := grafanaGet(ctx, endpoint, grafanaURL)
 	if err != nil {
 		return nil, err
 	}
@@ -45,8 +48,80 @@ func getRemoteDatasource(uid string) (*Datasource, error) {
 	return &d, nil
 }
 
-func postDatasource(source Datasource) error {
-	grafanaURL, err := getGrafanaURL("api/datasources")
+// listDatasources retrieves all datasources from Grafana
+func listDatasources(ctx context.Context, endpoint *grizzly.Endpoint) ([]Datasource, error) {
+	var sources []Datasource
+	if err := requestJSON(ctx, endpoint, "GET", "api/datasources", nil, &sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// deleteDatasource removes a datasource from Grafana
+func deleteDatasource(ctx context.Context, endpoint *grizzly.Endpoint, name string) error {
+	return requestJSON(ctx, endpoint, "DELETE", "api/datasources/name/"+url.PathEscape(name), nil, nil)
+}
+
+// datasourceHealth runs the health check of a datasource in Grafana, returning
+// its message. Datasources whose plugins have no health check return
+// ErrNotImplemented.
+func datasourceHealth(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (string, error) {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/datasources/uid/"+url.PathEscape(uid)+"/health")
+	if err != nil {
+		return "", err
+	}
+	resp, err := grafanaGet(ctx, endpoint, grafanaURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var r struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusNotImplemented:
+		return "", grizzly.ErrNotImplemented
+	case http.StatusOK, http.StatusBadRequest:
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return "", fmt.Errorf("Failed to decode health check response: %s", err)
+		}
+		if r.Status != "OK" {
+			return "", fmt.Errorf("Health check failed: %s", r.Message)
+		}
+		return r.Message, nil
+	default:
+		return "", fmt.Errorf("Non-200 response from Grafana during health check: %s", resp.Status)
+	}
+}
+
+// testDatasource runs the health check of a datasource that may not exist yet,
+// by adding it to Grafana under a temporary name, then deleting it
+func testDatasource(ctx context.Context, endpoint *grizzly.Endpoint, source Datasource) (string, error) {
+	temporary := Datasource{}
+	for k, v := range source {
+		temporary[k] = v
+	}
+	temporary["name"] = fmt.Sprintf("%s (grizzly preview %d)", source.UID(), time.Now().UnixNano())
+	for _, field := range []string{"id", "uid", "isDefault"} {
+		delete(temporary, field)
+	}
+
+	var added struct {
+		Datasource struct {
+			UID string `json:"uid"`
+		} `json:"datasource"`
+	}
+	if err := requestJSON(ctx, endpoint, "POST", "api/datasources", temporary, &added); err != nil {
+		return "", err
+	}
+	defer deleteDatasource(ctx, endpoint, temporary.UID())
+	return datasourceHealth(ctx, endpoint, added.Datasource.UID)
+}
+
+func postDatasource(ctx context.Context, endpoint *grizzly.Endpoint, source Datasource) error {
+	grafanaURL, err := getGrafanaURL(endpoint, "api/datasources")
 	if err != nil {
 		return err
 	}
@@ -56,36 +131,21 @@ func postDatasource(source Datasource) error {
 		return err
 	}
 
-	resp, err := http.Post(grafanaURL, "application/json", bytes.NewBufferString(sourceJSON))
+	resp, err := grafanaPost(ctx, endpoint, grafanaURL, "application/json", bytes.NewBufferString(sourceJSON))
 	if err != nil {
 		return err
 	}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		break
-	case http.StatusPreconditionFailed:
-		d := json.NewDecoder(resp.Body)
-		var r struct {
-			Message string `json:"message"`
-		}
-		if err := d.Decode(&r); err != nil {
-			return fmt.Errorf("Failed to decode actual error (412 Precondition failed): %s", err)
-		}
-		fmt.Println(sourceJSON)
-		return fmt.Errorf("Error while applying '%s' to Grafana: %s", source.UID(), r.Message)
-	default:
-		return fmt.Errorf("Non-200 response from Grafana while applying '%s': %s", resp.Status, source.UID())
-	}
-	return nil
+	defer resp.Body.Close()
+	return pushErr(resp, source.UID())
 }
 
-func putDatasource(source Datasource) error {
+func putDatasource(ctx context.Context, endpoint *grizzly.Endpoint, source Datasource) error {
 	id, err := source.getID()
 	if err != nil {
 		return err
 	}
-	grafanaURL, err := getGrafanaURL(fmt.Sprintf("api/datasources/%d", id))
+	grafanaURL, err := getGrafanaURL(endpoint, fmt.Sprintf("api/datasources/%d", id))
 	if err != nil {
 		return err
 	}
@@ -95,36 +155,94 @@ func putDatasource(source Datasource) error {
 		return err
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("PUT", grafanaURL, bytes.NewBufferString(sourceJSON))
+	req, err := http.NewRequestWithContext(ctx, "PUT", grafanaURL, bytes.NewBufferString(sourceJSON))
 	req.Header.Add("Content-type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := doGrafana(endpoint, req)
 	if err != nil {
 		return err
 	}
 
-	switch resp.StatusCode {
-	case http.StatusOK:
-		break
-	case http.StatusPreconditionFailed:
-		d := json.NewDecoder(resp.Body)
-		var r struct {
-			Message string `json:"message"`
+	defer resp.Body.Close()
+	return pushErr(resp, source.UID())
+}
+
+// Datasource encapsulates a datasource
+type Datasource map[string]interface{}
+
+// datasourceIgnoredFields are set by Grafana, or like secureJsonData, are never
+// returned by it, so cannot be compared
+var datasourceIgnoredFields = []string{"id", "version", "orgId", "typeLogoUrl", "readOnly", "secureJsonFields", "secureJsonData"}
+
+// datasourceDefaults are the values Grafana returns for fields that are not set
+var datasourceDefaults = map[string]interface{}{
+	"access":            "",
+	"basicAuth":         false,
+	"basicAuthPassword": "",
+	"basicAuthUser":     "",
+	"database":          "",
+	"isDefault":         false,
+	"password":          "",
+	"user":              "",
+	"withCredentials":   false,
+}
+
+// datasourceRequiredFields are the fields that datasources of core types
+// cannot work without, beyond a name and type
+var datasourceRequiredFields = map[string][]string{
+	"alertmanager":  {"url"},
+	"elasticsearch": {"url", "database"},
+	"graphite":      {"url"},
+	"influxdb":      {"url"},
+	"jaeger":        {"url"},
+	"loki":          {"url"},
+	"mssql":         {"url", "database"},
+	"mysql":         {"url", "database"},
+	"postgres":      {"url", "database"},
+	"prometheus":    {"url"},
+	"tempo":         {"url"},
+	"zipkin":        {"url"},
+}
+
+// validateDatasource checks that a datasource has the fields its type requires
+func validateDatasource(source Datasource) []error {
+	errs := []error{}
+	for _, field := range []string{"name", "type"} {
+		if v, _ := source[field].(string); v == "" {
+			errs = append(errs, fmt.Errorf("%s: must be a non-empty string", field))
 		}
-		if err := d.Decode(&r); err != nil {
-			return fmt.Errorf("Failed to decode actual error (412 Precondition failed): %s", err)
+	}
+	if access, ok := source["access"]; ok && access != "" && access != "proxy" && access != "direct" {
+		errs = append(errs, fmt.Errorf("access: must be proxy or direct, got %v", access))
+	}
+	typ, _ := source["type"].(string)
+	for _, field := range datasourceRequiredFields[typ] {
+		if v, _ := source[field].(string); v == "" {
+			errs = append(errs, fmt.Errorf("%s: required by %s datasources", field, typ))
 		}
-		fmt.Println(sourceJSON)
-		return fmt.Errorf("Error while applying '%s' to Grafana: %s", source.UID(), r.Message)
-	default:
-		return fmt.Errorf("Non-200 response from Grafana while applying '%s': %s", resp.Status, source.UID())
 	}
-	return nil
+	return errs
 }
 
-// Datasource encapsulates a datasource
-type Datasource map[string]interface{}
+// keepSecureFields drops the empty fields of the secureJsonData of a datasource
+// that are set in its existing equivalent. Grafana only returns which secure
+// fields are set, and keeps those that are not sent, whereas sending empty
+// values would wipe them.
+func keepSecureFields(source, existing Datasource) {
+	secureJSONData, ok := source["secureJsonData"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	secureJSONFields, _ := existing["secureJsonFields"].(map[string]interface{})
+	kept := map[string]interface{}{}
+	for field, value := range secureJSONData {
+		if set, _ := secureJSONFields[field].(bool); set && (value == nil || value == "") {
+			continue
+		}
+		kept[field] = value
+	}
+	source["secureJsonData"] = kept
+}
 
 func newDatasource(resource grizzly.Resource) Datasource {
 	return resource.Detail.(Datasource)
@@ -0,0 +1,352 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grafanatest"
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestUnprepareDatasource(t *testing.T) {
+	h := NewDatasourceHandler(nil)
+	local := Datasource{
+		"name":           "prometheus",
+		"type":           "prometheus",
+		"url":            "http://prometheus:9090",
+		"access":         "proxy",
+		"basicAuth":      false,
+		"secureJsonData": map[string]interface{}{"httpHeaderValue1": "secret"},
+	}
+	remote := Datasource{}
+	err := json.Unmarshal([]byte(`{
+		"id": 3, "version": 2, "orgId": 1, "name": "prometheus", "type": "prometheus",
+		"typeLogoUrl": "public/app/plugins/datasource/prometheus/img/prometheus_logo.svg",
+		"access": "proxy", "url": "http://prometheus:9090", "password": "", "user": "", "database": "",
+		"basicAuth": false, "basicAuthUser": "", "basicAuthPassword": "", "withCredentials": false,
+		"isDefault": false, "jsonData": {}, "secureJsonFields": {"httpHeaderValue1": true}, "readOnly": false
+	}`), &remote)
+	if err != nil {
+		t.Fatalf("Invalid test datasource: %s", err)
+	}
+
+	localResource := h.newDatasourceResource(datasourcesPath, "prometheus", "prometheus", local)
+	localRepresentation, err := grizzly.UnpreparedRepresentation(h, localResource)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering local datasource: %s", err)
+	}
+	remoteResource := h.newDatasourceResource(datasourcesPath, "prometheus", "prometheus", remote)
+	remoteRepresentation, err := h.Unprepare(remoteResource).GetRepresentation()
+	if err != nil {
+		t.Fatalf("Unexpected error rendering remote datasource: %s", err)
+	}
+	if localRepresentation != remoteRepresentation {
+		t.Errorf("Expected datasources to match, got:\n%s\n%s", localRepresentation, remoteRepresentation)
+	}
+	if _, ok := local["secureJsonData"]; !ok {
+		t.Errorf("Expected local datasource to keep its secureJsonData")
+	}
+}
+
+func TestValidateDatasource(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Source Datasource
+		Errors []string
+	}{
+		{
+			Name:   "valid",
+			Source: Datasource{"name": "prometheus", "type": "prometheus", "url": "http://prometheus:9090", "access": "proxy"},
+		},
+		{
+			Name:   "unknown type",
+			Source: Datasource{"name": "custom", "type": "my-plugin"},
+		},
+		{
+			Name:   "no name or type",
+			Source: Datasource{"url": "http://prometheus:9090"},
+			Errors: []string{"name: must be a non-empty string", "type: must be a non-empty string"},
+		},
+		{
+			Name:   "missing required fields",
+			Source: Datasource{"name": "db", "type": "postgres", "access": "server"},
+			Errors: []string{"access: must be proxy or direct, got server", "url: required by postgres datasources", "database: required by postgres datasources"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		errs := validateDatasource(test.Source)
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		if strings.Join(msgs, "\n") != strings.Join(test.Errors, "\n") {
+			t.Errorf("Expected errors:\n%s\ngot:\n%s", strings.Join(test.Errors, "\n"), strings.Join(msgs, "\n"))
+		}
+	}
+}
+
+func TestTestDatasource(t *testing.T) {
+	var added Datasource
+	deleted := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/datasources":
+			json.NewDecoder(r.Body).Decode(&added)
+			w.Write([]byte(`{"datasource": {"uid": "tmp"}, "id": 3}`))
+		case r.Method == "GET" && r.URL.Path == "/api/datasources/uid/tmp/health":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "ERROR", "message": "connection refused"}`))
+		case r.Method == "DELETE":
+			deleted = strings.TrimPrefix(r.URL.Path, "/api/datasources/name/")
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+
+	source := Datasource{"id": 1, "name": "prometheus", "type": "prometheus", "url": "http://prometheus:9090", "isDefault": true}
+	_, err := testDatasource(context.Background(), &grizzly.Endpoint{URL: server.URL}, source)
+	if err == nil || err.Error() != "Health check failed: connection refused" {
+		t.Errorf("Expected failed health check, got: %v", err)
+	}
+	name, _ := added["name"].(string)
+	if !strings.HasPrefix(name, "prometheus (grizzly preview ") || added["isDefault"] != nil || added["id"] != nil {
+		t.Errorf("Expected a temporary datasource, got: %v", added)
+	}
+	if deleted != name {
+		t.Errorf("Expected temporary datasource %q to be deleted, got: %q", name, deleted)
+	}
+	if source["name"] != "prometheus" {
+		t.Errorf("Expected datasource to be left unchanged, got: %v", source)
+	}
+}
+
+func TestCheckDatasourcesHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/datasources/name/healthy":
+			w.Write([]byte(`{"name": "healthy", "uid": "a"}`))
+		case "/api/datasources/name/unhealthy":
+			w.Write([]byte(`{"name": "unhealthy", "uid": "b"}`))
+		case "/api/datasources/uid/a/health":
+			w.Write([]byte(`{"status": "OK", "message": "Data source is working"}`))
+		case "/api/datasources/uid/b/health":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "ERROR", "message": "connection refused"}`))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	os.Setenv("GRAFANA_URL", server.URL)
+	defer os.Unsetenv("GRAFANA_URL")
+
+	h := NewDatasourceHandler(nil)
+	resources := grizzly.Resources{h: grizzly.ResourceList{
+		"datasource/healthy":   h.newDatasourceResource(datasourcesPath, "healthy", "healthy", Datasource{"name": "healthy"}),
+		"datasource/unhealthy": h.newDatasourceResource(datasourcesPath, "unhealthy", "unhealthy", Datasource{"name": "unhealthy"}),
+	}}
+	if err := checkDatasourcesHealth(context.Background(), nil, grizzly.Notifier{}, resources, grizzly.HealthCheckWarn); err != nil {
+		t.Errorf("Expected a warning only, got: %v", err)
+	}
+	err := checkDatasourcesHealth(context.Background(), nil, grizzly.Notifier{}, resources, grizzly.HealthCheckFail)
+	if err == nil || err.Error() != "Datasources failed their health checks: unhealthy" {
+		t.Errorf("Expected unhealthy datasource to fail, got: %v", err)
+	}
+}
+
+func TestKeepSecureFields(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Local    string
+		Remote   string
+		Expected string
+	}{
+		{
+			Name:     "no secrets",
+			Local:    `{"name": "prometheus"}`,
+			Remote:   `{"name": "prometheus", "secureJsonFields": {"basicAuthPassword": true}}`,
+			Expected: `{"name":"prometheus"}`,
+		},
+		{
+			Name:     "new secret",
+			Local:    `{"secureJsonData": {"basicAuthPassword": "hunter2"}}`,
+			Remote:   `{"secureJsonFields": {"basicAuthPassword": true}}`,
+			Expected: `{"secureJsonData":{"basicAuthPassword":"hunter2"}}`,
+		},
+		{
+			Name:     "empty secrets already set",
+			Local:    `{"secureJsonData": {"basicAuthPassword": "", "httpHeaderValue1": null, "password": "hunter2"}}`,
+			Remote:   `{"secureJsonFields": {"basicAuthPassword": true, "httpHeaderValue1": true}}`,
+			Expected: `{"secureJsonData":{"password":"hunter2"}}`,
+		},
+		{
+			Name:     "empty secret not set",
+			Local:    `{"secureJsonData": {"basicAuthPassword": ""}}`,
+			Remote:   `{"secureJsonFields": {}}`,
+			Expected: `{"secureJsonData":{"basicAuthPassword":""}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		local, remote := Datasource{}, Datasource{}
+		if err := json.Unmarshal([]byte(test.Local), &local); err != nil {
+			t.Fatalf("Invalid local datasource: %s", err)
+		}
+		if err := json.Unmarshal([]byte(test.Remote), &remote); err != nil {
+			t.Fatalf("Invalid remote datasource: %s", err)
+		}
+		keepSecureFields(local, remote)
+		actual, _ := json.Marshal(local)
+		if string(actual) != test.Expected {
+			t.Errorf("Expected %s, got %s", test.Expected, actual)
+		}
+	}
+}
+
+func TestDatasourceTerraform(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Datasource string
+		Expected   map[string]interface{}
+		ImportID   string
+	}{
+		{
+			Name:       "defaults left out",
+			Datasource: `{"name": "prometheus", "type": "prometheus", "url": "http://prometheus:9090", "basicAuth": false, "isDefault": true}`,
+			Expected:   map[string]interface{}{"name": "prometheus", "type": "prometheus", "url": "http://prometheus:9090", "is_default": true},
+		},
+		{
+			Name:       "secrets left out",
+			Datasource: `{"name": "loki", "type": "loki", "uid": "logs", "secureJsonData": {"basicAuthPassword": "hunter2"}}`,
+			Expected:   map[string]interface{}{"name": "loki", "type": "loki", "uid": "logs"},
+			ImportID:   "logs",
+		},
+		{
+			Name:       "json data encoded",
+			Datasource: `{"name": "tempo", "type": "tempo", "jsonData": {"httpMethod": "GET"}}`,
+			Expected: map[string]interface{}{"name": "tempo", "type": "tempo", "json_data_encoded": grizzly.TerraformExpr(`jsonencode({
+  "httpMethod": "GET"
+})`)},
+		},
+	}
+
+	h := NewDatasourceHandler(nil)
+	for _, test := range tests {
+		t.Logf("Running test case, %q...", test.Name)
+		source := Datasource{}
+		if err := json.Unmarshal([]byte(test.Datasource), &source); err != nil {
+			t.Fatalf("Invalid datasource: %s", err)
+		}
+		rendered, err := h.Terraform(h.newDatasourceResource(datasourcesPath, source.UID(), "", source), nil)
+		if err != nil {
+			t.Fatalf("Error rendering datasource: %s", err)
+		}
+		if len(rendered) != 1 || rendered[0].Type != "grafana_data_source" {
+			t.Fatalf("Expected a grafana_data_source, got %v", rendered)
+		}
+		actual, _ := json.Marshal(rendered[0].Attributes)
+		expected, _ := json.Marshal(test.Expected)
+		if string(actual) != string(expected) {
+			t.Errorf("Expected %s, got %s", expected, actual)
+		}
+		if rendered[0].ImportID != test.ImportID {
+			t.Errorf("Expected import ID %q, got %q", test.ImportID, rendered[0].ImportID)
+		}
+	}
+}
+
+func TestDatasourceHandlerApply(t *testing.T) {
+	tests := map[string]struct {
+		existing Datasource
+		add      bool
+		err      string
+	}{
+		"add": {
+			add: true,
+		},
+		"update": {
+			existing: Datasource{"name": "prometheus", "type": "prometheus", "url": "http://old:9090"},
+		},
+		"name taken": {
+			existing: Datasource{"name": "prometheus", "type": "prometheus", "url": "http://old:9090"},
+			add:      true,
+			err:      "Error while applying 'prometheus' to Grafana: data source with the same name already exists: conflict",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		h := NewDatasourceHandler(server.Endpoint())
+		ctx := context.Background()
+		if test.existing != nil {
+			server.AddDatasource(test.existing)
+		}
+
+		resource := h.newDatasourceResource(datasourcesPath, "prometheus", "", Datasource{"name": "prometheus", "type": "prometheus", "url": "http://prometheus:9090"})
+		var err error
+		if test.add {
+			err = h.Add(ctx, resource)
+		} else {
+			existing, getErr := h.GetRemote(ctx, "prometheus")
+			if getErr != nil {
+				t.Fatalf("Unexpected error retrieving datasource: %v", getErr)
+			}
+			err = h.Update(ctx, *existing, *h.Prepare(*existing, resource))
+		}
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			server.Close()
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error applying datasource: %v", err)
+		}
+		remote, err := h.GetRemote(ctx, "prometheus")
+		if err != nil {
+			t.Fatalf("Unexpected error retrieving datasource: %v", err)
+		}
+		if url := remote.Detail.(Datasource)["url"]; url != "http://prometheus:9090" {
+			t.Errorf("Expected url http://prometheus:9090, got: %v", url)
+		}
+		server.Close()
+	}
+}
+
+func TestDatasourceHandlerRemote(t *testing.T) {
+	server := grafanatest.NewServer()
+	defer server.Close()
+	h := NewDatasourceHandler(server.Endpoint())
+	ctx := context.Background()
+	server.AddDatasource(Datasource{"name": "loki", "type": "loki", "url": "http://loki:3100"})
+
+	if _, err := h.GetRemote(ctx, "missing"); err != grizzly.ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got: %v", err)
+	}
+	if err := h.Delete(ctx, "missing"); err != grizzly.ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting, got: %v", err)
+	}
+	remote, err := h.ListRemote(ctx, grizzly.ResourceList{})
+	if err != nil {
+		t.Fatalf("Unexpected error listing datasources: %v", err)
+	}
+	if _, ok := remote["datasource/loki"]; len(remote) != 1 || !ok {
+		t.Errorf("Expected datasource loki, got: %v", remote)
+	}
+	if err := h.Delete(ctx, "loki"); err != nil {
+		t.Errorf("Unexpected error deleting datasource: %v", err)
+	}
+	if _, ok := server.Datasource("loki"); ok {
+		t.Errorf("Expected datasource loki to be deleted")
+	}
+}
@@ -0,0 +1,97 @@
+package grafana
+
+import "strings"
+
+// Markers of resources managed by grizzly, see grizzly.MarkHandler
+const (
+	// dashboardMarkerTag tags dashboards managed by grizzly
+	dashboardMarkerTag = "managed-by:grizzly"
+	// dashboardSourceTag prefixes the tag naming the source of a dashboard
+	dashboardSourceTag = "grizzly-source:"
+	// datasourceMarkerField is set to "grizzly" in the jsonData of datasources
+	// managed by grizzly
+	datasourceMarkerField = "managedBy"
+	// datasourceSourceField names the source of a datasource in its jsonData
+	datasourceSourceField = "grizzlySource"
+)
+
+// isMarkerTag identifies the tags grizzly marks dashboards with
+func isMarkerTag(tag interface{}) bool {
+	s, ok := tag.(string)
+	return ok && (s == dashboardMarkerTag || strings.HasPrefix(s, dashboardSourceTag))
+}
+
+// markDashboard tags a dashboard as managed by grizzly, from source
+func markDashboard(board Dashboard, source string) {
+	tags := unmarkedTags(board["tags"])
+	tags = append(tags, dashboardMarkerTag)
+	if source != "" {
+		tags = append(tags, dashboardSourceTag+source)
+	}
+	board["tags"] = tags
+}
+
+// unmarkDashboard removes the tags grizzly marks a dashboard with
+func unmarkDashboard(board Dashboard) {
+	tags, ok := board["tags"].([]interface{})
+	if !ok {
+		return
+	}
+	unmarked := unmarkedTags(tags)
+	if len(unmarked) == 0 && len(tags) > 0 {
+		delete(board, "tags")
+		return
+	}
+	board["tags"] = unmarked
+}
+
+// dashboardMarked reports whether a dashboard is tagged as managed by grizzly
+func dashboardMarked(board Dashboard) bool {
+	tags, _ := board["tags"].([]interface{})
+	for _, tag := range tags {
+		if tag == dashboardMarkerTag {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarkedTags returns the tags of a dashboard other than markers
+func unmarkedTags(v interface{}) []interface{} {
+	tags, _ := v.([]interface{})
+	unmarked := []interface{}{}
+	for _, tag := range tags {
+		if !isMarkerTag(tag) {
+			unmarked = append(unmarked, tag)
+		}
+	}
+	return unmarked
+}
+
+// markDatasource sets the jsonData fields marking a datasource as managed by
+// grizzly, from source
+func markDatasource(source Datasource, from string) {
+	jsonData, ok := source["jsonData"].(map[string]interface{})
+	if !ok {
+		jsonData = map[string]interface{}{}
+		source["jsonData"] = jsonData
+	}
+	jsonData[datasourceMarkerField] = "grizzly"
+	if from != "" {
+		jsonData[datasourceSourceField] = from
+	}
+}
+
+// unmarkDatasource removes the jsonData fields marking a datasource
+func unmarkDatasource(source Datasource) {
+	if jsonData, ok := source["jsonData"].(map[string]interface{}); ok {
+		delete(jsonData, datasourceMarkerField)
+		delete(jsonData, datasourceSourceField)
+	}
+}
+
+// datasourceMarked reports whether a datasource is marked as managed by grizzly
+func datasourceMarked(source Datasource) bool {
+	jsonData, _ := source["jsonData"].(map[string]interface{})
+	return jsonData[datasourceMarkerField] == "grizzly"
+}
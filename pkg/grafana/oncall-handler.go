@@ -0,0 +1,164 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// OnCallHandler is a Grizzly Provider for one kind of Grafana OnCall resource
+type OnCallHandler struct {
+	kind     onCallKind
+	endpoint *grizzly.Endpoint
+}
+
+// NewOnCallIntegrationHandler returns a handler for OnCall integrations
+func NewOnCallIntegrationHandler(endpoint *grizzly.Endpoint) *OnCallHandler {
+	return &OnCallHandler{kind: onCallIntegrations, endpoint: endpoint}
+}
+
+// NewOnCallEscalationChainHandler returns a handler for OnCall escalation chains
+func NewOnCallEscalationChainHandler(endpoint *grizzly.Endpoint) *OnCallHandler {
+	return &OnCallHandler{kind: onCallEscalationChains, endpoint: endpoint}
+}
+
+// NewOnCallScheduleHandler returns a handler for OnCall schedules
+func NewOnCallScheduleHandler(endpoint *grizzly.Endpoint) *OnCallHandler {
+	return &OnCallHandler{kind: onCallSchedules, endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *OnCallHandler) GetName() string {
+	return h.kind.name
+}
+
+// GetFullName returns the name for this provider
+func (h *OnCallHandler) GetFullName() string {
+	return "grafana." + h.kind.name
+}
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *OnCallHandler) GetJSONPaths() []string {
+	return []string{
+		h.kind.jsonPath,
+	}
+}
+
+// GetExtension returns the file name extension for an OnCall resource
+func (h *OnCallHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana OnCall is not configured, if it is not
+func (h *OnCallHandler) Configured() error {
+	_, err := getOnCallURL(h.endpoint, "")
+	return err
+}
+
+func (h *OnCallHandler) newOnCallResource(filename string, r OnCallResource) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      r.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   r,
+		JSONPath: h.kind.jsonPath,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *OnCallHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		r := OnCallResource{}
+		err := mapstructure.Decode(v, &r)
+		if err != nil {
+			return nil, err
+		}
+		resource := h.newOnCallResource(k, r)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *OnCallHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	r := resource.Detail.(OnCallResource)
+	for _, field := range h.kind.serverFields {
+		delete(r, field)
+	}
+	if route, ok := r["default_route"].(map[string]interface{}); ok {
+		delete(route, "id")
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *OnCallHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	resource.Detail.(OnCallResource)["id"] = existing.Detail.(OnCallResource)["id"]
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *OnCallHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	r, err := getRemoteOnCallResource(ctx, h.endpoint, h.kind, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving %s %s: %v", h.kind.name, UID, err)
+	}
+	resource := h.newOnCallResource("", *r)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *OnCallHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves an OnCall resource as JSON
+func (h *OnCallHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves an OnCall resource as a Resource
+func (h *OnCallHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	r, err := getRemoteOnCallResource(ctx, h.endpoint, h.kind, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newOnCallResource("", *r)
+	return &resource, nil
+}
+
+// Add pushes a new resource to Grafana OnCall via the API
+func (h *OnCallHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postOnCallResource(ctx, h.endpoint, h.kind, resource.Detail.(OnCallResource))
+}
+
+// Update pushes a resource to Grafana OnCall via the API
+func (h *OnCallHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return putOnCallResource(ctx, h.endpoint, h.kind, resource.Detail.(OnCallResource))
+}
+
+// Delete removes a resource from Grafana OnCall via the API
+func (h *OnCallHandler) Delete(ctx context.Context, UID string) error {
+	return deleteOnCallResource(ctx, h.endpoint, h.kind, UID)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *OnCallHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
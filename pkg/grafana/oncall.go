@@ -0,0 +1,209 @@
+package grafana
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Grafana OnCall has its own API, authenticated with an OnCall API token.
+ * Resources are identified by server generated IDs, so resources are matched by
+ * name, and the ID of an existing resource is injected before updating it.
+ */
+
+// onCallKind describes a type of resource exposed by the OnCall API
+type onCallKind struct {
+	name     string
+	jsonPath string
+	endpoint string
+	// serverFields are generated by OnCall and never part of local resources
+	serverFields []string
+}
+
+var (
+	onCallIntegrations = onCallKind{
+		name:         "oncall-integration",
+		jsonPath:     "grafanaOnCallIntegrations",
+		endpoint:     "integrations",
+		serverFields: []string{"id", "link", "inbound_email", "heartbeat", "maintenance_mode", "maintenance_started_at", "maintenance_end_at"},
+	}
+	onCallEscalationChains = onCallKind{
+		name:         "oncall-escalation-chain",
+		jsonPath:     "grafanaOnCallEscalationChains",
+		endpoint:     "escalation_chains",
+		serverFields: []string{"id"},
+	}
+	onCallSchedules = onCallKind{
+		name:         "oncall-schedule",
+		jsonPath:     "grafanaOnCallSchedules",
+		endpoint:     "schedules",
+		serverFields: []string{"id", "on_call_now"},
+	}
+)
+
+// OnCallResource encapsulates an OnCall integration, escalation chain or schedule
+type OnCallResource map[string]interface{}
+
+// UID retrieves the UID from an OnCall resource
+func (r *OnCallResource) UID() string {
+	name, ok := (*r)["name"]
+	if !ok {
+		return ""
+	}
+	return name.(string)
+}
+
+func (r *OnCallResource) getID() (string, error) {
+	id, ok := (*r)["id"].(string)
+	if !ok {
+		return "", fmt.Errorf("OnCall resource %s requires an ID to update", r.UID())
+	}
+	return id, nil
+}
+
+func getOnCallURL(endpoint *grizzly.Endpoint, urlPath string) (string, error) {
+	if endpoint != nil {
+		return endpoint.JoinURL(path.Join("api/v1", urlPath) + "/")
+	}
+	onCallURL, exists := os.LookupEnv("GRAFANA_ONCALL_URL")
+	if !exists {
+		return "", fmt.Errorf("Require GRAFANA_ONCALL_URL and GRAFANA_ONCALL_TOKEN")
+	}
+	u, err := url.Parse(onCallURL)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, "api/v1", urlPath) + "/"
+	return u.String(), nil
+}
+
+func requestOnCall(ctx context.Context, endpoint *grizzly.Endpoint, method, onCallURL string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewBuffer(bs)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, onCallURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", os.Getenv("GRAFANA_ONCALL_TOKEN"))
+	req.Header.Add("Content-type", "application/json")
+
+	resp, err := endpoint.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("Non-200 response from Grafana OnCall: %s: %s", resp.Status, string(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return grizzly.APIErr{Err: err, Body: data}
+	}
+	return nil
+}
+
+// listOnCallResources retrieves all resources of a kind, following pagination
+func listOnCallResources(ctx context.Context, endpoint *grizzly.Endpoint, kind onCallKind) ([]OnCallResource, error) {
+	next, err := getOnCallURL(endpoint, kind.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	resources := []OnCallResource{}
+	for next != "" {
+		var page struct {
+			Next    string           `json:"next"`
+			Results []OnCallResource `json:"results"`
+		}
+		if err := requestOnCall(ctx, endpoint, "GET", next, nil, &page); err != nil {
+			return nil, err
+		}
+		resources = append(resources, page.Results...)
+		next = page.Next
+	}
+	return resources, nil
+}
+
+// getRemoteOnCallResource retrieves a resource of a kind by name
+func getRemoteOnCallResource(ctx context.Context, endpoint *grizzly.Endpoint, kind onCallKind, name string) (*OnCallResource, error) {
+	resources, err := listOnCallResources(ctx, endpoint, kind)
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		if resource.UID() == name {
+			return &resource, nil
+		}
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+func postOnCallResource(ctx context.Context, endpoint *grizzly.Endpoint, kind onCallKind, resource OnCallResource) error {
+	onCallURL, err := getOnCallURL(endpoint, kind.endpoint)
+	if err != nil {
+		return err
+	}
+	if err := requestOnCall(ctx, endpoint, "POST", onCallURL, resource, nil); err != nil {
+		return fmt.Errorf("Error while applying %s '%s': %v", kind.name, resource.UID(), err)
+	}
+	return nil
+}
+
+func putOnCallResource(ctx context.Context, endpoint *grizzly.Endpoint, kind onCallKind, resource OnCallResource) error {
+	id, err := resource.getID()
+	if err != nil {
+		return err
+	}
+	onCallURL, err := getOnCallURL(endpoint, path.Join(kind.endpoint, id))
+	if err != nil {
+		return err
+	}
+	if err := requestOnCall(ctx, endpoint, "PUT", onCallURL, resource, nil); err != nil {
+		return fmt.Errorf("Error while applying %s '%s': %v", kind.name, resource.UID(), err)
+	}
+	return nil
+}
+
+func deleteOnCallResource(ctx context.Context, endpoint *grizzly.Endpoint, kind onCallKind, name string) error {
+	resource, err := getRemoteOnCallResource(ctx, endpoint, kind, name)
+	if err != nil {
+		return err
+	}
+	id, err := resource.getID()
+	if err != nil {
+		return err
+	}
+	onCallURL, err := getOnCallURL(endpoint, path.Join(kind.endpoint, id))
+	if err != nil {
+		return err
+	}
+	if err := requestOnCall(ctx, endpoint, "DELETE", onCallURL, nil, nil); err != nil {
+		return fmt.Errorf("Error while deleting %s '%s': %v", kind.name, name, err)
+	}
+	return nil
+}
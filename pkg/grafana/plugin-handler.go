@@ -0,0 +1,156 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// PluginHandler is a Grizzly Provider for Grafana plugin settings
+type PluginHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewPluginHandler returns configuration defining a new Grafana Provider
+func NewPluginHandler(endpoint *grizzly.Endpoint) *PluginHandler {
+	return &PluginHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *PluginHandler) GetName() string {
+	return "plugin"
+}
+
+// GetFullName returns the name for this provider
+func (h *PluginHandler) GetFullName() string {
+	return "grafana.plugin"
+}
+
+const pluginsPath = "grafanaPlugins"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *PluginHandler) GetJSONPaths() []string {
+	return []string{
+		pluginsPath,
+	}
+}
+
+// GetExtension returns the file name extension for plugin settings
+func (h *PluginHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana is not configured, if it is not
+func (h *PluginHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
+func (h *PluginHandler) newPluginResource(path, filename string, settings PluginSettings) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      settings.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   settings,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *PluginHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		settings := PluginSettings{}
+		err := mapstructure.Decode(v, &settings)
+		if err != nil {
+			return nil, err
+		}
+		if settings.ID == "" {
+			settings.ID = k
+		}
+		if settings.JSONData == nil {
+			settings.JSONData = map[string]interface{}{}
+		}
+		resource := h.newPluginResource(path, k, settings)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *PluginHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *PluginHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *PluginHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	settings, err := getRemotePluginSettings(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving plugin %s: %v", UID, err)
+	}
+	resource := h.newPluginResource(pluginsPath, "", *settings)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate. Secure
+// JSON data is write-only, so is never included.
+func (h *PluginHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	settings := resource.Detail.(PluginSettings)
+	settings.SecureJSONData = nil
+	j, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves plugin settings as JSON
+func (h *PluginHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves plugin settings as a Resource
+func (h *PluginHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	settings, err := getRemotePluginSettings(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newPluginResource(pluginsPath, "", *settings)
+	return &resource, nil
+}
+
+// Add pushes plugin settings to Grafana via the API
+func (h *PluginHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postPluginSettings(ctx, h.endpoint, resource.Detail.(PluginSettings))
+}
+
+// Update pushes plugin settings to Grafana via the API
+func (h *PluginHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return postPluginSettings(ctx, h.endpoint, resource.Detail.(PluginSettings))
+}
+
+// Delete is not supported, as plugin settings cannot be removed
+func (h *PluginHandler) Delete(ctx context.Context, UID string) error {
+	return grizzly.ErrNotImplemented
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *PluginHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
@@ -0,0 +1,46 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// PluginSettings encapsulates the settings of an installed plugin. Only the
+// fields that can be changed via the API are retained.
+type PluginSettings struct {
+	ID             string                 `json:"id"`
+	Enabled        bool                   `json:"enabled"`
+	Pinned         bool                   `json:"pinned"`
+	JSONData       map[string]interface{} `json:"jsonData"`
+	SecureJSONData map[string]interface{} `json:"secureJsonData,omitempty"`
+}
+
+// UID retrieves the UID from plugin settings
+func (p *PluginSettings) UID() string {
+	return p.ID
+}
+
+// getRemotePluginSettings retrieves the settings of a plugin from Grafana
+func getRemotePluginSettings(ctx context.Context, endpoint *grizzly.Endpoint, id string) (*PluginSettings, error) {
+	var settings PluginSettings
+	err := requestJSON(ctx, endpoint, "GET", fmt.Sprintf("api/plugins/%s/settings", id), nil, &settings)
+	if err != nil {
+		return nil, err
+	}
+	if settings.JSONData == nil {
+		settings.JSONData = map[string]interface{}{}
+	}
+	return &settings, nil
+}
+
+// postPluginSettings updates the settings of a plugin. The plugin must already
+// be installed in Grafana.
+func postPluginSettings(ctx context.Context, endpoint *grizzly.Endpoint, settings PluginSettings) error {
+	err := requestJSON(ctx, endpoint, "POST", fmt.Sprintf("api/plugins/%s/settings", settings.ID), settings, nil)
+	if err != nil {
+		return fmt.Errorf("Error applying settings for plugin %s (is it installed?): %v", settings.ID, err)
+	}
+	return nil
+}
@@ -1,9 +1,20 @@
 package grafana
 
-import "github.com/grafana/grizzly/pkg/grizzly"
+import (
+	"context"
+	"fmt"
 
-// Provider defines a Grafana Provider
-type Provider struct{}
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// Provider defines a Grafana Provider. Its handlers send requests to the
+// endpoints of the APIs set, or configured by environment variables.
+type Provider struct {
+	Grafana             *grizzly.Endpoint
+	OnCall              *grizzly.Endpoint
+	Cloud               *grizzly.Endpoint
+	SyntheticMonitoring *grizzly.Endpoint
+}
 
 // GetName returns the name of the Grafana provider
 func (p *Provider) GetName() string {
@@ -13,8 +24,40 @@ func (p *Provider) GetName() string {
 // GetHandlers identifies the handlers for the Grafana provider
 func (p *Provider) GetHandlers() []grizzly.Handler {
 	return []grizzly.Handler{
-		&DashboardHandler{},
-		&DatasourceHandler{},
-		&SyntheticMonitoringHandler{},
+		NewDashboardHandler(p.Grafana),
+		NewDatasourceHandler(p.Grafana),
+		NewSyntheticMonitoringHandler(p.SyntheticMonitoring),
+		NewUserHandler(p.Grafana),
+		NewPluginHandler(p.Grafana),
+		NewReportHandler(p.Grafana),
+		NewOnCallIntegrationHandler(p.OnCall),
+		NewOnCallEscalationChainHandler(p.OnCall),
+		NewOnCallScheduleHandler(p.OnCall),
+		NewAccessPolicyHandler(p.Cloud),
+		NewSLOHandler(p.Grafana),
+	}
+}
+
+// Audit records an apply as an annotation in Grafana
+func (p *Provider) Audit(ctx context.Context, record grizzly.AuditRecord) error {
+	return postAnnotation(ctx, p.Grafana, newAuditAnnotation(record))
+}
+
+// PostApply records a deployment annotation in Grafana, and checks the health
+// of applied datasources, if requested
+func (p *Provider) PostApply(ctx context.Context, notifier grizzly.Notifier, resources grizzly.Resources, opts *grizzly.ApplyOpts) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.Annotate {
+		annotation := newDeployAnnotation(resources, opts.Commit)
+		if err := postAnnotation(ctx, p.Grafana, annotation); err != nil {
+			return fmt.Errorf("Error recording deployment annotation: %v", err)
+		}
+		notifier.Info(nil, "Annotation added: "+annotation.Text)
+	}
+	if opts.HealthCheck != "" {
+		return checkDatasourcesHealth(ctx, p.Grafana, notifier, resources, opts.HealthCheck)
 	}
+	return nil
 }
@@ -0,0 +1,20 @@
+package grafana
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+// provisioningYAML renders a provisioning file of Grafana, listing items
+// under a key, e.g. datasources
+func provisioningYAML(key string, items []interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(map[string]interface{}{
+		"apiVersion": 1,
+		key:          items,
+	})
+	return buf.String(), err
+}
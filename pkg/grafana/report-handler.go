@@ -0,0 +1,151 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// ReportHandler is a Grizzly Provider for Grafana Enterprise reports
+type ReportHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewReportHandler returns configuration defining a new Grafana Provider
+func NewReportHandler(endpoint *grizzly.Endpoint) *ReportHandler {
+	return &ReportHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *ReportHandler) GetName() string {
+	return "report"
+}
+
+// GetFullName returns the name for this provider
+func (h *ReportHandler) GetFullName() string {
+	return "grafana.report"
+}
+
+const reportsPath = "grafanaReports"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *ReportHandler) GetJSONPaths() []string {
+	return []string{
+		reportsPath,
+	}
+}
+
+// GetExtension returns the file name extension for a report
+func (h *ReportHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana is not configured, if it is not
+func (h *ReportHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
+func (h *ReportHandler) newReportResource(path, filename string, report Report) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      report.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   report,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *ReportHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		report := Report{}
+		err := mapstructure.Decode(v, &report)
+		if err != nil {
+			return nil, err
+		}
+		resource := h.newReportResource(path, k, report)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *ReportHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	for _, field := range reportServerFields {
+		delete(resource.Detail.(Report), field)
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *ReportHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	resource.Detail.(Report)["id"] = existing.Detail.(Report)["id"]
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *ReportHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	report, err := getRemoteReport(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving report %s: %v", UID, err)
+	}
+	resource := h.newReportResource(reportsPath, "", *report)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *ReportHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves a report as JSON
+func (h *ReportHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves a report as a Resource
+func (h *ReportHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	report, err := getRemoteReport(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newReportResource(reportsPath, "", *report)
+	return &resource, nil
+}
+
+// Add pushes a new report to Grafana via the API
+func (h *ReportHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postReport(ctx, h.endpoint, newReport(resource))
+}
+
+// Update pushes a report to Grafana via the API
+func (h *ReportHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return putReport(ctx, h.endpoint, newReport(resource))
+}
+
+// Delete removes a report from Grafana via the API
+func (h *ReportHandler) Delete(ctx context.Context, UID string) error {
+	return deleteReport(ctx, h.endpoint, UID)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *ReportHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
@@ -0,0 +1,122 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Reports are a Grafana Enterprise feature. The API identifies reports by a
+ * numeric ID generated by the server, so reports are matched by name, and the
+ * ID of an existing report is injected before updating it.
+ *
+ * Reports reference the dashboard to render by ID. As IDs differ between
+ * instances, a `dashboardUid` may be given instead, which is resolved to an ID
+ * before posting.
+ */
+
+// reportServerFields are generated by Grafana and never part of local resources
+var reportServerFields = []string{"id", "userId", "orgId", "dashboardId", "dashboardName", "created", "updated", "state"}
+
+// Report encapsulates a scheduled report
+type Report map[string]interface{}
+
+func newReport(resource grizzly.Resource) Report {
+	return resource.Detail.(Report)
+}
+
+// UID retrieves the UID from a report
+func (r *Report) UID() string {
+	name, ok := (*r)["name"]
+	if !ok {
+		return ""
+	}
+	return name.(string)
+}
+
+func (r *Report) getID() (int64, error) {
+	v, ok := (*r)["id"]
+	if !ok {
+		return 0, fmt.Errorf("Report %s requires an ID to update", r.UID())
+	}
+	return int64(v.(float64)), nil
+}
+
+// getRemoteReport retrieves a report object from Grafana, by name
+func getRemoteReport(ctx context.Context, endpoint *grizzly.Endpoint, name string) (*Report, error) {
+	reports := []Report{}
+	if err := requestJSON(ctx, endpoint, "GET", "api/reports", nil, &reports); err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		if report.UID() == name {
+			return &report, nil
+		}
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+// withDashboardID resolves a `dashboardUid` into the `dashboardId` Grafana expects
+func (r Report) withDashboardID(ctx context.Context, endpoint *grizzly.Endpoint) (Report, error) {
+	uid, ok := r["dashboardUid"].(string)
+	if !ok || uid == "" {
+		return r, nil
+	}
+	var d struct {
+		Dashboard struct {
+			ID int64 `json:"id"`
+		} `json:"dashboard"`
+	}
+	if err := requestJSON(ctx, endpoint, "GET", "api/dashboards/uid/"+uid, nil, &d); err != nil {
+		return nil, fmt.Errorf("Error resolving dashboard %s for report %s: %v", uid, r.UID(), err)
+	}
+	report := Report{}
+	for k, v := range r {
+		report[k] = v
+	}
+	report["dashboardId"] = d.Dashboard.ID
+	return report, nil
+}
+
+func postReport(ctx context.Context, endpoint *grizzly.Endpoint, report Report) error {
+	report, err := report.withDashboardID(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if err := requestJSON(ctx, endpoint, "POST", "api/reports", report, nil); err != nil {
+		return fmt.Errorf("Error while applying report '%s' to Grafana: %v", report.UID(), err)
+	}
+	return nil
+}
+
+func putReport(ctx context.Context, endpoint *grizzly.Endpoint, report Report) error {
+	id, err := report.getID()
+	if err != nil {
+		return err
+	}
+	report, err = report.withDashboardID(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	if err := requestJSON(ctx, endpoint, "PUT", fmt.Sprintf("api/reports/%d", id), report, nil); err != nil {
+		return fmt.Errorf("Error while applying report '%s' to Grafana: %v", report.UID(), err)
+	}
+	return nil
+}
+
+func deleteReport(ctx context.Context, endpoint *grizzly.Endpoint, name string) error {
+	report, err := getRemoteReport(ctx, endpoint, name)
+	if err != nil {
+		return err
+	}
+	id, err := report.getID()
+	if err != nil {
+		return err
+	}
+	if err := requestJSON(ctx, endpoint, "DELETE", fmt.Sprintf("api/reports/%d", id), nil, nil); err != nil {
+		return fmt.Errorf("Error while deleting report '%s' from Grafana: %v", name, err)
+	}
+	return nil
+}
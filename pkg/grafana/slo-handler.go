@@ -0,0 +1,151 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// SLOHandler is a Grizzly Provider for Grafana SLOs
+type SLOHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewSLOHandler returns configuration defining a new Grafana Provider
+func NewSLOHandler(endpoint *grizzly.Endpoint) *SLOHandler {
+	return &SLOHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *SLOHandler) GetName() string {
+	return "slo"
+}
+
+// GetFullName returns the name for this provider
+func (h *SLOHandler) GetFullName() string {
+	return "grafana.slo"
+}
+
+const slosPath = "grafanaSLOs"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *SLOHandler) GetJSONPaths() []string {
+	return []string{
+		slosPath,
+	}
+}
+
+// GetExtension returns the file name extension for an SLO
+func (h *SLOHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana is not configured, if it is not
+func (h *SLOHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
+func (h *SLOHandler) newSLOResource(path, filename string, slo SLO) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      slo.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   slo,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *SLOHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		slo := SLO{}
+		err := mapstructure.Decode(v, &slo)
+		if err != nil {
+			return nil, err
+		}
+		resource := h.newSLOResource(path, k, slo)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *SLOHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	for _, field := range sloServerFields {
+		delete(resource.Detail.(SLO), field)
+	}
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *SLOHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	resource.Detail.(SLO)["uuid"] = existing.Detail.(SLO)["uuid"]
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *SLOHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	slo, err := getRemoteSLO(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving SLO %s: %v", UID, err)
+	}
+	resource := h.newSLOResource(slosPath, "", *slo)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *SLOHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	j, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves an SLO as JSON
+func (h *SLOHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves an SLO as a Resource
+func (h *SLOHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	slo, err := getRemoteSLO(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newSLOResource(slosPath, "", *slo)
+	return &resource, nil
+}
+
+// Add pushes a new SLO to Grafana via the API
+func (h *SLOHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postSLO(ctx, h.endpoint, newSLO(resource))
+}
+
+// Update pushes an SLO to Grafana via the API
+func (h *SLOHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return putSLO(ctx, h.endpoint, newSLO(resource))
+}
+
+// Delete removes an SLO from Grafana via the API
+func (h *SLOHandler) Delete(ctx context.Context, UID string) error {
+	return deleteSLO(ctx, h.endpoint, UID)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *SLOHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
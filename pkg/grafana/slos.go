@@ -0,0 +1,84 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * SLOs are managed via the resource API of the Grafana SLO app plugin. The
+ * plugin generates a UUID for each SLO, so SLOs are matched by name, and the
+ * UUID of an existing SLO is injected before updating it.
+ */
+
+const sloAPIPath = "api/plugins/grafana-slo-app/resources/v1/slo"
+
+// sloServerFields are generated by the SLO plugin and never part of local resources
+var sloServerFields = []string{"uuid", "readOnly", "drillDownDashboardRef"}
+
+// SLO encapsulates a service level objective
+type SLO map[string]interface{}
+
+func newSLO(resource grizzly.Resource) SLO {
+	return resource.Detail.(SLO)
+}
+
+// UID retrieves the UID from an SLO
+func (s *SLO) UID() string {
+	name, ok := (*s)["name"]
+	if !ok {
+		return ""
+	}
+	return name.(string)
+}
+
+// getRemoteSLO retrieves an SLO from the SLO plugin, by name
+func getRemoteSLO(ctx context.Context, endpoint *grizzly.Endpoint, name string) (*SLO, error) {
+	var list struct {
+		SLOs []SLO `json:"slos"`
+	}
+	if err := requestJSON(ctx, endpoint, "GET", sloAPIPath, nil, &list); err != nil {
+		return nil, err
+	}
+	for _, slo := range list.SLOs {
+		if slo.UID() == name {
+			return &slo, nil
+		}
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+func postSLO(ctx context.Context, endpoint *grizzly.Endpoint, slo SLO) error {
+	if err := requestJSON(ctx, endpoint, "POST", sloAPIPath, slo, nil); err != nil {
+		return fmt.Errorf("Error while applying SLO '%s' to Grafana: %v", slo.UID(), err)
+	}
+	return nil
+}
+
+func putSLO(ctx context.Context, endpoint *grizzly.Endpoint, slo SLO) error {
+	uuid, ok := slo["uuid"].(string)
+	if !ok {
+		return fmt.Errorf("SLO %s requires a UUID to update", slo.UID())
+	}
+	if err := requestJSON(ctx, endpoint, "PUT", sloAPIPath+"/"+uuid, slo, nil); err != nil {
+		return fmt.Errorf("Error while applying SLO '%s' to Grafana: %v", slo.UID(), err)
+	}
+	return nil
+}
+
+func deleteSLO(ctx context.Context, endpoint *grizzly.Endpoint, name string) error {
+	slo, err := getRemoteSLO(ctx, endpoint, name)
+	if err != nil {
+		return err
+	}
+	uuid, ok := (*slo)["uuid"].(string)
+	if !ok {
+		return fmt.Errorf("SLO %s requires a UUID to delete", name)
+	}
+	if err := requestJSON(ctx, endpoint, "DELETE", sloAPIPath+"/"+uuid, nil, nil); err != nil {
+		return fmt.Errorf("Error while deleting SLO '%s' from Grafana: %v", name, err)
+	}
+	return nil
+}
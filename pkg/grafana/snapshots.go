@@ -0,0 +1,97 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+// snapshotNamePrefix starts the names of the snapshots grizzly creates as
+// previews, which identifies them among those shared from the Grafana UI
+const snapshotNamePrefix = "grizzly: "
+
+// snapshotNeverExpires is how far in the future Grafana sets the expiry of
+// snapshots that never expire, roughly
+const snapshotNeverExpires = 40 * 365 * 24 * time.Hour
+
+// listSnapshots lists the snapshots grizzly created as previews
+func listSnapshots(ctx context.Context, endpoint *grizzly.Endpoint) ([]grizzly.Snapshot, error) {
+	var listed []struct {
+		Key     string    `json:"key"`
+		Name    string    `json:"name"`
+		Created time.Time `json:"created"`
+		Expires time.Time `json:"expires"`
+	}
+	if err := requestJSON(ctx, endpoint, "GET", "api/dashboard/snapshots", nil, &listed); err != nil {
+		return nil, err
+	}
+	snapshots := []grizzly.Snapshot{}
+	for _, s := range listed {
+		if !strings.HasPrefix(s.Name, snapshotNamePrefix) {
+			continue
+		}
+		url, err := getGrafanaURL(endpoint, "dashboard/snapshot/"+s.Key)
+		if err != nil {
+			return nil, err
+		}
+		snapshot := grizzly.Snapshot{
+			Key:     s.Key,
+			Name:    strings.TrimPrefix(s.Name, snapshotNamePrefix),
+			URL:     url,
+			Created: s.Created,
+		}
+		if !s.Expires.IsZero() && s.Expires.Sub(s.Created) < snapshotNeverExpires {
+			expires := s.Expires
+			snapshot.Expires = &expires
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// deleteSnapshot deletes a snapshot, by key
+func deleteSnapshot(ctx context.Context, endpoint *grizzly.Endpoint, key string) error {
+	return requestJSON(ctx, endpoint, "DELETE", "api/snapshots/"+key, nil, nil)
+}
+
+// renderSnapshot renders a snapshot as a PNG image, with the image renderer
+// of Grafana
+func renderSnapshot(ctx context.Context, endpoint *grizzly.Endpoint, key string, opts *grizzly.PreviewOpts) ([]byte, error) {
+	query := url.Values{}
+	if opts.ImageWidth != 0 {
+		query.Set("width", strconv.Itoa(opts.ImageWidth))
+	}
+	if opts.ImageHeight != 0 {
+		query.Set("height", strconv.Itoa(opts.ImageHeight))
+	}
+	renderURL, err := getGrafanaURL(endpoint, "render/dashboard/snapshot/"+key+"?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := grafanaGet(ctx, endpoint, renderURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Non-200 response from Grafana while rendering snapshot %s, is the image renderer installed?: %s", key, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// snapshotKey returns the key of a snapshot from its URL
+func snapshotKey(snapshotURL string) (string, error) {
+	u, err := url.Parse(snapshotURL)
+	if err != nil {
+		return "", err
+	}
+	return path.Base(u.Path), nil
+}
@@ -0,0 +1,128 @@
+package grafana
+
+import (
+	"context"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grafanatest"
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestCleanupSnapshots(t *testing.T) {
+	tests := map[string]struct {
+		opts     grizzly.SnapshotCleanupOpts
+		expected []string
+	}{
+		"expired": {
+			expected: []string{"fresh", "old", "shared"},
+		},
+		"older than": {
+			opts:     grizzly.SnapshotCleanupOpts{OlderThan: 24 * time.Hour},
+			expected: []string{"fresh", "shared"},
+		},
+		"dry run": {
+			opts:     grizzly.SnapshotCleanupOpts{OlderThan: 24 * time.Hour, DryRun: true},
+			expected: []string{"expired", "fresh", "old", "shared"},
+		},
+	}
+	now := time.Now()
+	never := now.Add(50 * 365 * 24 * time.Hour)
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		server := grafanatest.NewServer()
+		keys := map[string]string{
+			server.AddSnapshot(snapshotNamePrefix+"Expired", now.Add(-2*time.Hour), now.Add(-time.Hour)): "expired",
+			server.AddSnapshot(snapshotNamePrefix+"Fresh", now.Add(-time.Hour), never):                   "fresh",
+			server.AddSnapshot(snapshotNamePrefix+"Old", now.Add(-48*time.Hour), never):                  "old",
+			server.AddSnapshot("Shared from the UI", now.Add(-48*time.Hour), now.Add(-time.Hour)):        "shared",
+		}
+		registry := grizzly.NewProviderRegistry()
+		if err := registry.RegisterProvider(&Provider{Grafana: server.Endpoint()}); err != nil {
+			t.Fatal(err)
+		}
+		config := grizzly.Config{Registry: registry}
+
+		opts := test.opts
+		if err := grizzly.CleanupSnapshots(context.Background(), config, &opts); err != nil {
+			t.Fatalf("Unexpected error cleaning up snapshots: %v", err)
+		}
+		left := []string{}
+		for _, key := range server.Snapshots() {
+			left = append(left, keys[key])
+		}
+		if !reflect.DeepEqual(left, test.expected) {
+			t.Errorf("Expected snapshots %v to be left, got: %v", test.expected, left)
+		}
+		server.Close()
+	}
+}
+
+func TestPreviewImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := grafanatest.NewServer()
+	defer server.Close()
+	for _, board := range []map[string]interface{}{
+		{"uid": "unchanged", "title": "Unchanged"},
+		{"uid": "changed", "title": "Before"},
+	} {
+		if err := server.AddDashboard("", board); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := grizzly.NewProviderRegistry()
+	if err := registry.RegisterProvider(&Provider{Grafana: server.Endpoint()}); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := registry.GetHandler("dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resourceList, err := handler.Parse(dashboardsPath, map[string]interface{}{
+		"unchanged.json": map[string]interface{}{"uid": "unchanged", "title": "Unchanged", "folderName": "General"},
+		"changed.json":   map[string]interface{}{"uid": "changed", "title": "After", "folderName": "General"},
+		"added.json":     map[string]interface{}{"uid": "added", "title": "Added", "folderName": "General"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := grizzly.Config{Registry: registry}
+	opts := &grizzly.PreviewOpts{ImageDir: dir, ImageWidth: 40, ImageHeight: 20}
+	if err := grizzly.Preview(context.Background(), config, grizzly.Resources{handler: resourceList}, opts); err != nil {
+		t.Fatalf("Unexpected error previewing: %v", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := []string{}
+	for _, file := range files {
+		rendered = append(rendered, file.Name())
+	}
+	expected := []string{"dashboard-added.png", "dashboard-changed.png"}
+	if !reflect.DeepEqual(rendered, expected) {
+		t.Fatalf("Expected images %v, got: %v", expected, rendered)
+	}
+	f, err := os.Open(filepath.Join(dir, "dashboard-changed.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("Expected a PNG image, got: %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 40 || size.Y != 20 {
+		t.Errorf("Expected an image of 40x20, got: %dx%d", size.X, size.Y)
+	}
+}
@@ -1,8 +1,11 @@
 package grafana
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 	"github.com/mitchellh/mapstructure"
@@ -21,11 +24,13 @@ import (
  */
 
 // SyntheticMonitoringHandler is a Grizzly Provider for Grafana Synthetic Monitoring
-type SyntheticMonitoringHandler struct{}
+type SyntheticMonitoringHandler struct {
+	endpoint *grizzly.Endpoint
+}
 
 // NewSyntheticMonitoringHandler returns configuration defining a new Grafana Provider
-func NewSyntheticMonitoringHandler() *SyntheticMonitoringHandler {
-	return &SyntheticMonitoringHandler{}
+func NewSyntheticMonitoringHandler(endpoint *grizzly.Endpoint) *SyntheticMonitoringHandler {
+	return &SyntheticMonitoringHandler{endpoint: endpoint}
 }
 
 // GetName returns the name for this provider
@@ -52,6 +57,14 @@ func (h *SyntheticMonitoringHandler) GetExtension() string {
 	return "json"
 }
 
+// Configured returns why Synthetic Monitoring is not configured, if it is not
+func (h *SyntheticMonitoringHandler) Configured() error {
+	if _, exists := os.LookupEnv("GRAFANA_SM_TOKEN"); !exists {
+		return fmt.Errorf("Require GRAFANA_SM_TOKEN")
+	}
+	return nil
+}
+
 func (h *SyntheticMonitoringHandler) newCheckResource(path string, filename string, check Check) grizzly.Resource {
 	resource := grizzly.Resource{
 		UID:      check.UID(),
@@ -73,13 +86,29 @@ func (h *SyntheticMonitoringHandler) Parse(path string, i interface{}) (grizzly.
 		if err != nil {
 			return nil, err
 		}
+		if err := check.validate(); err != nil {
+			return nil, err
+		}
+		probes := check.probeNames()
+		sort.Strings(probes)
+		check["probes"] = probes
 		resource := h.newCheckResource(path, k, check)
-		key := resource.Key()
-		resources[key] = resource
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
 	}
 	return resources, nil
 }
 
+// Validate checks a check is complete enough to be applied
+func (h *SyntheticMonitoringHandler) Validate(resource grizzly.Resource) []error {
+	check := resource.Detail.(Check)
+	if err := check.validate(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
 // Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
 func (h *SyntheticMonitoringHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
 	delete(resource.Detail.(Check), "tenantId")
@@ -97,8 +126,8 @@ func (h *SyntheticMonitoringHandler) Prepare(existing, resource grizzly.Resource
 }
 
 // GetByUID retrieves JSON for a resource from an endpoint, by UID
-func (h *SyntheticMonitoringHandler) GetByUID(UID string) (*grizzly.Resource, error) {
-	check, err := getRemoteCheck(UID)
+func (h *SyntheticMonitoringHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	check, err := getRemoteCheck(ctx, h.endpoint, UID)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving check %s: %v", UID, err)
 	}
@@ -116,17 +145,17 @@ func (h *SyntheticMonitoringHandler) GetRepresentation(uid string, resource griz
 }
 
 // GetRemoteRepresentation retrieves a datasource as JSON
-func (h *SyntheticMonitoringHandler) GetRemoteRepresentation(uid string) (string, error) {
-	check, err := getRemoteCheck(uid)
+func (h *SyntheticMonitoringHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	check, err := getRemoteCheck(ctx, h.endpoint, uid)
 	if err != nil {
 		return "", err
 	}
-	return check.toJSON()
+	return check.toJSON(ctx, h.endpoint)
 }
 
 // GetRemote retrieves a datasource as a Resource
-func (h *SyntheticMonitoringHandler) GetRemote(uid string) (*grizzly.Resource, error) {
-	check, err := getRemoteCheck(uid)
+func (h *SyntheticMonitoringHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	check, err := getRemoteCheck(ctx, h.endpoint, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -135,19 +164,24 @@ func (h *SyntheticMonitoringHandler) GetRemote(uid string) (*grizzly.Resource, e
 }
 
 // Add adds a new check to the SyntheticMonitoring endpoint
-func (h *SyntheticMonitoringHandler) Add(resource grizzly.Resource) error {
-	url := getURL("api/v1/check/add")
-	return postCheck(url, newCheck(resource))
+func (h *SyntheticMonitoringHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	url := getURL(h.endpoint, "api/v1/check/add")
+	return postCheck(ctx, h.endpoint, url, newCheck(resource))
 }
 
 // Update pushes an updated check to the SyntheticMonitoring endpoing
-func (h *SyntheticMonitoringHandler) Update(existing, resource grizzly.Resource) error {
+func (h *SyntheticMonitoringHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
 	check := newCheck(resource)
-	url := getURL("api/v1/check/update")
-	return postCheck(url, check)
+	url := getURL(h.endpoint, "api/v1/check/update")
+	return postCheck(ctx, h.endpoint, url, check)
+}
+
+// Delete removes a check from the SyntheticMonitoring endpoint
+func (h *SyntheticMonitoringHandler) Delete(ctx context.Context, UID string) error {
+	return deleteCheck(ctx, h.endpoint, UID)
 }
 
 // Preview renders Jsonnet then pushes them to the endpoint if previews are possible
-func (h *SyntheticMonitoringHandler) Preview(resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+func (h *SyntheticMonitoringHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
 	return grizzly.ErrNotImplemented
 }
@@ -2,12 +2,15 @@ package grafana
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 )
@@ -25,23 +28,26 @@ import (
  * 4. The API expects probes to be specified by ID. This is not
  *    user-friendly. This code therefore takes in strings, and converts
  *    them to IDs, having requested an ID<->string mapping from the API.
+ *    Probe names are kept sorted so that their order does not matter.
  */
 
-const smURL = "https://synthetic-monitoring-api.grafana.net/%s"
+const smURL = "https://synthetic-monitoring-api.grafana.net"
+
+// checkTypes lists the types of check supported by Synthetic Monitoring
+var checkTypes = []string{"http", "ping", "dns", "tcp"}
 
 // getRemoteCheck retrieves a check object from SM
-func getRemoteCheck(uid string) (*Check, error) {
-	url := getURL("api/v1/check/list")
-	authToken, err := getAuthToken()
+func getRemoteCheck(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*Check, error) {
+	url := getURL(endpoint, "api/v1/check/list")
+	authToken, err := getAuthToken(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Add("Authorization", "Bearer "+authToken)
 	req.Header.Add("Content-type", "application/json")
 
-	resp, err := client.Do(req)
+	resp, err := endpoint.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +71,7 @@ func getRemoteCheck(uid string) (*Check, error) {
 	if err := json.Unmarshal(data, &checks); err != nil {
 		return nil, grizzly.APIErr{Err: err, Body: data}
 	}
-	probes, err := getProbeList()
+	probes, err := getProbeList(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
@@ -74,9 +80,13 @@ func getRemoteCheck(uid string) (*Check, error) {
 			probeNames := []string{}
 			for _, probe := range check["probes"].([]interface{}) {
 				probeID := int(probe.(float64))
-				name := probes.ByID[probeID].Name
-				probeNames = append(probeNames, name)
+				probe, ok := probes.ByID[probeID]
+				if !ok {
+					return nil, fmt.Errorf("Check %s uses unknown probe %d", uid, probeID)
+				}
+				probeNames = append(probeNames, probe.Name)
 			}
+			sort.Strings(probeNames)
 			check["probes"] = probeNames
 			return &check, nil
 		}
@@ -84,24 +94,23 @@ func getRemoteCheck(uid string) (*Check, error) {
 	return nil, grizzly.ErrNotFound
 }
 
-func postCheck(url string, check Check) error {
-	checkJSON, err := check.toJSON()
+func postCheck(ctx context.Context, endpoint *grizzly.Endpoint, url string, check Check) error {
+	checkJSON, err := check.toJSON(ctx, endpoint)
 	if err != nil {
 		return err
 	}
 
-	client := &http.Client{}
-	accessToken, err := getAuthToken()
+	accessToken, err := getAuthToken(ctx, endpoint)
 	if err != nil {
 		return err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBufferString(checkJSON))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(checkJSON))
 	if err != nil {
 		return err
 	}
 	req.Header.Add("Authorization", "Bearer "+accessToken)
 	req.Header.Add("Content-type", "application/json")
-	resp, err := client.Do(req)
+	resp, err := endpoint.Do(req)
 	if err != nil {
 		return err
 	}
@@ -115,6 +124,37 @@ func postCheck(url string, check Check) error {
 	return nil
 }
 
+func deleteCheck(ctx context.Context, endpoint *grizzly.Endpoint, uid string) error {
+	check, err := getRemoteCheck(ctx, endpoint, uid)
+	if err != nil {
+		return err
+	}
+	id, ok := (*check)["id"].(float64)
+	if !ok {
+		return fmt.Errorf("Check %s requires an ID to delete", uid)
+	}
+
+	accessToken, err := getAuthToken(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "DELETE", getURL(endpoint, fmt.Sprintf("api/v1/check/delete/%d", int64(id))), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	resp, err := endpoint.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Non-200 response from Grafana Synthetic Monitoring while deleting '%s': %s", uid, resp.Status)
+	}
+	return nil
+}
+
 // Probe defines the properties of a single SM Probe
 type Probe struct {
 	ID       int    `json:"id"`
@@ -132,17 +172,16 @@ type Probes struct {
 }
 
 // getRemoteCheck retrieves a check object from SM
-func getProbeList() (*Probes, error) {
-	url := getURL("api/v1/probe/list")
-	authToken, err := getAuthToken()
+func getProbeList(ctx context.Context, endpoint *grizzly.Endpoint) (*Probes, error) {
+	url := getURL(endpoint, "api/v1/probe/list")
+	authToken, err := getAuthToken(ctx, endpoint)
 	if err != nil {
 		return nil, err
 	}
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Add("Authorization", "Bearer "+authToken)
 
-	resp, err := client.Do(req)
+	resp, err := endpoint.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -170,15 +209,27 @@ func getProbeList() (*Probes, error) {
 		ByID:   map[int]Probe{},
 		ByName: map[string]Probe{},
 	}
+	// Private and offline probes can still be selected by a check
 	for _, probe := range probeList {
-		if probe.Online && probe.Public {
-			probes.ByID[probe.ID] = probe
-			probes.ByName[probe.Name] = probe
-		}
+		probes.ByID[probe.ID] = probe
+		probes.ByName[probe.Name] = probe
 	}
 	return &probes, nil
 }
 
+// probeIDs resolves probe names to the IDs expected by the API
+func (p *Probes) probeIDs(names []string) ([]int, error) {
+	ids := []int{}
+	for _, name := range names {
+		probe, ok := p.ByName[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown probe %q", name)
+		}
+		ids = append(ids, probe.ID)
+	}
+	return ids, nil
+}
+
 // Check encapsulates a check
 type Check map[string]interface{}
 
@@ -188,51 +239,101 @@ func newCheck(resource grizzly.Resource) Check {
 
 // UID retrieves the UID from a check
 func (c *Check) UID() string {
-	job, ok := (*c)["job"]
+	return fmt.Sprintf("%s-%s", c.checkType(), (*c)["job"])
+}
+
+// checkType returns the type of a check, i.e. the single key of its settings
+func (c *Check) checkType() string {
+	settings, ok := (*c)["settings"].(map[string]interface{})
 	if !ok {
-		return "X"
+		return ""
 	}
-	settings, ok := (*c)["settings"]
-	if !ok {
-		return "Y"
+	for typ := range settings {
+		return typ
+	}
+	return ""
+}
+
+// probeNames returns the names of the probes a check runs on
+func (c *Check) probeNames() []string {
+	names := []string{}
+	switch probes := (*c)["probes"].(type) {
+	case []interface{}:
+		for _, probe := range probes {
+			names = append(names, fmt.Sprint(probe))
+		}
+	case []string:
+		names = append(names, probes...)
+	}
+	return names
+}
+
+// validate ensures a check is complete enough to be identified and applied
+func (c *Check) validate() error {
+	if _, ok := (*c)["job"].(string); !ok {
+		return fmt.Errorf("Check has no job set")
+	}
+	if _, ok := (*c)["target"].(string); !ok {
+		return fmt.Errorf("Check %s has no target set", (*c)["job"])
 	}
-	for typ := range settings.(map[string]interface{}) {
-		return fmt.Sprintf("%s-%s", typ, job)
+	settings, ok := (*c)["settings"].(map[string]interface{})
+	if !ok || len(settings) != 1 {
+		return fmt.Errorf("Check %s must have exactly one of %s in its settings", (*c)["job"], strings.Join(checkTypes, ", "))
 	}
-	return "NIL"
+	typ := c.checkType()
+	for _, t := range checkTypes {
+		if t == typ {
+			return nil
+		}
+	}
+	return fmt.Errorf("Check %s has unsupported type %s, expected one of %s", (*c)["job"], typ, strings.Join(checkTypes, ", "))
 }
 
-// toJSON returns JSON for a datasource
-func (c *Check) toJSON() (string, error) {
-	probes, err := getProbeList()
+// toJSON returns JSON for a check, with probe names converted to IDs
+func (c *Check) toJSON(ctx context.Context, endpoint *grizzly.Endpoint) (string, error) {
+	probes, err := getProbeList(ctx, endpoint)
 	if err != nil {
 		return "", err
 	}
-	probeIDs := []int{}
-	for _, probe := range (*c)["probes"].([]interface{}) {
-		probeName := probe.(string)
-		id := probes.ByName[probeName].ID
-		probeIDs = append(probeIDs, id)
+	probeIDs, err := probes.probeIDs(c.probeNames())
+	if err != nil {
+		return "", fmt.Errorf("Check %s: %v", c.UID(), err)
+	}
+	check := Check{}
+	for k, v := range *c {
+		check[k] = v
 	}
-	(*c)["probes"] = probeIDs
+	check["probes"] = probeIDs
 
-	j, err := json.MarshalIndent(c, "", "  ")
+	j, err := json.MarshalIndent(check, "", "  ")
 	if err != nil {
 		return "", err
 	}
 	return string(j), nil
 }
 
-func getURL(path string) string {
-	return fmt.Sprintf(smURL, path)
+func getURL(endpoint *grizzly.Endpoint, urlPath string) string {
+	base, exists := os.LookupEnv("GRAFANA_SM_URL")
+	if !exists {
+		base = smURL
+	}
+	if endpoint != nil {
+		base = endpoint.URL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + urlPath
 }
 
-func getAuthToken() (string, error) {
-	url := getURL("api/v1/register/init")
+func getAuthToken(ctx context.Context, endpoint *grizzly.Endpoint) (string, error) {
+	url := getURL(endpoint, "api/v1/register/init")
 	apiToken := os.Getenv("GRAFANA_SM_TOKEN")
 	authRequest := fmt.Sprintf(`{"apiToken":"%s"}`, apiToken)
 
-	resp, err := http.Post(url, "application/json", bytes.NewBufferString(authRequest))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString(authRequest))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := endpoint.Do(req)
 	if err != nil {
 		return "", err
 	} else if resp.StatusCode >= 400 {
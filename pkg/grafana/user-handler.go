@@ -0,0 +1,153 @@
+package grafana
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// UserHandler is a Grizzly Provider for Grafana users
+type UserHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewUserHandler returns configuration defining a new Grafana Provider
+func NewUserHandler(endpoint *grizzly.Endpoint) *UserHandler {
+	return &UserHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *UserHandler) GetName() string {
+	return "user"
+}
+
+// GetFullName returns the name for this provider
+func (h *UserHandler) GetFullName() string {
+	return "grafana.user"
+}
+
+const usersPath = "grafanaUsers"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *UserHandler) GetJSONPaths() []string {
+	return []string{
+		usersPath,
+	}
+}
+
+// GetExtension returns the file name extension for a user
+func (h *UserHandler) GetExtension() string {
+	return "json"
+}
+
+// Configured returns why Grafana is not configured, if it is not
+func (h *UserHandler) Configured() error {
+	_, err := getGrafanaURL(h.endpoint, "")
+	return err
+}
+
+func (h *UserHandler) newUserResource(path, filename string, user User) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      user.UID(),
+		Filename: filename,
+		Handler:  h,
+		Detail:   user,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *UserHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	for k, v := range msi {
+		user := User{}
+		err := mapstructure.Decode(v, &user)
+		if err != nil {
+			return nil, err
+		}
+		if user.Login == "" {
+			return nil, fmt.Errorf("User %s has no login set", k)
+		}
+		user.sortOrgs()
+		resource := h.newUserResource(path, k, user)
+		if err := resources.Add(resource); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *UserHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *UserHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *UserHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	user, err := getRemoteUser(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving user %s: %v", UID, err)
+	}
+	resource := h.newUserResource(usersPath, "", *user)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *UserHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	user := resource.Detail.(User)
+	user.Password = ""
+	j, err := json.MarshalIndent(user, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(j), nil
+}
+
+// GetRemoteRepresentation retrieves a user as JSON
+func (h *UserHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves a user as a Resource
+func (h *UserHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	user, err := getRemoteUser(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newUserResource(usersPath, "", *user)
+	return &resource, nil
+}
+
+// Add creates a user in Grafana via the API
+func (h *UserHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return postUser(ctx, h.endpoint, resource.Detail.(User))
+}
+
+// Update pushes a user and its org memberships to Grafana via the API
+func (h *UserHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return putUser(ctx, h.endpoint, existing.Detail.(User), resource.Detail.(User))
+}
+
+// Delete removes a user from Grafana via the API
+func (h *UserHandler) Delete(ctx context.Context, UID string) error {
+	return deleteUser(ctx, h.endpoint, UID)
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *UserHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
@@ -0,0 +1,197 @@
+package grafana
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * Users are identified by their login. Grafana assigns a numeric ID when a user
+ * is created, which is needed for all subsequent calls, so we look it up by
+ * login before every update.
+ *
+ * Passwords are only used when creating a user. Grafana never returns them,
+ * so they are not part of the representation used for diffing.
+ */
+
+// User encapsulates a local Grafana user and its org memberships
+type User struct {
+	Login          string    `json:"login"`
+	Email          string    `json:"email,omitempty"`
+	Name           string    `json:"name,omitempty"`
+	Password       string    `json:"password,omitempty"`
+	IsGrafanaAdmin bool      `json:"isGrafanaAdmin"`
+	Orgs           []UserOrg `json:"orgs,omitempty"`
+}
+
+// UserOrg describes the role a user has within an org
+type UserOrg struct {
+	OrgID int64  `json:"orgId"`
+	Role  string `json:"role"`
+}
+
+// UID retrieves the UID from a user
+func (u *User) UID() string {
+	return u.Login
+}
+
+func (u *User) sortOrgs() {
+	sort.Slice(u.Orgs, func(i, j int) bool {
+		return u.Orgs[i].OrgID < u.Orgs[j].OrgID
+	})
+}
+
+type remoteUser struct {
+	ID             int64  `json:"id"`
+	Login          string `json:"login"`
+	Email          string `json:"email"`
+	Name           string `json:"name"`
+	IsGrafanaAdmin bool   `json:"isGrafanaAdmin"`
+}
+
+func lookupUser(ctx context.Context, endpoint *grizzly.Endpoint, login string) (*remoteUser, error) {
+	var u remoteUser
+	err := requestJSON(ctx, endpoint, "GET", "api/users/lookup?loginOrEmail="+url.QueryEscape(login), nil, &u)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func getUserOrgs(ctx context.Context, endpoint *grizzly.Endpoint, id int64) ([]UserOrg, error) {
+	orgs := []UserOrg{}
+	err := requestJSON(ctx, endpoint, "GET", fmt.Sprintf("api/users/%d/orgs", id), nil, &orgs)
+	return orgs, err
+}
+
+// getRemoteUser retrieves a user, along with its org memberships, from Grafana
+func getRemoteUser(ctx context.Context, endpoint *grizzly.Endpoint, login string) (*User, error) {
+	remote, err := lookupUser(ctx, endpoint, login)
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := getUserOrgs(ctx, endpoint, remote.ID)
+	if err != nil {
+		return nil, err
+	}
+	user := User{
+		Login:          remote.Login,
+		Email:          remote.Email,
+		Name:           remote.Name,
+		IsGrafanaAdmin: remote.IsGrafanaAdmin,
+		Orgs:           orgs,
+	}
+	user.sortOrgs()
+	return &user, nil
+}
+
+func postUser(ctx context.Context, endpoint *grizzly.Endpoint, user User) error {
+	if user.Password == "" {
+		return fmt.Errorf("User %s requires a password to be created", user.Login)
+	}
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := requestJSON(ctx, endpoint, "POST", "api/admin/users", user, &created)
+	if err != nil {
+		return fmt.Errorf("Error creating user %s: %v", user.Login, err)
+	}
+	if user.IsGrafanaAdmin {
+		if err := putUserPermissions(ctx, endpoint, created.ID, true); err != nil {
+			return err
+		}
+	}
+	// Grafana adds new users to the default org automatically
+	existing, err := getUserOrgs(ctx, endpoint, created.ID)
+	if err != nil {
+		return err
+	}
+	return syncUserOrgs(ctx, endpoint, created.ID, user, existing)
+}
+
+func putUser(ctx context.Context, endpoint *grizzly.Endpoint, existing, user User) error {
+	remote, err := lookupUser(ctx, endpoint, existing.Login)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{
+		"login": user.Login,
+		"email": user.Email,
+		"name":  user.Name,
+	}
+	if err := requestJSON(ctx, endpoint, "PUT", fmt.Sprintf("api/users/%d", remote.ID), body, nil); err != nil {
+		return fmt.Errorf("Error updating user %s: %v", user.Login, err)
+	}
+	if existing.IsGrafanaAdmin != user.IsGrafanaAdmin {
+		if err := putUserPermissions(ctx, endpoint, remote.ID, user.IsGrafanaAdmin); err != nil {
+			return err
+		}
+	}
+	return syncUserOrgs(ctx, endpoint, remote.ID, user, existing.Orgs)
+}
+
+func putUserPermissions(ctx context.Context, endpoint *grizzly.Endpoint, id int64, isGrafanaAdmin bool) error {
+	body := map[string]bool{
+		"isGrafanaAdmin": isGrafanaAdmin,
+	}
+	return requestJSON(ctx, endpoint, "PUT", fmt.Sprintf("api/admin/users/%d/permissions", id), body, nil)
+}
+
+// deleteUser removes a user from Grafana, and so from all of its orgs
+func deleteUser(ctx context.Context, endpoint *grizzly.Endpoint, login string) error {
+	remote, err := lookupUser(ctx, endpoint, login)
+	if err != nil {
+		return err
+	}
+	if err := requestJSON(ctx, endpoint, "DELETE", fmt.Sprintf("api/admin/users/%d", remote.ID), nil, nil); err != nil {
+		return fmt.Errorf("Error while deleting user '%s' from Grafana: %v", login, err)
+	}
+	return nil
+}
+
+// syncUserOrgs adds, updates and removes org memberships so that they match the user
+func syncUserOrgs(ctx context.Context, endpoint *grizzly.Endpoint, id int64, user User, existing []UserOrg) error {
+	current := map[int64]string{}
+	for _, org := range existing {
+		current[org.OrgID] = org.Role
+	}
+	wanted := map[int64]bool{}
+	for _, org := range user.Orgs {
+		wanted[org.OrgID] = true
+		role, ok := current[org.OrgID]
+		switch {
+		case !ok:
+			body := map[string]string{
+				"loginOrEmail": user.Login,
+				"role":         org.Role,
+			}
+			if err := requestJSON(ctx, endpoint, "POST", fmt.Sprintf("api/orgs/%d/users", org.OrgID), body, nil); err != nil {
+				return fmt.Errorf("Error adding user %s to org %d: %v", user.Login, org.OrgID, err)
+			}
+		case role != org.Role:
+			body := map[string]string{
+				"role": org.Role,
+			}
+			if err := requestJSON(ctx, endpoint, "PATCH", fmt.Sprintf("api/orgs/%d/users/%d", org.OrgID, id), body, nil); err != nil {
+				return fmt.Errorf("Error updating role of user %s in org %d: %v", user.Login, org.OrgID, err)
+			}
+		}
+	}
+	if len(user.Orgs) == 0 {
+		return nil
+	}
+	for orgID := range current {
+		if wanted[orgID] {
+			continue
+		}
+		err := requestJSON(ctx, endpoint, "DELETE", fmt.Sprintf("api/orgs/%d/users/%d", orgID, id), nil, nil)
+		if err != nil && err != grizzly.ErrNotFound {
+			return fmt.Errorf("Error removing user %s from org %d: %v", user.Login, orgID, err)
+		}
+	}
+	return nil
+}
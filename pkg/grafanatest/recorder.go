@@ -0,0 +1,281 @@
+package grafanatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * A Recorder records the requests integration tests send to a real Grafana,
+ * and its responses, in a cassette file, then replays them, so that the
+ * tests run deterministically in CI, without an instance:
+ *
+ *   recorder, err := grafanatest.NewRecorder("testdata/dashboards.json", &grizzly.Endpoint{
+ *     URL:    os.Getenv("GRAFANA_URL"),
+ *     Header: http.Header{"Authorization": {"Bearer " + os.Getenv("GRAFANA_TOKEN")}},
+ *   })
+ *   handler := grafana.NewDashboardHandler(recorder.Endpoint())
+ *   ...
+ *   err = recorder.Close()
+ *
+ * Tests record with GRIZZLY_RECORD=true, and replay otherwise. Replaying fails
+ * requests that were not recorded, or were with another body, and Close
+ * reports the recorded requests that were not sent: either way, the requests
+ * grizzly sends changed, and the cassette should be recorded again, which
+ * shows the changes of the responses of Grafana in its diff.
+ *
+ * Only the method, path, query and body of requests, and the status, content
+ * type and body of responses are recorded, so credentials are not.
+ */
+
+// RecordEnv is the environment variable set to true to record cassettes,
+// rather than replay them
+const RecordEnv = "GRIZZLY_RECORD"
+
+// Interaction is a request recorded, with its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request recorded. JSON bodies are recorded as JSON,
+// others as strings.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	// URL is the path and query of the request, relative to the endpoint
+	URL  string          `json:"url"`
+	JSON json.RawMessage `json:"json,omitempty"`
+	Body string          `json:"body,omitempty"`
+}
+
+// RecordedResponse is a response recorded
+type RecordedResponse struct {
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType,omitempty"`
+	JSON        json.RawMessage `json:"json,omitempty"`
+	Body        string          `json:"body,omitempty"`
+}
+
+// Recorder records or replays the requests sent to an endpoint
+type Recorder struct {
+	cassette  string
+	recording bool
+	endpoint  grizzly.Endpoint
+	basePath  string
+	next      http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewRecorder returns a recorder of the requests sent to an endpoint, if
+// RecordEnv is set, or a recorder replaying the cassette otherwise, in which
+// case the endpoint is not sent any request, and may be nil
+func NewRecorder(cassette string, endpoint *grizzly.Endpoint) (*Recorder, error) {
+	r := &Recorder{cassette: cassette}
+	if endpoint != nil {
+		r.endpoint = *endpoint
+	}
+	if record, ok := os.LookupEnv(RecordEnv); ok {
+		recording, err := strconv.ParseBool(record)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", RecordEnv, err)
+		}
+		r.recording = recording
+	}
+
+	if r.recording {
+		if r.endpoint.URL == "" {
+			return nil, fmt.Errorf("Recording %s requires the URL of the endpoint to record", cassette)
+		}
+		client := r.endpoint.Client
+		if client == nil {
+			client = grizzly.HTTPClient()
+		}
+		r.next = client.Transport
+		if r.next == nil {
+			r.next = http.DefaultTransport
+		}
+	} else {
+		data, err := ioutil.ReadFile(cassette)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Cassette %s does not exist, record it with %s=true", cassette, RecordEnv)
+		} else if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &r.interactions); err != nil {
+			return nil, fmt.Errorf("Invalid cassette %s: %v", cassette, err)
+		}
+		r.replayed = make([]bool, len(r.interactions))
+		if r.endpoint.URL == "" {
+			r.endpoint.URL = "http://grafana.invalid"
+		}
+	}
+
+	base, err := url.Parse(r.endpoint.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid endpoint URL: %v", err)
+	}
+	r.basePath = strings.TrimSuffix(base.Path, "/")
+	return r, nil
+}
+
+// Endpoint returns the endpoint to inject into handlers, whose requests are
+// recorded or replayed
+func (r *Recorder) Endpoint() *grizzly.Endpoint {
+	endpoint := r.endpoint
+	endpoint.Client = &http.Client{Transport: r}
+	return &endpoint
+}
+
+// RoundTrip records or replays a request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    strings.TrimPrefix(req.URL.Path, r.basePath),
+	}
+	if req.URL.RawQuery != "" {
+		recorded.URL += "?" + req.URL.RawQuery
+	}
+	recorded.JSON, recorded.Body = recordBody(body)
+
+	if r.recording {
+		return r.record(req, recorded)
+	}
+	return r.replay(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	response := RecordedResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	response.JSON, response.Body = recordBody(body)
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{Request: recorded, Response: response})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// replay responds to a request as recorded. Identical requests, e.g. getting
+// a resource before and after updating it, are replayed in order.
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.replayed[i] || !interaction.Request.matches(recorded) {
+			continue
+		}
+		r.replayed[i] = true
+		response := interaction.Response
+		body := []byte(response.Body)
+		if len(response.JSON) > 0 {
+			var compact bytes.Buffer
+			json.Compact(&compact, response.JSON)
+			body = compact.Bytes()
+		}
+		header := http.Header{}
+		if response.ContentType != "" {
+			header.Set("Content-Type", response.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", response.Status, http.StatusText(response.Status)),
+			StatusCode:    response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("No response to %s %s recorded in %s, record it again with %s=true", recorded.Method, recorded.URL, r.cassette, RecordEnv)
+}
+
+// Close saves the cassette when recording. When replaying, the recorded
+// requests that were not sent are reported.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.recording {
+		data, err := json.MarshalIndent(r.interactions, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(r.cassette), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(r.cassette, append(data, '\n'), 0644)
+	}
+	unsent := []string{}
+	for i, interaction := range r.interactions {
+		if !r.replayed[i] {
+			unsent = append(unsent, interaction.Request.Method+" "+interaction.Request.URL)
+		}
+	}
+	if len(unsent) > 0 {
+		return fmt.Errorf("Requests recorded in %s were not sent, record it again with %s=true: %s", r.cassette, RecordEnv, strings.Join(unsent, ", "))
+	}
+	return nil
+}
+
+// matches reports whether a request is the one recorded. JSON bodies are
+// compared ignoring formatting and the order of fields.
+func (recorded RecordedRequest) matches(req RecordedRequest) bool {
+	if recorded.Method != req.Method || recorded.URL != req.URL || recorded.Body != req.Body {
+		return false
+	}
+	if len(recorded.JSON) == 0 || len(req.JSON) == 0 {
+		return len(recorded.JSON) == len(req.JSON)
+	}
+	var a, b interface{}
+	json.Unmarshal(recorded.JSON, &a)
+	json.Unmarshal(req.JSON, &b)
+	return reflect.DeepEqual(a, b)
+}
+
+// recordBody returns a body as JSON if it is, or as a string otherwise
+func recordBody(body []byte) (json.RawMessage, string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, ""
+	}
+	if json.Valid(body) {
+		return json.RawMessage(bytes.TrimSpace(body)), ""
+	}
+	return nil, string(body)
+}
@@ -0,0 +1,146 @@
+package grafanatest
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+type testRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+func send(t *testing.T, endpoint *grizzly.Endpoint, r testRequest) (int, string, error) {
+	url, err := endpoint.JoinURL(r.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), r.method, url, bytes.NewBufferString(r.body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := endpoint.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSpace(string(body)), nil
+}
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cassette := filepath.Join(dir, "testdata", "dashboards.json")
+
+	server := NewServer()
+	server.AddFolder("team", "Team")
+	recorded := []testRequest{
+		{"GET", "api/dashboards/uid/board", ""},
+		{"POST", "api/dashboards/db", `{"dashboard": {"uid": "board", "title": "Board"}, "folderId": 1, "overwrite": true}`},
+		{"GET", "api/dashboards/uid/board", ""},
+		{"GET", "api/search?type=dash-db", ""},
+	}
+	os.Setenv(RecordEnv, "true")
+	recorder, err := NewRecorder(cassette, &grizzly.Endpoint{
+		URL:    server.URL,
+		Header: http.Header{"Authorization": {"Bearer secret"}},
+	})
+	os.Unsetenv(RecordEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := []string{}
+	for _, r := range recorded {
+		status, body, err := send(t, recorder.Endpoint(), r)
+		if err != nil {
+			t.Fatalf("Unexpected error recording %s %s: %v", r.method, r.path, err)
+		}
+		responses = append(responses, body)
+		if r.method == "GET" && len(responses) == 1 && status != http.StatusNotFound {
+			t.Errorf("Expected 404 before adding the dashboard, got: %d", status)
+		}
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Unexpected error saving cassette: %v", err)
+	}
+	server.Close()
+	if data, _ := ioutil.ReadFile(cassette); bytes.Contains(data, []byte("secret")) {
+		t.Errorf("Expected credentials not to be recorded")
+	}
+
+	tests := map[string]struct {
+		requests []testRequest
+		err      string
+		closeErr string
+	}{
+		"same requests": {
+			requests: recorded,
+		},
+		"reformatted body": {
+			requests: []testRequest{
+				recorded[0],
+				{"POST", "api/dashboards/db", `{"overwrite": true, "folderId": 1, "dashboard": {"title": "Board", "uid": "board"}}`},
+				recorded[2],
+				recorded[3],
+			},
+		},
+		"changed body": {
+			requests: []testRequest{
+				recorded[0],
+				{"POST", "api/dashboards/db", `{"dashboard": {"uid": "board", "title": "Board"}, "folderId": 1}`},
+			},
+			err:      "No response to POST /api/dashboards/db recorded in " + cassette,
+			closeErr: "were not sent",
+		},
+		"request not sent": {
+			requests: recorded[:3],
+			closeErr: "Requests recorded in " + cassette + " were not sent, record it again with GRIZZLY_RECORD=true: GET /api/search?type=dash-db",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		replayer, err := NewRecorder(cassette, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error loading cassette: %v", err)
+		}
+		for i, r := range test.requests {
+			_, body, err := send(t, replayer.Endpoint(), r)
+			if err != nil {
+				if test.err == "" || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("Expected error %q, got: %v", test.err, err)
+				}
+				break
+			}
+			if body != responses[i] {
+				t.Errorf("Expected %s to be replayed, got: %s", responses[i], body)
+			}
+		}
+		err = replayer.Close()
+		if test.closeErr == "" && err != nil {
+			t.Errorf("Unexpected error closing cassette: %v", err)
+		}
+		if test.closeErr != "" && (err == nil || !strings.Contains(err.Error(), test.closeErr)) {
+			t.Errorf("Expected error %q, got: %v", test.closeErr, err)
+		}
+	}
+
+	if _, err := NewRecorder(filepath.Join(dir, "missing.json"), nil); err == nil {
+		t.Errorf("Expected error replaying a missing cassette")
+	}
+}
@@ -0,0 +1,800 @@
+package grafanatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * grafanatest runs an in-memory fake of the Grafana API, as httptest runs
+ * HTTP servers, so that the behavior of handlers can be tested without a
+ * Grafana instance:
+ *
+ *   server := grafanatest.NewServer()
+ *   defer server.Close()
+ *   handler := grafana.NewDashboardHandler(server.Endpoint())
+ *
+ * Dashboards, folders, datasources and snapshots are supported, with the
+ * responses, status codes and conflicts of Grafana for the requests grizzly
+ * sends:
+ *  - saving a dashboard without overwrite fails with 412 if its version is
+ *    not the current one, or another dashboard of its folder has its title
+ *  - adding a datasource fails with 409 if its name is taken, as does
+ *    updating one from an older version
+ *  - missing resources are reported with 404
+ *  - folders may be nested, as with the nested folders of Grafana 10
+ *  - snapshots are rendered as blank PNG images, as by the image renderer
+ * Other failures, e.g. errors or conflicts of a real instance, can be
+ * injected with Fail.
+ */
+
+// Server is a fake Grafana, holding its resources in memory
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	nextID      int64
+	folders     map[string]*folder
+	dashboards  map[string]*dashboard
+	datasources map[string]map[string]interface{}
+	snapshots   map[string]*snapshot
+	failures    []failure
+	requests    []string
+}
+
+type folder struct {
+	ID        int64  `json:"id"`
+	UID       string `json:"uid"`
+	Title     string `json:"title"`
+	ParentUID string `json:"parentUid,omitempty"`
+	Version   int    `json:"version"`
+}
+
+type dashboard struct {
+	model    map[string]interface{}
+	folderID int64
+	version  int
+}
+
+type snapshot struct {
+	Key     string    `json:"key"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// failure is a response to send to the next request to a path
+type failure struct {
+	method  string
+	path    string
+	status  int
+	message string
+}
+
+// NewServer starts a fake Grafana, with no resources. It should be closed
+// when done.
+func NewServer() *Server {
+	s := &Server{
+		folders:     map[string]*folder{},
+		dashboards:  map[string]*dashboard{},
+		datasources: map[string]map[string]interface{}{},
+		snapshots:   map[string]*snapshot{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Endpoint returns the endpoint handlers send requests to the server with
+func (s *Server) Endpoint() *grizzly.Endpoint {
+	return &grizzly.Endpoint{URL: s.URL, Client: s.Client()}
+}
+
+// AddFolder adds a folder, returning its ID
+func (s *Server) AddFolder(uid, title string) int64 {
+	return s.AddNestedFolder("", uid, title)
+}
+
+// AddNestedFolder adds a folder within another, by UID, returning its ID. The
+// parent folder must exist.
+func (s *Server) AddNestedFolder(parentUID, uid, title string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	s.folders[uid] = &folder{ID: s.nextID, UID: uid, Title: title, ParentUID: parentUID, Version: 1}
+	return s.nextID
+}
+
+// AddDashboard adds a dashboard to a folder, the General folder if
+// folderUID is empty. The folder must exist.
+func (s *Server) AddDashboard(folderUID string, model map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var folderID int64
+	if folderUID != "" {
+		f, ok := s.folders[folderUID]
+		if !ok {
+			return fmt.Errorf("Folder %s does not exist", folderUID)
+		}
+		folderID = f.ID
+	}
+	s.saveDashboard(copyMap(model), folderID)
+	return nil
+}
+
+// Dashboard returns a dashboard as stored, with its id and version, and the
+// UID of its folder
+func (s *Server) Dashboard(uid string) (model map[string]interface{}, folderUID string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.dashboards[uid]
+	if !ok {
+		return nil, "", false
+	}
+	if f := s.folderByID(d.folderID); f != nil {
+		folderUID = f.UID
+	}
+	return s.dashboardModel(d), folderUID, true
+}
+
+// AddDatasource adds a datasource, as if posted to the API
+func (s *Server) AddDatasource(source map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addDatasource(copyMap(source))
+}
+
+// Datasource returns a datasource by name, as the API returns it
+func (s *Server) Datasource(name string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.datasources[name]
+	if !ok {
+		return nil, false
+	}
+	return copyMap(source), true
+}
+
+// AddSnapshot adds a snapshot, created and expiring at the given times,
+// returning its key
+func (s *Server) AddSnapshot(name string, created, expires time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addSnapshot(name, created, expires).Key
+}
+
+// Snapshots returns the keys of the snapshots held, ordered
+func (s *Server) Snapshots() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for key := range s.snapshots {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Fail makes the next request with a method to a path fail, with a status
+// and message, e.g. Fail("POST", "/api/dashboards/db", 412, "...")
+func (s *Server) Fail(method, path string, status int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{method: method, path: path, status: status, message: message})
+}
+
+// Requests returns the requests received, as "METHOD /path"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// routes map requests to their handlers, by method and path
+var routes = []struct {
+	method string
+	path   *regexp.Regexp
+	handle func(s *Server, r *http.Request, params []string) (int, interface{})
+}{
+	{"GET", regexp.MustCompile(`^/api/search$`), (*Server).search},
+	{"GET", regexp.MustCompile(`^/api/dashboards/uid/([^/]+)$`), (*Server).getDashboard},
+	{"POST", regexp.MustCompile(`^/api/dashboards/db$`), (*Server).postDashboard},
+	{"DELETE", regexp.MustCompile(`^/api/dashboards/uid/([^/]+)$`), (*Server).deleteDashboard},
+	{"GET", regexp.MustCompile(`^/api/folders$`), (*Server).listFolders},
+	{"GET", regexp.MustCompile(`^/api/folders/([^/]+)$`), (*Server).getFolder},
+	{"POST", regexp.MustCompile(`^/api/folders$`), (*Server).postFolder},
+	{"DELETE", regexp.MustCompile(`^/api/folders/([^/]+)$`), (*Server).deleteFolder},
+	{"GET", regexp.MustCompile(`^/api/datasources$`), (*Server).listDatasources},
+	{"GET", regexp.MustCompile(`^/api/datasources/name/([^/]+)$`), (*Server).getDatasourceByName},
+	{"GET", regexp.MustCompile(`^/api/datasources/uid/([^/]+)$`), (*Server).getDatasourceByUID},
+	{"GET", regexp.MustCompile(`^/api/datasources/uid/([^/]+)/health$`), (*Server).datasourceHealth},
+	{"POST", regexp.MustCompile(`^/api/datasources$`), (*Server).postDatasource},
+	{"PUT", regexp.MustCompile(`^/api/datasources/([0-9]+)$`), (*Server).putDatasource},
+	{"DELETE", regexp.MustCompile(`^/api/datasources/name/([^/]+)$`), (*Server).deleteDatasource},
+	{"POST", regexp.MustCompile(`^/api/snapshots$`), (*Server).postSnapshot},
+	{"GET", regexp.MustCompile(`^/api/dashboard/snapshots$`), (*Server).listSnapshots},
+	{"DELETE", regexp.MustCompile(`^/api/snapshots/([^/]+)$`), (*Server).deleteSnapshot},
+	{"GET", regexp.MustCompile(`^/render/dashboard/snapshot/([^/]+)$`), (*Server).renderSnapshot},
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	status, body := http.StatusNotFound, interface{}(message("Not found"))
+	if i := s.failure(r); i >= 0 {
+		status, body = s.failures[i].status, message(s.failures[i].message)
+		s.failures = append(s.failures[:i], s.failures[i+1:]...)
+	} else {
+		for _, route := range routes {
+			match := route.path.FindStringSubmatch(r.URL.Path)
+			if route.method == r.Method && match != nil {
+				status, body = route.handle(s, r, match[1:])
+				break
+			}
+		}
+	}
+	if image, ok := body.([]byte); ok {
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(status)
+		w.Write(image)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// failure returns the index of the failure injected for a request, if any
+func (s *Server) failure(r *http.Request) int {
+	for i, f := range s.failures {
+		if f.method == r.Method && f.path == r.URL.Path {
+			return i
+		}
+	}
+	return -1
+}
+
+func message(msg string) map[string]interface{} {
+	return map[string]interface{}{"message": msg}
+}
+
+// decode decodes the JSON body of a request
+func decode(r *http.Request, v interface{}) error {
+	return json.NewDecoder(r.Body).Decode(v)
+}
+
+func (s *Server) folderByID(id int64) *folder {
+	for _, f := range s.folders {
+		if f.ID == id {
+			return f
+		}
+	}
+	return nil
+}
+
+// folderMeta returns the UID and title of a folder, the General folder
+// having no UID
+func (s *Server) folderMeta(id int64) (string, string) {
+	if f := s.folderByID(id); f != nil {
+		return f.UID, f.Title
+	}
+	return "", "General"
+}
+
+func (s *Server) dashboardModel(d *dashboard) map[string]interface{} {
+	model := copyMap(d.model)
+	model["version"] = d.version
+	return model
+}
+
+// saveDashboard stores a dashboard, assigning its ID and UID if new, and
+// bumping its version
+func (s *Server) saveDashboard(model map[string]interface{}, folderID int64) *dashboard {
+	uid, _ := model["uid"].(string)
+	if uid == "" {
+		uid = fmt.Sprintf("generated-%d", s.nextID+1)
+		model["uid"] = uid
+	}
+	d, ok := s.dashboards[uid]
+	if !ok {
+		s.nextID++
+		d = &dashboard{}
+		model["id"] = s.nextID
+		s.dashboards[uid] = d
+	} else {
+		model["id"] = d.model["id"]
+	}
+	delete(model, "version")
+	d.model = model
+	d.folderID = folderID
+	d.version++
+	return d
+}
+
+func (s *Server) search(r *http.Request, _ []string) (int, interface{}) {
+	query := r.URL.Query()
+	if t := query.Get("type"); t != "" && t != "dash-db" {
+		return http.StatusOK, []interface{}{}
+	}
+	folderIDs := map[int64]bool{}
+	for _, ids := range query["folderIds"] {
+		for _, id := range strings.Split(ids, ",") {
+			if id, err := strconv.ParseInt(id, 10, 64); err == nil {
+				folderIDs[id] = true
+			}
+		}
+	}
+	title := strings.ToLower(query.Get("query"))
+
+	uids := []string{}
+	for uid, d := range s.dashboards {
+		if len(folderIDs) > 0 && !folderIDs[d.folderID] {
+			continue
+		}
+		if t, _ := d.model["title"].(string); !strings.Contains(strings.ToLower(t), title) {
+			continue
+		}
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		ti, _ := s.dashboards[uids[i]].model["title"].(string)
+		tj, _ := s.dashboards[uids[j]].model["title"].(string)
+		if ti != tj {
+			return ti < tj
+		}
+		return uids[i] < uids[j]
+	})
+
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 1000
+	}
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	hits := []map[string]interface{}{}
+	for i := (page - 1) * limit; i < len(uids) && i < page*limit; i++ {
+		d := s.dashboards[uids[i]]
+		tags, _ := d.model["tags"].([]interface{})
+		if tags == nil {
+			tags = []interface{}{}
+		}
+		hit := map[string]interface{}{
+			"id":    d.model["id"],
+			"uid":   uids[i],
+			"title": d.model["title"],
+			"url":   "/d/" + uids[i],
+			"type":  "dash-db",
+			"tags":  tags,
+		}
+		if f := s.folderByID(d.folderID); f != nil {
+			hit["folderId"], hit["folderUid"], hit["folderTitle"] = f.ID, f.UID, f.Title
+		}
+		hits = append(hits, hit)
+	}
+	return http.StatusOK, hits
+}
+
+func (s *Server) getDashboard(_ *http.Request, params []string) (int, interface{}) {
+	d, ok := s.dashboards[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("Dashboard not found")
+	}
+	folderUID, folderTitle := s.folderMeta(d.folderID)
+	return http.StatusOK, map[string]interface{}{
+		"dashboard": s.dashboardModel(d),
+		"meta": map[string]interface{}{
+			"folderId":    d.folderID,
+			"folderUid":   folderUID,
+			"folderTitle": folderTitle,
+			"version":     d.version,
+			"url":         "/d/" + params[0],
+		},
+	}
+}
+
+func (s *Server) postDashboard(r *http.Request, _ []string) (int, interface{}) {
+	var cmd struct {
+		Dashboard map[string]interface{} `json:"dashboard"`
+		FolderID  int64                  `json:"folderId"`
+		Overwrite bool                   `json:"overwrite"`
+	}
+	if err := decode(r, &cmd); err != nil || cmd.Dashboard == nil {
+		return http.StatusBadRequest, message("bad request data")
+	}
+	title, _ := cmd.Dashboard["title"].(string)
+	if strings.TrimSpace(title) == "" {
+		return http.StatusBadRequest, message("Dashboard title cannot be empty")
+	}
+	if cmd.FolderID != 0 && s.folderByID(cmd.FolderID) == nil {
+		return http.StatusBadRequest, message("folder not found")
+	}
+	uid, _ := cmd.Dashboard["uid"].(string)
+	if !cmd.Overwrite {
+		if existing, ok := s.dashboards[uid]; ok {
+			if version, _ := cmd.Dashboard["version"].(float64); int(version) != existing.version {
+				return http.StatusPreconditionFailed, map[string]interface{}{
+					"status":  "version-mismatch",
+					"message": "The dashboard has been changed by someone else",
+				}
+			}
+		}
+		for other, d := range s.dashboards {
+			if other != uid && d.folderID == cmd.FolderID && d.model["title"] == title {
+				return http.StatusPreconditionFailed, map[string]interface{}{
+					"status":  "name-exists",
+					"message": "A dashboard with the same name in the folder already exists",
+				}
+			}
+		}
+	}
+	d := s.saveDashboard(cmd.Dashboard, cmd.FolderID)
+	uid = d.model["uid"].(string)
+	return http.StatusOK, map[string]interface{}{
+		"id":      d.model["id"],
+		"uid":     uid,
+		"url":     "/d/" + uid,
+		"status":  "success",
+		"version": d.version,
+	}
+}
+
+func (s *Server) deleteDashboard(_ *http.Request, params []string) (int, interface{}) {
+	d, ok := s.dashboards[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("Dashboard not found")
+	}
+	delete(s.dashboards, params[0])
+	return http.StatusOK, map[string]interface{}{
+		"id":      d.model["id"],
+		"title":   d.model["title"],
+		"message": fmt.Sprintf("Dashboard %v deleted", d.model["title"]),
+	}
+}
+
+func (s *Server) listFolders(r *http.Request, _ []string) (int, interface{}) {
+	parentUID := r.URL.Query().Get("parentUid")
+	folders := []*folder{}
+	for _, f := range s.folders {
+		if f.ParentUID == parentUID {
+			folders = append(folders, f)
+		}
+	}
+	sort.Slice(folders, func(i, j int) bool { return folders[i].Title < folders[j].Title })
+	return http.StatusOK, folders
+}
+
+func (s *Server) getFolder(_ *http.Request, params []string) (int, interface{}) {
+	f, ok := s.folders[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("folder not found")
+	}
+	// nested folders list the folders they are within, outermost first
+	parents := []*folder{}
+	for p := s.folders[f.ParentUID]; p != nil; p = s.folders[p.ParentUID] {
+		parents = append([]*folder{p}, parents...)
+	}
+	if len(parents) == 0 {
+		return http.StatusOK, f
+	}
+	return http.StatusOK, struct {
+		*folder
+		Parents []*folder `json:"parents"`
+	}{f, parents}
+}
+
+func (s *Server) postFolder(r *http.Request, _ []string) (int, interface{}) {
+	var f folder
+	if err := decode(r, &f); err != nil {
+		return http.StatusBadRequest, message("bad request data")
+	}
+	if strings.TrimSpace(f.Title) == "" {
+		return http.StatusBadRequest, message("folder title cannot be empty")
+	}
+	if _, exists := s.folders[f.UID]; exists {
+		return http.StatusConflict, message("a folder with the same uid already exists")
+	}
+	if _, exists := s.folders[f.ParentUID]; f.ParentUID != "" && !exists {
+		return http.StatusNotFound, message("parent folder not found")
+	}
+	for _, other := range s.folders {
+		if other.ParentUID == f.ParentUID && other.Title == f.Title {
+			return http.StatusConflict, message("a folder or dashboard in the general folder with the same name already exists")
+		}
+	}
+	s.nextID++
+	if f.UID == "" {
+		f.UID = fmt.Sprintf("generated-%d", s.nextID)
+	}
+	f.ID, f.Version = s.nextID, 1
+	s.folders[f.UID] = &f
+	return http.StatusOK, f
+}
+
+func (s *Server) deleteFolder(_ *http.Request, params []string) (int, interface{}) {
+	f, ok := s.folders[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("folder not found")
+	}
+	// folders nested within it are deleted along with it
+	for uid, child := range s.folders {
+		if child.ParentUID == f.UID {
+			s.deleteFolder(nil, []string{uid})
+		}
+	}
+	for uid, d := range s.dashboards {
+		if d.folderID == f.ID {
+			delete(s.dashboards, uid)
+		}
+	}
+	delete(s.folders, params[0])
+	return http.StatusOK, map[string]interface{}{"id": f.ID, "title": f.Title, "message": "Folder " + f.Title + " deleted"}
+}
+
+// datasourceDefaults are the fields Grafana returns for datasources, when not
+// set
+var datasourceDefaults = map[string]interface{}{
+	"access":            "proxy",
+	"basicAuth":         false,
+	"basicAuthPassword": "",
+	"basicAuthUser":     "",
+	"database":          "",
+	"isDefault":         false,
+	"jsonData":          map[string]interface{}{},
+	"password":          "",
+	"readOnly":          false,
+	"url":               "",
+	"user":              "",
+	"withCredentials":   false,
+}
+
+// storeDatasource keeps a datasource as Grafana returns it: with defaults,
+// and secureJsonData reported as secureJsonFields rather than returned
+func storeDatasource(source map[string]interface{}) {
+	for k, v := range datasourceDefaults {
+		if _, ok := source[k]; !ok {
+			source[k] = v
+		}
+	}
+	fields := map[string]interface{}{}
+	if existing, ok := source["secureJsonFields"].(map[string]interface{}); ok {
+		fields = existing
+	}
+	if secure, ok := source["secureJsonData"].(map[string]interface{}); ok {
+		for k := range secure {
+			fields[k] = true
+		}
+	}
+	delete(source, "secureJsonData")
+	source["secureJsonFields"] = fields
+}
+
+func (s *Server) addDatasource(source map[string]interface{}) map[string]interface{} {
+	s.nextID++
+	source["id"] = s.nextID
+	source["orgId"] = 1
+	source["version"] = 1
+	if uid, _ := source["uid"].(string); uid == "" {
+		source["uid"] = fmt.Sprintf("generated-%d", s.nextID)
+	}
+	storeDatasource(source)
+	s.datasources[source["name"].(string)] = source
+	return source
+}
+
+func (s *Server) datasourceByUID(uid string) map[string]interface{} {
+	for _, source := range s.datasources {
+		if source["uid"] == uid {
+			return source
+		}
+	}
+	return nil
+}
+
+func (s *Server) listDatasources(_ *http.Request, _ []string) (int, interface{}) {
+	names := []string{}
+	for name := range s.datasources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sources := []map[string]interface{}{}
+	for _, name := range names {
+		sources = append(sources, s.datasources[name])
+	}
+	return http.StatusOK, sources
+}
+
+func (s *Server) getDatasourceByName(_ *http.Request, params []string) (int, interface{}) {
+	source, ok := s.datasources[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("Data source not found")
+	}
+	return http.StatusOK, source
+}
+
+func (s *Server) getDatasourceByUID(_ *http.Request, params []string) (int, interface{}) {
+	source := s.datasourceByUID(params[0])
+	if source == nil {
+		return http.StatusNotFound, message("Data source not found")
+	}
+	return http.StatusOK, source
+}
+
+func (s *Server) datasourceHealth(_ *http.Request, params []string) (int, interface{}) {
+	if s.datasourceByUID(params[0]) == nil {
+		return http.StatusNotFound, message("Data source not found")
+	}
+	return http.StatusOK, map[string]interface{}{"status": "OK", "message": "Data source is working"}
+}
+
+func (s *Server) postDatasource(r *http.Request, _ []string) (int, interface{}) {
+	var source map[string]interface{}
+	if err := decode(r, &source); err != nil {
+		return http.StatusBadRequest, message("bad request data")
+	}
+	name, _ := source["name"].(string)
+	if name == "" {
+		return http.StatusBadRequest, message("Name is required")
+	}
+	if _, exists := s.datasources[name]; exists {
+		return http.StatusConflict, message("data source with the same name already exists")
+	}
+	delete(source, "id")
+	source = s.addDatasource(source)
+	return http.StatusOK, map[string]interface{}{
+		"datasource": source,
+		"id":         source["id"],
+		"name":       name,
+		"message":    "Datasource added",
+	}
+}
+
+func (s *Server) putDatasource(r *http.Request, params []string) (int, interface{}) {
+	id, _ := strconv.ParseInt(params[0], 10, 64)
+	var existing map[string]interface{}
+	for _, source := range s.datasources {
+		if source["id"] == id {
+			existing = source
+		}
+	}
+	if existing == nil {
+		return http.StatusNotFound, message("Data source not found")
+	}
+	var source map[string]interface{}
+	if err := decode(r, &source); err != nil {
+		return http.StatusBadRequest, message("bad request data")
+	}
+	name, _ := source["name"].(string)
+	if other, exists := s.datasources[name]; exists && other["id"] != id {
+		return http.StatusConflict, message("data source with the same name already exists")
+	}
+	if version, ok := source["version"].(float64); ok && int(version) < existing["version"].(int) {
+		return http.StatusConflict, message("Datasource has already been updated by someone else")
+	}
+	delete(s.datasources, existing["name"].(string))
+	source["id"] = id
+	source["orgId"] = 1
+	source["uid"] = existing["uid"]
+	source["version"] = existing["version"].(int) + 1
+	if fields, ok := existing["secureJsonFields"].(map[string]interface{}); ok {
+		source["secureJsonFields"] = fields
+	}
+	storeDatasource(source)
+	s.datasources[name] = source
+	return http.StatusOK, map[string]interface{}{
+		"datasource": source,
+		"id":         id,
+		"name":       name,
+		"message":    "Datasource updated",
+	}
+}
+
+func (s *Server) deleteDatasource(_ *http.Request, params []string) (int, interface{}) {
+	source, ok := s.datasources[params[0]]
+	if !ok {
+		return http.StatusNotFound, message("Data source not found")
+	}
+	delete(s.datasources, params[0])
+	return http.StatusOK, map[string]interface{}{"id": source["id"], "message": "Data source deleted"}
+}
+
+// snapshotNeverExpires is how far in the future Grafana sets the expiry of
+// snapshots that never expire
+const snapshotNeverExpires = 50 * 365 * 24 * time.Hour
+
+func (s *Server) addSnapshot(name string, created, expires time.Time) *snapshot {
+	s.nextID++
+	snap := &snapshot{Key: fmt.Sprintf("snapshot-%d", s.nextID), Name: name, Created: created, Expires: expires}
+	s.snapshots[snap.Key] = snap
+	return snap
+}
+
+func (s *Server) postSnapshot(r *http.Request, _ []string) (int, interface{}) {
+	var cmd struct {
+		Dashboard map[string]interface{} `json:"dashboard"`
+		Name      string                 `json:"name"`
+		Expires   int64                  `json:"expires"`
+	}
+	if err := decode(r, &cmd); err != nil || cmd.Dashboard == nil {
+		return http.StatusBadRequest, message("bad request data")
+	}
+	now := time.Now()
+	expires := now.Add(snapshotNeverExpires)
+	if cmd.Expires > 0 {
+		expires = now.Add(time.Duration(cmd.Expires) * time.Second)
+	}
+	snap := s.addSnapshot(cmd.Name, now, expires)
+	return http.StatusOK, map[string]interface{}{
+		"key":       snap.Key,
+		"deleteKey": "delete-" + snap.Key,
+		"url":       s.URL + "/dashboard/snapshot/" + snap.Key,
+		"deleteUrl": s.URL + "/api/snapshots-delete/delete-" + snap.Key,
+	}
+}
+
+func (s *Server) listSnapshots(_ *http.Request, _ []string) (int, interface{}) {
+	list := []*snapshot{}
+	for _, snap := range s.snapshots {
+		list = append(list, snap)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return http.StatusOK, list
+}
+
+func (s *Server) deleteSnapshot(_ *http.Request, params []string) (int, interface{}) {
+	if _, ok := s.snapshots[params[0]]; !ok {
+		return http.StatusNotFound, message("Snapshot not found")
+	}
+	delete(s.snapshots, params[0])
+	return http.StatusOK, message("Snapshot deleted")
+}
+
+// renderSnapshot renders a snapshot as a blank PNG image of the size asked for
+func (s *Server) renderSnapshot(r *http.Request, params []string) (int, interface{}) {
+	if _, ok := s.snapshots[params[0]]; !ok {
+		return http.StatusNotFound, message("Snapshot not found")
+	}
+	width, height := 800, 400
+	if w, err := strconv.Atoi(r.URL.Query().Get("width")); err == nil && w > 0 {
+		width = w
+	}
+	if h, err := strconv.Atoi(r.URL.Query().Get("height")); err == nil && h > 0 {
+		height = h
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		return http.StatusInternalServerError, message(err.Error())
+	}
+	return http.StatusOK, buf.Bytes()
+}
+
+// copyMap returns a deep copy of a JSON object, so that callers cannot
+// change the resources held
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	copied := map[string]interface{}{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(err)
+	}
+	return copied
+}
@@ -0,0 +1,174 @@
+package grizzly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+ * An audit log records every apply: who ran it, when, from which commit, and
+ * which resources it added, updated or deleted, with the diff of each update,
+ * so that changes to production dashboards can be traced. Each apply is
+ * recorded to every destination given:
+ *
+ *   - a file, to which a JSON record is appended per line
+ *   - an S3 prefix, s3://bucket/prefix, where a JSON object is uploaded per
+ *     apply with the aws binary
+ *   - grafana, recording an annotation (see AuditHook)
+ *
+ * Applies that fail part way are recorded too, with their error.
+ */
+
+// AuditGrafana is the audit log destination recording applies as Grafana
+// annotations
+const AuditGrafana = "grafana"
+
+// AuditRecord describes an apply
+type AuditRecord struct {
+	Time    time.Time     `json:"time"`
+	User    string        `json:"user"`
+	Host    string        `json:"host,omitempty"`
+	Commit  string        `json:"commit,omitempty"`
+	Changes []AuditChange `json:"changes"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// AuditChange is a change made to a resource by an apply
+type AuditChange struct {
+	Resource string `json:"resource"`
+	// Action is added, updated or deleted
+	Action string `json:"action"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+// AuditHook describes a provider that can record applies to an audit log at
+// its endpoint, as the grafana destination
+type AuditHook interface {
+	Audit(ctx context.Context, record AuditRecord) error
+}
+
+// auditChanges collects the changes announced by the Notifier, by key
+type auditChanges map[string]*AuditChange
+
+// record records the action taken on a resource, if any
+func (a auditChanges) record(resource Resource, action string) {
+	change, ok := a[resource.Key()]
+	if !ok {
+		change = &AuditChange{Resource: resource.Key()}
+		a[resource.Key()] = change
+	}
+	if action != "" {
+		change.Action = action
+	}
+}
+
+// auditDiff records the diff of an update, before it is announced
+func (n *Notifier) auditDiff(resource Resource, diff string) {
+	if n.audit == nil {
+		return
+	}
+	defer n.lock()()
+	n.audit.record(resource, "")
+	n.audit[resource.Key()].Diff = diff
+}
+
+// auditUser identifies who applies, as the current user
+func auditUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// newAuditRecord describes an apply, from the changes announced
+func newAuditRecord(changes auditChanges, opts *ApplyOpts, applyErr error) AuditRecord {
+	record := AuditRecord{
+		Time:    time.Now().UTC(),
+		User:    auditUser(),
+		Commit:  opts.Commit,
+		Changes: []AuditChange{},
+	}
+	record.Host, _ = os.Hostname()
+	for _, change := range changes {
+		if change.Action == "" {
+			// diffed, but failed to update
+			continue
+		}
+		record.Changes = append(record.Changes, *change)
+	}
+	sort.Slice(record.Changes, func(i, j int) bool {
+		return record.Changes[i].Resource < record.Changes[j].Resource
+	})
+	if applyErr != nil {
+		record.Error = applyErr.Error()
+	}
+	return record
+}
+
+// writeAudit records an apply to each audit log destination
+func writeAudit(ctx context.Context, config Config, destinations []string, record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	for _, destination := range destinations {
+		switch {
+		case destination == AuditGrafana:
+			for _, provider := range config.Registry.Providers {
+				if hook, ok := provider.(AuditHook); ok {
+					if err := hook.Audit(ctx, record); err != nil {
+						return fmt.Errorf("Error recording the apply to the audit log: %v", err)
+					}
+				}
+			}
+		case strings.HasPrefix(destination, "s3://"):
+			if err := uploadAudit(destination, record, data); err != nil {
+				return err
+			}
+		default:
+			if err := appendAudit(destination, data); err != nil {
+				return fmt.Errorf("Error recording the apply to %s: %v", destination, err)
+			}
+		}
+	}
+	return nil
+}
+
+// appendAudit appends a record to an audit log file
+func appendAudit(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// uploadAudit uploads a record as an object of an S3 prefix, with the aws
+// binary
+func uploadAudit(prefix string, record AuditRecord, data []byte) error {
+	name := record.Time.Format(backupTimeFormat) + ".json"
+	url := strings.TrimSuffix(prefix, "/") + "/" + name
+	cmd := exec.Command("aws", "s3", "cp", "-", url, "--content-type", "application/json")
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("Error uploading the audit log to %s, the aws binary is required: %v", url, err)
+		}
+		return fmt.Errorf("Error uploading the audit log to %s: %s", url, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package grizzly
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/term"
+)
+
+/*
+ * Backups keep remote resources as they were before grizzly overwrote or
+ * deleted them, so that a bad apply can be undone without digging through
+ * Grafana's version history, for any kind of resource. With a backup
+ * directory, each backup is written to
+ *
+ *   <backup-dir>/<kind>/<uid>/<timestamp>.<ext>
+ *
+ * and `grr rollback <kind>/<uid>` pushes the latest one back, backing up the
+ * resource it overwrites in turn.
+ */
+
+// backupTimeFormat names backups, so that they sort chronologically
+const backupTimeFormat = "2006-01-02T15-04-05.000Z"
+
+// backupResource writes the representation of a remote resource about to be
+// overwritten or deleted to a backup directory, if any
+func backupResource(config Config, dir string, resource Resource, representation string) error {
+	if dir == "" {
+		return nil
+	}
+	name := time.Now().UTC().Format(backupTimeFormat) + "." + resource.Handler.GetExtension()
+	path := filepath.Join(dir, resource.Kind(), resource.UID, name)
+	if err := writeFile(path, representation); err != nil {
+		return fmt.Errorf("Error backing up %s: %v", resource.Key(), err)
+	}
+	config.Notifier.Logf(LogDebug, "Backed up %s to %s", resource.Key(), path)
+	return nil
+}
+
+// listBackups returns the backups of a resource, the oldest first
+func listBackups(dir, kind, uid string) ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir, kind, uid))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	backups := []string{}
+	for _, file := range files {
+		if !file.IsDir() {
+			backups = append(backups, file.Name())
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// Rollback restores a resource, given by key, to a backup in a backup
+// directory
+func Rollback(ctx context.Context, config Config, dir, key string, opts *RollbackOpts) error {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Resource must be <kind>/<uid>: %s", key)
+	}
+	handler, err := config.Registry.GetHandler(parts[0])
+	if err != nil {
+		return err
+	}
+	kind, uid := handler.GetName(), parts[1]
+	backups, err := listBackups(dir, kind, uid)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		return fmt.Errorf("No backups of %s/%s in %s", kind, uid, dir)
+	}
+	backup := ""
+	for _, name := range backups {
+		if strings.HasPrefix(name, opts.Version) {
+			backup = name
+		}
+	}
+	if backup == "" {
+		return fmt.Errorf("No backup of %s/%s matches %q, expected one of %s", kind, uid, opts.Version, strings.Join(backups, ", "))
+	}
+
+	path := filepath.Join(dir, kind, uid, backup)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	documents, err := parseYAMLDocuments(string(data))
+	if err != nil || len(documents) != 1 {
+		return fmt.Errorf("Error reading backup %s: expected one resource", path)
+	}
+	parsed, err := handler.Parse(handler.GetJSONPaths()[0], map[string]interface{}{uid: documents[0]})
+	if err != nil {
+		return fmt.Errorf("Error parsing backup %s: %v", path, err)
+	}
+	resourceKey := kind + "/" + uid
+	if _, ok := parsed[resourceKey]; !ok {
+		return fmt.Errorf("Backup %s does not hold %s", path, resourceKey)
+	}
+
+	if !opts.AutoApprove {
+		if err := term.Confirm(ctx, fmt.Sprintf("%s will be restored to %s.", resourceKey, path), "yes"); err != nil {
+			return err
+		}
+	}
+	return Apply(ctx, config, Resources{handler: parsed}, &ApplyOpts{
+		AutoApprove: true,
+		BackupDir:   dir,
+	})
+}
@@ -0,0 +1,136 @@
+package grizzly
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+/*
+ * Client embeds grizzly in Go programs, e.g. internal portals or operators,
+ * rather than shelling out to grr:
+ *
+ *   client, err := grizzly.NewClient(grizzly.ClientOpts{
+ *     Providers: []grizzly.Provider{&grafana.Provider{}},
+ *     Output:    &buf,
+ *   })
+ *   resources, err := client.Evaluate([]string{"main.jsonnet"}, nil)
+ *   err = client.Diff(ctx, resources, nil)
+ *   err = client.Apply(ctx, resources, &grizzly.ApplyOpts{AutoApprove: true})
+ *
+ * Handlers are those of the providers given. Their endpoints are configured
+ * as for grr, by environment variables, unless injected into the providers.
+ */
+
+// ClientOpts configures a Client
+type ClientOpts struct {
+	// Providers hold the handlers of the resources managed
+	Providers []Provider
+	// HTTPClient, if set, replaces the client handlers send requests with
+	HTTPClient *http.Client
+	// Logger receives log messages, logged at info level to stderr if unset
+	Logger *Logger
+	// Output receives the resources announced as changed, diffs and
+	// summaries, rather than stdout
+	Output io.Writer
+	// Jsonnet holds the external variables and top-level arguments Jsonnet
+	// is evaluated with
+	Jsonnet JsonnetOpts
+	// StateFile records last-applied configurations, for three-way merges
+	StateFile string
+}
+
+// Client evaluates, diffs and applies resources, as grr does
+type Client struct {
+	config Config
+}
+
+// NewClient returns a client managing the resources of the given providers
+func NewClient(opts ClientOpts) (*Client, error) {
+	registry := NewProviderRegistry()
+	for _, provider := range opts.Providers {
+		if err := registry.RegisterProvider(provider); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HTTPClient != nil {
+		SetHTTPClient(opts.HTTPClient)
+	}
+	jsonnet := opts.Jsonnet
+	return &Client{
+		config: Config{
+			Registry:  registry,
+			Notifier:  Notifier{Logger: opts.Logger, out: opts.Output},
+			Jsonnet:   &jsonnet,
+			StateFile: opts.StateFile,
+		},
+	}, nil
+}
+
+// Registry returns the registry of the handlers of the client, e.g. to
+// disable some
+func (c *Client) Registry() *Registry {
+	return &c.config.Registry
+}
+
+// Evaluate parses resources from Jsonnet, CUE, YAML or JSON files, which may
+// be given as glob patterns
+func (c *Client) Evaluate(files []string, opts *ParseOpts) (Resources, error) {
+	if opts == nil {
+		opts = &ParseOpts{}
+	}
+	return ParseFiles(c.config, files, opts)
+}
+
+// Diff writes the differences between resources and their endpoints to the
+// output, returning ErrChangesDetected if there are any
+func (c *Client) Diff(ctx context.Context, resources Resources, opts *DiffOpts) error {
+	return Diff(ctx, c.config, resources, opts)
+}
+
+// Apply pushes resources to their endpoints. Unless opts.AutoApprove is set,
+// overwriting resources changed remotely or pruning asks for confirmation on
+// stdin.
+func (c *Client) Apply(ctx context.Context, resources Resources, opts *ApplyOpts) error {
+	if opts == nil {
+		opts = &ApplyOpts{}
+	}
+	return Apply(ctx, c.config, resources, opts)
+}
+
+// Prune deletes the remote resources no longer among the resources given
+func (c *Client) Prune(ctx context.Context, resources Resources, opts *PruneOpts) error {
+	if opts == nil {
+		opts = &PruneOpts{}
+	}
+	return Prune(ctx, c.config, resources, opts)
+}
+
+// Get retrieves a resource from its endpoint, by kind and UID, as it would
+// be diffed. ErrNotFound is returned if it does not exist.
+func (c *Client) Get(ctx context.Context, kind, UID string) (*Resource, error) {
+	handler, err := c.config.Registry.GetHandler(kind)
+	if err != nil {
+		return nil, err
+	}
+	resource, err := handler.GetByUID(ctx, UID)
+	if err != nil {
+		return nil, err
+	}
+	return handler.Unprepare(*resource), nil
+}
+
+// Delete removes a resource from its endpoint, by kind and UID
+func (c *Client) Delete(ctx context.Context, kind, UID string) error {
+	handler, err := c.config.Registry.GetHandler(kind)
+	if err != nil {
+		return err
+	}
+	if err := handler.Delete(ctx, UID); err == ErrNotImplemented {
+		return fmt.Errorf("%s provider does not support delete", handler.GetName())
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,13 +1,323 @@
 package grizzly
 
+import "time"
+
 // Config provides configuration to `grizzly`
 type Config struct {
 	Registry    Registry
 	Notifier    Notifier
 	JsonnetPath string
+	// Jsonnet holds the external variables and top-level arguments Jsonnet
+	// is evaluated with
+	Jsonnet *JsonnetOpts
+	// StateFile records last-applied configurations, for three-way merges
+	StateFile string
+	// Output is a machine-readable format for results, json or yaml. Empty
+	// outputs text for terminals.
+	Output string
+	// Overrides set fields of resources as they are parsed, e.g. from the
+	// context in use
+	Overrides *Overrides
+	// Transformers transform resources as they are parsed, once overridden
+	Transformers *Transformers
+}
+
+// JsonnetOpts Options to parameterize the evaluation of Jsonnet, as with the
+// jsonnet and tk commands. Values of Code maps are Jsonnet expressions.
+type JsonnetOpts struct {
+	// JPath are directories imports are searched in, the last first, before
+	// the vendor and lib directories of the project
+	JPath   []string
+	ExtStr  map[string]string
+	ExtCode map[string]string
+	TLAStr  map[string]string
+	TLACode map[string]string
+}
+
+// HTTPOpts Options to configure the client requests are sent with
+type HTTPOpts struct {
+	// ConnectTimeout limits the time taken to connect to an endpoint,
+	// including the TLS handshake. Zero means no limit.
+	ConnectTimeout time.Duration
+	// Timeout limits the time taken by each attempt at a request, until its
+	// response is read. Zero means no limit.
+	Timeout time.Duration
+	// Retry configures retries of requests failing transiently
+	Retry RetryOpts
+	// TLS configures TLS connections to endpoints
+	TLS TLSOpts
+}
+
+// TLSOpts Options to configure TLS connections to an endpoint
+type TLSOpts struct {
+	// CAFile is a PEM bundle of certificate authorities to trust, in addition
+	// to those of the system
+	CAFile string
+	// CertFile and KeyFile are the PEM certificate and key to present to
+	// endpoints requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify skips verifying the certificate of endpoints
+	InsecureSkipVerify bool
+}
+
+// RetryOpts Options to configure retries of requests failing transiently
+type RetryOpts struct {
+	// Attempts is the number of times a request is sent, at most
+	Attempts int
+	// Backoff is the time waited before the first retry, doubling with each
+	// further retry
+	Backoff time.Duration
+}
+
+// ParseOpts Options to select the resources to Parse
+type ParseOpts struct {
+	// Targets are the keys of resources to parse, all if empty. Keys may
+	// contain glob patterns.
+	Targets []string
+	// Excludes are the keys of resources not to parse, which may also contain
+	// glob patterns
+	Excludes []string
+	// Selector selects resources to parse by their labels, e.g. team=payments
+	Selector string
+	// InterpolateEnv replaces references to environment variables, e.g.
+	// ${VAR}, in the strings of resources
+	InterpolateEnv bool
+	// Strict fails parsing when the output of Jsonnet holds paths no handler
+	// consumes, e.g. misspelt ones, rather than skipping them
+	Strict bool
+	// TankaEnvironment names the inline Tanka environment to parse, if
+	// Jsonnet evaluates to several
+	TankaEnvironment string
+	// RequireUIDs fails parsing when resources, e.g. dashboards and
+	// datasources, do not declare a UID, or one matching UIDPattern if set
+	RequireUIDs bool
+	// UIDPattern is a regular expression declared UIDs must match, e.g. a
+	// naming convention. Setting it implies RequireUIDs.
+	UIDPattern string
+
+	// tanka is set when parsing a Tanka environment, whose Kubernetes
+	// manifests are expected at unregistered paths
+	tanka bool
+	// source is the file being parsed, which resources are attributed to
+	source string
+}
+
+// ValidateOpts Options to Configure a Validate
+type ValidateOpts struct {
+	// CheckReferences checks that the resources referred to, e.g. the
+	// datasources of dashboards, exist locally or remotely, and either warns
+	// or fails if not, as HealthCheck. Empty skips the check.
+	CheckReferences string
 }
 
 // PreviewOpts Options to Configure a Preview
 type PreviewOpts struct {
 	ExpiresSeconds int
+	// Lint checks resources for common mistakes before previewing them
+	Lint bool
+	// Report is a file to write a report of the previews to, or "-" for stdout
+	Report string
+	// ReportFormat is the format of the report, json or yaml
+	ReportFormat string
+	// ImageDir is a directory to save rendered images of the previews of
+	// changed resources to, if set
+	ImageDir string
+	// ImageWidth and ImageHeight are the size of the images in pixels, zero
+	// leaving the default of the renderer. A height of -1 renders the whole
+	// dashboard.
+	ImageWidth  int
+	ImageHeight int
+	// Open opens the links to previews in the default browser
+	Open bool
+}
+
+// SnapshotCleanupOpts Options to Configure a cleanup of snapshots
+type SnapshotCleanupOpts struct {
+	// OlderThan also deletes snapshots created longer ago than this, whether
+	// expired or not, if set
+	OlderThan time.Duration
+	// DryRun lists the snapshots that would be deleted, without deleting them
+	DryRun bool
+}
+
+// DiffOpts Options to Configure a Diff
+type DiffOpts struct {
+	// Format renders differences for terminals (text), or as Markdown to
+	// comment on pull requests
+	Format string
+}
+
+// ApplyOpts Options to Configure an Apply
+type ApplyOpts struct {
+	// Annotate records a deployment annotation once the apply has succeeded
+	Annotate bool
+	// Commit identifies the revision being applied, used in annotations
+	Commit string
+	// Lint checks resources for common mistakes before applying them
+	Lint bool
+	// Prune deletes remote resources that are no longer present locally
+	Prune bool
+	// AutoApprove skips the confirmation before overwriting resources changed
+	// remotely, or deleting resources
+	AutoApprove bool
+	// HealthCheck checks applied resources can connect to their backends, and
+	// either warns or fails if not. Empty skips health checks.
+	HealthCheck string
+	// CheckReferences checks that the resources referred to exist locally or
+	// remotely before applying, see ValidateOpts
+	CheckReferences string
+	// Parallel is the number of resources of a kind pushed at once. Kinds are
+	// still applied one after the other.
+	Parallel int
+	// ContinueOnError applies every resource it can rather than stopping at
+	// the first failure, then reports the failures
+	ContinueOnError bool
+	// SecretsFiles are SOPS-encrypted files of secrets to merge into
+	// resources as they are pushed, see Secrets
+	SecretsFiles []string
+	// Mark marks resources as managed by grizzly as they are pushed, refuses
+	// to overwrite unmarked ones and only prunes marked ones, see MarkHandler
+	Mark bool
+	// Adopt marks existing resources that are not marked yet, rather than
+	// refusing to overwrite them
+	Adopt bool
+	// Force overwrites versioned resources changed remotely since last
+	// applied, rather than refusing to, see VersionHandler
+	Force bool
+	// BackupDir is where remote resources are backed up before being
+	// overwritten or deleted, if set
+	BackupDir string
+	// AuditLog are the destinations each apply is recorded to: files, S3
+	// prefixes or AuditGrafana
+	AuditLog []string
+	// Notify are the webhooks, Slack or generic, each apply is posted to
+	Notify []string
+	// NotifyOn restricts notifications to NotifyChanges or NotifyFailures,
+	// rather than NotifyAlways
+	NotifyOn string
+}
+
+// Health check modes, for ApplyOpts
+const (
+	HealthCheckWarn = "warn"
+	HealthCheckFail = "fail"
+)
+
+// PruneOpts Options to Configure a Prune
+type PruneOpts struct {
+	// AutoApprove skips the confirmation before deleting resources
+	AutoApprove bool
+	// Mark only deletes resources marked as managed by grizzly
+	Mark bool
+	// BackupDir is where remote resources are backed up before being
+	// deleted, if set
+	BackupDir string
+}
+
+// RollbackOpts Options to Configure a Rollback
+type RollbackOpts struct {
+	// Version selects the backup whose name starts with it, rather than the
+	// latest one
+	Version string
+	// AutoApprove skips the confirmation before restoring the backup
+	AutoApprove bool
+}
+
+// GetOpts Options to Configure a Get
+type GetOpts struct {
+	// OutputDir is where resources are written, as Export writes them, rather
+	// than to stdout, if set
+	OutputDir string
+	// FilenameTemplate is the path of each resource written to OutputDir, see
+	// ExportOpts
+	FilenameTemplate string
+}
+
+// DefaultExportTemplate is the filename template used by Export, relative to
+// the export directory
+const DefaultExportTemplate = "{{.Kind}}/{{with .Folder}}{{.}}/{{end}}{{.UID}}.{{.Extension}}"
+
+// ExportOpts Options to Configure an Export
+type ExportOpts struct {
+	// FilenameTemplate is a Go template for the path of each resource, given its
+	// Kind, Folder, FolderTitle, UID, Filename (its key in the Jsonnet) and
+	// Extension
+	FilenameTemplate string
+	// Format is the format resources are exported in: files, the default,
+	// provisioning, for Grafana's file provisioning, or configmap, for the
+	// sidecar of Grafana in Kubernetes
+	Format string
+	// ProvisioningDir is the path of the provisioning directory on the Grafana
+	// server, for the provisioning format
+	ProvisioningDir string
+	// Namespace is the namespace of ConfigMaps, for the configmap format
+	Namespace string
+	// FolderAnnotation is the annotation the sidecar reads the folder of
+	// ConfigMaps from, for the configmap format
+	FolderAnnotation string
+}
+
+// ImportOpts Options to Configure an Import
+type ImportOpts struct {
+	// Dir is the directory Jsonnet is written to, the current one by default
+	Dir string
+	// Embed writes the resource as a JSON file, imported by the Jsonnet
+	Embed bool
+	// Grafonnet converts the resource to grafonnet, if supported
+	Grafonnet bool
+}
+
+// WatchOpts Options to Configure a Watch
+type WatchOpts struct {
+	// Debounce is how long to wait for changes to settle before evaluating Jsonnet
+	Debounce time.Duration
+	// Preview previews changed resources rather than applying them
+	Preview bool
+	// MetricsAddress is the address metrics are served on, if set
+	MetricsAddress string
+}
+
+// ServeOpts Options to Configure a Serve
+type ServeOpts struct {
+	// Address is the address the preview server listens on
+	Address string
+	// Debounce is how long to wait for changes to settle before evaluating Jsonnet
+	Debounce time.Duration
+	// ExpiresSeconds is how long previews last before they are deleted
+	ExpiresSeconds int
+}
+
+// ReconcileOpts Options to Configure a Reconcile
+type ReconcileOpts struct {
+	// Address is the address health and metrics are served on
+	Address string
+	// Interval is how long to wait between reconciliations
+	Interval time.Duration
+	// Repo is the Git repository resources are pulled from, if any
+	Repo string
+	// Ref is the branch or tag of the repository to follow, its default
+	// branch if empty
+	Ref string
+	// Dir is where the repository is cloned
+	Dir string
+	// Prune deletes remote resources that are no longer present locally
+	Prune bool
+}
+
+// WebhookOpts Options to Configure a ServeWebhooks
+type WebhookOpts struct {
+	// Address is the address webhooks are received on
+	Address string
+	// Secret verifies webhooks, as signed by GitHub or carried by GitLab
+	Secret string
+	// Repo is the Git repository resources are pulled from, if any
+	Repo string
+	// Ref is the branch or tag of the repository to follow, its default
+	// branch if empty. Pushes to other refs are ignored.
+	Ref string
+	// Dir is where the repository is cloned
+	Dir string
+	// Prune deletes remote resources that are no longer present locally
+	Prune bool
 }
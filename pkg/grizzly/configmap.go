@@ -0,0 +1,121 @@
+package grizzly
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * In Kubernetes, Grafana is often deployed with a sidecar loading dashboards
+ * from the ConfigMaps carrying a label, e.g. grafana_dashboard, as the
+ * kube-prometheus-stack chart does. Resources can be exported as such
+ * ConfigMaps, one per resource, so that they are deployed through existing
+ * Helm or GitOps pipelines. The sidecar writes the file of a ConfigMap in the
+ * folder named by its annotation, if any.
+ */
+
+// DefaultFolderAnnotation is the annotation the sidecar reads the folder of
+// a ConfigMap from, by default
+const DefaultFolderAnnotation = "k8s-sidecar-target-directory"
+
+// maxConfigMapSize is the largest ConfigMap Kubernetes accepts
+const maxConfigMapSize = 1 << 20
+
+// ConfigMapHandler describes a handler whose resources can be loaded from
+// ConfigMaps by the sidecar of Grafana
+type ConfigMapHandler interface {
+	// ConfigMapLabel returns the label the sidecar finds ConfigMaps holding
+	// the resources of the handler by, e.g. grafana_dashboard
+	ConfigMapLabel() string
+	// ConfigMapData returns the file the sidecar writes a resource to, its
+	// content, and the folder it belongs in, if any
+	ConfigMapData(resource Resource, resources ResourceList) (filename, content, folder string, err error)
+}
+
+// ConfigMap is a Kubernetes ConfigMap
+type ConfigMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   ConfigMapMetadata `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+}
+
+// ConfigMapMetadata names a ConfigMap
+type ConfigMapMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// invalidConfigMapName matches runs of characters Kubernetes does not allow in
+// names
+var invalidConfigMapName = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// configMapName returns a valid name for the ConfigMap of a resource
+func configMapName(resource Resource) string {
+	name := invalidConfigMapName.ReplaceAllString(strings.ToLower(resource.Kind()+"-"+resource.UID), "-")
+	name = strings.Trim(name, ".-")
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], ".-")
+	}
+	return name
+}
+
+// exportConfigMaps writes a ConfigMap per resource to a directory
+func exportConfigMaps(config Config, exportDir string, resources Resources, opts *ExportOpts) error {
+	folderAnnotation := opts.FolderAnnotation
+	if folderAnnotation == "" {
+		folderAnnotation = DefaultFolderAnnotation
+	}
+	count := 0
+	for handler, resourceList := range resources {
+		configMapHandler, ok := handler.(ConfigMapHandler)
+		for _, resource := range resourceList {
+			if !isStructured(resource.Detail) {
+				continue
+			}
+			if !ok {
+				config.Notifier.Warn(&resource, "cannot be loaded from a ConfigMap, skipped")
+				continue
+			}
+			filename, content, folder, err := configMapHandler.ConfigMapData(resource, resourceList)
+			if err != nil {
+				return fmt.Errorf("Error rendering the ConfigMap of %s: %v", resource.Key(), err)
+			}
+			if len(content) > maxConfigMapSize {
+				config.Notifier.Warn(&resource, "is larger than Kubernetes allows ConfigMaps to be")
+			}
+			configMap := ConfigMap{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Metadata: ConfigMapMetadata{
+					Name:      configMapName(resource),
+					Namespace: opts.Namespace,
+					Labels:    map[string]string{configMapHandler.ConfigMapLabel(): "1"},
+				},
+				Data: map[string]string{filename: content},
+			}
+			if folder != "" {
+				configMap.Metadata.Annotations = map[string]string{folderAnnotation: folder}
+			}
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(configMap); err != nil {
+				return err
+			}
+			if err := writeFile(filepath.Join(exportDir, configMap.Metadata.Name+".yaml"), buf.String()); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	config.Notifier.Info(nil, fmt.Sprintf("%d ConfigMaps written to %s", count, exportDir))
+	return nil
+}
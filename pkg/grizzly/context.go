@@ -0,0 +1,456 @@
+package grizzly
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Rather than juggling environment variables to switch between e.g. dev,
+ * staging and prod, the endpoints of each can be recorded as named contexts in
+ * a configuration file, kubeconfig-style. The fields of a context stand for
+ * the environment variables providers read, which are set from the context in
+ * use. Variables set in the environment take precedence over the context.
+ * Rather than secrets themselves, fields can hold references to environment
+ * variables, e.g. ${PROD_GRAFANA_TOKEN}, interpolated when the context is used.
+ */
+
+// ContextConfig is the configuration file holding named contexts
+type ContextConfig struct {
+	CurrentContext string              `yaml:"current-context,omitempty"`
+	Contexts       map[string]*Context `yaml:"contexts,omitempty"`
+	// Handlers configure handlers of resources behind simple JSON APIs,
+	// whatever the context
+	Handlers []GenericHandlerConfig `yaml:"handlers,omitempty"`
+	// TransformerList transforms every resource of a kind, whatever the
+	// context, see Transformer
+	TransformerList []Transformer `yaml:"transformers,omitempty"`
+
+	path string
+}
+
+// Context configures the endpoints of an environment
+type Context struct {
+	Grafana    GrafanaContext  `yaml:"grafana,omitempty"`
+	Prometheus RulerContext    `yaml:"prometheus,omitempty"`
+	Loki       RulerContext    `yaml:"loki,omitempty"`
+	Jsonnet    JsonnetContext  `yaml:"jsonnet,omitempty"`
+	Handlers   HandlersContext `yaml:"handlers,omitempty"`
+	// Overrides set fields of resources in this environment, see Override
+	Overrides []Override `yaml:"overrides,omitempty"`
+}
+
+// GrafanaContext configures a Grafana instance, or several
+type GrafanaContext struct {
+	URL   string `yaml:"url,omitempty"`
+	User  string `yaml:"user,omitempty"`
+	Token string `yaml:"token,omitempty"`
+	OrgID string `yaml:"org-id,omitempty"`
+	// SnapshotExpires is when previews expire, in seconds or as a duration
+	SnapshotExpires string `yaml:"snapshot-expires,omitempty"`
+
+	// Instances, if any, are the Grafana instances resources are all applied
+	// to, by name, e.g. the stacks of each region. Their fields default to
+	// those above.
+	Instances map[string]*GrafanaContext `yaml:"instances,omitempty"`
+}
+
+// RulerContext configures a Prometheus or Loki ruler
+type RulerContext struct {
+	Address  string `yaml:"address,omitempty"`
+	TenantID string `yaml:"tenant-id,omitempty"`
+	User     string `yaml:"user,omitempty"`
+	Token    string `yaml:"token,omitempty"`
+}
+
+// JsonnetContext parameterizes Jsonnet in an environment, as the --ext-str,
+// --ext-code, --tla-str and --tla-code flags do
+type JsonnetContext struct {
+	ExtStr  map[string]string `yaml:"ext-str,omitempty"`
+	ExtCode map[string]string `yaml:"ext-code,omitempty"`
+	TLAStr  map[string]string `yaml:"tla-str,omitempty"`
+	TLACode map[string]string `yaml:"tla-code,omitempty"`
+}
+
+// HandlersContext enables or disables handlers in an environment, by the
+// name of a handler, e.g. dashboard or grafana.dashboard, or of a provider,
+// e.g. prometheus
+type HandlersContext struct {
+	// Enabled, if set, are the only handlers enabled
+	Enabled  []string `yaml:"enabled,omitempty"`
+	Disabled []string `yaml:"disabled,omitempty"`
+}
+
+// GenericHandlerConfig configures a handler of resources behind a JSON API,
+// by the endpoints to get, put and delete them at. Endpoints are templates,
+// given the UID of a resource as {{.UID}}, and may refer to environment
+// variables, as may headers, e.g. ${STATUSPAGE_URL}.
+type GenericHandlerConfig struct {
+	Kind string `yaml:"kind"`
+	// Path is the path of the Jsonnet holding the resources by name, the
+	// kind by default
+	Path string `yaml:"path,omitempty"`
+	// UID is the field identifying a resource, e.g. $.metadata.name. By
+	// default, resources are identified by their name in the Jsonnet.
+	UID    string `yaml:"uid,omitempty"`
+	Get    string `yaml:"get"`
+	Put    string `yaml:"put"`
+	Delete string `yaml:"delete,omitempty"`
+	// EnvPrefix authenticates requests, and configures TLS, with the
+	// environment variables with a prefix, as for other endpoints, e.g.
+	// STATUSPAGE_BEARER_TOKEN
+	EnvPrefix string            `yaml:"env-prefix,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty"`
+	// IgnoreFields are set by the API, e.g. timestamps, so never compared
+	IgnoreFields []string `yaml:"ignore-fields,omitempty"`
+}
+
+// DefaultContextConfigPath returns the path of the configuration file:
+// GRIZZLY_CONFIG if set, or grizzly/grizzly.yaml in the user's configuration
+// directory, e.g. ~/.config
+func DefaultContextConfigPath() (string, error) {
+	if path, ok := os.LookupEnv("GRIZZLY_CONFIG"); ok {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "grizzly", "grizzly.yaml"), nil
+}
+
+// LoadContextConfig reads a configuration file. An empty configuration is
+// returned if the file does not exist yet.
+func LoadContextConfig(path string) (*ContextConfig, error) {
+	config := ContextConfig{
+		path:     path,
+		Contexts: map[string]*Context{},
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	if config.Contexts == nil {
+		config.Contexts = map[string]*Context{}
+	}
+	return &config, nil
+}
+
+// Save writes the configuration file. It may hold credentials, so only the
+// user can read it.
+func (c *ContextConfig) Save() error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, buf.Bytes(), 0600)
+}
+
+// UseContext makes a context the current one
+func (c *ContextConfig) UseContext(name string) error {
+	if _, ok := c.Contexts[name]; !ok {
+		return fmt.Errorf("No context named %q, expected one of %v", name, c.ContextNames())
+	}
+	c.CurrentContext = name
+	return nil
+}
+
+// Setenv sets the environment variables providers read from a context, or
+// from the current context if name is empty. Variables already set in the
+// environment are kept, and reported.
+func (c *ContextConfig) Setenv(name string, notifier Notifier) error {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	if name == "" {
+		return nil
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return fmt.Errorf("No context named %q in %s, expected one of %v", name, c.path, c.ContextNames())
+	}
+	env, err := context.env()
+	if err != nil {
+		return fmt.Errorf("Context %s: %v", name, err)
+	}
+	keys := []string{}
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, set := os.LookupEnv(key); set {
+			notifier.Logf(LogWarn, "%s is set in the environment, overriding context %s", key, name)
+			continue
+		}
+		if err := os.Setenv(key, env[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// contextKeys maps the keys of the fields of a context to the environment
+// variables they stand for
+var contextKeys = map[string]string{
+	"grafana.url":              "GRAFANA_URL",
+	"grafana.user":             "GRAFANA_USER",
+	"grafana.token":            "GRAFANA_TOKEN",
+	"grafana.org-id":           "GRAFANA_ORG_ID",
+	"grafana.snapshot-expires": "GRAFANA_SNAPSHOT_EXPIRES",
+	"prometheus.address":       "PROMETHEUS_ADDRESS",
+	"prometheus.tenant-id":     "PROMETHEUS_TENANT_ID",
+	"prometheus.user":          "PROMETHEUS_USER",
+	"prometheus.token":         "PROMETHEUS_TOKEN",
+	"loki.address":             "LOKI_ADDRESS",
+	"loki.tenant-id":           "LOKI_TENANT_ID",
+	"loki.user":                "LOKI_USER",
+	"loki.token":               "LOKI_TOKEN",
+}
+
+// fields returns the fields of a context by key
+func (c *Context) fields() map[string]*string {
+	return map[string]*string{
+		"grafana.url":              &c.Grafana.URL,
+		"grafana.user":             &c.Grafana.User,
+		"grafana.token":            &c.Grafana.Token,
+		"grafana.org-id":           &c.Grafana.OrgID,
+		"grafana.snapshot-expires": &c.Grafana.SnapshotExpires,
+		"prometheus.address":       &c.Prometheus.Address,
+		"prometheus.tenant-id":     &c.Prometheus.TenantID,
+		"prometheus.user":          &c.Prometheus.User,
+		"prometheus.token":         &c.Prometheus.Token,
+		"loki.address":             &c.Loki.Address,
+		"loki.tenant-id":           &c.Loki.TenantID,
+		"loki.user":                &c.Loki.User,
+		"loki.token":               &c.Loki.Token,
+	}
+}
+
+// fields returns the fields of a Grafana instance by key
+func (g *GrafanaContext) fields() map[string]*string {
+	return map[string]*string{
+		"url":    &g.URL,
+		"user":   &g.User,
+		"token":  &g.Token,
+		"org-id": &g.OrgID,
+	}
+}
+
+// field returns the field of a context with a key, e.g. grafana.url, or
+// grafana.instances.eu.url for the fields of an instance
+func (c *Context) field(key string) (*string, error) {
+	if parts := strings.SplitN(key, ".", 4); len(parts) == 4 && parts[0] == "grafana" && parts[1] == "instances" {
+		instance, ok := c.Grafana.Instances[parts[2]]
+		if !ok {
+			instance = &GrafanaContext{}
+		}
+		field, ok := instance.fields()[parts[3]]
+		if !ok {
+			return nil, fmt.Errorf("Unknown key %q, expected grafana.instances.<name>.url, user, token or org-id", key)
+		}
+		if c.Grafana.Instances == nil {
+			c.Grafana.Instances = map[string]*GrafanaContext{}
+		}
+		c.Grafana.Instances[parts[2]] = instance
+		return field, nil
+	}
+	field, ok := c.fields()[key]
+	if !ok {
+		keys := []string{}
+		for k := range contextKeys {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("Unknown key %q, expected one of %v", key, keys)
+	}
+	return field, nil
+}
+
+// jsonnetVar returns the variables of a context holding a Jsonnet variable or
+// argument with a key, e.g. jsonnet.ext-str.env, and its name. ok reports
+// whether the key names one.
+func (c *Context) jsonnetVar(key string) (vars *map[string]string, name string, ok bool, err error) {
+	parts := strings.SplitN(key, ".", 3)
+	if parts[0] != "jsonnet" {
+		return nil, "", false, nil
+	}
+	kinds := map[string]*map[string]string{
+		"ext-str":  &c.Jsonnet.ExtStr,
+		"ext-code": &c.Jsonnet.ExtCode,
+		"tla-str":  &c.Jsonnet.TLAStr,
+		"tla-code": &c.Jsonnet.TLACode,
+	}
+	if len(parts) == 3 {
+		if vars, found := kinds[parts[1]]; found && parts[2] != "" {
+			return vars, parts[2], true, nil
+		}
+	}
+	return nil, "", true, fmt.Errorf("Unknown key %q, expected jsonnet.<ext-str|ext-code|tla-str|tla-code>.<name>", key)
+}
+
+// Jsonnet returns the variables and arguments a context, or the current
+// context if name is empty, evaluates Jsonnet with
+func (c *ContextConfig) Jsonnet(name string) JsonnetOpts {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return JsonnetOpts{}
+	}
+	return context.Jsonnet.opts()
+}
+
+// ConfigureHandlers enables and disables the handlers of a registry as a
+// context, or the current context if name is empty, does
+func (c *ContextConfig) ConfigureHandlers(name string, registry *Registry) error {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return nil
+	}
+	if len(context.Handlers.Enabled) > 0 {
+		if err := registry.EnableOnly(context.Handlers.Enabled); err != nil {
+			return fmt.Errorf("Context %s: %v", name, err)
+		}
+	}
+	if err := registry.Disable(context.Handlers.Disabled); err != nil {
+		return fmt.Errorf("Context %s: %v", name, err)
+	}
+	return nil
+}
+
+// opts returns the variables and arguments Jsonnet is evaluated with
+func (j JsonnetContext) opts() JsonnetOpts {
+	return JsonnetOpts{
+		ExtStr:  j.ExtStr,
+		ExtCode: j.ExtCode,
+		TLAStr:  j.TLAStr,
+		TLACode: j.TLACode,
+	}
+}
+
+// env returns the environment variables set by a context, expanding
+// references to other environment variables
+func (c *Context) env() (map[string]string, error) {
+	env := map[string]string{}
+	for key, field := range c.fields() {
+		if *field == "" {
+			continue
+		}
+		value, err := Interpolate(*field)
+		if err != nil {
+			return nil, fmt.Errorf("Error expanding %s: %v", key, err)
+		}
+		env[contextKeys[key]] = value
+	}
+	return env, nil
+}
+
+// Instances returns the Grafana instances resources are all applied to by a
+// context, or by the current context if name is empty, if any
+func (c *ContextConfig) Instances(name string) ([]Instance, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return nil, nil
+	}
+	names := []string{}
+	for instanceName := range context.Grafana.Instances {
+		names = append(names, instanceName)
+	}
+	sort.Strings(names)
+	instances := []Instance{}
+	for _, instanceName := range names {
+		merged := Context{Grafana: context.Grafana}
+		mergedFields := merged.Grafana.fields()
+		for key, field := range context.Grafana.Instances[instanceName].fields() {
+			if *field != "" {
+				*mergedFields[key] = *field
+			}
+		}
+		env, err := merged.env()
+		if err != nil {
+			return nil, fmt.Errorf("Context %s, instance %s: %v", name, instanceName, err)
+		}
+		instances = append(instances, Instance{Name: instanceName, Env: env})
+	}
+	return instances, nil
+}
+
+// Set sets a field of a context, creating the context if needed
+func (c *ContextConfig) Set(name, key, value string) error {
+	context, ok := c.Contexts[name]
+	if !ok {
+		context = &Context{}
+	}
+	if vars, varName, ok, err := context.jsonnetVar(key); ok {
+		if err != nil {
+			return err
+		}
+		if *vars == nil {
+			*vars = map[string]string{}
+		}
+		(*vars)[varName] = value
+		c.Contexts[name] = context
+		return nil
+	}
+	field, err := context.field(key)
+	if err != nil {
+		return err
+	}
+	*field = value
+	c.Contexts[name] = context
+	return nil
+}
+
+// Get returns a field of a context, as written in the configuration file
+func (c *ContextConfig) Get(name, key string) (string, error) {
+	context, ok := c.Contexts[name]
+	if !ok {
+		return "", fmt.Errorf("No context named %q, expected one of %v", name, c.ContextNames())
+	}
+	if vars, varName, ok, err := context.jsonnetVar(key); ok {
+		if err != nil {
+			return "", err
+		}
+		return (*vars)[varName], nil
+	}
+	field, err := context.field(key)
+	if err != nil {
+		return "", err
+	}
+	return *field, nil
+}
+
+// ContextNames returns the names of the contexts, sorted
+func (c *ContextConfig) ContextNames() []string {
+	names := []string{}
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,40 @@
+package grizzly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * Resources can be defined in CUE (cuelang.org) rather than Jsonnet, so that
+ * their schemas are checked as they are evaluated. CUE files are evaluated by
+ * the cue binary, as `cue export` does, and output the same object as Jsonnet,
+ * e.g. with dashboards under grafanaDashboards, or envelopes.
+ */
+
+// isCUEFile identifies CUE files, by their extension
+func isCUEFile(file string) bool {
+	return strings.ToLower(filepath.Ext(file)) == ".cue"
+}
+
+// evaluateCUE evaluates a CUE file with the cue binary
+func evaluateCUE(file string) (interface{}, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("cue", "export", "--out", "json", file)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.Error); ok {
+			return nil, fmt.Errorf("Error evaluating %s, the cue binary is required: %v", file, err)
+		}
+		return nil, fmt.Errorf("Error evaluating %s: %s", file, strings.TrimSpace(stderr.String()))
+	}
+	var document interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &document); err != nil {
+		return nil, fmt.Errorf("Error parsing the output of cue for %s: %v", file, err)
+	}
+	return document, nil
+}
@@ -0,0 +1,143 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Besides at the paths of handlers, e.g. grafanaDashboards, resources can be
+ * written anywhere in the Jsonnet output as self-describing envelopes,
+ * Kubernetes-style:
+ *
+ *   {
+ *     apiVersion: 'grizzly.grafana.com/v1alpha1',
+ *     kind: 'Dashboard',
+ *     metadata: { name: 'my-dash.json', labels: { team: 'payments' } },
+ *     spec: { uid: 'my-dash', title: 'My dashboard', ... },
+ *   }
+ *
+ * The kind names a handler, e.g. Dashboard, Datasource or PrometheusRuleGroup,
+ * and the spec is what would be written under the name at the path of the
+ * handler. Labels of the metadata select resources as grizzlyLabels do.
+ */
+
+// EnvelopeAPIVersion is the API version of the envelopes of resources
+const EnvelopeAPIVersion = "grizzly.grafana.com/v1alpha1"
+
+// envelopeGroup prefixes the API versions of envelopes
+const envelopeGroup = "grizzly.grafana.com/"
+
+// Envelope describes a resource, Kubernetes-style
+type Envelope struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   EnvelopeMetadata `json:"metadata"`
+	Spec       interface{}      `json:"spec"`
+}
+
+// EnvelopeMetadata names a resource, and carries its labels and annotations
+type EnvelopeMetadata struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// isEnvelope identifies objects that are envelopes, by their API version
+func isEnvelope(v interface{}) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	return strings.HasPrefix(apiVersion, envelopeGroup)
+}
+
+// findEnvelopes returns the envelopes within a JSON value, reporting errors
+// by path
+func findEnvelopes(path string, v interface{}) ([]Envelope, error) {
+	if isEnvelope(v) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		envelope := Envelope{}
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			return nil, fmt.Errorf("Error parsing the envelope at %s: %v", path, err)
+		}
+		if envelope.APIVersion != EnvelopeAPIVersion {
+			return nil, fmt.Errorf("Unsupported apiVersion %s at %s, expected %s", envelope.APIVersion, path, EnvelopeAPIVersion)
+		}
+		if envelope.Kind == "" || envelope.Metadata.Name == "" {
+			return nil, fmt.Errorf("The envelope at %s requires a kind and metadata.name", path)
+		}
+		return []Envelope{envelope}, nil
+	}
+	envelopes := []Envelope{}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			found, err := findEnvelopes(path+"."+k, v[k])
+			if err != nil {
+				return nil, err
+			}
+			envelopes = append(envelopes, found...)
+		}
+	case []interface{}:
+		for i := range v {
+			found, err := findEnvelopes(path+"["+strconv.Itoa(i)+"]", v[i])
+			if err != nil {
+				return nil, err
+			}
+			envelopes = append(envelopes, found...)
+		}
+	}
+	return envelopes, nil
+}
+
+// parseEnvelope parses the resources of an envelope with the handler of its
+// kind
+func parseEnvelope(registry Registry, envelope Envelope) (Handler, ResourceList, error) {
+	handler, err := registry.GetHandlerByKind(envelope.Kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	var resources ResourceList
+	if envelopeHandler, ok := handler.(EnvelopeHandler); ok {
+		resources, err = envelopeHandler.ParseSpec(envelope.Metadata.Name, envelope.Spec)
+	} else {
+		resources, err = handler.Parse(handler.GetJSONPaths()[0], map[string]interface{}{
+			envelope.Metadata.Name: envelope.Spec,
+		})
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error parsing %s %s: %v", envelope.Kind, envelope.Metadata.Name, err)
+	}
+	return handler, resources, nil
+}
+
+// withMetadata adds the labels and annotations of an envelope to a resource
+func withMetadata(resource Resource, metadata EnvelopeMetadata) Resource {
+	if len(metadata.Labels) > 0 {
+		labels := map[string]string{}
+		for k, v := range resource.Labels {
+			labels[k] = v
+		}
+		for k, v := range metadata.Labels {
+			labels[k] = v
+		}
+		resource.Labels = labels
+	}
+	if len(metadata.Annotations) > 0 {
+		resource.Annotations = metadata.Annotations
+	}
+	return resource
+}
@@ -0,0 +1,169 @@
+package grizzly
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Rather than wrapping grr in Makefiles to point each environment at its
+ * endpoints, environments can be laid out Tanka-style, as directories holding
+ * a main.jsonnet and a spec.yaml describing where and what to apply:
+ *
+ *   environments/prod/spec.yaml
+ *   environments/prod/main.jsonnet
+ *
+ * Given such a directory, e.g. `grr apply environments/prod`, main.jsonnet is
+ * parsed with the targets of the spec, and applied to its context and tenant.
+ * Flags take precedence over the spec. The directories of Tanka environments
+ * are also environments (see tanka.go).
+ */
+
+const (
+	// environmentSpec describes an environment
+	environmentSpec = "spec.yaml"
+	// environmentMain holds the resources of an environment
+	environmentMain = "main.jsonnet"
+)
+
+// Environment is a directory of resources applied to the same endpoints
+type Environment struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   EnvelopeMetadata `yaml:"metadata"`
+	Spec       EnvironmentSpec  `yaml:"spec"`
+
+	dir string
+	// tanka is set for the static environments of Tanka
+	tanka bool
+}
+
+// EnvironmentSpec describes where and what an environment applies
+type EnvironmentSpec struct {
+	// Context is the context of the configuration file to use, rather than
+	// the current one
+	Context string `yaml:"context,omitempty"`
+	// Tenant overrides the Prometheus and Loki tenant of the context
+	Tenant string `yaml:"tenant,omitempty"`
+	// Targets, Excludes and Selector select resources, as the flags do
+	Targets  []string `yaml:"targets,omitempty"`
+	Excludes []string `yaml:"excludes,omitempty"`
+	Selector string   `yaml:"selector,omitempty"`
+	// Jsonnet parameterizes main.jsonnet
+	Jsonnet JsonnetContext `yaml:"jsonnet,omitempty"`
+}
+
+// isFile reports whether a path is a regular file
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// isEnvironment identifies directories holding an environment, or a static
+// Tanka environment
+func isEnvironment(path string) bool {
+	return isFile(filepath.Join(path, environmentSpec)) || isFile(filepath.Join(path, tankaSpec))
+}
+
+// LoadEnvironment reads the spec of an environment directory. The spec.json
+// of a Tanka environment is read if it has no spec.yaml.
+func LoadEnvironment(dir string) (*Environment, error) {
+	environment := Environment{dir: dir, tanka: isFile(filepath.Join(dir, tankaSpec))}
+	path, apiVersion := filepath.Join(dir, environmentSpec), EnvelopeAPIVersion
+	if !isFile(path) && environment.tanka {
+		path, apiVersion = filepath.Join(dir, tankaSpec), tankaAPIVersion
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s is a directory, but not an environment: it has no %s or %s", dir, environmentSpec, tankaSpec)
+	} else if err != nil {
+		return nil, err
+	}
+	// JSON is read as YAML, ignoring the fields of Tanka
+	if err := yaml.Unmarshal(data, &environment); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	if environment.APIVersion != apiVersion || environment.Kind != "Environment" {
+		return nil, fmt.Errorf("%s must have apiVersion %s and kind Environment", path, apiVersion)
+	}
+	if apiVersion == tankaAPIVersion {
+		// Tanka environments only name themselves
+		environment.Spec = EnvironmentSpec{}
+	}
+	if environment.Metadata.Name == "" {
+		environment.Metadata.Name = filepath.Base(filepath.Clean(dir))
+	}
+	return &environment, nil
+}
+
+// FindEnvironment returns the environment of the directories among paths, if
+// any. Only one environment can be used at a time.
+func FindEnvironment(paths []string) (*Environment, error) {
+	var found *Environment
+	for _, path := range paths {
+		if !isEnvironment(path) {
+			continue
+		}
+		if found != nil && filepath.Clean(found.dir) != filepath.Clean(path) {
+			return nil, fmt.Errorf("Only one environment can be used at a time, got %s and %s", found.dir, path)
+		}
+		environment, err := LoadEnvironment(path)
+		if err != nil {
+			return nil, err
+		}
+		found = environment
+	}
+	return found, nil
+}
+
+// Configure returns the context an environment uses, the one named if any,
+// overriding its tenant with that of the environment
+func (e *Environment) Configure(contexts *ContextConfig, name string) string {
+	if name == "" {
+		name = e.Spec.Context
+	}
+	if e.Spec.Tenant == "" {
+		return name
+	}
+	if name == "" {
+		name = contexts.CurrentContext
+	}
+	context := Context{}
+	if existing, ok := contexts.Contexts[name]; ok {
+		context = *existing
+	} else if name == "" {
+		name = "environment " + e.Metadata.Name
+	} else {
+		// left for Setenv to report the context as missing
+		return name
+	}
+	context.Prometheus.TenantID = e.Spec.Tenant
+	context.Loki.TenantID = e.Spec.Tenant
+	contexts.Contexts[name] = &context
+	return name
+}
+
+// JsonnetOpts returns the variables and arguments the environment evaluates
+// main.jsonnet with
+func (e *Environment) JsonnetOpts() JsonnetOpts {
+	return e.Spec.Jsonnet.opts()
+}
+
+// parseOpts returns the options selecting the resources of the environment,
+// those given taking precedence
+func (e *Environment) parseOpts(opts *ParseOpts) *ParseOpts {
+	merged := *opts
+	if len(merged.Targets) == 0 {
+		merged.Targets = e.Spec.Targets
+	}
+	merged.Excludes = append(append([]string{}, e.Spec.Excludes...), opts.Excludes...)
+	if merged.Selector == "" {
+		merged.Selector = e.Spec.Selector
+	}
+	merged.tanka = merged.tanka || e.tanka
+	return &merged
+}
@@ -11,6 +11,13 @@ var ErrNotFound = errors.New("not found")
 // ErrNotImplemented signals a feature that is not supported by a provider
 var ErrNotImplemented = errors.New("not implemented")
 
+// ErrChangesDetected signals that resources differ from those at their endpoints
+var ErrChangesDetected = errors.New("changes detected")
+
+// ErrConflict signals that a resource changed remotely while being pushed, so
+// that it is fetched and pushed again
+var ErrConflict = errors.New("conflict")
+
 // APIErr encapsulates an error from the Grafana API
 type APIErr struct {
 	Err  error
@@ -20,3 +27,16 @@ type APIErr struct {
 func (e APIErr) Error() string {
 	return fmt.Sprintf("Failed to parse Grafana response: %s.\n\nResponse:\n%s", e.Err, string(e.Body))
 }
+
+// PartialApplyErr signals an apply that failed after changing some resources
+type PartialApplyErr struct {
+	Err error
+}
+
+func (e PartialApplyErr) Error() string {
+	return fmt.Sprintf("Apply partially failed: %s", e.Err)
+}
+
+func (e PartialApplyErr) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,156 @@
+package grizzly
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/*
+ * Diffing against a Git reference shows what a pull request changes in the
+ * rendered resources, without contacting any endpoint: the files are
+ * evaluated both in the working tree and at the reference, checked out in a
+ * temporary worktree, and the two renderings compared. Imports missing from
+ * the reference, e.g. a vendor directory that is not committed, are still
+ * found in the working tree, as the current directory is on the Jsonnet path.
+ */
+
+// DiffRef compares the resources rendered from files in the working tree with
+// those rendered at a Git reference. ErrChangesDetected is returned if any
+// resource differs, was added or was removed.
+func DiffRef(ctx context.Context, config Config, files []string, ref string, parseOpts *ParseOpts, opts *DiffOpts) error {
+	changes := 0
+	config.Notifier.changes = &changes
+	finish, err := diffOutput(&config, opts)
+	if err != nil {
+		return err
+	}
+
+	local, err := ParseFiles(config, files, parseOpts)
+	if err != nil {
+		return err
+	}
+	refFiles, cleanup, err := checkoutRef(ref, files)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	previous := Resources{}
+	if len(refFiles) > 0 {
+		if previous, err = ParseFiles(config, refFiles, parseOpts); err != nil {
+			return fmt.Errorf("Error parsing at %s: %v", ref, err)
+		}
+	}
+
+	localReps, err := representationsByKey(local)
+	if err != nil {
+		return err
+	}
+	previousReps, err := representationsByKey(previous)
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	for key := range localReps {
+		keys = append(keys, key)
+	}
+	for key := range previousReps {
+		if _, ok := localReps[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		l, inLocal := localReps[key]
+		p, inPrevious := previousReps[key]
+		resource := l.resource
+		if !inLocal {
+			resource = p.resource
+		}
+		if inLocal && inPrevious && l.rep == p.rep {
+			config.Notifier.NoChanges(resource)
+			continue
+		}
+		config.Notifier.HasChanges(resource, unifiedDiff(ref+"/"+key, "local/"+key, p.rep, l.rep))
+	}
+
+	if err := finish(); err != nil {
+		return err
+	}
+	if changes > 0 {
+		return ErrChangesDetected
+	}
+	return nil
+}
+
+// keyedRepresentation is the representation of a resource, as diffed
+type keyedRepresentation struct {
+	resource Resource
+	rep      string
+}
+
+// representationsByKey returns the representations of resources by key
+func representationsByKey(resources Resources) (map[string]keyedRepresentation, error) {
+	reps := map[string]keyedRepresentation{}
+	for handler, resourceList := range resources {
+		for _, resource := range resourceList {
+			rep, err := UnpreparedRepresentation(handler, resource)
+			if err != nil {
+				return nil, err
+			}
+			reps[resource.Key()] = keyedRepresentation{resource: resource, rep: rep}
+		}
+	}
+	return reps, nil
+}
+
+// checkoutRef checks a Git reference out in a temporary worktree, returning
+// the paths of those files that exist within it, and a function removing it
+func checkoutRef(ref string, files []string) ([]string, func(), error) {
+	root, err := git("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, nil, err
+	}
+	tmp, err := ioutil.TempDir("", "grizzly-ref")
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Join(tmp, "tree")
+	if _, err := git(root, "worktree", "add", "--detach", dir, ref); err != nil {
+		os.RemoveAll(tmp)
+		return nil, nil, err
+	}
+	cleanup := func() {
+		git(root, "worktree", "remove", "--force", dir)
+		os.RemoveAll(tmp)
+	}
+
+	refFiles := []string{}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+		// the root is reported with symbolic links resolved
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			cleanup()
+			return nil, nil, fmt.Errorf("%s is not within the Git repository at %s", file, root)
+		}
+		refFile := filepath.Join(dir, rel)
+		if _, err := os.Stat(refFile); os.IsNotExist(err) {
+			// added since, all its resources are new
+			continue
+		}
+		refFiles = append(refFiles, refFile)
+	}
+	return refFiles, cleanup, nil
+}
@@ -0,0 +1,309 @@
+package grizzly
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHTTPOpts returns the options of the client requests are sent with,
+// unless configured otherwise
+func DefaultHTTPOpts() HTTPOpts {
+	return HTTPOpts{
+		ConnectTimeout: 10 * time.Second,
+		Timeout:        60 * time.Second,
+		Retry: RetryOpts{
+			Attempts: 3,
+			Backoff:  time.Second,
+		},
+	}
+}
+
+var (
+	// httpClient is shared by all providers, so that connections are reused
+	httpClient = NewHTTPClient(DefaultHTTPOpts(), nil)
+	// httpOpts and httpLogger configure clients with their own TLS options
+	httpOpts   = DefaultHTTPOpts()
+	httpLogger *Logger
+	// tlsClients caches clients by their TLS options
+	tlsClients = map[TLSOpts]*http.Client{}
+	tlsMutex   sync.Mutex
+)
+
+// HTTPClient returns the client providers send requests with
+func HTTPClient() *http.Client {
+	return httpClient
+}
+
+// SetHTTPClient replaces the client providers send requests with
+func SetHTTPClient(client *http.Client) {
+	httpClient = client
+}
+
+// ConfigureHTTP replaces the client providers send requests with by one with
+// the given options, also used by clients with their own TLS options
+func ConfigureHTTP(opts HTTPOpts, logger *Logger) {
+	tlsMutex.Lock()
+	defer tlsMutex.Unlock()
+	httpOpts, httpLogger = opts, logger
+	tlsClients = map[TLSOpts]*http.Client{}
+	SetHTTPClient(NewHTTPClient(opts, logger))
+}
+
+// HTTPClientFromEnv returns the client to send requests to an endpoint with,
+// using the TLS options set by environment variables with a prefix, e.g.
+// GRAFANA_TLS_CA for the prefix GRAFANA. Without TLS options, HTTPClient is
+// returned.
+func HTTPClientFromEnv(prefix string) *http.Client {
+	opts := TLSOpts{
+		CAFile:   os.Getenv(prefix + "_TLS_CA"),
+		CertFile: os.Getenv(prefix + "_TLS_CERT"),
+		KeyFile:  os.Getenv(prefix + "_TLS_KEY"),
+	}
+	if skip, ok := os.LookupEnv(prefix + "_TLS_INSECURE_SKIP_VERIFY"); ok {
+		insecure, err := strconv.ParseBool(skip)
+		if err != nil {
+			return failingClient(fmt.Errorf("Invalid %s_TLS_INSECURE_SKIP_VERIFY: %v", prefix, err))
+		}
+		opts.InsecureSkipVerify = insecure
+	}
+	if opts == (TLSOpts{}) {
+		return HTTPClient()
+	}
+
+	tlsMutex.Lock()
+	defer tlsMutex.Unlock()
+	if client, ok := tlsClients[opts]; ok {
+		return client
+	}
+	clientOpts := httpOpts
+	clientOpts.TLS = opts
+	client := NewHTTPClient(clientOpts, httpLogger)
+	tlsClients[opts] = client
+	return client
+}
+
+// NewHTTPClient returns a client with the given timeouts and TLS options,
+// retrying requests failing transiently, tracing and counting them. Retries are reported to logger, if
+// set. If the TLS options are invalid, requests sent with the client fail.
+func NewHTTPClient(opts HTTPOpts, logger *Logger) *http.Client {
+	tlsConfig, err := newTLSConfig(opts.TLS)
+	if err != nil {
+		return failingClient(err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   opts.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = opts.ConnectTimeout
+	transport.ResponseHeaderTimeout = opts.Timeout
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	retry := opts.Retry
+	return &http.Client{
+		Transport: TracingTransport{
+			Next: &RetryTransport{
+				Next:   timeoutTransport{next: metricsTransport{next: transport}, timeout: opts.Timeout},
+				Opts:   &retry,
+				Logger: logger,
+			},
+		},
+	}
+}
+
+// timeoutTransport limits the time taken by each attempt at a request,
+// including reading the response body, which ResponseHeaderTimeout does not.
+// A client wide Timeout would rather limit all attempts together.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelingBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelingBody releases the deadline of a request once its response body
+// is closed
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// newTLSConfig loads the certificates TLS options refer to. Without options,
+// no configuration is returned.
+func newTLSConfig(opts TLSOpts) (*tls.Config, error) {
+	if opts == (TLSOpts{}) {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := ioutil.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates found in CA bundle %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("A client certificate requires both a certificate and a key")
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// failingTransport fails all requests, with an error found configuring them
+type failingTransport struct {
+	err error
+}
+
+func (t failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
+
+// failingClient returns a client failing all requests with an error, so that
+// configuration errors are reported by the requests that need it
+func failingClient(err error) *http.Client {
+	return &http.Client{Transport: failingTransport{err}}
+}
+
+// SetAuthFromEnv authenticates a request to an endpoint with the environment
+// variables with a prefix: <prefix>_BEARER_TOKEN is sent as a bearer token,
+// or <prefix>_TOKEN with basic auth, as <prefix>_USER or the given user.
+// <prefix>_HEADERS adds headers to the request, as comma separated
+// name=value pairs.
+func SetAuthFromEnv(req *http.Request, prefix, user string) error {
+	token, hasToken := os.LookupEnv(prefix + "_TOKEN")
+	bearer, hasBearer := os.LookupEnv(prefix + "_BEARER_TOKEN")
+	switch {
+	case hasToken && hasBearer:
+		return fmt.Errorf("Only one of %s_TOKEN and %s_BEARER_TOKEN can be set", prefix, prefix)
+	case hasBearer:
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	case hasToken:
+		if u, exists := os.LookupEnv(prefix + "_USER"); exists {
+			user = u
+		}
+		req.SetBasicAuth(user, token)
+	}
+	headers, err := ParseHeaders(os.Getenv(prefix + "_HEADERS"))
+	if err != nil {
+		return fmt.Errorf("Invalid %s_HEADERS: %v", prefix, err)
+	}
+	for name, values := range headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	return nil
+}
+
+// ParseHeaders parses comma separated name=value pairs as HTTP headers, e.g.
+// `X-Team=payments,X-Env=prod`
+func ParseHeaders(s string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("Expected name=value, got %q", pair)
+		}
+		headers.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return headers, nil
+}
+
+// Endpoint is an API handlers send requests to, injected when they are
+// constructed rather than configured by environment variables, e.g. to send
+// requests through a proxy, instrument them, or to an httptest server
+type Endpoint struct {
+	// URL is the base URL of the API, request paths are relative to
+	URL string
+	// Client sends the requests, HTTPClient() if unset
+	Client *http.Client
+	// Header is set on requests, e.g. to authenticate them, over the headers
+	// set from environment variables
+	Header http.Header
+}
+
+// JoinURL returns the URL of a path of the endpoint, which may have a query
+func (e *Endpoint) JoinURL(urlPath string) (string, error) {
+	u, err := url.Parse(e.URL)
+	if err != nil {
+		return "", fmt.Errorf("Invalid endpoint URL: %v", err)
+	}
+	rel, err := url.Parse(urlPath)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join("/", u.Path, rel.Path)
+	if strings.HasSuffix(rel.Path, "/") && u.Path != "/" {
+		u.Path += "/"
+	}
+	u.RawQuery = rel.RawQuery
+	return u.String(), nil
+}
+
+// Do sends a request with the client and headers of the endpoint. Without an
+// endpoint, the request is sent with HTTPClient().
+func (e *Endpoint) Do(req *http.Request) (*http.Response, error) {
+	if e == nil {
+		return HTTPClient().Do(req)
+	}
+	for name, values := range e.Header {
+		req.Header.Del(name)
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	client := e.Client
+	if client == nil {
+		client = HTTPClient()
+	}
+	return client.Do(req)
+}
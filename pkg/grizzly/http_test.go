@@ -0,0 +1,45 @@
+package grizzly
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// slowBody blocks reads until its request is canceled
+type slowBody struct {
+	ctx context.Context
+}
+
+func (b slowBody) Read([]byte) (int, error) {
+	<-b.ctx.Done()
+	return 0, b.ctx.Err()
+}
+
+func (b slowBody) Close() error {
+	return nil
+}
+
+type slowTransport struct{}
+
+func (slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: slowBody{req.Context()}}, nil
+}
+
+func TestTimeoutTransport(t *testing.T) {
+	transport := timeoutTransport{next: slowTransport{}, timeout: 10 * time.Millisecond}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/api", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error creating request: %s", err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Unexpected error sending request: %s", err)
+	}
+	defer resp.Body.Close()
+	if _, err := ioutil.ReadAll(resp.Body); err != context.DeadlineExceeded {
+		t.Errorf("Expected reading a slow body to time out, got: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package grizzly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-jsonnet/formatter"
+)
+
+/*
+ * Importing scaffolds Jsonnet from a remote resource, so that resources built
+ * by hand, e.g. in the Grafana UI, can be managed with Grizzly. The resource is
+ * written as a Jsonnet object under the JSON path its handler consumes, either
+ * converted to Jsonnet or, with Embed, imported from a JSON file alongside.
+ * With Grafonnet, handlers that support it convert the resource to idiomatic
+ * grafonnet code instead.
+ */
+
+// Import retrieves a resource from a remote endpoint using its kind and UID,
+// and writes Jsonnet that renders it
+func Import(ctx context.Context, config Config, kind, UID string, opts *ImportOpts) error {
+	handler, err := config.Registry.GetHandler(kind)
+	if err != nil {
+		return err
+	}
+	if handler.GetExtension() != "json" {
+		return fmt.Errorf("%s provider does not support import", handler.GetName())
+	}
+	grafonnetHandler, isGrafonnet := handler.(GrafonnetHandler)
+	if opts.Grafonnet && !isGrafonnet {
+		return fmt.Errorf("%s provider does not support grafonnet", handler.GetName())
+	} else if opts.Grafonnet && opts.Embed {
+		return fmt.Errorf("Grafonnet cannot be combined with embedding JSON")
+	}
+	resource, err := handler.GetRemote(ctx, UID)
+	if err == ErrNotFound {
+		return fmt.Errorf("%s %s not found", handler.GetName(), UID)
+	} else if err != nil {
+		return err
+	}
+	resource = handler.Unprepare(*resource)
+	data, err := json.MarshalIndent(resource.Detail, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	if opts.Dir != "" {
+		dir = opts.Dir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	filename := UID + "." + handler.GetExtension()
+	locals, body := "", string(data)
+	if opts.Grafonnet {
+		locals, body, err = grafonnetHandler.ToGrafonnet(*resource)
+		if err != nil {
+			return err
+		}
+	} else if opts.Embed {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		body = fmt.Sprintf("import %q", filename)
+	}
+	jsonnetFile := UID + ".libsonnet"
+	source, err := formatter.Format(jsonnetFile, importSkeleton(handler, locals, filename, body), formatter.DefaultOptions())
+	if err != nil {
+		return fmt.Errorf("Error formatting Jsonnet for %s: %v", resource.Key(), err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, jsonnetFile), []byte(source), 0644); err != nil {
+		return err
+	}
+	config.Notifier.Info(resource, "imported to "+filepath.Join(dir, jsonnetFile))
+	return nil
+}
+
+// importSkeleton renders a resource body under the JSON path of its handler,
+// in the style of hand-written Grizzly Jsonnet, preceded by any locals
+func importSkeleton(handler Handler, locals, filename, body string) string {
+	if locals != "" {
+		locals += "\n\n"
+	}
+	return fmt.Sprintf("%s{\n  %s+:: {\n    %q:\n      %s,\n  },\n}\n", locals, handler.GetJSONPaths()[0], filename, body)
+}
@@ -0,0 +1,140 @@
+package grizzly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+ * The same resources can be applied to several instances of an endpoint in one
+ * run, e.g. the Grafana stacks of each region. An instance is described by the
+ * environment variables pointing providers at it, which are set in turn,
+ * overriding those already set. What was applied to each instance is recorded
+ * in a state file of its own.
+ */
+
+// Instance is one of several endpoints resources are applied to
+type Instance struct {
+	Name string
+	// Env holds the environment variables pointing providers at the instance
+	Env map[string]string
+}
+
+// ApplyInstances applies resources to several instances in turn, reporting the
+// outcome for each. An instance failing does not stop resources being applied
+// to the others.
+func ApplyInstances(ctx context.Context, config Config, resources Resources, opts *ApplyOpts, instances []Instance) error {
+	original := map[string]*string{}
+	for _, instance := range instances {
+		for key := range instance.Env {
+			if _, seen := original[key]; seen {
+				continue
+			}
+			original[key] = nil
+			if value, ok := os.LookupEnv(key); ok {
+				original[key] = &value
+			}
+		}
+	}
+	defer setenv(original)
+
+	statuses := map[string]string{}
+	failed := []string{}
+	// resources were changed if any instance was applied to, even partially
+	partial := false
+	for _, instance := range instances {
+		env := map[string]*string{}
+		for key, value := range original {
+			env[key] = value
+		}
+		for key, value := range instance.Env {
+			value := value
+			env[key] = &value
+		}
+		if err := setenv(env); err != nil {
+			return err
+		}
+
+		config.Notifier.Info(nil, fmt.Sprintf("Applying to %s", instance.Name))
+		instanceConfig := config
+		instanceConfig.StateFile = instance.StateFile(config.StateFile)
+		err := Apply(ctx, instanceConfig, resources, opts)
+		if err != nil {
+			config.Notifier.Error(nil, err.Error())
+			statuses[instance.Name] = "failed"
+			failed = append(failed, instance.Name)
+			var partialErr PartialApplyErr
+			partial = partial || errors.As(err, &partialErr)
+			continue
+		}
+		statuses[instance.Name] = "applied"
+		partial = true
+	}
+
+	if err := writeInstanceStatuses(config.Notifier.output(), statuses); err != nil {
+		return err
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	err := fmt.Errorf("Applying to %s failed", strings.Join(failed, ", "))
+	if partial {
+		return PartialApplyErr{Err: err}
+	}
+	return err
+}
+
+// Setenv points providers at an instance
+func (i Instance) Setenv() error {
+	for key, value := range i.Env {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StateFile returns the state file recording what was applied to the
+// instance, alongside stateFile, as each instance is merged, checked for
+// remote changes and pruned on its own
+func (i Instance) StateFile(stateFile string) string {
+	if stateFile == "" {
+		return ""
+	}
+	return stateFile + "." + i.Name
+}
+
+// setenv sets environment variables, unsetting those that are nil
+func setenv(env map[string]*string) error {
+	for key, value := range env {
+		if value == nil {
+			if err := os.Unsetenv(key); err != nil {
+				return err
+			}
+		} else if err := os.Setenv(key, *value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeInstanceStatuses outputs the outcome for each instance as a table
+func writeInstanceStatuses(out io.Writer, statuses map[string]string) error {
+	names := []string{}
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(out, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "%s\t%s\n", "INSTANCE", "STATUS")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, statuses[name])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+package grizzly
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Per-environment values, e.g. datasource URLs, can be injected from
+ * environment variables rather than maintained in separate Jsonnet trees.
+ * Strings may refer to variables as:
+ *
+ *   ${VAR}           the value of VAR, which must be set
+ *   ${VAR:-default}  the value of VAR, or default if unset or empty
+ *   ${VAR:?message}  the value of VAR, failing with message if unset or empty
+ *   $${VAR}          ${VAR} as is, e.g. for Grafana template variables
+ *
+ * Only the braced form is interpolated, so that $var is left alone.
+ */
+
+var interpolationRegexp = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:-|:\?)([^}]*))?\}`)
+
+// Interpolate replaces references to environment variables in a string
+func Interpolate(s string) (string, error) {
+	var errs []string
+	result := interpolationRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		parts := interpolationRegexp.FindStringSubmatch(match)
+		name, op, arg := parts[1], parts[2], parts[3]
+		value, set := os.LookupEnv(name)
+		switch {
+		case op == ":-" && value == "":
+			return arg
+		case op == ":?" && value == "":
+			if arg == "" {
+				arg = "not set"
+			}
+			errs = append(errs, name+": "+arg)
+		case op == "" && !set:
+			errs = append(errs, name+" not set")
+		}
+		return value
+	})
+	if len(errs) > 0 {
+		return "", fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return result, nil
+}
+
+// interpolateValue replaces references to environment variables in the
+// strings of a JSON value, reporting errors by path
+func interpolateValue(path string, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		s, err := Interpolate(v)
+		if err != nil {
+			return nil, fmt.Errorf("Error interpolating %s: %v", path, err)
+		}
+		return s, nil
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			value, err := interpolateValue(path+"."+k, v[k])
+			if err != nil {
+				return nil, err
+			}
+			v[k] = value
+		}
+	case []interface{}:
+		for i := range v {
+			value, err := interpolateValue(path+"["+strconv.Itoa(i)+"]", v[i])
+			if err != nil {
+				return nil, err
+			}
+			v[i] = value
+		}
+	}
+	return v, nil
+}
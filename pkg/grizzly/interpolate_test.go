@@ -0,0 +1,141 @@
+package grizzly
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("GRIZZLY_TEST_URL", "http://prometheus:9090")
+	os.Setenv("GRIZZLY_TEST_EMPTY", "")
+	os.Unsetenv("GRIZZLY_TEST_MISSING")
+	defer os.Unsetenv("GRIZZLY_TEST_URL")
+	defer os.Unsetenv("GRIZZLY_TEST_EMPTY")
+
+	tests := map[string]struct {
+		s        string
+		expected string
+		err      string
+	}{
+		"no reference": {
+			s:        "Overview",
+			expected: "Overview",
+		},
+		"set variable": {
+			s:        "url: ${GRIZZLY_TEST_URL}/api",
+			expected: "url: http://prometheus:9090/api",
+		},
+		"empty variable": {
+			s:        "[${GRIZZLY_TEST_EMPTY}]",
+			expected: "[]",
+		},
+		"missing variable": {
+			s:   "${GRIZZLY_TEST_MISSING}",
+			err: "GRIZZLY_TEST_MISSING not set",
+		},
+		"default of missing variable": {
+			s:        "${GRIZZLY_TEST_MISSING:-http://localhost}",
+			expected: "http://localhost",
+		},
+		"default of empty variable": {
+			s:        "${GRIZZLY_TEST_EMPTY:-fallback}",
+			expected: "fallback",
+		},
+		"default of set variable": {
+			s:        "${GRIZZLY_TEST_URL:-http://localhost}",
+			expected: "http://prometheus:9090",
+		},
+		"required variable": {
+			s:   "${GRIZZLY_TEST_MISSING:?the Prometheus URL}",
+			err: "GRIZZLY_TEST_MISSING: the Prometheus URL",
+		},
+		"required empty variable without message": {
+			s:   "${GRIZZLY_TEST_EMPTY:?}",
+			err: "GRIZZLY_TEST_EMPTY: not set",
+		},
+		"several missing variables": {
+			s:   "${GRIZZLY_TEST_MISSING}/${GRIZZLY_TEST_EMPTY:?}",
+			err: "GRIZZLY_TEST_MISSING not set, GRIZZLY_TEST_EMPTY: not set",
+		},
+		"escaped reference": {
+			s:        "$${GRIZZLY_TEST_MISSING}",
+			expected: "${GRIZZLY_TEST_MISSING}",
+		},
+		"escaped and interpolated references": {
+			s:        "$${cluster} on ${GRIZZLY_TEST_URL}",
+			expected: "${cluster} on http://prometheus:9090",
+		},
+		"unbraced reference": {
+			s:        "rate($interval) $GRIZZLY_TEST_URL",
+			expected: "rate($interval) $GRIZZLY_TEST_URL",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		result, err := Interpolate(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error interpolating: %v", err)
+		} else if result != test.expected {
+			t.Errorf("Expected %q, got: %q", test.expected, result)
+		}
+	}
+}
+
+func TestInterpolateValue(t *testing.T) {
+	os.Setenv("GRIZZLY_TEST_URL", "http://prometheus:9090")
+	os.Unsetenv("GRIZZLY_TEST_MISSING")
+	defer os.Unsetenv("GRIZZLY_TEST_URL")
+
+	tests := map[string]struct {
+		value    interface{}
+		expected interface{}
+		err      string
+	}{
+		"nested values": {
+			value: map[string]interface{}{
+				"url":     "${GRIZZLY_TEST_URL}",
+				"version": 2.0,
+				"jsonData": map[string]interface{}{
+					"links": []interface{}{"${GRIZZLY_TEST_URL}/graph", true},
+				},
+			},
+			expected: map[string]interface{}{
+				"url":     "http://prometheus:9090",
+				"version": 2.0,
+				"jsonData": map[string]interface{}{
+					"links": []interface{}{"http://prometheus:9090/graph", true},
+				},
+			},
+		},
+		"missing variable in nested value": {
+			value: map[string]interface{}{
+				"jsonData": map[string]interface{}{
+					"links": []interface{}{"ok", "${GRIZZLY_TEST_MISSING}"},
+				},
+			},
+			err: "Error interpolating prometheus.json.jsonData.links[1]: GRIZZLY_TEST_MISSING not set",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		result, err := interpolateValue("prometheus.json", test.value)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error interpolating: %v", err)
+		} else if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected %v, got: %v", test.expected, result)
+		}
+	}
+}
@@ -1,6 +1,12 @@
 package grizzly
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
 	"github.com/google/go-jsonnet"
 )
 
@@ -75,3 +81,106 @@ func evalToString(script string) (string, error) {
 	result, err := vm.EvaluateSnippet("grafana-dash", script)
 	return result, err
 }
+
+// identifier matches the names Jsonnet allows for parameters
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// jsonnetfile marks the root of a project using jsonnet-bundler, whose
+// libraries are vendored in the vendor directory next to it
+const jsonnetfile = "jsonnetfile.json"
+
+// findProjectRoot returns the closest directory above a Jsonnet file holding
+// a jsonnetfile.json, if any
+func findProjectRoot(jsonnetFile string) (string, bool) {
+	dir, err := filepath.Abs(filepath.Dir(jsonnetFile))
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, jsonnetfile)); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// jsonnetPath returns the directories imports of a Jsonnet file are searched
+// in, the last first: those given, then the vendor and lib directories of its
+// project, then those of the working directory
+func jsonnetPath(jsonnetFile string, opts *JsonnetOpts) []string {
+	jpath := []string{"vendor", "lib", "."}
+	if root, ok := findProjectRoot(jsonnetFile); ok {
+		jpath = append(jpath, filepath.Join(root, "vendor"), filepath.Join(root, "lib"))
+	}
+	if opts != nil {
+		jpath = append(jpath, opts.JPath...)
+	}
+	return jpath
+}
+
+// makeVM returns a VM evaluating a Jsonnet file with native functions,
+// external variables and top-level arguments
+func makeVM(jsonnetFile string, opts *JsonnetOpts) *jsonnet.VM {
+	vm := jsonnet.MakeVM()
+	vm.Importer(newExtendedImporter(jsonnetPath(jsonnetFile, opts)))
+	for _, fn := range nativeFuncs() {
+		vm.NativeFunction(fn)
+	}
+	if opts == nil {
+		return vm
+	}
+	for key, value := range opts.ExtStr {
+		vm.ExtVar(key, value)
+	}
+	for key, value := range opts.ExtCode {
+		vm.ExtCode(key, value)
+	}
+	for key, value := range opts.TLAStr {
+		vm.TLAVar(key, value)
+	}
+	for key, value := range opts.TLACode {
+		vm.TLACode(key, value)
+	}
+	return vm
+}
+
+// tlaNames returns the names of the top-level arguments, sorted
+func (o *JsonnetOpts) tlaNames() ([]string, error) {
+	names := []string{}
+	if o == nil {
+		return names, nil
+	}
+	for _, m := range []map[string]string{o.TLAStr, o.TLACode} {
+		for name := range m {
+			if !identifier.MatchString(name) {
+				return nil, fmt.Errorf("Invalid top-level argument %q, expected an identifier", name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SetDefaults sets the variables and arguments not already set, e.g. from a
+// context, to those of defaults
+func (o *JsonnetOpts) SetDefaults(defaults JsonnetOpts) {
+	setDefaults := func(m *map[string]string, defaults map[string]string) {
+		for key, value := range defaults {
+			if *m == nil {
+				*m = map[string]string{}
+			}
+			if _, ok := (*m)[key]; !ok {
+				(*m)[key] = value
+			}
+		}
+	}
+	setDefaults(&o.ExtStr, defaults.ExtStr)
+	setDefaults(&o.ExtCode, defaults.ExtCode)
+	setDefaults(&o.TLAStr, defaults.TLAStr)
+	setDefaults(&o.TLACode, defaults.TLACode)
+}
@@ -0,0 +1,167 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tests := map[string]struct {
+		doc      string
+		patch    []PatchOperation
+		expected string
+		err      string
+	}{
+		"add a field": {
+			doc:      `{"title": "Overview"}`,
+			patch:    []PatchOperation{{Op: "add", Path: "/editable", Value: false}},
+			expected: `{"title": "Overview", "editable": false}`,
+		},
+		"add to an array": {
+			doc:      `{"tags": ["a", "c"]}`,
+			patch:    []PatchOperation{{Op: "add", Path: "/tags/1", Value: "b"}},
+			expected: `{"tags": ["a", "b", "c"]}`,
+		},
+		"append to an array": {
+			doc:      `{"tags": ["a"]}`,
+			patch:    []PatchOperation{{Op: "add", Path: "/tags/-", Value: "b"}},
+			expected: `{"tags": ["a", "b"]}`,
+		},
+		"add a nested field": {
+			doc:      `{"panels": [{"title": "Rate"}]}`,
+			patch:    []PatchOperation{{Op: "add", Path: "/panels/0/datasource", Value: map[string]interface{}{"uid": "prom"}}},
+			expected: `{"panels": [{"title": "Rate", "datasource": {"uid": "prom"}}]}`,
+		},
+		"replace a field": {
+			doc:      `{"title": "Overview", "refresh": "5s"}`,
+			patch:    []PatchOperation{{Op: "replace", Path: "/refresh", Value: "1m"}},
+			expected: `{"title": "Overview", "refresh": "1m"}`,
+		},
+		"replace an array element": {
+			doc:      `{"tags": ["a", "b"]}`,
+			patch:    []PatchOperation{{Op: "replace", Path: "/tags/0", Value: 1}},
+			expected: `{"tags": [1, "b"]}`,
+		},
+		"replace the whole document": {
+			doc:      `{"title": "Overview"}`,
+			patch:    []PatchOperation{{Op: "replace", Path: "", Value: map[string]interface{}{"title": "API"}}},
+			expected: `{"title": "API"}`,
+		},
+		"remove a field": {
+			doc:      `{"title": "Overview", "id": 12}`,
+			patch:    []PatchOperation{{Op: "remove", Path: "/id"}},
+			expected: `{"title": "Overview"}`,
+		},
+		"remove an array element": {
+			doc:      `{"tags": ["a", "b", "c"]}`,
+			patch:    []PatchOperation{{Op: "remove", Path: "/tags/1"}},
+			expected: `{"tags": ["a", "c"]}`,
+		},
+		"move a field": {
+			doc:      `{"old": 1}`,
+			patch:    []PatchOperation{{Op: "move", From: "/old", Path: "/new"}},
+			expected: `{"new": 1}`,
+		},
+		"copy a field": {
+			doc:      `{"a": {"b": 1}}`,
+			patch:    []PatchOperation{{Op: "copy", From: "/a", Path: "/c"}},
+			expected: `{"a": {"b": 1}, "c": {"b": 1}}`,
+		},
+		"test a value": {
+			doc:      `{"version": 2}`,
+			patch:    []PatchOperation{{Op: "test", Path: "/version", Value: 2}, {Op: "replace", Path: "/version", Value: 3}},
+			expected: `{"version": 3}`,
+		},
+		"escaped slash": {
+			doc:      `{"labels": {"app.kubernetes.io/name": "grafana"}}`,
+			patch:    []PatchOperation{{Op: "replace", Path: "/labels/app.kubernetes.io~1name", Value: "loki"}},
+			expected: `{"labels": {"app.kubernetes.io/name": "loki"}}`,
+		},
+		"escaped tilde": {
+			doc:      `{"a~b": 1}`,
+			patch:    []PatchOperation{{Op: "remove", Path: "/a~0b"}},
+			expected: `{}`,
+		},
+		"escaped tilde before 1": {
+			doc:      `{"~1": 1, "/": 2}`,
+			patch:    []PatchOperation{{Op: "remove", Path: "/~01"}},
+			expected: `{"/": 2}`,
+		},
+		"replace a missing field": {
+			doc:   `{"title": "Overview"}`,
+			patch: []PatchOperation{{Op: "replace", Path: "/refresh", Value: "1m"}},
+			err:   "Patch operation 0 (replace /refresh): refresh not found",
+		},
+		"remove a missing field": {
+			doc:   `{"title": "Overview"}`,
+			patch: []PatchOperation{{Op: "add", Path: "/id", Value: 1}, {Op: "remove", Path: "/uid"}},
+			err:   "Patch operation 1 (remove /uid): uid not found",
+		},
+		"remove the whole document": {
+			doc:   `{"title": "Overview"}`,
+			patch: []PatchOperation{{Op: "remove", Path: ""}},
+			err:   "Patch operation 0 (remove ): cannot remove the whole document",
+		},
+		"add to a missing parent": {
+			doc:   `{}`,
+			patch: []PatchOperation{{Op: "add", Path: "/a/b", Value: 1}},
+			err:   "Patch operation 0 (add /a/b): a not found",
+		},
+		"add to a scalar": {
+			doc:   `{"a": 1}`,
+			patch: []PatchOperation{{Op: "add", Path: "/a/b", Value: 1}},
+			err:   "Patch operation 0 (add /a/b): cannot add b, its parent is not an object or array",
+		},
+		"array index out of range": {
+			doc:   `{"tags": ["a"]}`,
+			patch: []PatchOperation{{Op: "add", Path: "/tags/2", Value: "b"}},
+			err:   "Patch operation 0 (add /tags/2): invalid array index 2",
+		},
+		"array index with leading zero": {
+			doc:   `{"tags": ["a", "b"]}`,
+			patch: []PatchOperation{{Op: "remove", Path: "/tags/01"}},
+			err:   "Patch operation 0 (remove /tags/01): invalid array index 01",
+		},
+		"path not a pointer": {
+			doc:   `{"title": "Overview"}`,
+			patch: []PatchOperation{{Op: "remove", Path: "title"}},
+			err:   `Patch operation 0 (remove title): invalid path "title", expected a JSON pointer starting with /`,
+		},
+		"failed test": {
+			doc:   `{"version": 2}`,
+			patch: []PatchOperation{{Op: "test", Path: "/version", Value: 1}},
+			err:   "Patch operation 0 (test /version): test failed, value is 2",
+		},
+		"unknown operation": {
+			doc:   `{}`,
+			patch: []PatchOperation{{Op: "merge", Path: "/a"}},
+			err:   "Patch operation 0 (merge /a): unknown operation, expected add, remove, replace, move, copy or test",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		var doc interface{}
+		if err := json.Unmarshal([]byte(test.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		patched, err := applyPatch(doc, test.patch)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error patching: %v", err)
+			continue
+		}
+		var expected interface{}
+		if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(patched, expected) {
+			t.Errorf("Expected %v, got: %v", expected, patched)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package grizzly
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+/*
+ * Labels let several teams share one Jsonnet tree, while each acts only on
+ * their own resources. Resources carry labels in a grizzlyLabels field, e.g.
+ * `grizzlyLabels: { team: 'payments' }`, which is removed before the resource
+ * is sent anywhere. Selectors, e.g. `team=payments,tier!=critical`, then pick
+ * the resources that commands act on.
+ */
+
+// LabelsField is the field of a resource holding its labels
+const LabelsField = "grizzlyLabels"
+
+// withLabels moves the labels of a resource represented as a JSON object from
+// its detail to the resource
+func withLabels(resource Resource) (Resource, error) {
+	if !isObject(resource.Detail) {
+		return resource, nil
+	}
+	detail := reflect.ValueOf(resource.Detail)
+	field := reflect.ValueOf(LabelsField)
+	if detail.Type().Key().Kind() != reflect.String {
+		return resource, nil
+	}
+	value := detail.MapIndex(field.Convert(detail.Type().Key()))
+	if !value.IsValid() {
+		return resource, nil
+	}
+	labels, ok := value.Interface().(map[string]interface{})
+	if !ok {
+		return resource, fmt.Errorf("%s %s must be an object", resource.Key(), LabelsField)
+	}
+	resource.Labels = map[string]string{}
+	for k, v := range labels {
+		s, ok := v.(string)
+		if !ok {
+			return resource, fmt.Errorf("%s label %s must be a string", resource.Key(), k)
+		}
+		resource.Labels[k] = s
+	}
+	detail.SetMapIndex(field.Convert(detail.Type().Key()), reflect.Value{})
+	return resource, nil
+}
+
+// selectorRequirement is a single label requirement of a selector
+type selectorRequirement struct {
+	key    string
+	value  string
+	equals bool
+}
+
+// Selector selects resources by their labels
+type Selector []selectorRequirement
+
+// ParseSelector parses a comma separated list of label requirements, each of
+// the form key=value or key!=value
+func ParseSelector(s string) (Selector, error) {
+	selector := Selector{}
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		requirement := selectorRequirement{equals: true}
+		kv := strings.SplitN(part, "!=", 2)
+		if len(kv) == 2 {
+			requirement.equals = false
+		} else {
+			kv = strings.SplitN(part, "=", 2)
+		}
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Invalid selector %q, expected key=value or key!=value", part)
+		}
+		requirement.key = strings.TrimSpace(kv[0])
+		requirement.value = strings.TrimSpace(kv[1])
+		selector = append(selector, requirement)
+	}
+	return selector, nil
+}
+
+// Matches identifies whether a resource has labels satisfying every
+// requirement of the selector
+func (s Selector) Matches(resource Resource) bool {
+	for _, requirement := range s {
+		if (resource.Labels[requirement.key] == requirement.value) != requirement.equals {
+			return false
+		}
+	}
+	return true
+}
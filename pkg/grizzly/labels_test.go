@@ -0,0 +1,146 @@
+package grizzly
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := map[string]struct {
+		selector string
+		expected Selector
+		err      bool
+	}{
+		"empty": {
+			selector: " ",
+			expected: Selector{},
+		},
+		"equals": {
+			selector: "team=payments",
+			expected: Selector{{key: "team", value: "payments", equals: true}},
+		},
+		"not equals": {
+			selector: "tier!=critical",
+			expected: Selector{{key: "tier", value: "critical", equals: false}},
+		},
+		"several requirements with spaces": {
+			selector: "team = payments, tier!=critical",
+			expected: Selector{
+				{key: "team", value: "payments", equals: true},
+				{key: "tier", value: "critical", equals: false},
+			},
+		},
+		"empty value": {
+			selector: "team=",
+			expected: Selector{{key: "team", value: "", equals: true}},
+		},
+		"value holding =": {
+			selector: "query=a=b",
+			expected: Selector{{key: "query", value: "a=b", equals: true}},
+		},
+		"no operator": {
+			selector: "team",
+			err:      true,
+		},
+		"no key": {
+			selector: "=payments",
+			err:      true,
+		},
+		"empty requirement": {
+			selector: "team=payments,",
+			err:      true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		selector, err := ParseSelector(test.selector)
+		if err != nil && !test.err {
+			t.Errorf("Unexpected error parsing selector: %v", err)
+		}
+		if err == nil && test.err {
+			t.Errorf("Expected error parsing selector %q", test.selector)
+		}
+		if !test.err && !reflect.DeepEqual(selector, test.expected) {
+			t.Errorf("Expected %v, got: %v", test.expected, selector)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	tests := map[string]struct {
+		selector string
+		labels   map[string]string
+		matches  bool
+	}{
+		"empty selector":             {"", nil, true},
+		"matching label":             {"team=payments", map[string]string{"team": "payments"}, true},
+		"other value":                {"team=payments", map[string]string{"team": "search"}, false},
+		"missing label":              {"team=payments", nil, false},
+		"missing label, not equals":  {"tier!=critical", nil, true},
+		"excluded value":             {"tier!=critical", map[string]string{"tier": "critical"}, false},
+		"every requirement met":      {"team=payments,tier!=critical", map[string]string{"team": "payments", "tier": "low"}, true},
+		"one requirement not met":    {"team=payments,tier!=critical", map[string]string{"team": "payments", "tier": "critical"}, false},
+		"empty value, missing label": {"team=", nil, true},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		selector, err := ParseSelector(test.selector)
+		if err != nil {
+			t.Fatalf("Unexpected error parsing selector: %v", err)
+		}
+		if matches := selector.Matches(Resource{Labels: test.labels}); matches != test.matches {
+			t.Errorf("Expected %q to match %v: %v, got: %v", test.selector, test.labels, test.matches, matches)
+		}
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	tests := map[string]struct {
+		detail   interface{}
+		labels   map[string]string
+		expected interface{}
+		err      string
+	}{
+		"labels moved": {
+			detail:   map[string]interface{}{"title": "Overview", LabelsField: map[string]interface{}{"team": "payments"}},
+			labels:   map[string]string{"team": "payments"},
+			expected: map[string]interface{}{"title": "Overview"},
+		},
+		"no labels": {
+			detail:   map[string]interface{}{"title": "Overview"},
+			expected: map[string]interface{}{"title": "Overview"},
+		},
+		"not an object": {
+			detail:   "General",
+			expected: "General",
+		},
+		"labels not an object": {
+			detail: map[string]interface{}{LabelsField: "payments"},
+			err:    "test/overview grizzlyLabels must be an object",
+		},
+		"label not a string": {
+			detail: map[string]interface{}{LabelsField: map[string]interface{}{"tier": 1.0}},
+			err:    "test/overview label tier must be a string",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		resource, err := withLabels(Resource{UID: "overview", Handler: stateTestHandler{}, Detail: test.detail})
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error reading labels: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(resource.Labels, test.labels) {
+			t.Errorf("Expected labels %v, got: %v", test.labels, resource.Labels)
+		}
+		if !reflect.DeepEqual(resource.Detail, test.expected) {
+			t.Errorf("Expected %v, got: %v", test.expected, resource.Detail)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogLevel is the severity of a log message
+type LogLevel int
+
+// Log levels, from the most verbose
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the name of a log level
+func (l LogLevel) String() string {
+	if l < LogDebug || l > LogError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// Set sets a log level by name, so that it can be used as a flag
+func (l *LogLevel) Set(name string) error {
+	for i, n := range logLevelNames {
+		if strings.EqualFold(name, n) {
+			*l = LogLevel(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown log level %q, expected one of %s", name, strings.Join(logLevelNames, ", "))
+}
+
+// Type names the type of a log level flag
+func (l *LogLevel) Type() string {
+	return "level"
+}
+
+// Logger writes log messages at or above a level to stderr, as text or JSON
+type Logger struct {
+	Level LogLevel
+	// JSON writes each message as a JSON object, for log collectors
+	JSON bool
+
+	// Out, if set, receives messages rather than stderr
+	Out io.Writer
+}
+
+// defaultLogger is used by Notifiers without a Logger
+var defaultLogger = &Logger{Level: LogInfo}
+
+func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
+	if level < l.Level {
+		return
+	}
+	out := l.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.JSON {
+		data, err := json.Marshal(struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+			Msg   string    `json:"msg"`
+		}{time.Now().UTC(), level.String(), msg})
+		if err == nil {
+			fmt.Fprintln(out, string(data))
+			return
+		}
+	}
+	switch level {
+	case LogInfo:
+		fmt.Fprintln(out, msg)
+	case LogWarn:
+		fmt.Fprintln(out, "Warning: "+msg)
+	default:
+		fmt.Fprintf(out, "%s: %s\n", strings.Title(level.String()), msg)
+	}
+}
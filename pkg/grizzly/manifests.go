@@ -0,0 +1,105 @@
+package grizzly
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * Rather than Jsonnet, resources can be read from plain YAML or JSON files,
+ * e.g. dashboards exported from Grafana. A file, or each document of a YAML
+ * file, holds either:
+ *
+ *   - resources at the paths of handlers, as Jsonnet outputs them
+ *   - envelopes, alone or in lists (see envelope.go)
+ *   - a single resource recognised by its handler, e.g. a dashboard, named
+ *     after the file
+ */
+
+// isManifestFile identifies plain YAML and JSON files, by their extension
+func isManifestFile(file string) bool {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readManifests reads the documents of a YAML or JSON file
+func readManifests(file string) ([]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := parseYAMLDocuments(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", file, err)
+	}
+	return documents, nil
+}
+
+// detectHandler returns the handler recognising a document as one of its
+// resources, if it holds nothing else a handler would parse
+func detectHandler(registry Registry, document map[string]interface{}) Handler {
+	if isEnvelope(document) {
+		return nil
+	}
+	for k := range document {
+		if _, err := registry.GetHandler(k); err == nil {
+			return nil
+		}
+	}
+	for _, handler := range registry.Handlers {
+		if !registry.Enabled(handler) {
+			continue
+		}
+		if detector, ok := handler.(DetectHandler); ok && detector.Detect(document) {
+			return handler
+		}
+	}
+	return nil
+}
+
+// ParseFiles parses several Jsonnet, YAML or JSON files, which may be given
+// as glob patterns, e.g. dashboards/*.json
+func ParseFiles(config Config, files []string, opts *ParseOpts) (Resources, error) {
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		matches, err := filepath.Glob(file)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid file pattern %q: %v", file, err)
+		}
+		if len(matches) == 0 {
+			// left for parsing to report the file as missing
+			matches = []string{file}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				paths = append(paths, match)
+				seen[match] = true
+			}
+		}
+	}
+
+	resources := Resources{}
+	for _, file := range paths {
+		parsed, err := Parse(config, file, opts)
+		if err != nil {
+			return nil, err
+		}
+		for handler, resourceList := range parsed {
+			if _, ok := resources[handler]; !ok {
+				resources[handler] = ResourceList{}
+			}
+			for _, resource := range resourceList {
+				if err := resources[handler].Add(resource); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return resources, nil
+}
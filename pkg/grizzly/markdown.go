@@ -0,0 +1,102 @@
+package grizzly
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+ * Diffs can be rendered as Markdown, for CI to post as a comment on a pull
+ * request: a summary table of the resources that would change comes first,
+ * followed by the diff of each in a collapsible section, so that large diffs
+ * don't drown the conversation.
+ */
+
+// Diff formats
+const (
+	DiffFormatText     = "text"
+	DiffFormatMarkdown = "markdown"
+)
+
+// checkDiffFormat checks a diff format is supported
+func checkDiffFormat(format string) error {
+	if format != "" && format != DiffFormatText && format != DiffFormatMarkdown {
+		return fmt.Errorf("Unknown diff format %q, expected %s or %s", format, DiffFormatText, DiffFormatMarkdown)
+	}
+	return nil
+}
+
+// markdownStatuses describes the status of events in the summary, in the
+// order they are listed
+var markdownStatuses = []struct {
+	status string
+	label  string
+}{
+	{"changed", "changed"},
+	{"not-found", "new"},
+	{"not-supported", "not supported"},
+}
+
+// writeMarkdownDiff renders the events recorded while diffing as Markdown
+func writeMarkdownDiff(out io.Writer, events []ResourceEvent) error {
+	counts := map[string]int{}
+	for _, event := range events {
+		counts[event.Status]++
+	}
+	sorted := append([]ResourceEvent{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Resource < sorted[j].Resource
+	})
+
+	var buf strings.Builder
+	buf.WriteString("### grizzly diff\n\n")
+	summary := []string{}
+	for _, s := range markdownStatuses {
+		if counts[s.status] > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", counts[s.status], s.label))
+		}
+	}
+	summary = append(summary, fmt.Sprintf("%d unchanged", counts["unchanged"]))
+	buf.WriteString("**" + strings.Join(summary, ", ") + "**\n\n")
+
+	if counts["unchanged"] < len(events) {
+		buf.WriteString("| Resource | Status |\n| --- | --- |\n")
+		for _, s := range markdownStatuses {
+			for _, event := range sorted {
+				if event.Status == s.status {
+					fmt.Fprintf(&buf, "| `%s` | %s |\n", event.Resource, s.label)
+				}
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	for _, event := range sorted {
+		if event.Diff == "" {
+			continue
+		}
+		fence := markdownFence(event.Diff)
+		fmt.Fprintf(&buf, "<details>\n<summary><code>%s</code></summary>\n\n", event.Resource)
+		fmt.Fprintf(&buf, "%sdiff\n%s\n%s\n\n</details>\n\n", fence, strings.TrimSuffix(event.Diff, "\n"), fence)
+	}
+	_, err := io.WriteString(out, strings.TrimSuffix(buf.String(), "\n"))
+	return err
+}
+
+// backticks matches runs of backticks
+var backticks = regexp.MustCompile("`+")
+
+// markdownFence returns a code fence longer than any run of backticks within
+// the code it fences
+func markdownFence(code string) string {
+	longest := 2
+	for _, run := range backticks.FindAllString(code, -1) {
+		if len(run) > longest {
+			longest = len(run)
+		}
+	}
+	return strings.Repeat("`", longest+1)
+}
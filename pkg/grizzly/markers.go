@@ -0,0 +1,44 @@
+package grizzly
+
+/*
+ * Markers record on remote resources themselves that grizzly manages them, and
+ * from which file, e.g. as a dashboard tag or a datasource jsonData field. With
+ * --mark:
+ *
+ *   - resources are marked as they are pushed
+ *   - existing resources that are not marked are not overwritten, unless
+ *     adopted with --adopt, so that another team's dashboard sharing a UID is
+ *     not taken over by accident
+ *   - only marked resources are pruned
+ *
+ * Handlers strip markers as they unprepare resources, so that they never show
+ * in diffs.
+ */
+
+// MarkHandler describes a handler that can mark remote resources as managed by
+// grizzly
+type MarkHandler interface {
+	// Mark returns a resource about to be pushed, marked as managed by
+	// grizzly, from the given source file. The resource may be modified.
+	Mark(resource Resource, source string) Resource
+	// Marked reports whether a remote resource is marked as managed by grizzly
+	Marked(resource Resource) bool
+}
+
+// markResource marks a resource about to be pushed, if requested and
+// supported
+func markResource(handler Handler, resource Resource, opts *ApplyOpts) Resource {
+	markHandler, ok := handler.(MarkHandler)
+	if opts == nil || !opts.Mark || !ok {
+		return resource
+	}
+	resource.Detail = deepCopy(resource.Detail)
+	return markHandler.Mark(resource, resource.Source)
+}
+
+// isMarked reports whether a remote resource is marked as managed by grizzly.
+// Resources of handlers that cannot be marked always are.
+func isMarked(handler Handler, resource Resource) bool {
+	markHandler, ok := handler.(MarkHandler)
+	return !ok || markHandler.Marked(resource)
+}
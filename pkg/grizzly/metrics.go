@@ -0,0 +1,181 @@
+package grizzly
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+ * Self-metrics let grizzly be monitored when it runs for good, with
+ * `grr reconcile`, `grr server` or `grr watch --metrics-address`. Besides the
+ * metrics of each mode, all of them serve, in the Prometheus text format:
+ *
+ *   - grizzly_applies_total and grizzly_apply_failures_total
+ *   - grizzly_applied_resources_total, by kind and outcome, e.g. updated
+ *   - grizzly_api_requests_total, by host, method and status code
+ *   - grizzly_api_request_duration_seconds, a histogram by host and method
+ */
+
+// requestDurationBuckets are the upper bounds of the request duration
+// histogram, in seconds
+var requestDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// selfMetrics holds the metrics of this process
+var selfMetrics = &processMetrics{
+	resources: map[string]int{},
+	requests:  map[string]int{},
+	durations: map[string]*histogram{},
+}
+
+// processMetrics counts applies and requests. Series are keyed by their
+// labels, as written.
+type processMetrics struct {
+	mu            sync.Mutex
+	applies       int
+	applyFailures int
+	// resources counts resources applied by kind and outcome
+	resources map[string]int
+	// requests counts requests by host, method and status code
+	requests map[string]int
+	// durations are those of requests by host and method
+	durations map[string]*histogram
+}
+
+// histogram counts observations within requestDurationBuckets
+type histogram struct {
+	buckets []int
+	count   int
+	sum     float64
+}
+
+// recordApply counts an apply and the outcomes of its resources
+func (m *processMetrics) recordApply(summary ApplySummary, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applies++
+	if err != nil {
+		m.applyFailures++
+	}
+	for _, kind := range summary {
+		outcomes := map[string]int{
+			"added":     kind.Added,
+			"updated":   kind.Updated,
+			"unchanged": kind.Unchanged,
+			"deleted":   kind.Deleted,
+			"failed":    kind.Failed,
+		}
+		for outcome, n := range outcomes {
+			if n > 0 {
+				m.resources[fmt.Sprintf("kind=%q,outcome=%q", kind.Kind, outcome)] += n
+			}
+		}
+	}
+}
+
+// recordRequest counts a request, by its status code or error
+func (m *processMetrics) recordRequest(host, method, code string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[fmt.Sprintf("host=%q,method=%q,code=%q", host, method, code)]++
+	labels := fmt.Sprintf("host=%q,method=%q", host, method)
+	h, ok := m.durations[labels]
+	if !ok {
+		h = &histogram{buckets: make([]int, len(requestDurationBuckets))}
+		m.durations[labels] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range requestDurationBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// write writes the metrics in the Prometheus text format
+func (m *processMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeMetric(w, "grizzly_applies_total", "counter", "Applies run.", m.applies)
+	writeMetric(w, "grizzly_apply_failures_total", "counter", "Applies that failed.", m.applyFailures)
+	writeSeries(w, "grizzly_applied_resources_total", "counter", "Resources applied, by kind and outcome.", m.resources)
+	writeSeries(w, "grizzly_api_requests_total", "counter", "Requests sent to endpoints, by host, method and status code.", m.requests)
+
+	name := "grizzly_api_request_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s How long endpoints took to respond, by host and method.\n# TYPE %s histogram\n", name, name)
+	labelSets := []string{}
+	for labels := range m.durations {
+		labelSets = append(labelSets, labels)
+	}
+	sort.Strings(labelSets)
+	for _, labels := range labelSets {
+		h := m.durations[labels]
+		for i, bound := range requestDurationBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%v\"} %d\n", name, labels, bound, h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %v\n", name, labels, h.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+// writeSeries writes a metric with a series by set of labels
+func writeSeries(w io.Writer, name, kind, help string, series map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	labelSets := []string{}
+	for labels := range series {
+		labelSets = append(labelSets, labels)
+	}
+	sort.Strings(labelSets)
+	for _, labels := range labelSets {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels, series[labels])
+	}
+}
+
+// metricsTransport counts the requests it sends, and how long they take,
+// each attempt of requests retried apart
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	selfMetrics.recordRequest(req.URL.Host, req.Method, code, time.Since(start))
+	return resp, err
+}
+
+// serveMetrics serves the self-metrics, and those written by extra if any,
+// on /metrics at an address
+func serveMetrics(config Config, address string, extra func(w io.Writer)) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if extra != nil {
+			extra(w)
+		}
+		selfMetrics.write(w)
+	})
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			config.Notifier.Logf(LogError, "%v", err)
+		}
+	}()
+	config.Notifier.Logf(LogInfo, "Serving metrics at http://%s/metrics", listener.Addr())
+	return nil
+}
@@ -0,0 +1,151 @@
+package grizzly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Native functions extend the Jsonnet standard library with what mixins, e.g.
+ * kube-prometheus style libraries, expect of Tanka, under the same names and
+ * signatures. They are called as std.native('parseYaml')(str).
+ */
+
+// nativeFuncs returns the native functions registered in the Jsonnet VM
+func nativeFuncs() []*jsonnet.NativeFunction {
+	return []*jsonnet.NativeFunction{
+		// parseJson parses a JSON string
+		stringFunc("parseJson", ast.Identifiers{"json"}, func(args []string) (interface{}, error) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(args[0]), &v); err != nil {
+				return nil, fmt.Errorf("Error parsing JSON: %v", err)
+			}
+			return v, nil
+		}),
+		// parseYaml parses a YAML string into an array of its documents
+		stringFunc("parseYaml", ast.Identifiers{"yaml"}, func(args []string) (interface{}, error) {
+			documents, err := parseYAMLDocuments(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing YAML: %v", err)
+			}
+			return documents, nil
+		}),
+		// manifestJsonFromJson reindents a JSON string
+		{
+			Name:   "manifestJsonFromJson",
+			Params: ast.Identifiers{"json", "indent"},
+			Func: func(args []interface{}) (interface{}, error) {
+				j, ok := args[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("manifestJsonFromJson expects a string, got %T", args[0])
+				}
+				n, ok := args[1].(float64)
+				if !ok {
+					return nil, fmt.Errorf("manifestJsonFromJson expects a number of spaces to indent with, got %T", args[1])
+				}
+				var buf bytes.Buffer
+				if err := json.Indent(&buf, []byte(j), "", strings.Repeat(" ", int(n))); err != nil {
+					return nil, fmt.Errorf("Error parsing JSON: %v", err)
+				}
+				return buf.String() + "\n", nil
+			},
+		},
+		// manifestYamlFromJson converts a JSON string to YAML
+		stringFunc("manifestYamlFromJson", ast.Identifiers{"json"}, func(args []string) (interface{}, error) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(args[0]), &v); err != nil {
+				return nil, fmt.Errorf("Error parsing JSON: %v", err)
+			}
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(v); err != nil {
+				return nil, err
+			}
+			return buf.String(), nil
+		}),
+		// escapeStringRegex escapes the metacharacters of a string
+		stringFunc("escapeStringRegex", ast.Identifiers{"str"}, func(args []string) (interface{}, error) {
+			return regexp.QuoteMeta(args[0]), nil
+		}),
+		// regexMatch reports whether a string contains a match of a regular
+		// expression
+		stringFunc("regexMatch", ast.Identifiers{"regex", "string"}, func(args []string) (interface{}, error) {
+			re, err := regexp.Compile(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return re.MatchString(args[1]), nil
+		}),
+		// regexSubst replaces the matches of a regular expression, with $1 and
+		// so on referring to its groups
+		stringFunc("regexSubst", ast.Identifiers{"regex", "src", "repl"}, func(args []string) (interface{}, error) {
+			re, err := regexp.Compile(args[0])
+			if err != nil {
+				return nil, err
+			}
+			return re.ReplaceAllString(args[1], args[2]), nil
+		}),
+		// sha256 returns the hex encoded SHA-256 hash of a string
+		stringFunc("sha256", ast.Identifiers{"str"}, func(args []string) (interface{}, error) {
+			return fmt.Sprintf("%x", sha256.Sum256([]byte(args[0]))), nil
+		}),
+	}
+}
+
+// stringFunc returns a native function whose arguments must all be strings
+func stringFunc(name string, params ast.Identifiers, fn func(args []string) (interface{}, error)) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   name,
+		Params: params,
+		Func: func(args []interface{}) (interface{}, error) {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				str, ok := arg.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s expects a string for %s, got %T", name, params[i], arg)
+				}
+				strs[i] = str
+			}
+			return fn(strs)
+		},
+	}
+}
+
+// parseYAMLDocuments parses the documents of a YAML string, skipping empty
+// ones, into values as Jsonnet represents them, e.g. with numbers as float64
+func parseYAMLDocuments(s string) ([]interface{}, error) {
+	documents := []interface{}{}
+	decoder := yaml.NewDecoder(strings.NewReader(s))
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if document == nil {
+			continue
+		}
+		j, err := json.Marshal(document)
+		if err != nil {
+			return nil, err
+		}
+		document = nil
+		if err := json.Unmarshal(j, &document); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
@@ -0,0 +1,142 @@
+package grizzly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+/*
+ * Notifications post a summary of each apply to Slack or a generic webhook, so
+ * that teams sharing a Grafana instance know what changed and who changed it.
+ * Slack incoming webhooks, at hooks.slack.com, receive a message; any other
+ * URL receives the summary as JSON:
+ *
+ *   {"time": ..., "user": ..., "commit": ..., "changes": [...],
+ *    "summary": [{"kind": ..., "added": ..., ...}], "error": ...}
+ *
+ * Depending on ApplyOpts.NotifyOn, every apply is notified, or only those that
+ * changed anything, or only those that failed.
+ */
+
+// When to notify, for ApplyOpts
+const (
+	NotifyAlways   = "always"
+	NotifyChanges  = "changes"
+	NotifyFailures = "failures"
+)
+
+// notifyTimeout bounds posting a notification, so that an unresponsive
+// webhook does not hold an apply up
+const notifyTimeout = 10 * time.Second
+
+// ApplyNotification summarises an apply, as posted to webhooks
+type ApplyNotification struct {
+	AuditRecord
+	Summary []KindSummary `json:"summary"`
+}
+
+// shouldNotify reports whether an apply is to be notified
+func shouldNotify(on string, record AuditRecord) bool {
+	switch on {
+	case NotifyFailures:
+		return record.Error != ""
+	case NotifyChanges:
+		return record.Error != "" || len(record.Changes) > 0
+	default:
+		return true
+	}
+}
+
+// notify posts the summary of an apply to each webhook
+func notify(webhooks []string, on string, record AuditRecord, summary ApplySummary) error {
+	if !shouldNotify(on, record) {
+		return nil
+	}
+	notification := ApplyNotification{AuditRecord: record, Summary: summary.kinds()}
+	for _, webhook := range webhooks {
+		var payload interface{} = notification
+		if isSlackWebhook(webhook) {
+			payload = map[string]string{"text": slackMessage(notification)}
+		}
+		if err := postNotification(webhook, payload); err != nil {
+			return fmt.Errorf("Error notifying %s: %v", redactWebhook(webhook), err)
+		}
+	}
+	return nil
+}
+
+// isSlackWebhook reports whether a webhook is a Slack incoming webhook
+func isSlackWebhook(webhook string) bool {
+	u, err := url.Parse(webhook)
+	return err == nil && u.Host == "hooks.slack.com"
+}
+
+// redactWebhook strips the path of a webhook from errors, as it holds the
+// secret of Slack webhooks
+func redactWebhook(webhook string) string {
+	u, err := url.Parse(webhook)
+	if err != nil || u.Host == "" {
+		return "webhook"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// slackMessage formats the summary of an apply as a Slack message
+func slackMessage(n ApplyNotification) string {
+	var b strings.Builder
+	outcome := "applied"
+	if n.Error != "" {
+		outcome = "failed to apply"
+	}
+	fmt.Fprintf(&b, "*%s* %s", n.User, outcome)
+	if n.Host != "" {
+		fmt.Fprintf(&b, " from %s", n.Host)
+	}
+	if n.Commit != "" {
+		fmt.Fprintf(&b, " at commit `%s`", n.Commit)
+	}
+	b.WriteString("\n")
+	for _, kind := range n.Summary {
+		fmt.Fprintf(&b, "• %s: %d added, %d updated, %d unchanged, %d deleted", kind.Kind, kind.Added, kind.Updated, kind.Unchanged, kind.Deleted)
+		if kind.Failed > 0 {
+			fmt.Fprintf(&b, ", %d failed", kind.Failed)
+		}
+		b.WriteString("\n")
+	}
+	for _, change := range n.Changes {
+		fmt.Fprintf(&b, "%s `%s`\n", change.Action, change.Resource)
+	}
+	if n.Error != "" {
+		fmt.Fprintf(&b, "```%s```\n", n.Error)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// postNotification posts a JSON payload to a webhook
+func postNotification(webhook string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		if uErr, ok := err.(*url.Error); ok {
+			// the URL is redacted by the caller
+			err = uErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -2,6 +2,11 @@ package grizzly
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -10,65 +15,271 @@ var (
 	red    = color.New(color.FgRed).SprintFunc()
 	yellow = color.New(color.FgYellow).SprintFunc()
 	green  = color.New(color.FgGreen).SprintFunc()
+	cyan   = color.New(color.FgCyan).SprintFunc()
 )
 
 // Notifier provides Handlers terminal agnostic mechanisms to announce results of actions
-type Notifier struct{}
+type Notifier struct {
+	// Logger receives log messages, logged at info level to stderr if unset
+	Logger *Logger
+
+	// changes, if set, counts resources announced as changed or not found
+	changes *int
+	// previews, if set, records the links to resources announced as previewed
+	previews *[]PreviewLink
+	// out, if set, receives announcements rather than stdout
+	out io.Writer
+	// summary, if set, counts resources announced as applied, by kind
+	summary ApplySummary
+	// failures, if set, records the resources that failed to apply, to be
+	// reported once the apply is over
+	failures *[]ApplyFailure
+	// events, if set, records announcements rather than printing them
+	events *[]ResourceEvent
+	// audit, if set, records the resources announced as applied, for the
+	// audit log
+	audit auditChanges
+	// mu, if set, serialises announcements made concurrently
+	mu *sync.Mutex
+}
+
+// lock serialises an announcement, returning the function that ends it
+func (n *Notifier) lock() func() {
+	if n.mu == nil {
+		return func() {}
+	}
+	n.mu.Lock()
+	return n.mu.Unlock
+}
+
+// record records an announcement for machine-readable output, reporting
+// whether it was recorded
+func (n *Notifier) record(resource *Resource, status, msg, diff string) bool {
+	if n.events == nil {
+		return false
+	}
+	event := ResourceEvent{Status: status, Message: msg, Diff: diff}
+	if resource != nil {
+		event.Resource = resource.Key()
+	}
+	*n.events = append(*n.events, event)
+	return true
+}
+
+func (n *Notifier) output() io.Writer {
+	if n.out != nil {
+		return n.out
+	}
+	return os.Stdout
+}
+
+// PreviewLink identifies a preview of a resource
+type PreviewLink struct {
+	Resource  string     `json:"resource" yaml:"resource"`
+	URL       string     `json:"url" yaml:"url"`
+	DeleteURL string     `json:"deleteUrl,omitempty" yaml:"deleteUrl,omitempty"`
+	Expires   *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+	// Image is the file a rendered image of the preview was saved to, if any
+	Image string `json:"image,omitempty" yaml:"image,omitempty"`
+}
+
+// Logf logs a message about the progress of an action, rather than its results
+func (n *Notifier) Logf(level LogLevel, format string, args ...interface{}) {
+	logger := n.Logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	logger.logf(level, format, args...)
+}
+
+func (n *Notifier) countChange() {
+	if n.changes != nil {
+		*n.changes++
+	}
+}
 
 // NoChanges announces that nothing has changed
 func (n *Notifier) NoChanges(resource Resource) {
-	fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, yellow("no differences"))
+	defer n.lock()()
+	if n.summary != nil {
+		n.summary.kind(resource.Kind()).Unchanged++
+	}
+	if n.record(&resource, "unchanged", "", "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, yellow("no differences"))
 }
 
 // HasChanges announces that a resource has changed, and displays the differences
 func (n *Notifier) HasChanges(resource Resource, diff string) {
-	fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, red("changes detected:"))
-	fmt.Println(diff)
+	defer n.lock()()
+	n.countChange()
+	if n.record(&resource, "changed", "", diff) {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, red("changes detected:"))
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Fprintln(n.output(), line)
+		case strings.HasPrefix(line, "+"):
+			fmt.Fprintln(n.output(), green(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Fprintln(n.output(), red(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Fprintln(n.output(), cyan(line))
+		default:
+			fmt.Fprintln(n.output(), line)
+		}
+	}
 }
 
 // NotFound announces that a resource was not found on the remote endpoint
 func (n *Notifier) NotFound(resource Resource) {
-	fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, yellow("not present in "+resource.Handler.GetName()))
+	defer n.lock()()
+	n.countChange()
+	if n.record(&resource, "not-found", "not present in "+resource.Handler.GetName(), "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, yellow("not present in "+resource.Handler.GetName()))
 }
 
 // Added announces that a resource has been added to the remote endpoint
 func (n *Notifier) Added(resource Resource) {
-	fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, green("added"))
+	defer n.lock()()
+	if n.audit != nil {
+		n.audit.record(resource, "added")
+	}
+	if n.summary != nil {
+		n.summary.kind(resource.Kind()).Added++
+	}
+	if n.record(&resource, "added", "", "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green("added"))
 }
 
 // Updated announces that a resource has been updated at the remote endpoint
 func (n *Notifier) Updated(resource Resource) {
-	fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, green("updated"))
+	defer n.lock()()
+	if n.audit != nil {
+		n.audit.record(resource, "updated")
+	}
+	if n.summary != nil {
+		n.summary.kind(resource.Kind()).Updated++
+	}
+	if n.record(&resource, "updated", "", "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green("updated"))
+}
+
+// Deleted announces that a resource has been deleted from the remote endpoint
+func (n *Notifier) Deleted(resource Resource) {
+	defer n.lock()()
+	if n.audit != nil {
+		n.audit.record(resource, "deleted")
+	}
+	if n.summary != nil {
+		n.summary.kind(resource.Kind()).Deleted++
+	}
+	if n.record(&resource, "deleted", "", "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green("deleted"))
+}
+
+// Previewed announces that a preview of a resource can be viewed at a URL
+func (n *Notifier) Previewed(resource Resource, url, deleteURL string) {
+	defer n.lock()()
+	if n.previews != nil {
+		*n.previews = append(*n.previews, PreviewLink{
+			Resource:  resource.Key(),
+			URL:       url,
+			DeleteURL: deleteURL,
+		})
+	}
+	if n.record(&resource, "previewed", url, "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green("view: "+url))
+	if deleteURL != "" {
+		fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, red("delete: "+deleteURL))
+	}
+}
+
+// Rendered announces that an image of the preview of a resource was saved to
+// a file
+func (n *Notifier) Rendered(resource Resource, file string) {
+	defer n.lock()()
+	if n.record(&resource, "rendered", file, "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green("image: "+file))
 }
 
 // NotSupported announces that a behaviour is not supported by a handler
 func (n *Notifier) NotSupported(resource Resource, behaviour string) {
-	fmt.Printf("%s/%s %s provider %s\n", resource.JSONPath, resource.UID, resource.Handler.GetName(), red("does not support "+behaviour))
+	defer n.lock()()
+	if n.record(&resource, "not-supported", "does not support "+behaviour, "") {
+		return
+	}
+	fmt.Fprintf(n.output(), "%s/%s %s provider %s\n", resource.JSONPath, resource.UID, resource.Handler.GetName(), red("does not support "+behaviour))
 }
 
 // Info announces a message in green
 func (n *Notifier) Info(resource *Resource, msg string) {
+	defer n.lock()()
+	if n.record(resource, "info", msg, "") {
+		return
+	}
 	if resource == nil {
-		fmt.Println(green(msg))
+		fmt.Fprintln(n.output(), green(msg))
 	} else {
-		fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, green(msg))
+		fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, green(msg))
 	}
 }
 
 // Warn announces a message in yellow
 func (n *Notifier) Warn(resource *Resource, msg string) {
+	defer n.lock()()
+	if n.record(resource, "warning", msg, "") {
+		return
+	}
 	if resource == nil {
-		fmt.Println(yellow(msg))
+		fmt.Fprintln(n.output(), yellow(msg))
 	} else {
-		fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, yellow(msg))
+		fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, yellow(msg))
 	}
 }
 
 // Error announces a message in yellow
 func (n *Notifier) Error(resource *Resource, msg string) {
+	defer n.lock()()
+	if n.record(resource, "error", msg, "") {
+		return
+	}
 	if resource == nil {
-		fmt.Println(red(msg))
+		fmt.Fprintln(n.output(), red(msg))
 	} else {
-		fmt.Printf("%s/%s %s\n", resource.JSONPath, resource.UID, red(msg))
+		fmt.Fprintf(n.output(), "%s/%s %s\n", resource.JSONPath, resource.UID, red(msg))
+	}
+}
+
+// failed announces that a resource, or the resources of a kind if resource is
+// nil, failed to apply, recording the failure to report it later
+func (n *Notifier) failed(kind string, resource *Resource, err error) {
+	key := kind
+	if resource != nil {
+		key = resource.Key()
+	}
+	n.Error(resource, err.Error())
+	defer n.lock()()
+	if n.summary != nil {
+		n.summary.kind(kind).Failed++
+	}
+	if n.failures != nil {
+		*n.failures = append(*n.failures, ApplyFailure{Resource: key, Error: err.Error()})
 	}
 }
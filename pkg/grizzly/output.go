@@ -0,0 +1,61 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Commands can output their results in a machine-readable format, so that
+ * scripts and bots can parse them rather than scraping terminal text. While
+ * doing so, the Notifier records announcements as events rather than printing
+ * them, and these are output along with the results.
+ */
+
+// Machine-readable output formats
+const (
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+// ResourceEvent is an announcement made by the Notifier, as recorded for
+// machine-readable output
+type ResourceEvent struct {
+	Resource string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Status   string `json:"status" yaml:"status"`
+	Message  string `json:"message,omitempty" yaml:"message,omitempty"`
+	Diff     string `json:"diff,omitempty" yaml:"diff,omitempty"`
+}
+
+// checkOutputFormat checks a machine-readable output format is supported
+func checkOutputFormat(format string) error {
+	if format != OutputJSON && format != OutputYAML {
+		return fmt.Errorf("Unknown output format %q, expected %s or %s", format, OutputJSON, OutputYAML)
+	}
+	return nil
+}
+
+// marshalOutput renders a value in a machine-readable output format
+func marshalOutput(format string, v interface{}) ([]byte, error) {
+	if format == OutputYAML {
+		return yaml.Marshal(v)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writeOutput writes a value to stdout in a machine-readable output format
+func writeOutput(format string, v interface{}) error {
+	data, err := marshalOutput(format, v)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
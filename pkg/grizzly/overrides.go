@@ -0,0 +1,136 @@
+package grizzly
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+/*
+ * Values that differ slightly from one environment to the next, e.g. the URL
+ * of a datasource, or the environment named in dashboard titles, can be
+ * overridden by the context in use, rather than parameterizing the Jsonnet:
+ *
+ *   contexts:
+ *     prod:
+ *       overrides:
+ *       - target: datasource/prometheus
+ *         set:
+ *           url: https://prometheus.prod.example.com
+ *       - target: dashboard/*
+ *         set:
+ *           title: '{{ .Value }} ({{ .Context }})'
+ *
+ * Targets are resource keys, which may contain glob patterns, as --target.
+ * Fields are dotted paths, e.g. jsonData.httpMethod, created if missing.
+ * String values are Go templates, given the current value of the field as
+ * .Value and the name of the context as .Context. Overrides are applied, in
+ * order, to resources as they are parsed, so that diffs show what is applied.
+ */
+
+// Override sets fields of the resources matching a target
+type Override struct {
+	Target string                 `yaml:"target"`
+	Set    map[string]interface{} `yaml:"set"`
+}
+
+// Overrides are the overrides of a context
+type Overrides struct {
+	Context string
+	List    []Override
+}
+
+// Overrides returns the overrides of a context, or of the current context if
+// name is empty
+func (c *ContextConfig) Overrides(name string) Overrides {
+	if name == "" {
+		name = c.CurrentContext
+	}
+	context, ok := c.Contexts[name]
+	if !ok {
+		return Overrides{}
+	}
+	return Overrides{Context: name, List: context.Overrides}
+}
+
+// Apply overrides the fields of the resources matching each target
+func (o *Overrides) Apply(resources Resources) error {
+	if o == nil {
+		return nil
+	}
+	for _, override := range o.List {
+		for _, resourceList := range resources {
+			for key, resource := range resourceList {
+				if !isObject(resource.Detail) || !resource.MatchesTarget([]string{override.Target}) {
+					continue
+				}
+				overridden, err := o.apply(override, resource)
+				if err != nil {
+					return err
+				}
+				resourceList[key] = overridden
+			}
+		}
+	}
+	return nil
+}
+
+// apply returns a resource with the fields of an override set
+func (o *Overrides) apply(override Override, resource Resource) (Resource, error) {
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	fields := []string{}
+	for field := range override.Set {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value := override.Set[field]
+		path := strings.Split(field, ".")
+		parent := obj
+		for _, name := range path[:len(path)-1] {
+			child, ok := parent[name].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[name] = child
+			}
+			parent = child
+		}
+		name := path[len(path)-1]
+		if tmpl, ok := value.(string); ok {
+			current := parent[name]
+			if current == nil {
+				current = ""
+			}
+			if value, err = o.render(tmpl, current); err != nil {
+				return resource, fmt.Errorf("Error overriding %s of %s: %v", field, resource.Key(), err)
+			}
+		}
+		parent[name] = value
+	}
+	detail, err := fromObject(obj, resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	resource.Detail = detail
+	return resource, nil
+}
+
+// render renders the template of a string value, given the current value of
+// the field and the name of the context
+func (o *Overrides) render(tmpl string, current interface{}) (string, error) {
+	t, err := template.New("override").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, struct {
+		Value   interface{}
+		Context string
+	}{current, o.Context})
+	return buf.String(), err
+}
@@ -0,0 +1,125 @@
+package grizzly
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOverridesApply(t *testing.T) {
+	tests := map[string]struct {
+		overrides []Override
+		detail    map[string]interface{}
+		expected  map[string]interface{}
+		// err is the start of the error expected
+		err string
+	}{
+		"set field": {
+			overrides: []Override{
+				{Target: "test/prometheus", Set: map[string]interface{}{"url": "https://prometheus.prod"}},
+			},
+			detail:   map[string]interface{}{"name": "prometheus", "url": "http://localhost:9090"},
+			expected: map[string]interface{}{"name": "prometheus", "url": "https://prometheus.prod"},
+		},
+		"other target left alone": {
+			overrides: []Override{
+				{Target: "test/loki", Set: map[string]interface{}{"url": "https://loki.prod"}},
+			},
+			detail:   map[string]interface{}{"name": "prometheus", "url": "http://localhost:9090"},
+			expected: map[string]interface{}{"name": "prometheus", "url": "http://localhost:9090"},
+		},
+		"glob target": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"editable": false}},
+			},
+			detail:   map[string]interface{}{"name": "prometheus"},
+			expected: map[string]interface{}{"name": "prometheus", "editable": false},
+		},
+		"nested fields merged": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"jsonData.httpMethod": "GET", "jsonData.tls.skipVerify": true}},
+			},
+			detail: map[string]interface{}{
+				"jsonData": map[string]interface{}{"httpMethod": "POST", "timeout": 30},
+			},
+			expected: map[string]interface{}{
+				"jsonData": map[string]interface{}{
+					"httpMethod": "GET",
+					"timeout":    30.0,
+					"tls":        map[string]interface{}{"skipVerify": true},
+				},
+			},
+		},
+		"later overrides take precedence": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"url": "https://all.prod", "access": "proxy"}},
+				{Target: "test/prometheus", Set: map[string]interface{}{"url": "https://prometheus.prod"}},
+			},
+			detail:   map[string]interface{}{"url": "http://localhost:9090"},
+			expected: map[string]interface{}{"url": "https://prometheus.prod", "access": "proxy"},
+		},
+		"templates see earlier overrides": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"title": "{{ .Value }} ({{ .Context }})"}},
+				{Target: "test/*", Set: map[string]interface{}{"title": "[{{ .Value }}]"}},
+			},
+			detail:   map[string]interface{}{"title": "Prometheus"},
+			expected: map[string]interface{}{"title": "[Prometheus (prod)]"},
+		},
+		"template of missing field": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"description": "{{ .Value }}managed in {{ .Context }}"}},
+			},
+			detail:   map[string]interface{}{},
+			expected: map[string]interface{}{"description": "managed in prod"},
+		},
+		"invalid template": {
+			overrides: []Override{
+				{Target: "test/*", Set: map[string]interface{}{"title": "{{ .Missing }}"}},
+			},
+			detail: map[string]interface{}{"title": "Prometheus"},
+			err:    "Error overriding title of test/prometheus: ",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		handler := stateTestHandler{}
+		resource := Resource{UID: "prometheus", Handler: handler, Detail: test.detail}
+		resources := Resources{handler: ResourceList{resource.Key(): resource}}
+		overrides := Overrides{Context: "prod", List: test.overrides}
+		err := overrides.Apply(resources)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error overriding: %v", err)
+			continue
+		}
+		if detail := resources[handler][resource.Key()].Detail; !reflect.DeepEqual(detail, test.expected) {
+			t.Errorf("Expected %v, got: %v", test.expected, detail)
+		}
+	}
+}
+
+func TestContextOverrides(t *testing.T) {
+	prod := []Override{{Target: "test/*", Set: map[string]interface{}{"editable": false}}}
+	config := ContextConfig{
+		CurrentContext: "dev",
+		Contexts: map[string]*Context{
+			"dev":  {},
+			"prod": {Overrides: prod},
+		},
+	}
+	if overrides := config.Overrides("prod"); overrides.Context != "prod" || !reflect.DeepEqual(overrides.List, prod) {
+		t.Errorf("Expected the overrides of prod, got: %v", overrides)
+	}
+	if overrides := config.Overrides(""); overrides.Context != "dev" || len(overrides.List) != 0 {
+		t.Errorf("Expected the overrides of the current context, got: %v", overrides)
+	}
+	if overrides := config.Overrides("staging"); overrides.Context != "" || len(overrides.List) != 0 {
+		t.Errorf("Expected no overrides for an unknown context, got: %v", overrides)
+	}
+}
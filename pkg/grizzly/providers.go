@@ -1,6 +1,14 @@
 package grizzly
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
 
 // Resource represents a single Resource destined for a single endpoint
 type Resource struct {
@@ -9,6 +17,15 @@ type Resource struct {
 	Handler  Handler     `json:"handler"`
 	Detail   interface{} `json:"detail"`
 	JSONPath string      `json:"path"`
+	// Source is the file the resource was parsed from. Jsonnet evaluates the
+	// files a file imports into a single document, which does not record
+	// where each of its values came from, so resources merged from imported
+	// mixins are attributed to the file evaluated.
+	Source string `json:"source,omitempty"`
+	// Labels identify resources for selectors, see LabelsField
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are arbitrary metadata, given by the envelope of a resource
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Kind returns the 'kind' of the resource, i.e. the type of the provider
@@ -27,18 +44,19 @@ func (r *Resource) GetRepresentation() (string, error) {
 }
 
 // GetRemoteRepresentation Gets the string representation for this resource
-func (r *Resource) GetRemoteRepresentation() (string, error) {
-	return r.Handler.GetRemoteRepresentation(r.UID)
+func (r *Resource) GetRemoteRepresentation(ctx context.Context) (string, error) {
+	return r.Handler.GetRemoteRepresentation(ctx, r.UID)
 }
 
-// MatchesTarget identifies whether a resource is in a target list
+// MatchesTarget identifies whether a resource is in a target list. Targets are
+// keys, i.e. <kind>/<uid>, which may contain glob patterns, e.g. dashboard/*.
 func (r *Resource) MatchesTarget(targets []string) bool {
 	if len(targets) == 0 {
 		return true
 	}
 	key := r.Key()
 	for _, target := range targets {
-		if target == key {
+		if matched, _ := path.Match(target, key); matched {
 			return true
 		}
 	}
@@ -48,10 +66,55 @@ func (r *Resource) MatchesTarget(targets []string) bool {
 // ResourceList represents a set of named resources
 type ResourceList map[string]Resource
 
+// Add adds a resource to a list by key, failing if the list holds another
+// resource with the same key, e.g. two dashboards with the same UID merged
+// from different mixins, rather than silently replacing it. Settings that are
+// not structured, e.g. the folder of dashboards, may be repeated, e.g. by
+// several files, as long as they agree.
+func (l ResourceList) Add(resource Resource) error {
+	key := resource.Key()
+	if other, ok := l[key]; ok {
+		if !isStructured(resource.Detail) && reflect.DeepEqual(other.Detail, resource.Detail) {
+			return nil
+		}
+		locations := []string{other.sourceLocation(), resource.sourceLocation()}
+		if locations[0] == locations[1] {
+			return fmt.Errorf("%s is defined twice, at %s", key, locations[0])
+		}
+		sort.Strings(locations)
+		return fmt.Errorf("%s is defined twice, at %s and %s", key, locations[0], locations[1])
+	}
+	l[key] = resource
+	return nil
+}
+
+// location returns where a resource is defined in the document it was parsed
+// from, for errors
+func (r *Resource) location() string {
+	switch {
+	case r.JSONPath == "":
+		return r.Filename
+	case r.Filename == "":
+		return r.JSONPath
+	}
+	return r.JSONPath + "." + r.Filename
+}
+
+// sourceLocation returns where a resource is defined, including the file
+// holding it if known, for errors
+func (r *Resource) sourceLocation() string {
+	if r.Source == "" {
+		return r.location()
+	}
+	return r.location() + " in " + r.Source
+}
+
 // Resources represents a set of resources by handler
 type Resources map[Handler]ResourceList
 
-// Handler describes a handler for a single API resource handled by a single provider
+// Handler describes a handler for a single API resource handled by a single
+// provider. Operations on the endpoint are given a context, whose
+// cancellation aborts their requests.
 type Handler interface {
 	GetName() string
 	GetFullName() string
@@ -68,43 +131,166 @@ type Handler interface {
 	Prepare(existing, resource Resource) *Resource
 
 	// Get retrieves JSON for a resource from an endpoint, by UID
-	GetByUID(UID string) (*Resource, error)
+	GetByUID(ctx context.Context, UID string) (*Resource, error)
 
 	// GetRepresentation renders Jsonnet to Grizzly resources, rendering as a string
 	GetRepresentation(uid string, resource Resource) (string, error)
 
 	// GetRemoteRepresentation retrieves a resource from the endpoint and renders to a string
-	GetRemoteRepresentation(uid string) (string, error)
+	GetRemoteRepresentation(ctx context.Context, uid string) (string, error)
 
 	// GetRemote retrieves a resource as a datastructure
-	GetRemote(uid string) (*Resource, error)
+	GetRemote(ctx context.Context, uid string) (*Resource, error)
 
 	// Add pushes a new resource to the endpoint
-	Add(resource Resource) error
+	Add(ctx context.Context, resource Resource) error
 
 	// Update pushes an existing resource to the endpoint
-	Update(existing, resource Resource) error
+	Update(ctx context.Context, existing, resource Resource) error
+
+	// Delete removes a resource from the endpoint, by UID
+	Delete(ctx context.Context, UID string) error
 
 	// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
-	Preview(resource Resource, notifier Notifier, opts *PreviewOpts) error
+	Preview(ctx context.Context, resource Resource, notifier Notifier, opts *PreviewOpts) error
 }
 
 // MultiResourceHandler describes a handler that can handle multiple resources in one go.
 // This could be because it needs to see all resources before sending, or because the
 // endpoint API supports batching of resources.
 type MultiResourceHandler interface {
-	// Diff compares local resources with remote equivalents and output result
-	Diff(notifier Notifier, resources ResourceList) error
+	// Diff compares local resources, merged using the state if any, with remote
+	// equivalents and output result
+	Diff(ctx context.Context, notifier Notifier, resources ResourceList, state *State) error
+
+	// Apply local resources to remote endpoint, recording them in the state if any
+	Apply(ctx context.Context, notifier Notifier, resources ResourceList, state *State) error
+}
+
+// ValidateHandler describes a handler that can check resources before they are
+// sent to its endpoint
+type ValidateHandler interface {
+	// Validate checks a resource, returning all problems found
+	Validate(resource Resource) []error
+}
+
+// LintHandler describes a handler that can check resources for common mistakes,
+// on request
+type LintHandler interface {
+	// Lint checks a resource, returning all problems found
+	Lint(resource Resource) []error
+}
+
+// ReferenceCheckHandler describes a handler whose resources refer to others,
+// e.g. dashboards to datasources, that can check these exist, either among
+// the resources parsed with them or at the endpoint
+type ReferenceCheckHandler interface {
+	// CheckReferences returns the references to missing resources of each
+	// resource of a list, by key, given all the resources parsed
+	CheckReferences(ctx context.Context, resourceList ResourceList, resources Resources) (map[string][]error, error)
+}
+
+// UIDHandler describes a handler whose resources may leave the UID others
+// refer to them by to the endpoint, e.g. datasources, named in grizzly but
+// referred to by a UID Grafana generates if missing
+type UIDHandler interface {
+	// DeclaredUID returns the UID a resource declares, empty if none
+	DeclaredUID(resource Resource) string
+}
 
-	// Apply local resources to remote endpoint
-	Apply(notifier Notifier, resources ResourceList) error
+// VersionHandler describes a handler whose remote resources carry a version
+// incremented on each change, e.g. dashboards, so that changes made remotely
+// since they were last applied are not overwritten by accident
+type VersionHandler interface {
+	// Version returns the version of a remote resource
+	Version(resource Resource) int
+}
+
+// PruneHandler describes a handler that can list the resources at its endpoint,
+// so that those no longer present in the Jsonnet can be deleted
+type PruneHandler interface {
+	// ListRemote retrieves the resources at the endpoint that are managed alongside
+	// the given local resources
+	ListRemote(ctx context.Context, resources ResourceList) (ResourceList, error)
+}
+
+// ListHandler describes a handler that can enumerate all resources at its endpoint
+type ListHandler interface {
+	// ListAll retrieves a summary of each resource at the endpoint
+	ListAll(ctx context.Context) ([]ResourceSummary, error)
+}
+
+// ResourceSummary describes a resource found at an endpoint
+type ResourceSummary struct {
+	UID    string `json:"uid" yaml:"uid"`
+	Title  string `json:"title" yaml:"title"`
+	Folder string `json:"folder" yaml:"folder"`
+}
+
+// FolderHandler describes a handler whose resources are organised into folders,
+// e.g. dashboard folders or rule namespaces
+type FolderHandler interface {
+	// GetFolder returns the folder of a resource, given the resources parsed with it
+	GetFolder(resource Resource, resources ResourceList) string
+}
+
+// PreviewListHandler describes a handler whose previews depend on the other
+// resources of the handler parsed with the one previewed, e.g. rule groups
+// unit tested together
+type PreviewListHandler interface {
+	// PreviewList previews a resource, given the resources of its handler
+	// parsed with it
+	PreviewList(ctx context.Context, resource Resource, resourceList ResourceList, notifier Notifier, opts *PreviewOpts) error
+}
+
+// PreviewRenderer describes a handler whose previews can be rendered as images
+type PreviewRenderer interface {
+	// RenderPreview renders the preview at a URL as a PNG image
+	RenderPreview(ctx context.Context, url string, opts *PreviewOpts) ([]byte, error)
+}
+
+// FolderTitleHandler describes a handler whose folders have a title besides
+// their identifier, e.g. dashboard folders
+type FolderTitleHandler interface {
+	// GetFolderTitle returns the title of the folder of a resource, given the
+	// resources parsed with it
+	GetFolderTitle(resource Resource, resources ResourceList) string
+}
+
+// PrepareListHandler describes a handler whose resources depend on others
+// parsed with them, e.g. settings shared by all of them
+type PrepareListHandler interface {
+	// PrepareList readies resources to be diffed or applied one by one,
+	// dropping those only holding settings
+	PrepareList(resources ResourceList) ResourceList
+}
+
+// EnvelopeHandler describes a handler whose path does not hold resources by
+// name, so parses the spec of envelopes itself
+type EnvelopeHandler interface {
+	// ParseSpec parses the spec of an envelope, given the name of its metadata
+	ParseSpec(name string, spec interface{}) (ResourceList, error)
+}
+
+// DetectHandler describes a handler recognising its resources in plain files,
+// e.g. dashboards exported from Grafana
+type DetectHandler interface {
+	// Detect reports whether a document is one of its resources
+	Detect(document map[string]interface{}) bool
+}
+
+// GrafonnetHandler describes a handler that can render resources as grafonnet,
+// rather than as plain JSON
+type GrafonnetHandler interface {
+	// ToGrafonnet returns the locals a resource needs, and an expression rendering it
+	ToGrafonnet(resource Resource) (string, string, error)
 }
 
 // ListenHandler describes a handler that has the ability to watch a single
 // resource for changes, and write changes to that resource to a local file
 type ListenHandler interface {
 	// Listen watches a resource and update local file on changes
-	Listen(notifier Notifier, UID, filename string) error
+	Listen(ctx context.Context, notifier Notifier, UID, filename string) error
 }
 
 // Provider describes a single Endpoint Provider
@@ -113,12 +299,31 @@ type Provider interface {
 	GetHandlers() []Handler
 }
 
-// Registry records providers
+// ApplyHook describes a provider that acts once all resources have been applied
+// successfully, e.g. to record that a deployment happened
+type ApplyHook interface {
+	PostApply(ctx context.Context, notifier Notifier, resources Resources, opts *ApplyOpts) error
+}
+
+// ConfiguredHandler describes a handler that can tell whether its endpoint is
+// configured, e.g. by environment variables, so that it is left out when
+// going through all handlers rather than failing for lack of credentials
+type ConfiguredHandler interface {
+	// Configured returns why the endpoint is not configured, if it is not
+	Configured() error
+}
+
+// Registry records providers. Handlers may be disabled, e.g. by the context
+// in use, in which case their resources are skipped.
 type Registry struct {
 	Providers     []Provider
 	Handlers      []Handler
 	HandlerByName map[string]Handler
 	HandlerByPath map[string]Handler
+
+	// disabled are the names of the handlers disabled, shared by copies of
+	// the registry
+	disabled map[string]bool
 }
 
 // NewProviderRegistry returns a new registry instance
@@ -128,6 +333,7 @@ func NewProviderRegistry() Registry {
 	registry.Handlers = []Handler{}
 	registry.HandlerByName = map[string]Handler{}
 	registry.HandlerByPath = map[string]Handler{}
+	registry.disabled = map[string]bool{}
 	return registry
 }
 
@@ -153,7 +359,137 @@ func (r *Registry) GetHandler(path string) (Handler, error) {
 		if !exists {
 			return nil, fmt.Errorf("No handler registered to %s", path)
 		}
-		return handler, nil
+	}
+	if !r.Enabled(handler) {
+		return nil, fmt.Errorf("The %s handler is disabled", handler.GetName())
 	}
 	return handler, nil
 }
+
+// Enabled reports whether a handler is enabled
+func (r *Registry) Enabled(handler Handler) bool {
+	return !r.disabled[handler.GetName()]
+}
+
+// Disable disables handlers, by their name or that of their provider
+func (r *Registry) Disable(names []string) error {
+	handlers, err := r.handlersNamed(names)
+	if err != nil {
+		return err
+	}
+	if r.disabled == nil {
+		r.disabled = map[string]bool{}
+	}
+	for _, handler := range handlers {
+		r.disabled[handler.GetName()] = true
+	}
+	return nil
+}
+
+// EnableOnly disables all handlers but those given, by their name or that of
+// their provider
+func (r *Registry) EnableOnly(names []string) error {
+	handlers, err := r.handlersNamed(names)
+	if err != nil {
+		return err
+	}
+	if r.disabled == nil {
+		r.disabled = map[string]bool{}
+	}
+	enabled := map[string]bool{}
+	for _, handler := range handlers {
+		enabled[handler.GetName()] = true
+	}
+	for _, handler := range r.Handlers {
+		if !enabled[handler.GetName()] {
+			r.disabled[handler.GetName()] = true
+		}
+	}
+	return nil
+}
+
+// handlersNamed returns the handlers given by the name of their provider,
+// their name or their full name. A provider shadows a handler of the same
+// name, e.g. prometheus, which its full name still gives.
+func (r *Registry) handlersNamed(names []string) ([]Handler, error) {
+	handlers := []Handler{}
+	for _, name := range names {
+		found := false
+		for _, provider := range r.Providers {
+			if provider.GetName() == name {
+				handlers = append(handlers, provider.GetHandlers()...)
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		handler, ok := r.HandlerByName[name]
+		if !ok {
+			return nil, fmt.Errorf("No handler or provider named %s", name)
+		}
+		handlers = append(handlers, handler)
+	}
+	return handlers, nil
+}
+
+// isDisabledPath reports whether a path, or the kind of an envelope, is that
+// of a disabled handler, whose resources are skipped
+func (r *Registry) isDisabledPath(path string) bool {
+	if handler, exists := r.HandlerByPath[path]; exists {
+		return !r.Enabled(handler)
+	}
+	for _, handler := range r.Handlers {
+		for _, name := range []string{handler.GetName(), handler.GetFullName()} {
+			if normalizeKind(name) == normalizeKind(path) {
+				return !r.Enabled(handler)
+			}
+		}
+	}
+	return false
+}
+
+// ActiveHandlers returns the handlers that are enabled and whose endpoint is
+// configured, for operations going through all handlers rather than those
+// of the resources given
+func (r *Registry) ActiveHandlers() []Handler {
+	handlers := []Handler{}
+	for _, handler := range r.Handlers {
+		if !r.Enabled(handler) {
+			continue
+		}
+		if configured, ok := handler.(ConfiguredHandler); ok && configured.Configured() != nil {
+			continue
+		}
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// GetHandlerByKind returns the handler of the kind of an envelope, e.g.
+// Dashboard or PrometheusRuleGroup, matching the name or full name of handlers
+// regardless of case and punctuation
+func (r *Registry) GetHandlerByKind(kind string) (Handler, error) {
+	for _, handler := range r.Handlers {
+		for _, name := range []string{handler.GetName(), handler.GetFullName()} {
+			if normalizeKind(name) != normalizeKind(kind) {
+				continue
+			}
+			if !r.Enabled(handler) {
+				return nil, fmt.Errorf("The %s handler is disabled", handler.GetName())
+			}
+			return handler, nil
+		}
+	}
+	return nil, fmt.Errorf("No handler registered for kind %s", kind)
+}
+
+// normalizeKind lowercases a kind, dropping punctuation
+func normalizeKind(kind string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, kind)
+}
@@ -0,0 +1,72 @@
+package grizzly
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+/*
+ * For Grafana instances whose HTTP API is out of reach, e.g. air-gapped ones,
+ * resources can be exported in Grafana's file provisioning format, laid out as
+ * Grafana's provisioning directory, e.g. /etc/grafana/provisioning:
+ *
+ *   datasources/grizzly.yaml   the datasources
+ *   dashboards/grizzly.yaml    the provider of the dashboards below
+ *   dashboards/grizzly/...     the JSON of dashboards, by folder
+ *
+ * Handlers provide the files provisioning their resources (see
+ * ProvisioningHandler).
+ */
+
+// DefaultProvisioningDir is where Grafana reads provisioning files by default
+const DefaultProvisioningDir = "/etc/grafana/provisioning"
+
+// ProvisioningHandler describes a handler whose resources Grafana can
+// provision from files
+type ProvisioningHandler interface {
+	// Provision returns the files provisioning resources, by path relative to
+	// the provisioning directory, given the path of that directory on the
+	// Grafana server
+	Provision(resources ResourceList, provisioningDir string) (map[string]string, error)
+}
+
+// exportProvisioning writes the files provisioning resources to a directory
+func exportProvisioning(config Config, exportDir string, resources Resources, opts *ExportOpts) error {
+	provisioningDir := opts.ProvisioningDir
+	if provisioningDir == "" {
+		provisioningDir = DefaultProvisioningDir
+	}
+	files := map[string]string{}
+	for handler, resourceList := range resources {
+		provisioningHandler, ok := handler.(ProvisioningHandler)
+		if !ok {
+			for _, resource := range resourceList {
+				if isStructured(resource.Detail) {
+					config.Notifier.Warn(&resource, "cannot be provisioned from files, skipped")
+				}
+			}
+			continue
+		}
+		handlerFiles, err := provisioningHandler.Provision(resourceList, provisioningDir)
+		if err != nil {
+			return fmt.Errorf("Error provisioning %s: %v", handler.GetName(), err)
+		}
+		for path, content := range handlerFiles {
+			files[path] = content
+		}
+	}
+
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := writeFile(filepath.Join(exportDir, filepath.Clean("/"+path)), files[path]); err != nil {
+			return err
+		}
+	}
+	config.Notifier.Info(nil, fmt.Sprintf("%d provisioning files written to %s", len(paths), exportDir))
+	return nil
+}
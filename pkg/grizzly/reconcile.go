@@ -0,0 +1,253 @@
+package grizzly
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Reconciling turns grizzly into a GitOps controller: rather than applying once
+ * from CI, `grr reconcile` runs for good, e.g. as a Kubernetes deployment, and
+ * every interval:
+ *
+ *   - pulls a Git repository, if one is given, with the git binary
+ *   - evaluates the resources, and counts those that drifted from the endpoints,
+ *     along with those to be pruned
+ *   - applies them, whether Git changed or someone edited them by hand
+ *
+ * Its health and the outcome of the last reconciliation are served on /healthz,
+ * and as Prometheus metrics on /metrics.
+ */
+
+// Reconcile continuously applies resources, pulled from Git if a repository
+// is given, serving health and drift metrics, until the context is canceled
+func Reconcile(ctx context.Context, config Config, parser Parser, opts *ReconcileOpts) error {
+	r := &reconciler{
+		config: config,
+		parser: parser,
+		opts:   opts,
+	}
+
+	listener, err := net.Listen("tcp", opts.Address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", r.health)
+	mux.HandleFunc("/metrics", r.metrics)
+	go func() {
+		// closing the listener on return stops serving
+		if err := http.Serve(listener, mux); err != nil && ctx.Err() == nil {
+			config.Notifier.Logf(LogError, "%v", err)
+		}
+	}()
+	config.Notifier.Logf(LogInfo, "Serving health and metrics at http://%s/", listener.Addr())
+
+	for {
+		r.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.Interval):
+		}
+	}
+}
+
+// reconciler holds the outcome of the reconciliations
+type reconciler struct {
+	config Config
+	parser Parser
+	opts   *ReconcileOpts
+
+	mu          sync.Mutex
+	running     bool
+	runs        int
+	failures    int
+	drifted     int
+	duration    time.Duration
+	lastRun     time.Time
+	lastSuccess time.Time
+	commit      string
+	err         error
+}
+
+// reconcile pulls, diffs and applies the resources once
+func (r *reconciler) reconcile(ctx context.Context) {
+	start := time.Now()
+	r.mu.Lock()
+	r.running = true
+	r.mu.Unlock()
+	span := StartTrace("grizzly.reconcile")
+	commit, drifted, err := r.run(ctx)
+	span.SetAttribute("vcs.commit", commit)
+	span.SetAttribute("grizzly.drifted", drifted)
+	span.End(err)
+	if flushErr := FlushTracing(); flushErr != nil {
+		r.config.Notifier.Logf(LogWarn, "%v", flushErr)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running = false
+	r.runs++
+	r.lastRun = start
+	r.duration = time.Since(start)
+	r.err = err
+	if commit != "" {
+		r.commit = commit
+	}
+	if err != nil {
+		r.failures++
+		r.config.Notifier.Logf(LogError, "Reconciliation failed: %v", err)
+		return
+	}
+	r.drifted = drifted
+	r.lastSuccess = start
+}
+
+func (r *reconciler) run(ctx context.Context) (commit string, drifted int, err error) {
+	if r.opts.Repo != "" {
+		if commit, err = syncRepo(r.opts.Repo, r.opts.Ref, r.opts.Dir); err != nil {
+			return "", 0, err
+		}
+		r.config.Notifier.Logf(LogInfo, "Reconciling %s at %s", r.parser.Name(), commit)
+	} else {
+		r.config.Notifier.Logf(LogInfo, "Reconciling %s", r.parser.Name())
+	}
+	resources, err := r.parser.Parse(r.config)
+	if err != nil {
+		return commit, 0, err
+	}
+	if drifted, err = diff(ctx, r.config, resources, nil); err != nil {
+		return commit, 0, err
+	}
+	if r.opts.Prune {
+		// diff does not report orphans, e.g. resources only removed from Git
+		orphans, err := countOrphans(ctx, r.config, resources)
+		if err != nil {
+			return commit, 0, err
+		}
+		drifted += orphans
+	}
+	if drifted == 0 {
+		return commit, 0, nil
+	}
+	return commit, drifted, Apply(ctx, r.config, resources, &ApplyOpts{
+		Commit:      commit,
+		Prune:       r.opts.Prune,
+		AutoApprove: true,
+	})
+}
+
+// countOrphans counts the remote resources pruning would delete
+func countOrphans(ctx context.Context, config Config, resources Resources) (int, error) {
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for handler, resourceList := range withRecordedHandlers(config, resources, state) {
+		orphans, err := listOrphans(ctx, config, handler, resourceList, state, false)
+		if err != nil {
+			return 0, err
+		}
+		count += len(orphans)
+	}
+	return count, nil
+}
+
+// health reports whether the last reconciliation succeeded
+func (r *reconciler) health(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		http.Error(w, r.err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// metrics writes the outcome of the reconciliations in the Prometheus text
+// format
+func (r *reconciler) metrics(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	success := 0
+	if r.runs > 0 && r.err == nil {
+		success = 1
+	}
+	lastSuccess := 0.0
+	if !r.lastSuccess.IsZero() {
+		lastSuccess = float64(r.lastSuccess.UnixNano()) / 1e9
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "grizzly_reconcile_runs_total", "counter", "Reconciliations run.", r.runs)
+	writeMetric(w, "grizzly_reconcile_failures_total", "counter", "Reconciliations that failed.", r.failures)
+	writeMetric(w, "grizzly_reconcile_success", "gauge", "Whether the last reconciliation succeeded.", success)
+	writeMetric(w, "grizzly_reconcile_drifted_resources", "gauge", "Resources that differed from the endpoints at the last successful reconciliation.", r.drifted)
+	writeMetric(w, "grizzly_reconcile_duration_seconds", "gauge", "How long the last reconciliation took.", r.duration.Seconds())
+	writeMetric(w, "grizzly_reconcile_last_success_timestamp_seconds", "gauge", "When the last successful reconciliation started.", lastSuccess)
+	if r.commit != "" {
+		fmt.Fprintf(w, "# HELP grizzly_reconcile_commit_info The commit last reconciled.\n# TYPE grizzly_reconcile_commit_info gauge\ngrizzly_reconcile_commit_info{commit=%q} 1\n", r.commit)
+	}
+	selfMetrics.write(w)
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// syncRepo clones a Git repository into dir, or updates the clone to the
+// latest commit of ref, returning that commit. An empty ref follows the
+// default branch.
+func syncRepo(repo, ref, dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		args := []string{"clone", "--single-branch"}
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+		if _, err := git("", append(args, repo, dir)...); err != nil {
+			return "", err
+		}
+	} else {
+		fetch := []string{"fetch", "origin"}
+		if ref != "" {
+			fetch = append(fetch, ref)
+		}
+		if _, err := git(dir, fetch...); err != nil {
+			return "", err
+		}
+		if _, err := git(dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return git(dir, "rev-parse", "--short", "HEAD")
+}
+
+// git runs a git command, in dir if given, returning its output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return "", fmt.Errorf("Error running git, the git binary is required: %v", err)
+		}
+		return "", fmt.Errorf("Error running git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
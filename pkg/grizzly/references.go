@@ -0,0 +1,203 @@
+package grizzly
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+/*
+ * Resources may refer to other resources of the same tree by key, rather than
+ * hard-coding their UIDs twice, e.g. a dashboard panel to a datasource:
+ *
+ *   datasource: { type: 'loki', uid: '${datasource:loki-prod}' },
+ *
+ * References are resolved as resources are applied, or diffed, to the
+ * identifier the endpoint knows the resource referred to by, see
+ * ReferenceHandler, which may only be known once it has been applied: kinds
+ * referred to are applied first. References to resources not in the tree are
+ * left as they are, as Grafana formats template variables as ${var:format}.
+ */
+
+var referenceRegexp = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9._-]*):([^}]+)\}`)
+
+// ReferenceHandler is a handler whose resources are referred to by an
+// identifier other than their UID, e.g. datasources, which grizzly identifies
+// by name, and dashboards refer to by uid
+type ReferenceHandler interface {
+	// ReferenceID returns the identifier a resource, either parsed or
+	// remote, is referred to by, or an empty string if it does not have one
+	// yet, e.g. until Grafana assigns it
+	ReferenceID(resource Resource) string
+}
+
+// references resolves the references between resources applied together,
+// remembering the identifiers of the resources referred to
+type references struct {
+	resources map[string]Resource
+	mu        sync.Mutex
+	ids       map[string]string
+}
+
+func newReferences(resources Resources) *references {
+	r := &references{
+		resources: map[string]Resource{},
+		ids:       map[string]string{},
+	}
+	for _, resourceList := range resources {
+		for _, resource := range resourceList {
+			r.resources[resource.Key()] = resource
+		}
+	}
+	return r
+}
+
+// referencedKinds returns the kinds a resource refers to
+func (r *references) referencedKinds(resource Resource) map[string]bool {
+	kinds := map[string]bool{}
+	if !isObject(resource.Detail) {
+		return kinds
+	}
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return kinds
+	}
+	mapStrings(obj, func(s string) string {
+		for _, match := range referenceRegexp.FindAllStringSubmatch(s, -1) {
+			if _, ok := r.resources[match[1]+"/"+match[2]]; ok {
+				kinds[match[1]] = true
+			}
+		}
+		return s
+	})
+	return kinds
+}
+
+// order returns handlers in the order to apply them in: those of kinds
+// referred to by other resources first, then by name
+func (r *references) order(resources Resources) []Handler {
+	referenced := map[string]bool{}
+	for _, resource := range r.resources {
+		for kind := range r.referencedKinds(resource) {
+			if kind != resource.Kind() {
+				referenced[kind] = true
+			}
+		}
+	}
+	handlers := []Handler{}
+	for handler := range resources {
+		handlers = append(handlers, handler)
+	}
+	sort.SliceStable(handlers, func(i, j int) bool {
+		a, b := handlers[i].GetName(), handlers[j].GetName()
+		if referenced[a] != referenced[b] {
+			return referenced[a]
+		}
+		return a < b
+	})
+	return handlers
+}
+
+// resolve returns a resource with its references resolved. Referring to a
+// resource whose identifier is not known until it is applied fails with
+// ErrNotFound if it has not been.
+func (r *references) resolve(ctx context.Context, resource Resource) (Resource, error) {
+	if r == nil || !isObject(resource.Detail) {
+		return resource, nil
+	}
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	var resolveErr error
+	resolved := false
+	value := mapStrings(obj, func(s string) string {
+		return referenceRegexp.ReplaceAllStringFunc(s, func(match string) string {
+			parts := referenceRegexp.FindStringSubmatch(match)
+			referred, ok := r.resources[parts[1]+"/"+parts[2]]
+			if !ok || resolveErr != nil {
+				return match
+			}
+			id, err := r.id(ctx, referred)
+			if err != nil {
+				resolveErr = fmt.Errorf("Error resolving %s in %s: %w", match, resource.Key(), err)
+				return match
+			}
+			resolved = true
+			return id
+		})
+	})
+	if resolveErr != nil || !resolved {
+		return resource, resolveErr
+	}
+	detail, err := fromObject(value.(map[string]interface{}), resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	resource.Detail = detail
+	return resource, nil
+}
+
+// resolveList returns a list of resources with their references resolved
+func (r *references) resolveList(ctx context.Context, resourceList ResourceList) (ResourceList, error) {
+	resolved := ResourceList{}
+	for key, resource := range resourceList {
+		resource, err := r.resolve(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		resolved[key] = resource
+	}
+	return resolved, nil
+}
+
+// id returns the identifier a resource is referred to by, retrieving it from
+// the endpoint if it is not set in the tree
+func (r *references) id(ctx context.Context, resource Resource) (string, error) {
+	referrer, ok := resource.Handler.(ReferenceHandler)
+	if !ok {
+		return resource.UID, nil
+	}
+	if id := referrer.ReferenceID(resource); id != "" {
+		return id, nil
+	}
+	key := resource.Key()
+	r.mu.Lock()
+	id, ok := r.ids[key]
+	r.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+	remote, err := resource.Handler.GetRemote(ctx, resource.UID)
+	if err == ErrNotFound {
+		return "", fmt.Errorf("%s has not been applied yet: %w", key, ErrNotFound)
+	} else if err != nil {
+		return "", err
+	}
+	if id = referrer.ReferenceID(*remote); id == "" {
+		return "", fmt.Errorf("%s has no identifier to refer to it by", key)
+	}
+	r.mu.Lock()
+	r.ids[key] = id
+	r.mu.Unlock()
+	return id, nil
+}
+
+// mapStrings replaces the strings of a JSON value with the results of fn
+func mapStrings(v interface{}, fn func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return fn(v)
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = mapStrings(v[k], fn)
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = mapStrings(v[i], fn)
+		}
+	}
+	return v
+}
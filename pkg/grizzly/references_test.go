@@ -0,0 +1,134 @@
+package grizzly
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// refTestHandler serves the remote resources of a kind, by UID
+type refTestHandler struct {
+	Handler
+	name   string
+	remote map[string]*Resource
+}
+
+func (h refTestHandler) GetName() string {
+	return h.name
+}
+
+func (h refTestHandler) GetRemote(ctx context.Context, uid string) (*Resource, error) {
+	resource, ok := h.remote[uid]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return resource, nil
+}
+
+// idTestHandler refers to resources by the id Grafana assigns them, rather
+// than by their UID
+type idTestHandler struct {
+	refTestHandler
+}
+
+func (h idTestHandler) ReferenceID(resource Resource) string {
+	id, _ := resource.Detail.(map[string]interface{})["id"].(string)
+	return id
+}
+
+func TestReferencedKinds(t *testing.T) {
+	datasources := &idTestHandler{refTestHandler{name: "datasource"}}
+	dashboards := &refTestHandler{name: "dashboard"}
+	loki := Resource{UID: "loki", Handler: datasources, Detail: map[string]interface{}{"name": "loki"}}
+	overview := Resource{UID: "overview", Handler: dashboards, Detail: map[string]interface{}{
+		"panels": []interface{}{
+			map[string]interface{}{"datasource": map[string]interface{}{"uid": "${datasource:loki}"}},
+			map[string]interface{}{"links": []interface{}{"/d/${dashboard:api}", "${var:text}"}},
+		},
+	}}
+	api := Resource{UID: "api", Handler: dashboards, Detail: map[string]interface{}{"title": "API"}}
+	refs := newReferences(Resources{
+		datasources: ResourceList{loki.Key(): loki},
+		dashboards:  ResourceList{overview.Key(): overview, api.Key(): api},
+	})
+
+	expected := map[string]bool{"datasource": true, "dashboard": true}
+	if kinds := refs.referencedKinds(overview); !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected references to %v, got: %v", expected, kinds)
+	}
+	if kinds := refs.referencedKinds(api); len(kinds) != 0 {
+		t.Errorf("Expected no references, got: %v", kinds)
+	}
+	order := refs.order(Resources{dashboards: nil, datasources: nil})
+	if order[0] != Handler(datasources) {
+		t.Errorf("Expected the datasources referred to to be applied first, got: %s", order[0].GetName())
+	}
+}
+
+func TestResolveReferences(t *testing.T) {
+	datasources := &idTestHandler{refTestHandler{name: "datasource", remote: map[string]*Resource{
+		"loki": {UID: "loki", Detail: map[string]interface{}{"id": "P8E80F9AEF21F6940"}},
+	}}}
+	dashboards := &refTestHandler{name: "dashboard"}
+	loki := Resource{UID: "loki", Handler: datasources, Detail: map[string]interface{}{"name": "loki"}}
+	tempo := Resource{UID: "tempo", Handler: datasources, Detail: map[string]interface{}{"name": "tempo"}}
+	prometheus := Resource{UID: "prometheus", Handler: datasources, Detail: map[string]interface{}{"name": "prometheus", "id": "prom"}}
+	api := Resource{UID: "api", Handler: dashboards, Detail: map[string]interface{}{"title": "API"}}
+	refs := newReferences(Resources{
+		datasources: ResourceList{loki.Key(): loki, tempo.Key(): tempo, prometheus.Key(): prometheus},
+		dashboards:  ResourceList{api.Key(): api},
+	})
+
+	tests := map[string]struct {
+		value    string
+		expected string
+		notFound bool
+	}{
+		"no reference": {
+			value:    "Overview",
+			expected: "Overview",
+		},
+		"reference by UID": {
+			value:    "/d/${dashboard:api}",
+			expected: "/d/api",
+		},
+		"identifier set in the tree": {
+			value:    "${datasource:prometheus}",
+			expected: "prom",
+		},
+		"identifier assigned remotely": {
+			value:    "${datasource:loki}",
+			expected: "P8E80F9AEF21F6940",
+		},
+		"resource not in the tree": {
+			value:    "${datasource:mimir} ${var:text}",
+			expected: "${datasource:mimir} ${var:text}",
+		},
+		"resource not applied yet": {
+			value:    "${datasource:tempo}",
+			notFound: true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		resource := Resource{UID: "overview", Handler: dashboards, Detail: map[string]interface{}{
+			"panels": []interface{}{map[string]interface{}{"value": test.value}},
+		}}
+		resolved, err := refs.resolve(context.Background(), resource)
+		if test.notFound {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected a resource not found, got: %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error resolving: %v", err)
+			continue
+		}
+		panel := resolved.Detail.(map[string]interface{})["panels"].([]interface{})[0]
+		if value := panel.(map[string]interface{})["value"]; value != test.expected {
+			t.Errorf("Expected %q, got: %q", test.expected, value)
+		}
+	}
+}
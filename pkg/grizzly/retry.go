@@ -0,0 +1,139 @@
+package grizzly
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+/*
+ * Gateways in front of Grafana and Cortex occasionally fail requests, e.g.
+ * while a backend restarts. Rather than failing a whole apply, such requests
+ * are retried with an exponential backoff: rate limited requests (429),
+ * server errors (5xx, except 501 Not Implemented, which is not transient) and
+ * timeouts. Requests whose body cannot be replayed are not retried.
+ *
+ * Only idempotent requests (GET, HEAD, PUT, DELETE) are retried after a
+ * server error or timeout, as a POST may have taken effect before failing,
+ * e.g. creating a resource twice. A POST is retried only when it was
+ * certainly not processed: rate limited (429) or unavailable (503).
+ */
+
+// RetryTransport is an http.RoundTripper that retries requests failing
+// transiently
+type RetryTransport struct {
+	// Next sends requests, http.DefaultTransport if unset
+	Next http.RoundTripper
+	// Opts configures the attempts made, and the backoff between them
+	Opts *RetryOpts
+	// Logger reports retries, at warning level
+	Logger *Logger
+}
+
+// maxBackoff caps the time waited between two attempts
+const maxBackoff = 30 * time.Second
+
+// RoundTrip sends a request, retrying it if it fails transiently
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	attempts, backoff := 1, time.Duration(0)
+	if t.Opts != nil {
+		attempts, backoff = t.Opts.Attempts, t.Opts.Backoff
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := next.RoundTrip(req)
+		reason, retry := retryable(req.Method, resp, err)
+		if !retry || attempt >= attempts {
+			return resp, err
+		}
+
+		wait := retryAfter(resp)
+		if wait == 0 {
+			wait = backoff << uint(attempt-1)
+		}
+		if wait > maxBackoff || wait < 0 {
+			wait = maxBackoff
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if t.Logger != nil {
+			t.Logger.logf(LogWarn, "%s %s%s failed with %s, retrying in %s (attempt %d of %d)", req.Method, req.URL.Host, req.URL.Path, reason, wait, attempt+1, attempts)
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// idempotentMethods are the methods of requests that can safely be sent again
+// after failing at any point
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+// retryable reports whether a request with a method failed transiently, and
+// can be retried, and why
+func retryable(method string, resp *http.Response, err error) (string, bool) {
+	idempotent := idempotentMethods[method]
+	if err != nil {
+		var netErr net.Error
+		if idempotent && errors.As(err, &netErr) && netErr.Timeout() {
+			return "timeout", true
+		}
+		return "", false
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusServiceUnavailable:
+		return resp.Status, true
+	case resp.StatusCode == http.StatusNotImplemented:
+		return "", false
+	case resp.StatusCode >= 500:
+		return resp.Status, idempotent
+	}
+	return "", false
+}
+
+// retryAfter returns the time to wait requested by a Retry-After header in
+// seconds, if any
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,71 @@
+package grizzly
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeTransport answers every request with a status, or fails it with an
+// error, counting the attempts made
+type fakeTransport struct {
+	status   int
+	err      error
+	attempts int
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.attempts++
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Status:     http.StatusText(t.status),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Header:     http.Header{},
+	}, nil
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := map[string]struct {
+		method   string
+		status   int
+		err      error
+		attempts int
+	}{
+		"GET succeeding":               {http.MethodGet, http.StatusOK, nil, 1},
+		"GET failing with 500":         {http.MethodGet, http.StatusInternalServerError, nil, 3},
+		"GET failing with 501":         {http.MethodGet, http.StatusNotImplemented, nil, 1},
+		"GET failing with 404":         {http.MethodGet, http.StatusNotFound, nil, 1},
+		"GET timing out":               {http.MethodGet, 0, context.DeadlineExceeded, 3},
+		"PUT failing with 502":         {http.MethodPut, http.StatusBadGateway, nil, 3},
+		"DELETE failing with 504":      {http.MethodDelete, http.StatusGatewayTimeout, nil, 3},
+		"POST failing with 500":        {http.MethodPost, http.StatusInternalServerError, nil, 1},
+		"POST failing with 502":        {http.MethodPost, http.StatusBadGateway, nil, 1},
+		"POST timing out":              {http.MethodPost, 0, context.DeadlineExceeded, 1},
+		"POST rate limited":            {http.MethodPost, http.StatusTooManyRequests, nil, 3},
+		"POST failing with 503":        {http.MethodPost, http.StatusServiceUnavailable, nil, 3},
+		"PATCH failing with 500":       {http.MethodPatch, http.StatusInternalServerError, nil, 1},
+		"PATCH failing with 503":       {http.MethodPatch, http.StatusServiceUnavailable, nil, 3},
+		"GET failing with other error": {http.MethodGet, 0, context.Canceled, 1},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		next := &fakeTransport{status: test.status, err: test.err}
+		transport := &RetryTransport{Next: next, Opts: &RetryOpts{Attempts: 3}}
+		req, err := http.NewRequest(test.method, "http://localhost/api", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("Unexpected error creating request: %s", err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if next.attempts != test.attempts {
+			t.Errorf("Expected %d attempts, got: %d", test.attempts, next.attempts)
+		}
+	}
+}
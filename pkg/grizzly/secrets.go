@@ -0,0 +1,149 @@
+package grizzly
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Secrets, e.g. datasource passwords or webhook tokens, are kept out of the
+ * Jsonnet in files encrypted with SOPS (github.com/mozilla/sops). A secrets
+ * file maps the keys of resources to the fields to merge into them:
+ *
+ *   datasource/prometheus:
+ *     secureJsonData:
+ *       basicAuthPassword: hunter2
+ *
+ * Files are decrypted with the sops binary, and merged into resources just
+ * before they are pushed, so that secrets never end up in diffs or state files.
+ */
+
+// Secrets holds the fields to merge into resources, by resource key
+type Secrets map[string]map[string]interface{}
+
+// LoadSecrets decrypts SOPS-encrypted YAML or JSON secrets files. Fields of
+// later files take precedence.
+func LoadSecrets(files []string) (Secrets, error) {
+	secrets := Secrets{}
+	for _, file := range files {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command("sops", "--decrypt", file)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("Error decrypting %s with sops: %v: %s", file, err, strings.TrimSpace(stderr.String()))
+		}
+		decrypted := map[string]map[string]interface{}{}
+		if err := yaml.Unmarshal(stdout.Bytes(), &decrypted); err != nil {
+			return nil, fmt.Errorf("Error parsing %s, expected fields by resource key, e.g. datasource/prometheus: %v", file, err)
+		}
+		for key, fields := range decrypted {
+			secrets[key] = mergeObjects(nil, secrets[key], fields)
+		}
+	}
+	return secrets, nil
+}
+
+// Merge returns a resource with its secrets merged in, reporting whether it
+// has any
+func (s Secrets) Merge(resource Resource) (Resource, bool, error) {
+	fields, ok := s[resource.Key()]
+	if !ok {
+		return resource, false, nil
+	}
+	if !isObject(resource.Detail) {
+		return resource, false, fmt.Errorf("Secrets cannot be merged into %s, which is not an object", resource.Key())
+	}
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return resource, false, err
+	}
+	detail, err := fromObject(mergeObjects(nil, obj, fields), resource.Detail)
+	if err != nil {
+		return resource, false, err
+	}
+	resource.Detail = detail
+	return resource, true, nil
+}
+
+// SecretsBackend resolves references to secrets kept outside of Jsonnet
+type SecretsBackend interface {
+	// Resolve returns the secret a reference points to, without its prefix,
+	// e.g. secret/data/grafana#password for vault:secret/data/grafana#password
+	Resolve(ref string) (string, error)
+}
+
+// secretsBackends holds backends by the prefix of their references
+var secretsBackends = map[string]SecretsBackend{
+	"vault": &VaultBackend{},
+}
+
+// RegisterSecretsBackend resolves references prefixed with scheme: with a
+// backend
+func RegisterSecretsBackend(scheme string, backend SecretsBackend) {
+	secretsBackends[scheme] = backend
+}
+
+// secureField holds the secrets of a resource, e.g. a datasource, in which
+// references to secrets are resolved
+const secureField = "secureJsonData"
+
+// ResolveSecrets returns a resource with the references to secrets in its
+// secureJsonData resolved, reporting whether it has any
+func ResolveSecrets(resource Resource) (Resource, bool, error) {
+	if !isObject(resource.Detail) {
+		return resource, false, nil
+	}
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return resource, false, err
+	}
+	fields, ok := obj[secureField].(map[string]interface{})
+	if !ok {
+		return resource, false, nil
+	}
+	resolved := false
+	for name, value := range fields {
+		ref, ok := value.(string)
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(ref, ":", 2)
+		backend, ok := secretsBackends[parts[0]]
+		if !ok || len(parts) < 2 {
+			continue
+		}
+		secret, err := backend.Resolve(parts[1])
+		if err != nil {
+			return resource, false, fmt.Errorf("Error resolving %s.%s of %s: %v", secureField, name, resource.Key(), err)
+		}
+		fields[name] = secret
+		resolved = true
+	}
+	if !resolved {
+		return resource, false, nil
+	}
+	detail, err := fromObject(obj, resource.Detail)
+	if err != nil {
+		return resource, false, err
+	}
+	resource.Detail = detail
+	return resource, true, nil
+}
+
+// Inject returns a resource ready to be pushed, with its secrets merged in
+// and references to secrets resolved, reporting whether it has any
+func (s Secrets) Inject(resource Resource) (Resource, bool, error) {
+	merged, hasSecrets, err := s.Merge(resource)
+	if err != nil {
+		return resource, false, err
+	}
+	resolved, hasRefs, err := ResolveSecrets(merged)
+	if err != nil {
+		return resource, false, err
+	}
+	return resolved, hasSecrets || hasRefs, nil
+}
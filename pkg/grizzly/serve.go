@@ -0,0 +1,193 @@
+package grizzly
+
+import (
+	"context"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Serving gives a live development environment for resources as code. The
+ * Jsonnet is evaluated, and previews pushed, whenever files change, as with
+ * `grr watch --preview`. A local web server lists the resources, each with its
+ * latest preview and the rendered resource itself.
+ */
+
+// Serve watches a directory tree, previewing resources as they change, and
+// serves an index of the previews, until the context is canceled
+func Serve(ctx context.Context, config Config, watchDir string, parser Parser, opts *ServeOpts) error {
+	s := &server{
+		config:    config,
+		parser:    parser,
+		opts:      opts,
+		resources: map[string]Resource{},
+		reps:      map[string]string{},
+		links:     map[string]PreviewLink{},
+	}
+	s.refresh(ctx)
+
+	listener, err := net.Listen("tcp", opts.Address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/resources/", s.resource)
+	go func() {
+		// closing the listener on return stops serving
+		if err := http.Serve(listener, mux); err != nil && ctx.Err() == nil {
+			config.Notifier.Logf(LogError, "%v", err)
+		}
+	}()
+	config.Notifier.Logf(LogInfo, "Serving previews at http://%s/", listener.Addr())
+
+	return watchChanges(ctx, config.Notifier, watchDir, opts.Debounce, func() {
+		s.refresh(ctx)
+	})
+}
+
+// server holds the latest evaluation of the Jsonnet, and previews of it
+type server struct {
+	config Config
+	parser Parser
+	opts   *ServeOpts
+
+	mu        sync.Mutex
+	resources map[string]Resource
+	reps      map[string]string
+	links     map[string]PreviewLink
+	updated   time.Time
+	err       error
+}
+
+// refresh evaluates the Jsonnet and previews the resources that changed
+func (s *server) refresh(ctx context.Context) {
+	s.config.Notifier.Logf(LogInfo, "Evaluating %s", s.parser.Name())
+	resources, err := s.parser.Parse(s.config)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+	current, err := representations(resources)
+	if err != nil {
+		s.fail(err)
+		return
+	}
+
+	s.mu.Lock()
+	last := s.reps
+	s.mu.Unlock()
+	links, err := preview(ctx, s.config, changedResources(resources, last, current, false), &PreviewOpts{
+		ExpiresSeconds: s.opts.ExpiresSeconds,
+	})
+	if err != nil {
+		s.fail(err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resources = map[string]Resource{}
+	for _, resourceList := range resources {
+		for _, resource := range resourceList {
+			s.resources[resource.Key()] = resource
+		}
+	}
+	for key := range s.links {
+		if _, ok := s.resources[key]; !ok {
+			delete(s.links, key)
+		}
+	}
+	for _, link := range links {
+		s.links[link.Resource] = link
+	}
+	s.reps = current
+	s.updated = time.Now()
+	s.err = nil
+}
+
+func (s *server) fail(err error) {
+	s.config.Notifier.Logf(LogError, "%v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// indexEntry is a resource listed on the index page
+type indexEntry struct {
+	Key string
+	URL string
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Grizzly</title></head>
+<body>
+<h1>Grizzly previews</h1>
+{{with .Error}}<p style="color: red">Error: {{.}}</p>{{end}}
+{{with .Updated}}<p>Updated {{.Format "15:04:05"}}</p>{{end}}
+<table>
+<tr><th>Resource</th><th>Preview</th></tr>
+{{range .Entries}}<tr>
+<td><a href="/resources/{{.Key}}">{{.Key}}</a></td>
+<td>{{with .URL}}<a href="{{.}}">{{.}}</a>{{else}}-{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// index lists the resources, with links to their previews
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	data := struct {
+		Entries []indexEntry
+		Updated *time.Time
+		Error   error
+	}{Error: s.err}
+	if !s.updated.IsZero() {
+		updated := s.updated
+		data.Updated = &updated
+	}
+	for key := range s.resources {
+		data.Entries = append(data.Entries, indexEntry{Key: key, URL: s.links[key].URL})
+	}
+	s.mu.Unlock()
+	sort.Slice(data.Entries, func(i, j int) bool {
+		return data.Entries[i].Key < data.Entries[j].Key
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, data); err != nil {
+		s.config.Notifier.Logf(LogError, "%v", err)
+	}
+}
+
+// resource renders a resource as it was last evaluated
+func (s *server) resource(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/resources/")
+	s.mu.Lock()
+	resource, ok := s.resources[key]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rep, err := resource.GetRepresentation()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(rep))
+}
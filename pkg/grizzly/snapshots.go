@@ -0,0 +1,133 @@
+package grizzly
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+/*
+ * Previews of dashboards are snapshots kept by Grafana, which never expire
+ * unless asked to. Snapshots created by grizzly are named after their
+ * dashboard with a "grizzly: " prefix, so that they can be told apart from
+ * those shared from the Grafana UI, listed with `grr snapshots list`, and
+ * deleted once expired, or old, with `grr snapshots cleanup`.
+ */
+
+// Snapshot is a preview kept at an endpoint
+type Snapshot struct {
+	Key     string    `json:"key" yaml:"key"`
+	Name    string    `json:"name" yaml:"name"`
+	URL     string    `json:"url" yaml:"url"`
+	Created time.Time `json:"created" yaml:"created"`
+	// Expires is unset for snapshots that never expire
+	Expires *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// expired reports whether a snapshot has expired, or, if olderThan is set,
+// was created longer ago
+func (s Snapshot) expired(now time.Time, olderThan time.Duration) bool {
+	if s.Expires != nil && !s.Expires.After(now) {
+		return true
+	}
+	return olderThan > 0 && s.Created.Before(now.Add(-olderThan))
+}
+
+// SnapshotHandler describes a handler whose previews are snapshots kept at its
+// endpoint, which can be listed and deleted
+type SnapshotHandler interface {
+	// ListSnapshots lists the snapshots grizzly created at the endpoint
+	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	// DeleteSnapshot deletes a snapshot, by key
+	DeleteSnapshot(ctx context.Context, key string) error
+}
+
+// snapshotHandlers lists the active handlers that keep snapshots, along with
+// their snapshots, ordered by creation
+func snapshotHandlers(ctx context.Context, config Config) (map[SnapshotHandler][]Snapshot, error) {
+	handlers := map[SnapshotHandler][]Snapshot{}
+	for _, handler := range config.Registry.ActiveHandlers() {
+		snapshotHandler, ok := handler.(SnapshotHandler)
+		if !ok {
+			continue
+		}
+		snapshots, err := snapshotHandler.ListSnapshots(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing %s snapshots: %v", handler.GetName(), err)
+		}
+		sort.Slice(snapshots, func(i, j int) bool {
+			return snapshots[i].Created.Before(snapshots[j].Created)
+		})
+		handlers[snapshotHandler] = snapshots
+	}
+	return handlers, nil
+}
+
+// ListSnapshots outputs the snapshots grizzly created as previews
+func ListSnapshots(ctx context.Context, config Config) error {
+	handlers, err := snapshotHandlers(ctx, config)
+	if err != nil {
+		return err
+	}
+	snapshots := []Snapshot{}
+	for _, handlerSnapshots := range handlers {
+		snapshots = append(snapshots, handlerSnapshots...)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Created.Before(snapshots[j].Created)
+	})
+
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return err
+		}
+		return writeOutput(config.Output, snapshots)
+	}
+	f := "%s\t%s\t%s\t%s\t%s\n"
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, f, "KEY", "NAME", "CREATED", "EXPIRES", "URL")
+	for _, s := range snapshots {
+		expires := "never"
+		if s.Expires != nil {
+			expires = s.Expires.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, f, s.Key, s.Name, s.Created.Format(time.RFC3339), expires, s.URL)
+	}
+	return w.Flush()
+}
+
+// CleanupSnapshots deletes the snapshots grizzly created as previews that have
+// expired, or are older than opts.OlderThan
+func CleanupSnapshots(ctx context.Context, config Config, opts *SnapshotCleanupOpts) error {
+	if opts == nil {
+		opts = &SnapshotCleanupOpts{}
+	}
+	handlers, err := snapshotHandlers(ctx, config)
+	if err != nil {
+		return err
+	}
+	now, deleted := time.Now(), 0
+	for handler, snapshots := range handlers {
+		for _, s := range snapshots {
+			if !s.expired(now, opts.OlderThan) {
+				continue
+			}
+			if opts.DryRun {
+				config.Notifier.Info(nil, fmt.Sprintf("Would delete snapshot %s (%s)", s.Name, s.Key))
+				continue
+			}
+			if err := handler.DeleteSnapshot(ctx, s.Key); err != nil {
+				return fmt.Errorf("Error deleting snapshot %s: %v", s.Key, err)
+			}
+			config.Notifier.Info(nil, fmt.Sprintf("Deleted snapshot %s (%s)", s.Name, s.Key))
+			deleted++
+		}
+	}
+	if !opts.DryRun {
+		config.Notifier.Logf(LogInfo, "Deleted %d snapshot(s)", deleted)
+	}
+	return nil
+}
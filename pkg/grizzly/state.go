@@ -0,0 +1,281 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+ * A state file records the configuration of each resource as last applied by
+ * Grizzly. This allows a three-way merge on apply: fields set in the Jsonnet
+ * are applied, fields removed from the Jsonnet since the last apply are
+ * removed, and all other fields found remotely, e.g. those managed in the
+ * Grafana UI, are kept. Only resources represented as JSON objects are merged.
+ * The state also identifies the resources managed by Grizzly, which limits
+ * pruning to those, and lets resources removed from the Jsonnet be pruned even
+ * when their endpoint cannot list resources, or no resource of their kind is
+ * left. The remote version of versioned resources, e.g. dashboards, is
+ * recorded too, so that applies refuse to overwrite newer versions, e.g. a
+ * hotfix made in the Grafana UI, unless forced.
+ */
+
+// State records the last-applied configuration of resources, by key
+type State struct {
+	path        string
+	mu          sync.Mutex
+	LastApplied map[string]map[string]interface{} `json:"lastApplied"`
+	Versions    map[string]int                    `json:"versions,omitempty"`
+}
+
+// LoadState reads a state file. No state (nil) is returned for an empty path,
+// and an empty state if the file does not exist yet.
+func LoadState(path string) (*State, error) {
+	if path == "" {
+		return nil, nil
+	}
+	state := State{
+		path:        path,
+		LastApplied: map[string]map[string]interface{}{},
+		Versions:    map[string]int{},
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.LastApplied == nil {
+		state.LastApplied = map[string]map[string]interface{}{}
+	}
+	if state.Versions == nil {
+		state.Versions = map[string]int{}
+	}
+	return &state, nil
+}
+
+// Save writes the state file
+func (s *State) Save() error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path, data, 0644)
+}
+
+// Record records a local resource as applied
+func (s *State) Record(resource Resource) error {
+	if s == nil || !isStructured(resource.Detail) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, err := toObject(resource.Detail)
+	if err != nil {
+		return err
+	}
+	s.LastApplied[resource.Key()] = obj
+	return nil
+}
+
+// RecordVersion records the remote version of a resource as applied
+func (s *State) RecordVersion(resource Resource, version int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Versions[resource.Key()] = version
+}
+
+// Version returns the remote version of a resource as last applied, if
+// recorded
+func (s *State) Version(resource Resource) (int, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	version, ok := s.Versions[resource.Key()]
+	return version, ok
+}
+
+// Applied reports whether a resource was applied by Grizzly. Without state,
+// all resources are considered applied.
+func (s *State) Applied(resource Resource) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.LastApplied[resource.Key()]
+	return ok
+}
+
+// Recorded returns the resources of a handler recorded as applied, by key,
+// with only their UID set
+func (s *State) Recorded(handler Handler) ResourceList {
+	recorded := ResourceList{}
+	if s == nil {
+		return recorded
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := handler.GetName() + "/"
+	for key := range s.LastApplied {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		recorded[key] = Resource{
+			UID:      strings.TrimPrefix(key, prefix),
+			Handler:  handler,
+			JSONPath: handler.GetJSONPaths()[0],
+		}
+	}
+	return recorded
+}
+
+// Forget removes a resource deleted from its endpoint from the state
+func (s *State) Forget(resource Resource) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.LastApplied, resource.Key())
+	delete(s.Versions, resource.Key())
+}
+
+// Merge returns a local resource merged with its remote equivalent, using the
+// configuration last applied. Without state, the local resource is returned.
+func (s *State) Merge(handler Handler, existing, resource Resource) (Resource, error) {
+	if s == nil || !isObject(resource.Detail) {
+		return resource, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing.Detail = deepCopy(existing.Detail)
+	remote, err := toObject(handler.Unprepare(existing).Detail)
+	if err != nil {
+		return resource, err
+	}
+	local, err := toObject(resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	merged := mergeObjects(s.LastApplied[resource.Key()], remote, local)
+
+	detail, err := fromObject(merged, resource.Detail)
+	if err != nil {
+		return resource, err
+	}
+	resource.Detail = detail
+	return resource, nil
+}
+
+// Overwrites reports whether applying a local resource would overwrite fields
+// changed remotely since it was last applied. Without state, or a record of
+// the resource, no changes can be identified.
+func (s *State) Overwrites(handler Handler, existing, resource Resource) (bool, error) {
+	if s == nil || !isStructured(resource.Detail) {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastApplied, ok := s.LastApplied[resource.Key()]
+	if !ok {
+		return false, nil
+	}
+	last := resource
+	detail, err := fromObject(lastApplied, resource.Detail)
+	if err != nil {
+		return false, err
+	}
+	last.Detail = detail
+	objects := []map[string]interface{}{}
+	for _, r := range []Resource{last, existing, resource} {
+		r.Detail = deepCopy(r.Detail)
+		obj, err := toObject(handler.Unprepare(r).Detail)
+		if err != nil {
+			return false, err
+		}
+		objects = append(objects, obj)
+	}
+	lastObj, remote, local := objects[0], objects[1], objects[2]
+	for k, v := range lastObj {
+		if !reflect.DeepEqual(remote[k], v) && !reflect.DeepEqual(local[k], remote[k]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mergeObjects merges local fields into remote ones, removing those that were
+// last applied but are no longer set locally. Nested objects are merged, any
+// other value is replaced.
+func mergeObjects(last, remote, local map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for k, v := range remote {
+		if _, wasApplied := last[k]; wasApplied {
+			if _, isLocal := local[k]; !isLocal {
+				continue
+			}
+		}
+		merged[k] = v
+	}
+	for k, v := range local {
+		localObj, localIsObj := v.(map[string]interface{})
+		remoteObj, remoteIsObj := merged[k].(map[string]interface{})
+		if localIsObj && remoteIsObj {
+			lastObj, _ := last[k].(map[string]interface{})
+			merged[k] = mergeObjects(lastObj, remoteObj, localObj)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+// isObject identifies details represented as JSON objects
+func isObject(detail interface{}) bool {
+	return detail != nil && reflect.TypeOf(detail).Kind() == reflect.Map
+}
+
+// isStructured identifies details that can be recorded as JSON objects
+func isStructured(detail interface{}) bool {
+	return isObject(detail) || detail != nil && reflect.TypeOf(detail).Kind() == reflect.Struct
+}
+
+// fromObject converts a JSON object to a detail of the same type as like
+func fromObject(obj map[string]interface{}, like interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	detail := reflect.New(reflect.TypeOf(like))
+	if err := json.Unmarshal(data, detail.Interface()); err != nil {
+		return nil, err
+	}
+	return detail.Elem().Interface(), nil
+}
+
+func toObject(detail interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,132 @@
+package grizzly
+
+import (
+	"reflect"
+	"testing"
+)
+
+// stateTestHandler implements the methods of a handler merging uses, leaving
+// remote resources as they are
+type stateTestHandler struct {
+	Handler
+}
+
+func (h stateTestHandler) GetName() string {
+	return "test"
+}
+
+func (h stateTestHandler) GetJSONPaths() []string {
+	return []string{"tests"}
+}
+
+func (h stateTestHandler) Unprepare(resource Resource) *Resource {
+	return &resource
+}
+
+func TestMergeObjects(t *testing.T) {
+	tests := map[string]struct {
+		last     map[string]interface{}
+		remote   map[string]interface{}
+		local    map[string]interface{}
+		expected map[string]interface{}
+	}{
+		"remote only change is kept": {
+			last:     map[string]interface{}{"title": "Overview"},
+			remote:   map[string]interface{}{"title": "Overview", "refresh": "5s"},
+			local:    map[string]interface{}{"title": "Overview"},
+			expected: map[string]interface{}{"title": "Overview", "refresh": "5s"},
+		},
+		"local change wins": {
+			last:     map[string]interface{}{"title": "Overview"},
+			remote:   map[string]interface{}{"title": "Overview"},
+			local:    map[string]interface{}{"title": "API"},
+			expected: map[string]interface{}{"title": "API"},
+		},
+		"conflicting change is overwritten locally": {
+			last:     map[string]interface{}{"title": "Overview"},
+			remote:   map[string]interface{}{"title": "Hotfix"},
+			local:    map[string]interface{}{"title": "API"},
+			expected: map[string]interface{}{"title": "API"},
+		},
+		"key deleted locally is removed": {
+			last:     map[string]interface{}{"title": "Overview", "refresh": "5s"},
+			remote:   map[string]interface{}{"title": "Overview", "refresh": "5s"},
+			local:    map[string]interface{}{"title": "Overview"},
+			expected: map[string]interface{}{"title": "Overview"},
+		},
+		"key deleted remotely is restored": {
+			last:     map[string]interface{}{"title": "Overview", "refresh": "5s"},
+			remote:   map[string]interface{}{"title": "Overview"},
+			local:    map[string]interface{}{"title": "Overview", "refresh": "5s"},
+			expected: map[string]interface{}{"title": "Overview", "refresh": "5s"},
+		},
+		"nested objects are merged": {
+			last: map[string]interface{}{
+				"time": map[string]interface{}{"from": "now-1h", "to": "now"},
+			},
+			remote: map[string]interface{}{
+				"time": map[string]interface{}{"from": "now-1h", "to": "now", "timezone": "utc"},
+			},
+			local: map[string]interface{}{
+				"time": map[string]interface{}{"from": "now-6h"},
+			},
+			expected: map[string]interface{}{
+				"time": map[string]interface{}{"from": "now-6h", "timezone": "utc"},
+			},
+		},
+		"nothing applied yet": {
+			remote:   map[string]interface{}{"title": "Overview", "id": 1.0},
+			local:    map[string]interface{}{"title": "API"},
+			expected: map[string]interface{}{"title": "API", "id": 1.0},
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		merged := mergeObjects(test.last, test.remote, test.local)
+		if !reflect.DeepEqual(merged, test.expected) {
+			t.Errorf("Expected %v, got: %v", test.expected, merged)
+		}
+	}
+}
+
+func TestStateMerge(t *testing.T) {
+	handler := stateTestHandler{}
+	state := &State{
+		LastApplied: map[string]map[string]interface{}{
+			"test/overview": {"title": "Overview", "refresh": "5s"},
+		},
+	}
+	existing := Resource{UID: "overview", Handler: handler, Detail: map[string]interface{}{
+		"title":   "Hotfix",
+		"refresh": "5s",
+		"editor":  "alice",
+	}}
+	resource := Resource{UID: "overview", Handler: handler, Detail: map[string]interface{}{
+		"title": "API",
+	}}
+
+	merged, err := state.Merge(handler, existing, resource)
+	if err != nil {
+		t.Fatalf("Unexpected error merging: %v", err)
+	}
+	expected := map[string]interface{}{"title": "API", "editor": "alice"}
+	if !reflect.DeepEqual(merged.Detail, expected) {
+		t.Errorf("Expected %v, got: %v", expected, merged.Detail)
+	}
+	if _, ok := existing.Detail.(map[string]interface{})["refresh"]; !ok {
+		t.Errorf("Expected the remote resource to be left unchanged")
+	}
+
+	overwrites, err := state.Overwrites(handler, existing, resource)
+	if err != nil {
+		t.Fatalf("Unexpected error comparing: %v", err)
+	}
+	if !overwrites {
+		t.Errorf("Expected the title changed remotely to be reported as overwritten")
+	}
+
+	var none *State
+	if merged, err := none.Merge(handler, existing, resource); err != nil || !reflect.DeepEqual(merged.Detail, resource.Detail) {
+		t.Errorf("Expected the local resource without state, got: %v, %v", merged.Detail, err)
+	}
+}
@@ -0,0 +1,80 @@
+package grizzly
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// KindSummary counts the outcomes of applying the resources of a kind
+type KindSummary struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Added     int    `json:"added" yaml:"added"`
+	Updated   int    `json:"updated" yaml:"updated"`
+	Unchanged int    `json:"unchanged" yaml:"unchanged"`
+	Deleted   int    `json:"deleted" yaml:"deleted"`
+	Failed    int    `json:"failed" yaml:"failed"`
+}
+
+// ApplySummary counts the outcomes of an apply, by kind
+type ApplySummary map[string]*KindSummary
+
+func (s ApplySummary) kind(kind string) *KindSummary {
+	counts, ok := s[kind]
+	if !ok {
+		counts = &KindSummary{Kind: kind}
+		s[kind] = counts
+	}
+	return counts
+}
+
+// kinds lists the summaries of each kind, ordered by kind
+func (s ApplySummary) kinds() []KindSummary {
+	kinds := []KindSummary{}
+	for _, counts := range s {
+		kinds = append(kinds, *counts)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].Kind < kinds[j].Kind
+	})
+	return kinds
+}
+
+// Changed reports whether any resource was added, updated or deleted
+func (s ApplySummary) Changed() bool {
+	for _, counts := range s {
+		if counts.Added+counts.Updated+counts.Deleted > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// write outputs the summary as a table, one row per kind
+func (s ApplySummary) write(out io.Writer) error {
+	f := "%s\t%v\t%v\t%v\t%v\t%v\n"
+	w := tabwriter.NewWriter(out, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, f, "KIND", "ADDED", "UPDATED", "UNCHANGED", "DELETED", "FAILED")
+	for _, c := range s.kinds() {
+		fmt.Fprintf(w, f, c.Kind, c.Added, c.Updated, c.Unchanged, c.Deleted, c.Failed)
+	}
+	return w.Flush()
+}
+
+// ApplyFailure is a resource, or kind of resources, that failed to apply
+type ApplyFailure struct {
+	Resource string `json:"resource" yaml:"resource"`
+	Error    string `json:"error" yaml:"error"`
+}
+
+// writeFailures outputs the failures of an apply, ordered by resource
+func writeFailures(out io.Writer, failures []ApplyFailure) {
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Resource < failures[j].Resource
+	})
+	fmt.Fprintln(out, red(fmt.Sprintf("%d resource(s) failed to apply:", len(failures))))
+	for _, failure := range failures {
+		fmt.Fprintf(out, "  %s: %s\n", failure.Resource, failure.Error)
+	}
+}
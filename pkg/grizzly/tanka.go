@@ -0,0 +1,88 @@
+package grizzly
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+ * Teams using Tanka (tanka.dev) for Kubernetes can point grizzly at the same
+ * environments, and their Grafana and Prometheus paths are picked out of the
+ * Kubernetes manifests, which are left alone:
+ *
+ *   - the directory of a static environment, holding a spec.json, parses its
+ *     main.jsonnet, as for grizzly environments (see environment.go)
+ *   - inline environments, objects of kind Environment evaluated from Jsonnet,
+ *     parse their data
+ */
+
+const (
+	// tankaAPIVersion is the API version of Tanka environments
+	tankaAPIVersion = "tanka.dev/v1alpha1"
+	// tankaSpec describes a static Tanka environment
+	tankaSpec = "spec.json"
+)
+
+// isTankaEnvironment identifies inline Tanka environments
+func isTankaEnvironment(v interface{}) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	return obj["apiVersion"] == tankaAPIVersion && obj["kind"] == "Environment"
+}
+
+// findTankaEnvironments returns the inline Tanka environments within a JSON
+// value, by name
+func findTankaEnvironments(v interface{}, found map[string]map[string]interface{}) {
+	if isTankaEnvironment(v) {
+		env := v.(map[string]interface{})
+		name := ""
+		if metadata, ok := env["metadata"].(map[string]interface{}); ok {
+			name, _ = metadata["name"].(string)
+		}
+		found[name] = env
+		return
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			findTankaEnvironments(child, found)
+		}
+	case []interface{}:
+		for _, child := range v {
+			findTankaEnvironments(child, found)
+		}
+	}
+}
+
+// tankaData returns the data of the inline Tanka environment of a document,
+// the one named if there are several. ok reports whether the document holds
+// inline environments.
+func tankaData(document interface{}, name string) (data interface{}, ok bool, err error) {
+	envs := map[string]map[string]interface{}{}
+	findTankaEnvironments(document, envs)
+	if len(envs) == 0 {
+		return nil, false, nil
+	}
+	names := []string{}
+	for envName := range envs {
+		names = append(names, envName)
+	}
+	sort.Strings(names)
+	if name == "" {
+		if len(envs) > 1 {
+			return nil, true, fmt.Errorf("Found several Tanka environments, select one with --tanka-env: %s", strings.Join(names, ", "))
+		}
+		name = names[0]
+	}
+	env, found := envs[name]
+	if !found {
+		return nil, true, fmt.Errorf("No Tanka environment named %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	if data, ok := env["data"].(map[string]interface{}); ok {
+		return data, true, nil
+	}
+	return map[string]interface{}{}, true, nil
+}
@@ -0,0 +1,200 @@
+package grizzly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Resources can be rendered as the configuration of Terraform's Grafana
+ * provider, to migrate between grizzly and Terraform in either direction, or
+ * compare both. Handlers render their resources as Terraform resources (see
+ * TerraformHandler), which are written to a grizzly.tf file, along with files
+ * the configuration reads, e.g. the JSON of dashboards. Import blocks adopt
+ * resources already in Grafana, rather than creating them.
+ */
+
+// terraformFile is the file Terraform configuration is written to
+const terraformFile = "grizzly.tf"
+
+// TerraformResource is a resource of a Terraform configuration
+type TerraformResource struct {
+	// Type is the type of the resource, e.g. grafana_dashboard
+	Type string
+	// Name names the resource in the configuration, see TerraformName
+	Name string
+	// Attributes are the values of the arguments of the resource, strings,
+	// numbers and booleans, or TerraformExpr
+	Attributes map[string]interface{}
+	// ImportID identifies an existing resource to import, if it can be
+	ImportID string
+	// Files are written next to the configuration, by path, e.g. the JSON of
+	// dashboards read with file()
+	Files map[string]string
+}
+
+// Address returns the address of a Terraform resource, e.g.
+// grafana_dashboard.my_dash
+func (r TerraformResource) Address() string {
+	return r.Type + "." + r.Name
+}
+
+// TerraformExpr is a Terraform expression, written as is, e.g. a reference to
+// another resource
+type TerraformExpr string
+
+// TerraformJSON returns an expression encoding a value as JSON
+func TerraformJSON(v interface{}) (TerraformExpr, error) {
+	j, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return TerraformExpr("jsonencode(" + escapeTerraformTemplates(string(j)) + ")"), nil
+}
+
+// invalidTerraformName matches characters Terraform does not allow in names
+var invalidTerraformName = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// TerraformName returns a valid Terraform name for a resource, from its UID
+func TerraformName(uid string) string {
+	name := invalidTerraformName.ReplaceAllString(uid, "_")
+	if name == "" || !(name[0] == '_' || (name[0] >= 'A' && name[0] <= 'Z') || (name[0] >= 'a' && name[0] <= 'z')) {
+		name = "_" + name
+	}
+	return name
+}
+
+// escapeTerraformTemplates escapes template sequences, so that strings are
+// written as is, e.g. Grafana variables like ${var}
+func escapeTerraformTemplates(s string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(s)
+}
+
+// terraformValue renders a value of an attribute
+func terraformValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case TerraformExpr:
+		return string(v), nil
+	case string:
+		return escapeTerraformTemplates(strconv.Quote(v)), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("Cannot render %T as a Terraform value", v)
+	}
+}
+
+// TerraformHandler describes a handler whose resources can be rendered as the
+// resources of Terraform's Grafana provider
+type TerraformHandler interface {
+	// Terraform renders a resource, given the resources parsed with it. The
+	// same Terraform resource, e.g. a folder, may be rendered for several.
+	Terraform(resource Resource, resources ResourceList) ([]TerraformResource, error)
+}
+
+// ExportTerraform renders resources as Terraform configuration, written to
+// a directory, with import blocks if imports is set
+func ExportTerraform(config Config, dir string, resources Resources, imports bool) error {
+	rendered := map[string]TerraformResource{}
+	for handler, resourceList := range resources {
+		terraformHandler, ok := handler.(TerraformHandler)
+		for _, resource := range resourceList {
+			if !isStructured(resource.Detail) {
+				// settings of other resources, e.g. the folder of dashboards
+				continue
+			}
+			if !ok {
+				config.Notifier.Warn(&resource, "has no Terraform equivalent, skipped")
+				continue
+			}
+			terraformResources, err := terraformHandler.Terraform(resource, resourceList)
+			if err != nil {
+				return fmt.Errorf("Error rendering %s for Terraform: %v", resource.Key(), err)
+			}
+			for _, r := range terraformResources {
+				rendered[r.Address()] = r
+			}
+		}
+	}
+
+	addresses := []string{}
+	for address := range rendered {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	var buf bytes.Buffer
+	for _, address := range addresses {
+		r := rendered[address]
+		if err := writeTerraformResource(&buf, r); err != nil {
+			return fmt.Errorf("Error rendering %s: %v", address, err)
+		}
+		for path, content := range r.Files {
+			if err := writeFile(filepath.Join(dir, path), content); err != nil {
+				return err
+			}
+		}
+	}
+	if imports {
+		for _, address := range addresses {
+			r := rendered[address]
+			if r.ImportID == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, "import {\n  to = %s\n  id = %s\n}\n\n", address, escapeTerraformTemplates(strconv.Quote(r.ImportID)))
+		}
+	}
+	path := filepath.Join(dir, terraformFile)
+	if err := writeFile(path, strings.TrimSuffix(buf.String(), "\n")); err != nil {
+		return err
+	}
+	config.Notifier.Info(nil, fmt.Sprintf("%d Terraform resources written to %s", len(rendered), path))
+	return nil
+}
+
+// writeTerraformResource writes the block of a resource, aligning its
+// arguments as terraform fmt does
+func writeTerraformResource(buf *bytes.Buffer, r TerraformResource) error {
+	names := []string{}
+	width := 0
+	for name := range r.Attributes {
+		names = append(names, name)
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintf(buf, "resource %q %q {\n", r.Type, r.Name)
+	for _, name := range names {
+		value, err := terraformValue(r.Attributes[name])
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		// nested lines, e.g. of JSON, are indented with the block
+		value = strings.ReplaceAll(value, "\n", "\n  ")
+		fmt.Fprintf(buf, "  %-*s = %s\n", width, name, value)
+	}
+	buf.WriteString("}\n\n")
+	return nil
+}
+
+// writeFile writes a file ending with a newline, creating its directory if
+// needed
+func writeFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
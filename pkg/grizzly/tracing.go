@@ -0,0 +1,345 @@
+package grizzly
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * Tracing records OpenTelemetry spans for commands, Jsonnet evaluations and
+ * every request sent to an endpoint, so that slow applies against large
+ * instances can be profiled. It is configured by the standard environment
+ * variables:
+ *
+ *   - OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or OTEL_EXPORTER_OTLP_ENDPOINT to
+ *     which /v1/traces is appended, enables tracing
+ *   - OTEL_EXPORTER_OTLP_TRACES_HEADERS or OTEL_EXPORTER_OTLP_HEADERS, as
+ *     comma separated name=value pairs, are sent along, e.g. credentials
+ *   - OTEL_SERVICE_NAME names the service, grizzly by default
+ *
+ * Spans are exported with OTLP over HTTP, JSON encoded, once the command
+ * completes or, for long-running commands, after each run. Requests carry a
+ * W3C traceparent header, so that traces continue within Grafana.
+ */
+
+// Kinds of spans, as numbered by OTLP
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// maxSpans bounds the spans kept before they are exported, dropping further
+// ones
+const maxSpans = 10000
+
+// tracer records spans, if tracing is configured
+var tracer *spanTracer
+
+// spanTracer records spans until they are exported to an OTLP endpoint
+type spanTracer struct {
+	endpoint string
+	headers  http.Header
+	service  string
+	version  string
+
+	mu       sync.Mutex
+	active   *Span
+	finished []*Span
+}
+
+// Span is an operation traced, e.g. evaluating a Jsonnet file or a request.
+// The methods of a nil span, as returned when tracing is not configured, do
+// nothing.
+type Span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	kind       int
+	start, end time.Time
+	attributes map[string]interface{}
+	err        string
+	// previous is the span active before this one started
+	previous *Span
+}
+
+// ConfigureTracing enables tracing, if an OTLP endpoint is configured by the
+// environment. Spans are reported as those of the given version of grizzly.
+func ConfigureTracing(version string) error {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		tracer = nil
+		return nil
+	}
+	variable := "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	if _, ok := os.LookupEnv(variable); !ok {
+		variable = "OTEL_EXPORTER_OTLP_HEADERS"
+	}
+	headers, err := ParseHeaders(os.Getenv(variable))
+	if err != nil {
+		return fmt.Errorf("Invalid %s: %v", variable, err)
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "grizzly"
+	}
+	tracer = &spanTracer{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		version:  version,
+	}
+	return nil
+}
+
+// StartSpan starts a span of an operation, within the span active, if any.
+// Until it ends, the span is the one further operations and requests are
+// traced within.
+func StartSpan(name string) *Span {
+	return tracer.start(name, false)
+}
+
+// StartTrace starts a span of an operation as a new trace, e.g. for each run
+// of a long-running command
+func StartTrace(name string) *Span {
+	return tracer.start(name, true)
+}
+
+func (t *spanTracer) start(name string, root bool) *Span {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent := t.active
+	if root {
+		parent = nil
+	}
+	span := t.newSpan(name, spanKindInternal, parent)
+	span.previous = t.active
+	t.active = span
+	return span
+}
+
+// newSpan returns a span within a parent, or a new trace if nil. The tracer
+// must be locked.
+func (t *spanTracer) newSpan(name string, kind int, parent *Span) *Span {
+	span := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: map[string]interface{}{},
+	}
+	if parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		rand.Read(span.traceID[:])
+	}
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// SetAttribute records an attribute of the operation, e.g. the file evaluated
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends the span, recording whether the operation failed
+func (s *Span) End(err error) {
+	if s == nil || tracer == nil {
+		return
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	if tracer.active == s {
+		tracer.active = s.previous
+	}
+	if len(tracer.finished) < maxSpans {
+		tracer.finished = append(tracer.finished, s)
+	}
+}
+
+// spanKey is the key of the span a context carries
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying a span, within which requests
+// sent with the context are traced rather than the span active, e.g. for
+// operations run concurrently
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// traceparent is the W3C trace context header of a span
+func (s *Span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// FlushTracing exports the spans ended so far, if tracing is configured
+func FlushTracing() error {
+	if tracer == nil {
+		return nil
+	}
+	tracer.mu.Lock()
+	spans := tracer.finished
+	tracer.finished = nil
+	tracer.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(tracer.export(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, tracer.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("Error exporting traces: %v", err)
+	}
+	req.Header = tracer.headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	// not traced itself, nor retried
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Error exporting traces: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Error exporting traces: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// export encodes spans as an OTLP export request, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func (t *spanTracer) export(spans []*Span) map[string]interface{} {
+	encoded := []map[string]interface{}{}
+	for _, span := range spans {
+		s := map[string]interface{}{
+			"traceId":           hex.EncodeToString(span.traceID[:]),
+			"spanId":            hex.EncodeToString(span.spanID[:]),
+			"name":              span.name,
+			"kind":              span.kind,
+			"startTimeUnixNano": strconv.FormatInt(span.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.attributes),
+		}
+		if span.parentID != ([8]byte{}) {
+			s["parentSpanId"] = hex.EncodeToString(span.parentID[:])
+		}
+		if span.err != "" {
+			s["status"] = map[string]interface{}{"code": 2, "message": span.err}
+		}
+		encoded = append(encoded, s)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{
+						"service.name":    t.service,
+						"service.version": t.version,
+					}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/grafana/grizzly"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+// otlpAttributes encodes attributes as OTLP key values
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := []interface{}{}
+	for _, key := range keys {
+		var v map[string]interface{}
+		switch value := attributes[key].(type) {
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": v})
+	}
+	return encoded
+}
+
+// TracingTransport traces the requests it sends, within the span of their
+// context if any, or else the span active
+type TracingTransport struct {
+	Next http.RoundTripper
+}
+
+func (t TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tracer == nil {
+		return t.Next.RoundTrip(req)
+	}
+	tracer.mu.Lock()
+	parent, ok := req.Context().Value(spanKey{}).(*Span)
+	if !ok {
+		parent = tracer.active
+	}
+	span := tracer.newSpan(req.Method+" "+req.URL.Path, spanKindClient, parent)
+	tracer.mu.Unlock()
+	// credentials are never part of the URL recorded
+	u := *req.URL
+	u.User = nil
+	u.RawQuery = ""
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", u.String())
+	span.SetAttribute("server.address", req.URL.Hostname())
+
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", span.traceparent())
+	resp, err := t.Next.RoundTrip(req)
+	spanErr := err
+	if err == nil {
+		span.SetAttribute("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= 500 {
+			spanErr = fmt.Errorf("%s", resp.Status)
+		}
+	}
+	span.End(spanErr)
+	return resp, err
+}
@@ -0,0 +1,140 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+/*
+ * Policies applying to every resource of a kind, e.g. that dashboards are not
+ * editable, or follow a tag scheme, can be enforced by transformers listed in
+ * the configuration file, whatever the context:
+ *
+ *   transformers:
+ *   - kind: dashboard
+ *     jsonnet: |
+ *       function(resource) resource { editable: false }
+ *   - kind: dashboard
+ *     jsonnet-file: transformers/tags.jsonnet
+ *   - kind: datasource
+ *     patch:
+ *     - op: add
+ *       path: /jsonData/timeout
+ *       value: 60
+ *
+ * A transformer is either a Jsonnet function of a resource, returning it
+ * transformed, inline or in a file relative to the configuration file, or a
+ * JSON Patch (RFC 6902). Transformers are applied in order to resources as
+ * they are parsed, after the overrides of the context, so that diffs show
+ * what is applied.
+ */
+
+// Transformer transforms every resource of a kind
+type Transformer struct {
+	// Kind is the kind of resources transformed, e.g. dashboard
+	Kind string `yaml:"kind"`
+	// Jsonnet is a function of a resource, returning it transformed
+	Jsonnet string `yaml:"jsonnet,omitempty"`
+	// JsonnetFile holds such a function, relative to the configuration file
+	JsonnetFile string `yaml:"jsonnet-file,omitempty"`
+	// Patch is a JSON Patch applied to resources
+	Patch []PatchOperation `yaml:"patch,omitempty"`
+}
+
+// Transformers are the transformers of a configuration file
+type Transformers struct {
+	List []Transformer
+	// dir is the directory of the configuration file, which Jsonnet files
+	// are relative to
+	dir string
+}
+
+// Transformers returns the transformers of the configuration file
+func (c *ContextConfig) Transformers() Transformers {
+	return Transformers{List: c.TransformerList, dir: filepath.Dir(c.path)}
+}
+
+// Apply transforms the resources of the kind of each transformer
+func (t *Transformers) Apply(resources Resources) error {
+	if t == nil {
+		return nil
+	}
+	for i, transformer := range t.List {
+		transform, err := t.transform(transformer)
+		if err != nil {
+			return fmt.Errorf("Transformer %d of %s: %v", i, transformer.Kind, err)
+		}
+		for _, resourceList := range resources {
+			for key, resource := range resourceList {
+				if resource.Kind() != transformer.Kind || !isStructured(resource.Detail) {
+					continue
+				}
+				obj, err := toObject(resource.Detail)
+				if err != nil {
+					return err
+				}
+				transformed, err := transform(obj)
+				if err != nil {
+					return fmt.Errorf("Error transforming %s with transformer %d: %v", key, i, err)
+				}
+				transformedObj, ok := transformed.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("Error transforming %s with transformer %d: expected an object, got %v", key, i, transformed)
+				}
+				if resource.Detail, err = fromObject(transformedObj, resource.Detail); err != nil {
+					return err
+				}
+				resourceList[key] = resource
+			}
+		}
+	}
+	return nil
+}
+
+// transform returns the function a transformer transforms resources with
+func (t *Transformers) transform(transformer Transformer) (func(map[string]interface{}) (interface{}, error), error) {
+	set := 0
+	for _, isSet := range []bool{transformer.Jsonnet != "", transformer.JsonnetFile != "", len(transformer.Patch) > 0} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("expected one of jsonnet, jsonnet-file or patch")
+	}
+	if len(transformer.Patch) > 0 {
+		return func(obj map[string]interface{}) (interface{}, error) {
+			return applyPatch(obj, transformer.Patch)
+		}, nil
+	}
+
+	filename, snippet := filepath.Join(t.dir, "transformer.jsonnet"), transformer.Jsonnet
+	if transformer.JsonnetFile != "" {
+		filename = transformer.JsonnetFile
+		if !filepath.IsAbs(filename) {
+			filename = filepath.Join(t.dir, filename)
+		}
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		snippet = string(data)
+	}
+	return func(obj map[string]interface{}) (interface{}, error) {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		vm := makeVM(filename, nil)
+		vm.TLACode("resource", string(data))
+		result, err := vm.EvaluateSnippet(filename, snippet)
+		if err != nil {
+			return nil, err
+		}
+		var transformed interface{}
+		err = json.Unmarshal([]byte(result), &transformed)
+		return transformed, err
+	}, nil
+}
@@ -0,0 +1,56 @@
+package grizzly
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+/*
+ * Grafana generates a random UID for dashboards and datasources that do not
+ * declare one, which differs between instances, so that diffs, references and
+ * links break across environments. With --require-uids, parsing fails unless
+ * each resource declares a UID, and with --uid-pattern one that follows a
+ * naming convention, e.g. ^team-[a-z0-9-]+$.
+ */
+
+// checkUIDs fails if resources of the handlers that report declared UIDs do
+// not declare one, or one not matching opts.UIDPattern, if required
+func checkUIDs(resources Resources, opts *ParseOpts) error {
+	if !opts.RequireUIDs && opts.UIDPattern == "" {
+		return nil
+	}
+	var pattern *regexp.Regexp
+	if opts.UIDPattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(opts.UIDPattern); err != nil {
+			return fmt.Errorf("Invalid UID pattern %q: %v", opts.UIDPattern, err)
+		}
+	}
+	violations := []string{}
+	for handler, resourceList := range resources {
+		uidHandler, ok := handler.(UIDHandler)
+		if !ok {
+			continue
+		}
+		for _, resource := range resourceList {
+			// settings, e.g. dashboard folders, are not resources of their own
+			if !isStructured(resource.Detail) {
+				continue
+			}
+			uid := uidHandler.DeclaredUID(resource)
+			switch {
+			case uid == "":
+				violations = append(violations, fmt.Sprintf("%s %s declares no UID", resource.Kind(), resource.location()))
+			case pattern != nil && !pattern.MatchString(uid):
+				violations = append(violations, fmt.Sprintf("%s %s declares UID %q, not matching %s", resource.Kind(), resource.location(), uid, opts.UIDPattern))
+			}
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Strings(violations)
+	return fmt.Errorf("%d resource(s) without a stable UID:\n  %s", len(violations), strings.Join(violations, "\n  "))
+}
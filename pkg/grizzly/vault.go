@@ -0,0 +1,135 @@
+package grizzly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/*
+ * Rather than in encrypted files, secrets can be kept in HashiCorp Vault and
+ * referred to from the secureJsonData of resources, e.g. datasources:
+ *
+ *   secureJsonData: { basicAuthPassword: 'vault:secret/data/grafana#password' }
+ *
+ * References are resolved just before resources are pushed, by reading the
+ * path from the Vault at VAULT_ADDR with VAULT_TOKEN, or the token left by
+ * `vault login`. Paths are those of the HTTP API, i.e. KV v2 paths include
+ * data/.
+ */
+
+// VaultBackend reads secrets from HashiCorp Vault, reading each path once
+type VaultBackend struct {
+	mu    sync.Mutex
+	cache map[string]map[string]interface{}
+}
+
+// Resolve returns the value of a key at a path, referred to as path#key
+func (v *VaultBackend) Resolve(ref string) (string, error) {
+	i := strings.LastIndex(ref, "#")
+	if i < 0 {
+		return "", fmt.Errorf("Expected a Vault reference of the form path#key, got %q", ref)
+	}
+	path, key := ref[:i], ref[i+1:]
+	data, err := v.read(path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("No key %q at %s in Vault", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// read returns the data at a path
+func (v *VaultBackend) read(path string) (map[string]interface{}, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if data, ok := v.cache[path]; ok {
+		return data, nil
+	}
+
+	addr, ok := os.LookupEnv("VAULT_ADDR")
+	if !ok {
+		return nil, fmt.Errorf("Vault address must be set in VAULT_ADDR")
+	}
+	req, err := http.NewRequest("GET", strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace, ok := os.LookupEnv("VAULT_NAMESPACE"); ok {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := HTTPClientFromEnv("VAULT").Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var secret struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []string               `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("Error parsing %s from Vault: %v", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(secret.Errors) > 0 {
+			return nil, fmt.Errorf("Error reading %s from Vault: %s: %s", path, resp.Status, strings.Join(secret.Errors, ", "))
+		}
+		return nil, fmt.Errorf("Error reading %s from Vault: %s", path, resp.Status)
+	}
+
+	data := secret.Data
+	// KV v2 nests the data of a secret alongside its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	if v.cache == nil {
+		v.cache = map[string]map[string]interface{}{}
+	}
+	v.cache[path] = data
+	return data, nil
+}
+
+// vaultToken returns the token set in VAULT_TOKEN, or left by `vault login`
+func vaultToken() (string, error) {
+	if token, ok := os.LookupEnv("VAULT_TOKEN"); ok {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	token, err := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("Vault token must be set in VAULT_TOKEN, or by vault login")
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(token)), nil
+}
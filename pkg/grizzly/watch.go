@@ -0,0 +1,205 @@
+package grizzly
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/fsnotify.v1"
+)
+
+// Watch watches a directory tree for changes then, once changes have settled,
+// pushes the Jsonnet resources that changed to endpoints, or previews them,
+// until the context is canceled
+func Watch(ctx context.Context, config Config, watchDir string, parser Parser, opts *WatchOpts) error {
+	metrics := &watchMetrics{}
+	if opts.MetricsAddress != "" {
+		if err := serveMetrics(config, opts.MetricsAddress, metrics.write); err != nil {
+			return err
+		}
+	}
+	last := map[string]string{}
+	resources, err := parser.Parse(config)
+	if err != nil {
+		config.Notifier.Logf(LogError, "%v", err)
+	} else if last, err = representations(prepareResources(resources)); err != nil {
+		return err
+	}
+
+	return watchChanges(ctx, config.Notifier, watchDir, opts.Debounce, func() {
+		config.Notifier.Logf(LogInfo, "Changes detected. Evaluating %s", parser.Name())
+		changes, err := func() (int, error) {
+			resources, err := parser.Parse(config)
+			if err != nil {
+				return 0, err
+			}
+			resources = prepareResources(resources)
+			current, err := representations(resources)
+			if err != nil {
+				return 0, err
+			}
+			changed := changedResources(resources, last, current, !opts.Preview)
+			if len(changed) == 0 {
+				config.Notifier.Logf(LogInfo, "No resources changed")
+				return 0, nil
+			}
+			if opts.Preview {
+				err = Preview(ctx, config, changed, &PreviewOpts{})
+			} else {
+				err = Apply(ctx, config, changed, &ApplyOpts{})
+			}
+			if err != nil {
+				return 0, err
+			}
+			last = current
+			count := 0
+			for _, resourceList := range changed {
+				count += len(resourceList)
+			}
+			return count, nil
+		}()
+		metrics.record(changes, err)
+		if err != nil {
+			config.Notifier.Logf(LogError, "%v", err)
+		}
+	})
+}
+
+// watchMetrics counts the evaluations of a watch
+type watchMetrics struct {
+	mu          sync.Mutex
+	evaluations int
+	failures    int
+	changed     int
+}
+
+// record counts an evaluation, and the resources it changed
+func (m *watchMetrics) record(changed int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evaluations++
+	if err != nil {
+		m.failures++
+		return
+	}
+	m.changed = changed
+}
+
+func (m *watchMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeMetric(w, "grizzly_watch_evaluations_total", "counter", "Evaluations run as files changed.", m.evaluations)
+	writeMetric(w, "grizzly_watch_evaluation_failures_total", "counter", "Evaluations, or the applies following them, that failed.", m.failures)
+	writeMetric(w, "grizzly_watch_changed_resources", "gauge", "Resources changed by the last successful evaluation.", m.changed)
+}
+
+// watchChanges watches a directory tree, calling onChange once changes have
+// settled for the debounce duration, until the context is canceled
+func watchChanges(ctx context.Context, notifier Notifier, watchDir string, debounce time.Duration, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watchTree(watcher, watchDir); err != nil {
+		return err
+	}
+
+	notifier.Logf(LogInfo, "Watching for changes")
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isHidden(event.Name) {
+				continue
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						notifier.Logf(LogError, "%v", err)
+					}
+				}
+			}
+			settled = time.After(debounce)
+		case <-settled:
+			settled = nil
+			onChange()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			notifier.Logf(LogError, "%v", err)
+		}
+	}
+}
+
+// watchTree watches a directory and all directories within it, other than
+// hidden ones such as .git
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && isHidden(path) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// isHidden identifies hidden files and directories, including editor swap files
+func isHidden(path string) bool {
+	name := filepath.Base(path)
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// representations renders resources, by key
+func representations(resources Resources) (map[string]string, error) {
+	reps := map[string]string{}
+	for _, resourceList := range resources {
+		for key, resource := range resourceList {
+			rep, err := resource.GetRepresentation()
+			if err != nil {
+				return nil, err
+			}
+			reps[key] = rep
+		}
+	}
+	return reps, nil
+}
+
+// changedResources returns the resources whose representation has changed.
+// When applying, multi-resource handlers see all of their resources, if any
+// changed.
+func changedResources(resources Resources, last, current map[string]string, applying bool) Resources {
+	changed := Resources{}
+	for handler, resourceList := range resources {
+		changedList := ResourceList{}
+		for key, resource := range resourceList {
+			if rep, ok := last[key]; !ok || rep != current[key] {
+				changedList[key] = resource
+			}
+		}
+		if len(changedList) == 0 {
+			continue
+		}
+		if applying && isMultiResource(handler) {
+			changedList = resourceList
+		}
+		changed[handler] = changedList
+	}
+	return changed
+}
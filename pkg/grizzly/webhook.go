@@ -0,0 +1,182 @@
+package grizzly
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+ * Rather than polling, as `grr reconcile` does, `grr server` applies when told
+ * to: Git hosts post to /webhook on every push, and the repository is pulled,
+ * evaluated, diffed and applied (see reconcile.go). Pushes arriving during a
+ * run are coalesced into the next one. /status reports the last run as JSON.
+ *
+ * With a secret, webhooks must be signed as GitHub does (X-Hub-Signature-256),
+ * or carry the token as GitLab does (X-Gitlab-Token). Without one, anyone who
+ * can reach /webhook can trigger runs, which is warned about on start.
+ */
+
+// maxWebhookSize bounds the payloads of webhooks
+const maxWebhookSize = 25 << 20
+
+// ServeWebhooks applies resources whenever a webhook is received, and once on
+// start, serving the status of the last run, until the context is canceled
+func ServeWebhooks(ctx context.Context, config Config, parser Parser, opts *WebhookOpts) error {
+	r := &reconciler{
+		config: config,
+		parser: parser,
+		opts: &ReconcileOpts{
+			Repo:  opts.Repo,
+			Ref:   opts.Ref,
+			Dir:   opts.Dir,
+			Prune: opts.Prune,
+		},
+	}
+	trigger := make(chan struct{}, 1)
+	trigger <- struct{}{}
+
+	listener, err := net.Listen("tcp", opts.Address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", webhook(config, opts, trigger))
+	mux.HandleFunc("/status", r.status)
+	mux.HandleFunc("/healthz", r.health)
+	mux.HandleFunc("/metrics", r.metrics)
+	go func() {
+		// closing the listener on return stops serving
+		if err := http.Serve(listener, mux); err != nil && ctx.Err() == nil {
+			config.Notifier.Logf(LogError, "%v", err)
+		}
+	}()
+	config.Notifier.Logf(LogInfo, "Listening for webhooks at http://%s/webhook", listener.Addr())
+	if opts.Secret == "" {
+		config.Notifier.Logf(LogWarn, "No webhook secret set: anyone who can reach /webhook can trigger an apply")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-trigger:
+			r.reconcile(ctx)
+		}
+	}
+}
+
+// webhook queues a run for each push received, unless one is queued already
+func webhook(config Config, opts *WebhookOpts, trigger chan struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Webhooks must be posted", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if opts.Secret != "" && !validWebhook(req, body, opts.Secret) {
+			config.Notifier.Logf(LogWarn, "Rejected a webhook from %s: invalid signature or token", req.RemoteAddr)
+			http.Error(w, "Invalid signature or token", http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("X-GitHub-Event") == "ping" {
+			fmt.Fprintln(w, "pong")
+			return
+		}
+		var push struct {
+			Ref string `json:"ref"`
+		}
+		// payloads other than pushes trigger a run too
+		_ = json.Unmarshal(body, &push)
+		if !matchesRef(push.Ref, opts.Ref) {
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "Ignoring push to %s\n", push.Ref)
+			return
+		}
+		select {
+		case trigger <- struct{}{}:
+			config.Notifier.Logf(LogInfo, "Queued a run for a webhook from %s", req.RemoteAddr)
+		default:
+			// a run is already queued, and will pull this push
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintln(w, "Run queued")
+	}
+}
+
+// validWebhook checks the GitHub signature, or the GitLab token, of a webhook
+func validWebhook(req *http.Request, body []byte, secret string) bool {
+	if signature := req.Header.Get("X-Hub-Signature-256"); signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(signature), []byte(expected))
+	}
+	token := req.Header.Get("X-Gitlab-Token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// matchesRef reports whether a push is to the branch or tag followed. Pushes
+// not naming a ref match any.
+func matchesRef(pushed, ref string) bool {
+	if pushed == "" || ref == "" {
+		return true
+	}
+	return pushed == ref || strings.TrimPrefix(strings.TrimPrefix(pushed, "refs/heads/"), "refs/tags/") == ref
+}
+
+// runStatus describes the last run, as served on /status
+type runStatus struct {
+	Running   bool       `json:"running"`
+	Runs      int        `json:"runs"`
+	Failures  int        `json:"failures"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	Duration  string     `json:"duration,omitempty"`
+	Commit    string     `json:"commit,omitempty"`
+	Succeeded bool       `json:"succeeded"`
+	Drifted   int        `json:"drifted"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// status writes the status of the last run as JSON
+func (r *reconciler) status(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	status := runStatus{
+		Running:   r.running,
+		Runs:      r.runs,
+		Failures:  r.failures,
+		Commit:    r.commit,
+		Succeeded: r.runs > 0 && r.err == nil,
+		Drifted:   r.drifted,
+	}
+	if r.runs > 0 {
+		lastRun := r.lastRun
+		status.LastRun = &lastRun
+		status.Duration = r.duration.String()
+	}
+	if r.err != nil {
+		status.Error = r.err.Error()
+	}
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(status); err != nil {
+		r.config.Notifier.Logf(LogError, "%v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package grizzly
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidWebhook(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]struct {
+		headers map[string]string
+		valid   bool
+	}{
+		"GitHub signature":              {map[string]string{"X-Hub-Signature-256": signature}, true},
+		"GitHub signature of other key": {map[string]string{"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(make([]byte, sha256.Size))}, false},
+		"GitHub signature malformed":    {map[string]string{"X-Hub-Signature-256": strings.TrimPrefix(signature, "sha256=")}, false},
+		"GitLab token":                  {map[string]string{"X-Gitlab-Token": "secret"}, true},
+		"GitLab token wrong":            {map[string]string{"X-Gitlab-Token": "secrets"}, false},
+		"invalid signature with token":  {map[string]string{"X-Hub-Signature-256": "sha256=00", "X-Gitlab-Token": "secret"}, false},
+		"neither":                       {map[string]string{}, false},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		for header, value := range test.headers {
+			req.Header.Set(header, value)
+		}
+		if valid := validWebhook(req, body, "secret"); valid != test.valid {
+			t.Errorf("Expected valid: %v, got: %v", test.valid, valid)
+		}
+	}
+}
+
+func TestMatchesRef(t *testing.T) {
+	tests := map[string]struct {
+		pushed  string
+		ref     string
+		matches bool
+	}{
+		"no ref followed":       {"refs/heads/dev", "", true},
+		"no ref pushed":         {"", "main", true},
+		"branch":                {"refs/heads/main", "main", true},
+		"tag":                   {"refs/tags/v1.0.0", "v1.0.0", true},
+		"full ref":              {"refs/heads/main", "refs/heads/main", true},
+		"other branch":          {"refs/heads/dev", "main", false},
+		"branch with same stem": {"refs/heads/main-next", "main", false},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		if matches := matchesRef(test.pushed, test.ref); matches != test.matches {
+			t.Errorf("Expected %q to match %q: %v, got: %v", test.pushed, test.ref, test.matches, matches)
+		}
+	}
+}
+
+func TestWebhookCoalesces(t *testing.T) {
+	trigger := make(chan struct{}, 1)
+	handler := webhook(Config{}, &WebhookOpts{Ref: "main"}, trigger)
+	post := func(body string) int {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body)))
+		return recorder.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := post(`{"ref":"refs/heads/main"}`); code != http.StatusAccepted {
+			t.Errorf("Expected push %d to be accepted, got: %d", i, code)
+		}
+	}
+	if len(trigger) != 1 {
+		t.Fatalf("Expected pushes during a run to queue a single run, got: %d", len(trigger))
+	}
+	<-trigger
+	if code := post(`{"ref":"refs/heads/dev"}`); code != http.StatusAccepted || len(trigger) != 0 {
+		t.Errorf("Expected a push to another ref to be ignored, got: %d, %d run(s) queued", code, len(trigger))
+	}
+	if code := post(`{"ref":"refs/heads/main"}`); code != http.StatusAccepted || len(trigger) != 1 {
+		t.Errorf("Expected a push once run to queue another run, got: %d, %d run(s) queued", code, len(trigger))
+	}
+}
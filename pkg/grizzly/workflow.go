@@ -1,19 +1,27 @@
 package grizzly
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"text/tabwriter"
+	"text/template"
+	"time"
 
-	"github.com/google/go-jsonnet"
 	"github.com/grafana/grizzly/pkg/term"
-	"github.com/kylelemons/godebug/diff"
+	"github.com/pmezard/go-difflib/difflib"
 	"golang.org/x/crypto/ssh/terminal"
-	"gopkg.in/fsnotify.v1"
 )
 
 var interactive = terminal.IsTerminal(int(os.Stdout.Fd()))
@@ -23,301 +31,1630 @@ func isMultiResource(handler Handler) bool {
 	return ok
 }
 
-// Get retrieves a resource from a remote endpoint using its UID
-func Get(config Config, UID string) error {
-	count := strings.Count(UID, ".")
+// prepareList readies the resources of a handler to be diffed or applied one
+// by one
+func prepareList(handler Handler, resourceList ResourceList) ResourceList {
+	if preparer, ok := handler.(PrepareListHandler); ok {
+		return preparer.PrepareList(resourceList)
+	}
+	return resourceList
+}
+
+// prepareResources readies the resources of all handlers to be diffed or
+// applied one by one
+func prepareResources(resources Resources) Resources {
+	prepared := Resources{}
+	for handler, resourceList := range resources {
+		prepared[handler] = prepareList(handler, resourceList)
+	}
+	return prepared
+}
+
+// Get retrieves resources from their remote endpoints. Each reference is a
+// resource, <kind>/<uid> or <kind>.<uid>, or a kind, whose every resource is
+// retrieved. Resources are written to stdout, or to files as Export writes
+// them if opts.OutputDir is set.
+func Get(ctx context.Context, config Config, refs []string, opts *GetOpts) error {
+	if opts == nil {
+		opts = &GetOpts{}
+	}
+	resources := Resources{}
+	ordered := []Resource{}
+	for _, ref := range refs {
+		handler, uids, err := getRefUIDs(ctx, config, ref)
+		if err != nil {
+			return err
+		}
+		if _, ok := resources[handler]; !ok {
+			resources[handler] = ResourceList{}
+		}
+		for _, uid := range uids {
+			resource, err := handler.GetByUID(ctx, uid)
+			if err != nil {
+				return err
+			}
+			resource = handler.Unprepare(*resource)
+			resources[handler][resource.Key()] = *resource
+			ordered = append(ordered, *resource)
+		}
+	}
+
+	if opts.OutputDir != "" {
+		return Export(config, opts.OutputDir, resources, &ExportOpts{FilenameTemplate: opts.FilenameTemplate})
+	}
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return err
+		}
+		type got struct {
+			Kind   string      `json:"kind" yaml:"kind"`
+			UID    string      `json:"uid" yaml:"uid"`
+			Detail interface{} `json:"detail" yaml:"detail"`
+		}
+		list := []got{}
+		for _, resource := range ordered {
+			list = append(list, got{resource.Kind(), resource.UID, resource.Detail})
+		}
+		// a single resource is output as an object, as it always was
+		if len(refs) == 1 && len(list) == 1 && !isKindRef(config, refs[0]) {
+			return writeOutput(config.Output, list[0])
+		}
+		return writeOutput(config.Output, list)
+	}
+	for _, resource := range ordered {
+		rep, err := resource.GetRepresentation()
+		if err != nil {
+			return err
+		}
+		fmt.Println(rep)
+	}
+	return nil
+}
+
+// isKindRef reports whether a reference passed to Get is a kind, rather than
+// a resource
+func isKindRef(config Config, ref string) bool {
+	_, err := config.Registry.GetHandler(ref)
+	return err == nil
+}
+
+// getRefUIDs returns the handler of a reference passed to Get, and the UIDs
+// of the resources it refers to
+func getRefUIDs(ctx context.Context, config Config, ref string) (Handler, []string, error) {
+	if isKindRef(config, ref) {
+		handler, _ := config.Registry.GetHandler(ref)
+		listHandler, ok := handler.(ListHandler)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s provider does not support listing remote resources", handler.GetName())
+		}
+		summaries, err := listHandler.ListAll(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		uids := []string{}
+		for _, summary := range summaries {
+			uids = append(uids, summary.UID)
+		}
+		sort.Strings(uids)
+		return handler, uids, nil
+	}
+
 	var handlerName, resourceID string
-	if count == 1 {
-		parts := strings.SplitN(UID, ".", 2)
-		handlerName = parts[0]
-		resourceID = parts[1]
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		handlerName, resourceID = parts[0], parts[1]
+	} else if count := strings.Count(ref, "."); count == 1 {
+		parts := strings.SplitN(ref, ".", 2)
+		handlerName, resourceID = parts[0], parts[1]
 	} else if count == 2 {
-		parts := strings.SplitN(UID, ".", 3)
-		handlerName = parts[0] + "." + parts[1]
-		resourceID = parts[2]
+		parts := strings.SplitN(ref, ".", 3)
+		handlerName, resourceID = parts[0]+"."+parts[1], parts[2]
+	} else {
+		return nil, nil, fmt.Errorf("Resource must be <kind>/<uid>, <kind>.<uid> or a kind: %s", ref)
+	}
+	handler, err := config.Registry.GetHandler(handlerName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return handler, []string{resourceID}, nil
+}
+
+// Delete removes a resource from a remote endpoint using its kind and UID
+func Delete(ctx context.Context, config Config, kind, UID string) error {
+	handler, err := config.Registry.GetHandler(kind)
+	if err != nil {
+		return err
+	}
+	resource, err := handler.GetRemote(ctx, UID)
+	if err == ErrNotFound {
+		return fmt.Errorf("%s %s not found", handler.GetName(), UID)
+	} else if err != nil {
+		return err
+	}
+	err = handler.Delete(ctx, UID)
+	if err == ErrNotImplemented {
+		return fmt.Errorf("%s provider does not support delete", handler.GetName())
+	} else if err != nil {
+		return err
+	}
+	config.Notifier.Deleted(*resource)
+	return nil
+}
+
+// List outputs the keys resources found in resulting json.
+func List(config Config, resources Resources) error {
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return err
+		}
+		type listed struct {
+			Handler string `json:"handler" yaml:"handler"`
+			Kind    string `json:"kind" yaml:"kind"`
+			UID     string `json:"uid" yaml:"uid"`
+		}
+		list := []listed{}
+		for handler, resourceList := range resources {
+			for _, r := range resourceList {
+				list = append(list, listed{handler.GetName(), r.Kind(), r.UID})
+			}
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].Kind+"/"+list[i].UID < list[j].Kind+"/"+list[j].UID
+		})
+		return writeOutput(config.Output, list)
+	}
+	f := "%s\t%s\t%s\n"
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+
+	fmt.Fprintf(w, f, "HANDLER", "KIND", "NAME")
+	for handler, resourceList := range resources {
+		for _, r := range resourceList {
+			fmt.Fprintf(w, f, handler.GetName(), r.Kind(), r.UID)
+		}
+	}
+	return w.Flush()
+}
+
+// ListRemote outputs the resources of a kind found at its remote endpoint. With
+// state, whether each resource is managed by Grizzly is shown.
+func ListRemote(ctx context.Context, config Config, kind string) error {
+	handler, err := config.Registry.GetHandler(kind)
+	if err != nil {
+		return err
+	}
+	listHandler, ok := handler.(ListHandler)
+	if !ok {
+		return fmt.Errorf("%s provider does not support listing remote resources", handler.GetName())
+	}
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	summaries, err := listHandler.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UID < summaries[j].UID
+	})
+
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return err
+		}
+		type listed struct {
+			ResourceSummary `yaml:",inline"`
+			Managed         *bool `json:"managed,omitempty" yaml:"managed,omitempty"`
+		}
+		list := []listed{}
+		for _, s := range summaries {
+			l := listed{ResourceSummary: s}
+			if state != nil {
+				managed := state.Applied(Resource{UID: s.UID, Handler: handler})
+				l.Managed = &managed
+			}
+			list = append(list, l)
+		}
+		return writeOutput(config.Output, list)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+	if state == nil {
+		f := "%s\t%s\t%s\n"
+		fmt.Fprintf(w, f, "UID", "TITLE", "FOLDER")
+		for _, s := range summaries {
+			fmt.Fprintf(w, f, s.UID, s.Title, s.Folder)
+		}
+		return w.Flush()
+	}
+	f := "%s\t%s\t%s\t%s\n"
+	fmt.Fprintf(w, f, "UID", "TITLE", "FOLDER", "MANAGED")
+	for _, s := range summaries {
+		managed := "no"
+		if state.Applied(Resource{UID: s.UID, Handler: handler}) {
+			managed = "yes"
+		}
+		fmt.Fprintf(w, f, s.UID, s.Title, s.Folder, managed)
+	}
+	return w.Flush()
+}
+
+// getPrivateElementsScript wraps a Jsonnet file so that the paths of handlers
+// are output even when hidden, if it evaluates to an object. Files evaluating
+// to a function are called with the top-level arguments, as the jsonnet
+// command does.
+func getPrivateElementsScript(jsonnetFile string, handlers []Handler, tlas []string) string {
+	const script = `
+    function(%s)
+    local src = import '%s';
+    local output = if std.isFunction(src) then src(%s) else src;
+    if std.isObject(output) then output + {
+    %s
+    } else output
+	`
+	handlerStrings := []string{}
+	for _, handler := range handlers {
+		for _, jsonPath := range handler.GetJSONPaths() {
+			handlerStrings = append(handlerStrings, fmt.Sprintf("  %s+::: {},", jsonPath))
+		}
+	}
+	args := []string{}
+	for _, tla := range tlas {
+		args = append(args, fmt.Sprintf("%s=%s", tla, tla))
+	}
+	return fmt.Sprintf(script, strings.Join(tlas, ", "), jsonnetFile, strings.Join(args, ", "), strings.Join(handlerStrings, "\n"))
+}
+
+// Parse evaluates a Jsonnet or CUE file, or reads a plain YAML or JSON file,
+// and parses it into an object tree. Given an environment directory, its
+// main.jsonnet is parsed with the targets of its spec.
+func Parse(config Config, jsonnetFile string, opts *ParseOpts) (Resources, error) {
+	if info, err := os.Stat(jsonnetFile); err == nil && info.IsDir() {
+		environment, err := LoadEnvironment(jsonnetFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Notifier.Logf(LogDebug, "Parsing environment %s", environment.Metadata.Name)
+		return Parse(config, filepath.Join(jsonnetFile, environmentMain), environment.parseOpts(opts))
+	}
+	for _, pattern := range append(append([]string{}, opts.Targets...), opts.Excludes...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid target %q: %v", pattern, err)
+		}
+	}
+	selector, err := ParseSelector(opts.Selector)
+	if err != nil {
+		return nil, err
+	}
 
+	var documents []interface{}
+	if isManifestFile(jsonnetFile) {
+		config.Notifier.Logf(LogDebug, "Reading %s", jsonnetFile)
+		if documents, err = readManifests(jsonnetFile); err != nil {
+			return nil, err
+		}
+	} else if isCUEFile(jsonnetFile) {
+		config.Notifier.Logf(LogDebug, "Evaluating %s with cue", jsonnetFile)
+		document, err := evaluateCUE(jsonnetFile)
+		if err != nil {
+			return nil, err
+		}
+		documents = []interface{}{document}
 	} else {
-		return fmt.Errorf("UID must be <provider>.<uid>: %s", UID)
+		config.Notifier.Logf(LogDebug, "Evaluating %s", jsonnetFile)
+		tlas, err := config.Jsonnet.tlaNames()
+		if err != nil {
+			return nil, err
+		}
+		script := getPrivateElementsScript(jsonnetFile, config.Registry.Handlers, tlas)
+		vm := makeVM(jsonnetFile, config.Jsonnet)
+
+		span := StartSpan("jsonnet.evaluate")
+		span.SetAttribute("jsonnet.file", jsonnetFile)
+		result, err := vm.EvaluateSnippet(jsonnetFile, script)
+		span.End(err)
+		if err != nil {
+			return nil, err
+		}
+
+		var document interface{}
+		if err := json.Unmarshal([]byte(result), &document); err != nil {
+			return nil, err
+		}
+		documents = []interface{}{document}
+	}
+
+	resources := Resources{}
+	for i, document := range documents {
+		name := filepath.Base(jsonnetFile)
+		if len(documents) > 1 {
+			name = fmt.Sprintf("%s[%d]", name, i)
+		}
+		documentOpts := *opts
+		documentOpts.source = jsonnetFile
+		if data, ok, err := tankaData(document, opts.TankaEnvironment); err != nil {
+			return nil, err
+		} else if ok {
+			documentOpts.tanka = true
+			document = data
+		}
+		if opts.InterpolateEnv {
+			if msi, ok := document.(map[string]interface{}); ok {
+				for k, v := range msi {
+					if msi[k], err = interpolateValue(k, v); err != nil {
+						return nil, err
+					}
+				}
+			} else if document, err = interpolateValue(name, document); err != nil {
+				return nil, err
+			}
+		}
+		if err := parseDocument(config, resources, name, document, selector, &documentOpts); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.Overrides.Apply(resources); err != nil {
+		return nil, err
+	}
+	if err := config.Transformers.Apply(resources); err != nil {
+		return nil, err
+	}
+	if err := checkUIDs(resources, opts); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// parseDocument parses the resources of the output of Jsonnet, or of a
+// document of a plain file, adding them to those of all handlers
+func parseDocument(config Config, resources Resources, name string, document interface{}, selector Selector, opts *ParseOpts) error {
+	msi, ok := document.(map[string]interface{})
+	if !ok {
+		envelopes, err := findEnvelopes(name, document)
+		if err != nil {
+			return err
+		}
+		if len(envelopes) == 0 {
+			return fmt.Errorf("%s holds no resources", name)
+		}
+		return addEnvelopes(config, resources, envelopes, selector, opts)
+	}
+	if handler := detectHandler(config.Registry, msi); handler != nil {
+		handlerResources, err := handler.Parse(handler.GetJSONPaths()[0], map[string]interface{}{name: msi})
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return addParsed(resources, handler, handlerResources, EnvelopeMetadata{}, selector, opts)
+	}
+
+	others := map[string]interface{}{}
+	for k, v := range msi {
+		if config.Registry.isDisabledPath(k) {
+			config.Notifier.Logf(LogDebug, "Skipping %s, its handler is disabled", k)
+			continue
+		}
+		handler, err := config.Registry.GetHandler(k)
+		if _, isPath := config.Registry.HandlerByPath[k]; err != nil || (opts.tanka && !isPath) {
+			// the components of Tanka environments may be named after
+			// handlers, e.g. prometheus
+			others[k] = v
+			continue
+		}
+		handlerResources, err := handler.Parse(k, v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if err := addParsed(resources, handler, handlerResources, EnvelopeMetadata{}, selector, opts); err != nil {
+			return err
+		}
+	}
+
+	envelopes := []Envelope{}
+	if isEnvelope(others) {
+		found, err := findEnvelopes(name, others)
+		if err != nil {
+			return err
+		}
+		envelopes = found
+	} else {
+		unknown := []string{}
+		for k, v := range others {
+			found, err := findEnvelopes(k, v)
+			if err != nil {
+				return err
+			}
+			if len(found) == 0 && opts.tanka {
+				config.Notifier.Logf(LogDebug, "Skipping %s, not managed by grizzly", k)
+			} else if len(found) == 0 && opts.Strict {
+				unknown = append(unknown, k)
+			} else if len(found) == 0 {
+				config.Notifier.Logf(LogWarn, "Skipping unregistered path %s", k)
+			}
+			envelopes = append(envelopes, found...)
+		}
+		if len(unknown) > 0 {
+			return unknownPathsErr(config.Registry, name, unknown)
+		}
+	}
+	return addEnvelopes(config, resources, envelopes, selector, opts)
+}
+
+// unknownPathsErr reports the paths of a document no handler consumes, in
+// strict mode, suggesting the registered paths they are likely typos of
+func unknownPathsErr(registry Registry, name string, unknown []string) error {
+	sort.Strings(unknown)
+	msgs := []string{}
+	for _, k := range unknown {
+		msg := k
+		best, bestDistance := "", len(k)/3+1
+		for path := range registry.HandlerByPath {
+			if d := editDistance(strings.ToLower(k), strings.ToLower(path)); d < bestDistance || d == bestDistance && best != "" && path < best {
+				best, bestDistance = path, d
+			}
+		}
+		if best != "" {
+			msg += fmt.Sprintf(" (did you mean %s?)", best)
+		}
+		msgs = append(msgs, msg)
+	}
+	return fmt.Errorf("%s holds paths no handler consumes: %s", name, strings.Join(msgs, ", "))
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			current[j] = previous[j-1]
+			if a[i-1] != b[j-1] {
+				current[j]++
+			}
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// addEnvelopes parses the resources of envelopes, adding them to those of all
+// handlers
+func addEnvelopes(config Config, resources Resources, envelopes []Envelope, selector Selector, opts *ParseOpts) error {
+	for _, envelope := range envelopes {
+		if config.Registry.isDisabledPath(envelope.Kind) {
+			config.Notifier.Logf(LogDebug, "Skipping %s %s, its handler is disabled", envelope.Kind, envelope.Metadata.Name)
+			continue
+		}
+		handler, handlerResources, err := parseEnvelope(config.Registry, envelope)
+		if err != nil {
+			return err
+		}
+		if err := addParsed(resources, handler, handlerResources, envelope.Metadata, selector, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addParsed adds the resources parsed by a handler to those of all handlers,
+// if selected
+func addParsed(resources Resources, handler Handler, parsed ResourceList, metadata EnvelopeMetadata, selector Selector, opts *ParseOpts) error {
+	resourceList, ok := resources[handler]
+	if !ok {
+		resourceList = ResourceList{}
+	}
+	for _, resource := range parsed {
+		resource, err := withLabels(resource)
+		if err != nil {
+			return err
+		}
+		resource = withMetadata(resource, metadata)
+		resource.Source = opts.source
+		// settings that are not structured, e.g. dashboard folders, cannot
+		// carry labels, so are kept alongside the resources selected
+		if isStructured(resource.Detail) && !selector.Matches(resource) {
+			continue
+		}
+		if !resource.MatchesTarget(opts.Targets) || len(opts.Excludes) > 0 && resource.MatchesTarget(opts.Excludes) {
+			continue
+		}
+		if err := resourceList.Add(resource); err != nil {
+			return err
+		}
+	}
+	resources[handler] = resourceList
+	return nil
+}
+
+// Show displays resources
+func Show(config Config, resources Resources) error {
+
+	var items []term.PageItem
+	for handler, resourceList := range resources {
+		for _, resource := range resourceList {
+			resource = *(handler.Unprepare(resource))
+
+			rep, err := resource.GetRepresentation()
+			if err != nil {
+				return err
+			}
+			if interactive {
+				items = append(items, term.PageItem{
+					Name:    fmt.Sprintf("%s/%s", resource.Kind(), resource.UID),
+					Content: rep,
+				})
+			} else {
+				fmt.Printf("%s/%s:\n", resource.Kind(), resource.UID)
+				fmt.Println(rep)
+			}
+		}
+	}
+	if interactive {
+		return term.Page(items)
+	}
+	return nil
+}
+
+// UnpreparedRepresentation renders a local resource the way it is compared with
+// its remote equivalent, i.e. after Unprepare, leaving the resource itself as
+// it will be sent to the endpoint
+func UnpreparedRepresentation(handler Handler, resource Resource) (string, error) {
+	resource.Detail = deepCopy(resource.Detail)
+	return handler.Unprepare(resource).GetRepresentation()
+}
+
+// deepCopy copies maps, slices and the exported fields of structs recursively
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// UnifiedDiff returns the differences between the remote and local
+// representations of a resource, as a unified diff
+func UnifiedDiff(resource Resource, remote, local string) string {
+	return unifiedDiff("remote/"+resource.Key(), "local/"+resource.Key(), remote, local)
+}
+
+// unifiedDiff returns the unified diff of two representations, labelled. An
+// empty representation is that of a resource added or removed.
+func unifiedDiff(fromLabel, toLabel, from, to string) string {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(from),
+		B:        diffLines(to),
+		FromFile: fromLabel,
+		ToFile:   toLabel,
+		Context:  3,
+	})
+	if err != nil {
+		// Writing to a string buffer does not fail
+		panic(err)
+	}
+	return diff
+}
+
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return difflib.SplitLines(s)
+}
+
+// Diff compares resources to those at the endpoints. ErrChangesDetected is
+// returned if any resource differs or is missing.
+func Diff(ctx context.Context, config Config, resources Resources, opts *DiffOpts) error {
+	changes, err := diff(ctx, config, resources, opts)
+	if err != nil {
+		return err
+	}
+	if changes > 0 {
+		return ErrChangesDetected
+	}
+	return nil
+}
+
+// diff compares resources to those at the endpoints, returning how many
+// differ
+func diff(ctx context.Context, config Config, resources Resources, opts *DiffOpts) (int, error) {
+	changes := 0
+	config.Notifier.changes = &changes
+	finish, err := diffOutput(&config, opts)
+	if err != nil {
+		return 0, err
+	}
+	config.Notifier.mu = &sync.Mutex{}
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return 0, err
+	}
+
+	refs := newReferences(resources)
+	for handler, resourceList := range resources {
+		if isMultiResource(handler) {
+			multiHandler := handler.(MultiResourceHandler)
+			resourceList, err := refs.resolveList(ctx, resourceList)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return 0, err
+			}
+			if err := multiHandler.Diff(ctx, config.Notifier, resourceList, state); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		err := forEachResource(prepareList(handler, resourceList), fetchParallelism, func(resource Resource) error {
+			return diffResource(ctx, config, handler, resource, state, refs)
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := finish(); err != nil {
+		return 0, err
+	}
+	return changes, nil
+}
+
+// diffOutput sets the Notifier up to record differences for machine-readable
+// or Markdown output, returning the function writing them once diffed
+func diffOutput(config *Config, opts *DiffOpts) (func() error, error) {
+	format := ""
+	if opts != nil {
+		format = opts.Format
+	}
+	if err := checkDiffFormat(format); err != nil {
+		return nil, err
+	}
+	events := []ResourceEvent{}
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return nil, err
+		}
+		config.Notifier.events = &events
+		return func() error {
+			return writeOutput(config.Output, struct {
+				Resources []ResourceEvent `json:"resources" yaml:"resources"`
+			}{events})
+		}, nil
+	}
+	if format == DiffFormatMarkdown {
+		config.Notifier.events = &events
+		return func() error {
+			return writeMarkdownDiff(config.Notifier.output(), events)
+		}, nil
+	}
+	return func() error { return nil }, nil
+}
+
+// diffResource compares a resource with its remote equivalent. References to
+// resources that have not been applied yet are compared unresolved.
+func diffResource(ctx context.Context, config Config, handler Handler, resource Resource, state *State, refs *references) error {
+	resolved, err := refs.resolve(ctx, resource)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	} else if err == nil {
+		resource = resolved
+	}
+	remote, err := handler.GetRemote(ctx, resource.UID)
+	if err == ErrNotFound {
+		config.Notifier.NotFound(resource)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error retrieving resource from %s %s: %v", resource.Kind(), resource.UID, err)
+	}
+	merged, err := state.Merge(handler, *remote, resource)
+	if err != nil {
+		return err
+	}
+	local, err := UnpreparedRepresentation(handler, merged)
+	if err != nil {
+		return err
+	}
+	remote = handler.Unprepare(*remote)
+	remoteRepresentation, err := (*remote).GetRepresentation()
+	if err != nil {
+		return err
+	}
+
+	if local == remoteRepresentation {
+		config.Notifier.NoChanges(resource)
+	} else {
+		difference := UnifiedDiff(resource, remoteRepresentation, local)
+		config.Notifier.HasChanges(resource, difference)
+	}
+	return nil
+}
+
+// Validate checks resources with the handlers that support validation, and
+// optionally their references to other resources
+func Validate(ctx context.Context, config Config, resources Resources, opts *ValidateOpts) error {
+	if err := validate(config, resources, true); err != nil {
+		return err
+	}
+	if opts != nil && opts.CheckReferences != "" {
+		return checkReferences(ctx, config, resources, opts.CheckReferences)
+	}
+	return nil
+}
+
+// validate checks resources, announcing invalid ones, and all other results
+// if verbose. An error is returned if any resource is invalid.
+func validate(config Config, resources Resources, verbose bool) error {
+	invalid := 0
+	for handler, resourceList := range resources {
+		validateHandler, ok := handler.(ValidateHandler)
+		for _, resource := range resourceList {
+			if !ok {
+				if verbose {
+					config.Notifier.NotSupported(resource, "validate")
+				}
+				continue
+			}
+			errs := validateHandler.Validate(resource)
+			if len(errs) == 0 {
+				if verbose {
+					config.Notifier.Info(&resource, "valid")
+				}
+				continue
+			}
+			invalid++
+			// each problem is an announcement, so that it is an event of
+			// machine-readable output
+			for _, err := range errs {
+				config.Notifier.Error(&resource, "invalid: "+err.Error())
+			}
+		}
+	}
+	if invalid > 0 {
+		return fmt.Errorf("%d resource(s) failed validation", invalid)
+	}
+	return nil
+}
+
+// checkReferences announces the resources referring to others that exist
+// neither locally nor remotely, with the handlers that support it. In
+// HealthCheckFail mode, an error is returned if there are any.
+func checkReferences(ctx context.Context, config Config, resources Resources, mode string) error {
+	broken := 0
+	for handler, resourceList := range resources {
+		checkHandler, ok := handler.(ReferenceCheckHandler)
+		if !ok {
+			continue
+		}
+		errs, err := checkHandler.CheckReferences(ctx, prepareList(handler, resourceList), resources)
+		if err != nil {
+			return err
+		}
+		keys := []string{}
+		for key := range errs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resource := resourceList[key]
+			broken++
+			for _, err := range errs[key] {
+				if mode == HealthCheckFail {
+					config.Notifier.Error(&resource, "broken reference: "+err.Error())
+				} else {
+					config.Notifier.Warn(&resource, "broken reference: "+err.Error())
+				}
+			}
+		}
+	}
+	if broken > 0 && mode == HealthCheckFail {
+		return fmt.Errorf("%d resource(s) refer to missing resources", broken)
+	}
+	return nil
+}
+
+// lint checks resources for common mistakes, with the handlers that support it
+func lint(config Config, resources Resources) error {
+	failed := 0
+	for handler, resourceList := range resources {
+		lintHandler, ok := handler.(LintHandler)
+		if !ok {
+			continue
+		}
+		for _, resource := range resourceList {
+			errs := lintHandler.Lint(resource)
+			if len(errs) == 0 {
+				continue
+			}
+			failed++
+			for _, err := range errs {
+				config.Notifier.Warn(&resource, "lint problem: "+err.Error())
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d resource(s) failed linting", failed)
+	}
+	return nil
+}
+
+// Apply validates (and optionally lints) resources, then pushes them to endpoints
+func Apply(ctx context.Context, config Config, resources Resources, opts *ApplyOpts) error {
+	events := []ResourceEvent{}
+	if config.Output != "" {
+		if err := checkOutputFormat(config.Output); err != nil {
+			return err
+		}
+		config.Notifier.events = &events
+	}
+	if err := validate(config, resources, false); err != nil {
+		return err
+	}
+	if opts != nil && opts.Lint {
+		if err := lint(config, resources); err != nil {
+			return err
+		}
+	}
+	if opts != nil && opts.CheckReferences != "" {
+		if err := checkReferences(ctx, config, resources, opts.CheckReferences); err != nil {
+			return err
+		}
+	}
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	var secrets Secrets
+	if opts != nil && len(opts.SecretsFiles) > 0 {
+		if secrets, err = LoadSecrets(opts.SecretsFiles); err != nil {
+			return err
+		}
+	}
+	if err := confirmApply(ctx, config, resources, opts, state); err != nil {
+		return err
+	}
+	summary := ApplySummary{}
+	config.Notifier.summary = summary
+	config.Notifier.mu = &sync.Mutex{}
+	audit := opts != nil && (len(opts.AuditLog) > 0 || len(opts.Notify) > 0)
+	if audit {
+		config.Notifier.audit = auditChanges{}
+	}
+	failures := []ApplyFailure{}
+	config.Notifier.failures = &failures
+	err = apply(ctx, config, resources, opts, state, secrets)
+	if err == nil && len(failures) > 0 {
+		err = fmt.Errorf("%d resource(s) failed to apply", len(failures))
+	}
+	if saveErr := state.Save(); err == nil {
+		err = saveErr
+	}
+	partial := err != nil && summary.Changed()
+	if err == nil {
+		err = postApply(ctx, config, resources, opts)
+	}
+	if audit {
+		record := newAuditRecord(config.Notifier.audit, opts, err)
+		// applies canceled part way are recorded too
+		if auditErr := writeAudit(context.Background(), config, opts.AuditLog, record); err == nil {
+			err = auditErr
+		}
+		if notifyErr := notify(opts.Notify, opts.NotifyOn, record, summary); err == nil {
+			err = notifyErr
+		}
+	}
+
+	selfMetrics.recordApply(summary, err)
+
+	var writeErr error
+	if config.Output != "" {
+		writeErr = writeOutput(config.Output, struct {
+			Resources []ResourceEvent `json:"resources" yaml:"resources"`
+			Summary   []KindSummary   `json:"summary" yaml:"summary"`
+			Failures  []ApplyFailure  `json:"failures,omitempty" yaml:"failures,omitempty"`
+		}{events, summary.kinds(), failures})
+	} else {
+		if len(summary) > 0 {
+			writeErr = summary.write(config.Notifier.output())
+		}
+		if len(failures) > 0 {
+			writeFailures(config.Notifier.output(), failures)
+		}
+	}
+	if err == nil {
+		err = writeErr
+	}
+	if partial {
+		return PartialApplyErr{Err: err}
+	}
+	return err
+}
+
+// confirmApply lists the resources an apply would overwrite, having changed
+// remotely since last applied, or delete when pruning, and asks for
+// confirmation of these
+func confirmApply(ctx context.Context, config Config, resources Resources, opts *ApplyOpts, state *State) error {
+	if opts == nil {
+		opts = &ApplyOpts{}
+	}
+	if opts.Prune {
+		resources = withRecordedHandlers(config, resources, state)
+	}
+	overwrites, deletes := 0, 0
+	for handler, resourceList := range resources {
+		if state != nil {
+			for _, resource := range prepareList(handler, resourceList) {
+				if _, recorded := state.LastApplied[resource.Key()]; !recorded {
+					continue
+				}
+				existing, err := handler.GetRemote(ctx, resource.UID)
+				if err == ErrNotFound {
+					continue
+				} else if err != nil {
+					return err
+				}
+				overwrite, err := state.Overwrites(handler, *existing, resource)
+				if err != nil {
+					return err
+				}
+				if overwrite {
+					config.Notifier.Warn(&resource, "changed remotely since last applied, will be overwritten")
+					overwrites++
+				}
+			}
+		}
+		if opts.Prune {
+			orphans, err := listOrphans(ctx, config, handler, resourceList, state, opts.Mark)
+			if err != nil {
+				return err
+			}
+			for _, resource := range orphans {
+				config.Notifier.Warn(&resource, "not present in Jsonnet, will be deleted")
+			}
+			deletes += len(orphans)
+		}
+	}
+	if overwrites+deletes == 0 || opts.AutoApprove {
+		return nil
+	}
+	return term.Confirm(ctx, fmt.Sprintf("%d resource(s) will be overwritten, %d resource(s) will be deleted.", overwrites, deletes), "yes")
+}
+
+// apply pushes resources to endpoints, recording those applied in the state.
+// Kinds of resources referred to by others are applied first. With
+// ContinueOnError, failures are recorded by the notifier rather than returned.
+func apply(ctx context.Context, config Config, resources Resources, opts *ApplyOpts, state *State, secrets Secrets) error {
+	refs := newReferences(resources)
+	for _, handler := range refs.order(resources) {
+		resourceList := resources[handler]
+		config.Notifier.Logf(LogDebug, "Applying %d %s resource(s)", len(resourceList), handler.GetName())
+		if err := applyHandler(ctx, config, handler, resourceList, opts, state, secrets, refs); err != nil {
+			if continueOnError(opts) {
+				config.Notifier.failed(handler.GetName(), nil, err)
+				continue
+			}
+			if config.Notifier.summary != nil {
+				config.Notifier.summary.kind(handler.GetName()).Failed++
+			}
+			return err
+		}
+	}
+	for handler := range withRecordedHandlers(config, resources, state) {
+		if _, applied := resources[handler]; applied {
+			continue
+		}
+		if err := prune(ctx, config, handler, ResourceList{}, opts, state); err != nil {
+			if continueOnError(opts) {
+				config.Notifier.failed(handler.GetName(), nil, err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func continueOnError(opts *ApplyOpts) bool {
+	return opts != nil && opts.ContinueOnError
+}
+
+// applyHandler pushes the resources of a handler to its endpoint
+func applyHandler(ctx context.Context, config Config, handler Handler, resourceList ResourceList, opts *ApplyOpts, state *State, secrets Secrets, refs *references) error {
+	if isMultiResource(handler) {
+		multiHandler := handler.(MultiResourceHandler)
+		resolved, err := refs.resolveList(ctx, resourceList)
+		if err != nil {
+			return err
+		}
+		if err := multiHandler.Apply(ctx, config.Notifier, resolved, state); err != nil {
+			return err
+		}
+		return prune(ctx, config, handler, resourceList, opts, state)
+	}
+	parallel := 1
+	if opts != nil && opts.Parallel > 1 {
+		parallel = opts.Parallel
+	}
+	err := forEachResource(prepareList(handler, resourceList), parallel, func(resource Resource) error {
+		err := applyResource(ctx, config, handler, resource, state, secrets, opts, refs)
+		if err != nil && continueOnError(opts) {
+			config.Notifier.failed(handler.GetName(), &resource, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return prune(ctx, config, handler, resourceList, opts, state)
+}
+
+// conflictRetries is the number of times a resource that changed remotely while
+// being pushed is fetched and pushed again
+const conflictRetries = 3
+
+// applyResource pushes a resource to its endpoint, retrying with the remote
+// resource fetched again if it changed remotely while being pushed
+func applyResource(ctx context.Context, config Config, handler Handler, resource Resource, state *State, secrets Secrets, opts *ApplyOpts, refs *references) error {
+	resource, err := refs.resolve(ctx, resource)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := pushResource(ctx, config, handler, resource, state, secrets, opts)
+		if !errors.Is(err, ErrConflict) || attempt > conflictRetries {
+			return err
+		}
+		config.Notifier.Logf(LogInfo, "%s changed remotely while being applied, retrying: %v", resource.Key(), err)
+	}
+}
+
+// pushResource pushes a resource to its endpoint, adding or updating it.
+// Resources with secrets are always updated, as endpoints do not return their
+// secrets to compare with, as are those to be marked.
+func pushResource(ctx context.Context, config Config, handler Handler, resource Resource, state *State, secrets Secrets, opts *ApplyOpts) error {
+	existingResource, err := handler.GetRemote(ctx, resource.UID)
+	if err == ErrNotFound {
+		pushed, _, err := secrets.Inject(resource)
+		if err != nil {
+			return err
+		}
+		if err := handler.Add(ctx, markResource(handler, pushed, opts)); err != nil {
+			return err
+		}
+		config.Notifier.Added(resource)
+		if err := recordVersion(ctx, handler, resource, state); err != nil {
+			return err
+		}
+		return state.Record(resource)
+	} else if err != nil {
+		return err
+	}
+	unmarked := opts != nil && opts.Mark && !isMarked(handler, *existingResource)
+	if unmarked && !opts.Adopt {
+		return fmt.Errorf("%s exists but is not marked as managed by grizzly, adopt it with --adopt", resource.Key())
+	}
+	version, versioned := remoteVersion(handler, *existingResource)
+	local := resource
+	resource, err = state.Merge(handler, *existingResource, resource)
+	if err != nil {
+		return err
+	}
+	resourceRepresentation, err := UnpreparedRepresentation(handler, resource)
+	if err != nil {
+		return err
+	}
+	resource = *handler.Prepare(*existingResource, resource)
+	existingResource = handler.Unprepare(*existingResource)
+	existingResourceRepresentation, err := existingResource.GetRepresentation()
+	if err != nil {
+		return err
+	}
+	pushed, hasSecrets, err := secrets.Inject(resource)
+	if err != nil {
+		return err
+	}
+	if resourceRepresentation == existingResourceRepresentation && !hasSecrets && !unmarked {
+		config.Notifier.NoChanges(resource)
+		if versioned {
+			state.RecordVersion(resource, version)
+		}
+	} else {
+		if versioned {
+			if err := checkVersion(resource, version, state, opts); err != nil {
+				return err
+			}
+		}
+		if opts != nil {
+			if err := backupResource(config, opts.BackupDir, *existingResource, existingResourceRepresentation); err != nil {
+				return err
+			}
+		}
+		if config.Notifier.audit != nil {
+			config.Notifier.auditDiff(resource, UnifiedDiff(resource, existingResourceRepresentation, resourceRepresentation))
+		}
+		if err := handler.Update(ctx, *existingResource, markResource(handler, pushed, opts)); err != nil {
+			return err
+		}
+		config.Notifier.Updated(resource)
+		if err := recordVersion(ctx, handler, resource, state); err != nil {
+			return err
+		}
 	}
+	return state.Record(local)
+}
 
-	handler, err := config.Registry.GetHandler(handlerName)
-	if err != nil {
-		return err
+// remoteVersion returns the version of a remote resource, if versioned
+func remoteVersion(handler Handler, remote Resource) (int, bool) {
+	versionHandler, ok := handler.(VersionHandler)
+	if !ok {
+		return 0, false
 	}
+	return versionHandler.Version(remote), true
+}
 
-	resource, err := handler.GetByUID(resourceID)
-	if err != nil {
-		return err
+// checkVersion refuses to overwrite the remote version of a resource if newer
+// than the one last applied, unless forced
+func checkVersion(resource Resource, version int, state *State, opts *ApplyOpts) error {
+	last, ok := state.Version(resource)
+	if !ok || version <= last || (opts != nil && opts.Force) {
+		return nil
 	}
+	return fmt.Errorf("%s was changed remotely since last applied (version %d, last applied %d), overwrite it with --force", resource.Key(), version, last)
+}
 
-	resource = handler.Unprepare(*resource)
-	rep, err := resource.GetRepresentation()
+// recordVersion records the remote version of a resource just pushed, if
+// versioned
+func recordVersion(ctx context.Context, handler Handler, resource Resource, state *State) error {
+	if _, ok := handler.(VersionHandler); !ok || state == nil {
+		return nil
+	}
+	remote, err := handler.GetRemote(ctx, resource.UID)
 	if err != nil {
 		return err
 	}
-
-	fmt.Println(rep)
+	version, _ := remoteVersion(handler, *remote)
+	state.RecordVersion(resource, version)
 	return nil
 }
 
-// List outputs the keys resources found in resulting json.
-func List(config Config, resources Resources) error {
-	f := "%s\t%s\n"
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
+// fetchParallelism is the number of remote resources fetched at once, when
+// diffing or previewing
+const fetchParallelism = 8
 
-	fmt.Fprintf(w, f, "HANDLER", "KIND", "NAME")
-	for handler, resourceList := range resources {
-		for _, r := range resourceList {
-			fmt.Fprintf(w, f, handler.GetName(), r.Kind(), r.UID)
-		}
+// forEachResource calls fn for each resource of a list, running up to parallel
+// calls at once. Once a call fails, no further calls are started, and the first
+// error is returned.
+func forEachResource(resourceList ResourceList, parallel int, fn func(Resource) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
 	}
-	return w.Flush()
-}
-
-func getPrivateElementsScript(jsonnetFile string, handlers []Handler) string {
-	const script = `
-    local src = import '%s';
-    src + {
-    %s
-    }
-	`
-	handlerStrings := []string{}
-	for _, handler := range handlers {
-		for _, jsonPath := range handler.GetJSONPaths() {
-			handlerStrings = append(handlerStrings, fmt.Sprintf("  %s+::: {},", jsonPath))
+	slots := make(chan struct{}, parallel)
+	for _, resource := range resourceList {
+		slots <- struct{}{}
+		if failed() {
+			<-slots
+			break
 		}
+		wg.Add(1)
+		go func(resource Resource) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			if err := fn(resource); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(resource)
 	}
-	return fmt.Sprintf(script, jsonnetFile, strings.Join(handlerStrings, "\n"))
+	wg.Wait()
+	return firstErr
 }
 
-// Parse evaluates a jsonnet file and parses it into an object tree
-func Parse(config Config, jsonnetFile string, targets []string) (Resources, error) {
-
-	script := getPrivateElementsScript(jsonnetFile, config.Registry.Handlers)
-	vm := jsonnet.MakeVM()
-	vm.Importer(newExtendedImporter([]string{"vendor", "lib", "."}))
-
-	result, err := vm.EvaluateSnippet(jsonnetFile, script)
+// prune deletes the remote resources of a handler that are no longer present
+// locally, if requested
+func prune(ctx context.Context, config Config, handler Handler, resourceList ResourceList, opts *ApplyOpts, state *State) error {
+	if opts == nil || !opts.Prune {
+		return nil
+	}
+	orphans, err := listOrphans(ctx, config, handler, resourceList, state, opts.Mark)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return deleteResources(ctx, config, handler, orphans, state, opts.BackupDir)
+}
 
-	msi := map[string]interface{}{}
-	if err := json.Unmarshal([]byte(result), &msi); err != nil {
-		return nil, err
+// listOrphans lists the remote resources of a handler, managed alongside the
+// given local ones, that are not present locally. With state, only resources
+// previously applied are listed, and only marked ones if marked is set.
+func listOrphans(ctx context.Context, config Config, handler Handler, resourceList ResourceList, state *State, marked bool) (ResourceList, error) {
+	pruneHandler, ok := handler.(PruneHandler)
+	if !ok && state == nil {
+		for _, resource := range resourceList {
+			config.Notifier.NotSupported(resource, "prune")
+			break
+		}
+		return nil, nil
 	}
-
-	resources := Resources{}
-
-	for k, v := range msi {
-		handler, err := config.Registry.GetHandler(k)
+	remoteList := ResourceList{}
+	if ok {
+		listed, err := pruneHandler.ListRemote(ctx, resourceList)
 		if err != nil {
-			fmt.Println("Skipping unregistered path", k)
+			return nil, err
+		}
+		remoteList = listed
+	}
+	// resources recorded as applied may be elsewhere, e.g. in a folder no
+	// longer used, or at endpoints that cannot list them
+	for key, recorded := range state.Recorded(handler) {
+		if _, listed := remoteList[key]; listed {
 			continue
 		}
-		handlerResources, err := handler.Parse(k, v)
-		if err != nil {
+		if _, exists := resourceList[key]; exists {
+			continue
+		}
+		remote, err := handler.GetRemote(ctx, recorded.UID)
+		if err == ErrNotFound {
+			state.Forget(recorded)
+			continue
+		} else if err != nil {
 			return nil, err
 		}
-		resourceList, ok := resources[handler]
-		if !ok {
-			resourceList = ResourceList{}
+		remoteList[key] = *remote
+	}
+	orphans := ResourceList{}
+	for key, resource := range remoteList {
+		if _, exists := resourceList[key]; exists || !state.Applied(resource) {
+			continue
 		}
-		for kk, resource := range handlerResources {
-			if resource.MatchesTarget(targets) {
-				resourceList[kk] = resource
-			}
+		if marked && !isMarked(handler, resource) {
+			continue
 		}
-		resources[handler] = resourceList
+		orphans[key] = resource
 	}
-	return resources, nil
+	return orphans, nil
 }
 
-// Show displays resources
-func Show(config Config, resources Resources) error {
-
-	var items []term.PageItem
+// withRecordedHandlers returns resources along with an empty list for each
+// handler that has resources recorded as applied in the state, but none left
+// locally, so that those can be pruned
+func withRecordedHandlers(config Config, resources Resources, state *State) Resources {
+	all := Resources{}
 	for handler, resourceList := range resources {
-		for _, resource := range resourceList {
-			resource = *(handler.Unprepare(resource))
-
-			rep, err := resource.GetRepresentation()
-			if err != nil {
-				return err
-			}
-			if interactive {
-				items = append(items, term.PageItem{
-					Name:    fmt.Sprintf("%s/%s", resource.Kind(), resource.UID),
-					Content: rep,
-				})
-			} else {
-				fmt.Printf("%s/%s:\n", resource.Kind(), resource.UID)
-				fmt.Println(rep)
-			}
-		}
+		all[handler] = resourceList
 	}
-	if interactive {
-		return term.Page(items)
+	for _, handler := range config.Registry.ActiveHandlers() {
+		if _, ok := all[handler]; !ok && len(state.Recorded(handler)) > 0 {
+			all[handler] = ResourceList{}
+		}
 	}
-	return nil
+	return all
 }
 
-// Diff compares resources to those at the endpoints
-func Diff(config Config, resources Resources) error {
-
-	for handler, resourceList := range resources {
-		if isMultiResource(handler) {
-			multiHandler := handler.(MultiResourceHandler)
-			multiHandler.Diff(config.Notifier, resourceList)
-			continue
-		}
-
-		for _, resource := range resourceList {
-			local, err := resource.GetRepresentation()
-			if err != nil {
-				return nil
-			}
-			resource = *handler.Unprepare(resource)
-			uid := resource.UID
-			remote, err := handler.GetRemote(resource.UID)
-			if err == ErrNotFound {
-				config.Notifier.NotFound(resource)
-				continue
-			}
+// deleteResources deletes resources from the endpoint of their handler,
+// backing them up first if backupDir is set
+func deleteResources(ctx context.Context, config Config, handler Handler, resourceList ResourceList, state *State, backupDir string) error {
+	for _, resource := range resourceList {
+		if backupDir != "" {
+			remote, err := handler.GetRemote(ctx, resource.UID)
 			if err != nil {
-				return fmt.Errorf("Error retrieving resource from %s %s: %v", resource.Kind(), uid, err)
+				return fmt.Errorf("Error backing up %s: %v", resource.Key(), err)
 			}
-			remote = handler.Unprepare(*remote)
-			remoteRepresentation, err := (*remote).GetRepresentation()
+			representation, err := UnpreparedRepresentation(handler, *remote)
 			if err != nil {
 				return err
 			}
-
-			if local == remoteRepresentation {
-				config.Notifier.NoChanges(resource)
-			} else {
-				difference := diff.Diff(remoteRepresentation, local)
-				config.Notifier.HasChanges(resource, difference)
+			if err := backupResource(config, backupDir, *remote, representation); err != nil {
+				return err
 			}
 		}
+		if err := handler.Delete(ctx, resource.UID); err != nil {
+			return err
+		}
+		config.Notifier.Deleted(resource)
+		state.Forget(resource)
 	}
 	return nil
 }
 
-// Apply pushes resources to endpoints
-func Apply(config Config, resources Resources) error {
-	for handler, resourceList := range resources {
-		if isMultiResource(handler) {
-			multiHandler := handler.(MultiResourceHandler)
-			multiHandler.Apply(config.Notifier, resourceList)
+// Prune deletes remote resources that are no longer present in the Jsonnet,
+// once confirmed
+func Prune(ctx context.Context, config Config, resources Resources, opts *PruneOpts) error {
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	orphans := Resources{}
+	count := 0
+	for handler, resourceList := range withRecordedHandlers(config, resources, state) {
+		orphanList, err := listOrphans(ctx, config, handler, resourceList, state, opts.Mark)
+		if err != nil {
+			return err
+		}
+		if len(orphanList) == 0 {
 			continue
 		}
-		for _, resource := range resourceList {
-			existingResource, err := handler.GetRemote(resource.UID)
-			if err == ErrNotFound {
+		for _, resource := range orphanList {
+			config.Notifier.Warn(&resource, "not present in Jsonnet, will be deleted")
+		}
+		orphans[handler] = orphanList
+		count += len(orphanList)
+	}
+	if count == 0 {
+		config.Notifier.Info(nil, "Nothing to prune")
+		return nil
+	}
+	if !opts.AutoApprove {
+		if err := term.Confirm(ctx, fmt.Sprintf("%d resource(s) will be deleted.", count), "yes"); err != nil {
+			return err
+		}
+	}
+	for handler, orphanList := range orphans {
+		if err = deleteResources(ctx, config, handler, orphanList, state, opts.BackupDir); err != nil {
+			break
+		}
+	}
+	if saveErr := state.Save(); err == nil {
+		err = saveErr
+	}
+	return err
+}
 
-				err := handler.Add(resource)
-				if err != nil {
-					return err
-				}
-				config.Notifier.Added(resource)
-				continue
-			} else if err != nil {
-				return err
-			}
-			resourceRepresentation, err := resource.GetRepresentation()
-			if err != nil {
-				return err
-			}
-			resource = *handler.Prepare(*existingResource, resource)
-			existingResource = handler.Unprepare(*existingResource)
-			existingResourceRepresentation, err := existingResource.GetRepresentation()
-			if err != nil {
-				return nil
-			}
-			if resourceRepresentation == existingResourceRepresentation {
-				config.Notifier.NoChanges(resource)
-			} else {
-				err = handler.Update(*existingResource, resource)
-				if err != nil {
-					return err
-				}
-				config.Notifier.Updated(resource)
-			}
+// postApply runs the ApplyHooks of all registered providers
+func postApply(ctx context.Context, config Config, resources Resources, opts *ApplyOpts) error {
+	for _, provider := range config.Registry.Providers {
+		hook, ok := provider.(ApplyHook)
+		if !ok {
+			continue
+		}
+		if err := hook.PostApply(ctx, config.Notifier, resources, opts); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
 // Preview pushes resources to endpoints as previews, if supported
-func Preview(config Config, resources Resources, opts *PreviewOpts) error {
-	for handler, resourceList := range resources {
-		for _, resource := range resourceList {
-			err := handler.Preview(resource, config.Notifier, opts)
-			if err == ErrNotImplemented {
-				config.Notifier.NotSupported(resource, "preview")
-			} else if err != nil {
-				return err
-			}
+func Preview(ctx context.Context, config Config, resources Resources, opts *PreviewOpts) error {
+	if opts.Report != "" {
+		if err := checkOutputFormat(opts.ReportFormat); err != nil {
+			return err
+		}
+		if opts.Report == "-" {
+			// keep stdout for the report
+			config.Notifier.out = os.Stderr
 		}
 	}
-	return nil
+	links, err := preview(ctx, config, resources, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Open {
+		openPreviews(config, links)
+	}
+	if opts.Report == "" {
+		return nil
+	}
+	return writePreviewReport(links, opts)
 }
 
-// Parser encapsulates the action of parsing a resource (jsonnet or otherwise)
-type Parser interface {
-	Name() string
-	Parse(config Config) (Resources, error)
+// openPreviews opens the links to previews in the default browser. Failing to
+// do so, e.g. without a desktop, only warns, as the links were printed.
+func openPreviews(config Config, links []PreviewLink) {
+	for _, link := range links {
+		if err := openBrowser(link.URL); err != nil {
+			config.Notifier.Logf(LogWarn, "Unable to open %s in a browser: %v", link.URL, err)
+		}
+	}
+}
+
+// openBrowser opens a URL in the default browser, with the command of the
+// operating system
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	// reap the command once the browser took the URL
+	go cmd.Wait()
+	return nil
 }
 
-// Watch watches a directory for changes then pushes Jsonnet resource to endpoints
-// when changes are noticed
-func Watch(config Config, watchDir string, parser Parser) error {
-	watcher, err := fsnotify.NewWatcher()
+// writePreviewReport writes the links to previews, in a machine-readable format
+func writePreviewReport(links []PreviewLink, opts *PreviewOpts) error {
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Resource < links[j].Resource
+	})
+	report := struct {
+		Previews []PreviewLink `json:"previews" yaml:"previews"`
+	}{links}
+	if opts.Report == "-" {
+		return writeOutput(opts.ReportFormat, report)
+	}
+	data, err := marshalOutput(opts.ReportFormat, report)
 	if err != nil {
 		return err
 	}
-	defer watcher.Close()
+	return ioutil.WriteFile(opts.Report, data, 0644)
+}
 
-	done := make(chan bool)
-	go func() {
-		log.Println("Watching for changes")
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					log.Println("Changes detected. Applying", parser.Name())
-					resources, err := parser.Parse(config)
-					if err != nil {
-						log.Println("Error: ", err)
-					}
-					err = Apply(config, resources)
-					if err != nil {
-						log.Println("Error: ", err)
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Println("error:", err)
+// preview pushes resources to endpoints as previews, returning links to them
+func preview(ctx context.Context, config Config, resources Resources, opts *PreviewOpts) ([]PreviewLink, error) {
+	if opts.Lint {
+		if err := lint(config, resources); err != nil {
+			return nil, err
+		}
+	}
+	links := []PreviewLink{}
+	config.Notifier.previews = &links
+	config.Notifier.mu = &sync.Mutex{}
+	for handler, resourceList := range resources {
+		err := forEachResource(resourceList, fetchParallelism, func(resource Resource) error {
+			var err error
+			if listHandler, ok := handler.(PreviewListHandler); ok {
+				err = listHandler.PreviewList(ctx, resource, resourceList, config.Notifier, opts)
+			} else {
+				err = handler.Preview(ctx, resource, config.Notifier, opts)
+			}
+			if err == ErrNotImplemented {
+				config.Notifier.NotSupported(resource, "preview")
+				return nil
 			}
+			return err
+		})
+		if err != nil {
+			return links, err
+		}
+	}
+	if opts.ImageDir != "" {
+		if err := renderPreviews(ctx, config, resources, links, opts); err != nil {
+			return links, err
+		}
+	}
+	if opts.ExpiresSeconds > 0 {
+		expires := time.Now().Add(time.Duration(opts.ExpiresSeconds) * time.Second).UTC()
+		for i := range links {
+			links[i].Expires = &expires
 		}
-	}()
+	}
+	return links, nil
+}
 
-	err = watcher.Add(watchDir)
-	if err != nil {
+// renderPreviews saves images of the previews of resources that changed, or
+// do not exist remotely, to opts.ImageDir, with the handlers that render them
+func renderPreviews(ctx context.Context, config Config, resources Resources, links []PreviewLink, opts *PreviewOpts) error {
+	if err := os.MkdirAll(opts.ImageDir, 0755); err != nil {
 		return err
 	}
-	<-done
+	handlers := map[string]Handler{}
+	byKey := map[string]Resource{}
+	for handler, resourceList := range resources {
+		for _, resource := range resourceList {
+			handlers[resource.Key()] = handler
+			byKey[resource.Key()] = resource
+		}
+	}
+	for i, link := range links {
+		renderer, ok := handlers[link.Resource].(PreviewRenderer)
+		if !ok {
+			continue
+		}
+		resource := byKey[link.Resource]
+		changed, err := previewChanged(ctx, handlers[link.Resource], resource)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			config.Notifier.Logf(LogDebug, "Not rendering %s, as it is unchanged", link.Resource)
+			continue
+		}
+		image, err := renderer.RenderPreview(ctx, link.URL, opts)
+		if err != nil {
+			return fmt.Errorf("Error rendering preview of %s: %v", link.Resource, err)
+		}
+		file := filepath.Join(opts.ImageDir, strings.ReplaceAll(link.Resource, "/", "-")+".png")
+		if err := ioutil.WriteFile(file, image, 0644); err != nil {
+			return err
+		}
+		links[i].Image = file
+		config.Notifier.Rendered(resource, file)
+	}
 	return nil
 }
 
+// previewChanged reports whether a resource differs from the remote one, or
+// does not exist remotely
+func previewChanged(ctx context.Context, handler Handler, resource Resource) (bool, error) {
+	remote, err := handler.GetRemote(ctx, resource.UID)
+	if err == ErrNotFound {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Error retrieving resource from %s %s: %v", resource.Kind(), resource.UID, err)
+	}
+	local, err := UnpreparedRepresentation(handler, resource)
+	if err != nil {
+		return false, err
+	}
+	remoteRepresentation, err := handler.Unprepare(*remote).GetRepresentation()
+	if err != nil {
+		return false, err
+	}
+	return local != remoteRepresentation, nil
+}
+
+// Parser encapsulates the action of parsing a resource (jsonnet or otherwise)
+type Parser interface {
+	Name() string
+	Parse(config Config) (Resources, error)
+}
+
 // Listen waits for remote changes to a resource and saves them to disk
-func Listen(config Config, UID, filename string) error {
+func Listen(ctx context.Context, config Config, UID, filename string) error {
 	count := strings.Count(UID, ".")
 	var handlerName, resourceID string
 	if count == 1 {
@@ -347,17 +1684,41 @@ func Listen(config Config, UID, filename string) error {
 		config.Notifier.NotSupported(tmpResource, "watch-resource")
 		return nil
 	}
-	return listenHandler.Listen(config.Notifier, resourceID, filename)
+	return listenHandler.Listen(ctx, config.Notifier, resourceID, filename)
 }
 
-// Export renders Jsonnet resources then saves them to a directory
-func Export(config Config, exportDir string, resources Resources) error {
-	if _, err := os.Stat(exportDir); os.IsNotExist(err) {
-		err = os.Mkdir(exportDir, 0755)
-		if err != nil {
-			return err
+// exportFile describes the file a resource is exported to, for filename templates
+type exportFile struct {
+	Kind        string
+	Folder      string
+	FolderTitle string
+	UID         string
+	Filename    string
+	Extension   string
+}
+
+// Export renders Jsonnet resources and saves them to a directory, at paths
+// given by a filename template, or as Grafana provisioning files or ConfigMaps
+func Export(config Config, exportDir string, resources Resources, opts *ExportOpts) error {
+	if opts != nil {
+		switch opts.Format {
+		case "", "files":
+		case "provisioning":
+			return exportProvisioning(config, exportDir, resources, opts)
+		case "configmap":
+			return exportConfigMaps(config, exportDir, resources, opts)
+		default:
+			return fmt.Errorf("Unknown export format %q, expected files, provisioning or configmap", opts.Format)
 		}
 	}
+	filenameTemplate := DefaultExportTemplate
+	if opts != nil && opts.FilenameTemplate != "" {
+		filenameTemplate = opts.FilenameTemplate
+	}
+	tmpl, err := template.New("filename").Option("missingkey=error").Parse(filenameTemplate)
+	if err != nil {
+		return fmt.Errorf("Invalid filename template: %v", err)
+	}
 
 	for handler, resourceList := range resources {
 		for _, resource := range resourceList {
@@ -365,15 +1726,27 @@ func Export(config Config, exportDir string, resources Resources) error {
 			if err != nil {
 				return err
 			}
-			extension := handler.GetExtension()
-			dir := fmt.Sprintf("%s/%s", exportDir, resource.Kind())
-			if _, err := os.Stat(dir); os.IsNotExist(err) {
-				err = os.Mkdir(dir, 0755)
-				if err != nil {
-					return err
-				}
+			file := exportFile{
+				Kind:      resource.Kind(),
+				UID:       resource.UID,
+				Filename:  resource.Filename,
+				Extension: handler.GetExtension(),
+			}
+			if folderHandler, ok := handler.(FolderHandler); ok {
+				file.Folder = folderHandler.GetFolder(resource, resourceList)
+			}
+			file.FolderTitle = file.Folder
+			if titleHandler, ok := handler.(FolderTitleHandler); ok {
+				file.FolderTitle = titleHandler.GetFolderTitle(resource, resourceList)
+			}
+			var name strings.Builder
+			if err := tmpl.Execute(&name, file); err != nil {
+				return fmt.Errorf("Error rendering filename of %s: %v", resource.Key(), err)
+			}
+			path := filepath.Join(exportDir, filepath.Clean("/"+name.String()))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
 			}
-			path := fmt.Sprintf("%s/%s.%s", dir, resource.UID, extension)
 
 			existingResourceBytes, err := ioutil.ReadFile(path)
 			isNotExist := os.IsNotExist(err)
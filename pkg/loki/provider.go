@@ -0,0 +1,26 @@
+package loki
+
+import "github.com/grafana/grizzly/pkg/grizzly"
+
+// Provider defines a Loki Provider. Its handlers send requests to Endpoint
+// if set, or as configured by environment variables.
+type Provider struct {
+	Endpoint *grizzly.Endpoint
+}
+
+// NewProvider returns a new Loki Provider
+func NewProvider() *Provider {
+	return &Provider{}
+}
+
+// GetName returns the name of the Loki provider
+func (p *Provider) GetName() string {
+	return "loki"
+}
+
+// GetHandlers identifies the handlers for the Loki provider
+func (p *Provider) GetHandlers() []grizzly.Handler {
+	return []grizzly.Handler{
+		NewRuleHandler(p.Endpoint),
+	}
+}
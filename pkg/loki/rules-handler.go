@@ -0,0 +1,157 @@
+package loki
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// RuleHandler is a Grizzly Provider for Loki rule groups
+type RuleHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewRuleHandler returns configuration defining a new Loki Provider
+func NewRuleHandler(endpoint *grizzly.Endpoint) *RuleHandler {
+	return &RuleHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *RuleHandler) GetName() string {
+	return "loki"
+}
+
+// GetFullName returns the name for this provider
+func (h *RuleHandler) GetFullName() string {
+	return "loki.rulegroup"
+}
+
+const lokiAlertsPath = "lokiAlerts"
+const lokiRulesPath = "lokiRules"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *RuleHandler) GetJSONPaths() []string {
+	return []string{
+		lokiAlertsPath,
+		lokiRulesPath,
+	}
+}
+
+// GetExtension returns the file name extension for a rule grouping
+func (h *RuleHandler) GetExtension() string {
+	return "yaml"
+}
+
+// Configured returns why the Loki ruler is not configured, if it is not
+func (h *RuleHandler) Configured() error {
+	_, err := getRulerURL(h.endpoint, "")
+	return err
+}
+
+func (h *RuleHandler) newRuleGroupingResource(path string, group RuleGroup) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      group.UID(),
+		Filename: group.UID(),
+		Handler:  h,
+		Detail:   group,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *RuleHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	msi := i.(map[string]interface{})
+	groupings := map[string]RuleGrouping{}
+	err := mapstructure.Decode(msi, &groupings)
+	if err != nil {
+		return nil, err
+	}
+	for k, grouping := range groupings {
+		for _, group := range grouping.Groups {
+			group.Namespace = k
+			resource := h.newRuleGroupingResource(path, group)
+			resource.Labels = grouping.Labels
+			if err := resources.Add(resource); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return resources, nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *RuleHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *RuleHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *RuleHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	group, err := getRemoteRuleGroup(ctx, h.endpoint, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving rule group %s: %v", UID, err)
+	}
+	resource := h.newRuleGroupingResource(lokiAlertsPath, *group)
+	return &resource, nil
+}
+
+// GetRepresentation renders a resource as YAML, with LogQL expressions normalized
+func (h *RuleHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	g := resource.Detail.(RuleGroup)
+	normalized := g.normalized()
+	return normalized.toYAML()
+}
+
+// GetRemoteRepresentation retrieves a rule group as YAML
+func (h *RuleHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	resource, err := h.GetRemote(ctx, uid)
+	if err != nil {
+		return "", err
+	}
+	return h.GetRepresentation(uid, *resource)
+}
+
+// GetRemote retrieves a rule group as a Resource
+func (h *RuleHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	group, err := getRemoteRuleGroup(ctx, h.endpoint, uid)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newRuleGroupingResource("", *group)
+	return &resource, nil
+}
+
+// Add pushes a rule group to the Loki ruler
+func (h *RuleHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	g := resource.Detail.(RuleGroup)
+	return writeRuleGroup(ctx, h.endpoint, g)
+}
+
+// Update pushes a rule group to the Loki ruler
+func (h *RuleHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	g := resource.Detail.(RuleGroup)
+	return writeRuleGroup(ctx, h.endpoint, g)
+}
+
+// Delete removes a rule group from the Loki ruler
+func (h *RuleHandler) Delete(ctx context.Context, UID string) error {
+	return deleteRuleGroup(ctx, h.endpoint, UID)
+}
+
+// GetFolder returns the namespace of a rule group
+func (h *RuleHandler) GetFolder(resource grizzly.Resource, resources grizzly.ResourceList) string {
+	return resource.Detail.(RuleGroup).Namespace
+}
+
+// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
+func (h *RuleHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return grizzly.ErrNotImplemented
+}
@@ -0,0 +1,290 @@
+package loki
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/grafana/loki/pkg/logql"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Rule groups are pushed to the Loki ruler API, on behalf of the tenant given
+ * by LOKI_TENANT_ID. Loki may store and return LogQL expressions formatted
+ * differently to how they were written, so expressions are parsed with Loki's
+ * LogQL parser, and compared as Loki prints them. Expressions it cannot parse
+ * are compared with their whitespace normalized.
+ */
+
+const rulerAPIPath = "loki/api/v1/rules"
+
+// getRemoteRuleGroup retrieves a rule group from the Loki ruler
+func getRemoteRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*RuleGroup, error) {
+	namespace, name, err := parseRuleGroupUID(uid)
+	if err != nil {
+		return nil, err
+	}
+	urlPath := fmt.Sprintf("%s/%s/%s", rulerAPIPath, url.PathEscape(namespace), url.PathEscape(name))
+	out, err := rulerRequest(ctx, endpoint, "GET", urlPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	var group RuleGroup
+	if err := yaml.Unmarshal(out, &group); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	group.Namespace = namespace
+	return &group, nil
+}
+
+// parseRuleGroupUID splits a UID into namespace and group name
+func parseRuleGroupUID(uid string) (namespace, name string, err error) {
+	parts := strings.SplitN(uid, "-", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("Rule group UID must be <namespace>-<name>: %s", uid)
+	}
+	return parts[0], parts[1], nil
+}
+
+// RuleGroup encapsulates a list of rules
+type RuleGroup struct {
+	Namespace string                   `yaml:"-"`
+	Name      string                   `yaml:"name"`
+	Rules     []map[string]interface{} `yaml:"rules"`
+}
+
+// UID retrieves the UID from a rule group
+func (g *RuleGroup) UID() string {
+	return fmt.Sprintf("%s-%s", g.Namespace, g.Name)
+}
+
+// toYAML returns YAML for a rule group
+func (g *RuleGroup) toYAML() (string, error) {
+	y, err := yaml.Marshal(g)
+	if err != nil {
+		return "", err
+	}
+	return string(y), nil
+}
+
+// normalized returns a copy of the rule group with LogQL expressions normalized
+func (g *RuleGroup) normalized() RuleGroup {
+	group := *g
+	group.Rules = []map[string]interface{}{}
+	for _, rule := range g.Rules {
+		r := map[string]interface{}{}
+		for k, v := range rule {
+			r[k] = v
+		}
+		if expr, ok := r["expr"].(string); ok {
+			r["expr"] = normalizeLogQL(expr)
+		}
+		group.Rules = append(group.Rules, r)
+	}
+	return group
+}
+
+// RuleGrouping encapsulates a set of named rule groups
+type RuleGrouping struct {
+	Namespace string      `json:"namespace"`
+	Groups    []RuleGroup `json:"groups"`
+	// Labels are the grizzly labels of the rule groups in this namespace
+	Labels map[string]string `json:"grizzlyLabels,omitempty" mapstructure:"grizzlyLabels"`
+}
+
+func writeRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, group RuleGroup) error {
+	out, err := group.toYAML()
+	if err != nil {
+		return err
+	}
+	urlPath := fmt.Sprintf("%s/%s", rulerAPIPath, url.PathEscape(group.Namespace))
+	if _, err := rulerRequest(ctx, endpoint, "POST", urlPath, []byte(out)); err != nil {
+		return fmt.Errorf("Error while applying rule group '%s': %v", group.UID(), err)
+	}
+	return nil
+}
+
+func deleteRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, uid string) error {
+	namespace, name, err := parseRuleGroupUID(uid)
+	if err != nil {
+		return err
+	}
+	urlPath := fmt.Sprintf("%s/%s/%s", rulerAPIPath, url.PathEscape(namespace), url.PathEscape(name))
+	if _, err := rulerRequest(ctx, endpoint, "DELETE", urlPath, nil); err != nil {
+		return fmt.Errorf("Error while deleting rule group '%s': %v", uid, err)
+	}
+	return nil
+}
+
+// normalizeLogQL formats a LogQL expression as Loki prints it once parsed,
+// with the label matchers of each selector sorted, so that equivalent
+// expressions are equal however they were written
+func normalizeLogQL(expr string) string {
+	parsed, err := logql.ParseExpr(expr)
+	if err != nil {
+		return normalizeWhitespace(expr)
+	}
+	return sortMatchers(parsed.String())
+}
+
+// sortMatchers sorts the label matchers of the selectors of an expression, as
+// printed by Loki: braces outside strings only delimit selectors, and commas
+// within them only separate matchers
+func sortMatchers(expr string) string {
+	var b, matcher strings.Builder
+	var matchers []string
+	var quote rune
+	escaped, inSelector := false, false
+	for _, r := range expr {
+		out := &b
+		if inSelector {
+			out = &matcher
+		}
+		if quote != 0 {
+			out.WriteRune(r)
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\' && quote != '`':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case r == '"' || r == '`':
+			quote = r
+			out.WriteRune(r)
+		case r == '{':
+			inSelector = true
+			b.WriteRune(r)
+		case inSelector && (r == ',' || r == '}'):
+			matchers = append(matchers, matcher.String())
+			matcher.Reset()
+			if r == '}' {
+				sort.Strings(matchers)
+				b.WriteString(strings.Join(matchers, ","))
+				b.WriteRune(r)
+				matchers = nil
+				inSelector = false
+			}
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// normalizeWhitespace normalizes the whitespace of a LogQL expression, leaving
+// string literals untouched: runs of whitespace become a single space, and
+// whitespace next to brackets and commas is removed
+func normalizeWhitespace(expr string) string {
+	var b strings.Builder
+	var quote, last rune
+	escaped := false
+	pendingSpace := false
+	for _, r := range strings.TrimSpace(expr) {
+		if quote != 0 {
+			b.WriteRune(r)
+			last = r
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\' && quote != '`':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			pendingSpace = true
+			continue
+		case strings.ContainsRune("(){}[],", r):
+			pendingSpace = false
+		case pendingSpace && !strings.ContainsRune("({[,", last):
+			b.WriteRune(' ')
+			pendingSpace = false
+		default:
+			pendingSpace = false
+		}
+		if r == '"' || r == '`' {
+			quote = r
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+func getRulerURL(endpoint *grizzly.Endpoint, urlPath string) (string, error) {
+	if endpoint != nil {
+		return endpoint.JoinURL(urlPath)
+	}
+	address, exists := os.LookupEnv("LOKI_ADDRESS")
+	if !exists {
+		return "", fmt.Errorf("Require LOKI_ADDRESS (optionally LOKI_TENANT_ID & LOKI_TOKEN)")
+	}
+	if _, err := url.Parse(address); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(address, "/") + "/" + urlPath, nil
+}
+
+func rulerRequest(ctx context.Context, endpoint *grizzly.Endpoint, method, urlPath string, body []byte) ([]byte, error) {
+	rulerURL, err := getRulerURL(endpoint, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rulerURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/yaml")
+
+	tenant := os.Getenv("LOKI_TENANT_ID")
+	if tenant != "" {
+		req.Header.Add("X-Scope-OrgID", tenant)
+	}
+	if err := grizzly.SetAuthFromEnv(req, "LOKI", tenant); err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	if endpoint != nil {
+		resp, err = endpoint.Do(req)
+	} else {
+		resp, err = grizzly.HTTPClientFromEnv("LOKI").Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("Non-200 response from Loki ruler: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,86 @@
+package loki
+
+import (
+	"testing"
+)
+
+func TestNormalizeLogQL(t *testing.T) {
+	tests := map[string]struct {
+		a string
+		b string
+	}{
+		"line breaks and indentation": {
+			"sum by (job) (\n  rate({app=\"api\"} |= \"error\" [5m])\n) > 0",
+			"sum by(job)(rate({app=\"api\"} |= \"error\"[5m])) > 0",
+		},
+		"spaces in selectors": {
+			`count_over_time({ app = "api", env="prod" }[1m])`,
+			`count_over_time({app = "api",env="prod"}[1m])`,
+		},
+		"surrounding whitespace": {
+			"  rate({app=\"api\"}[5m])\n",
+			`rate({app="api"}[5m])`,
+		},
+		"spaces around operators": {
+			`{app = "api"} |= "error"`,
+			`{app="api"}|="error"`,
+		},
+		"label matcher order": {
+			`count_over_time({env="prod", app=~"api|web", team!="search"}[1m])`,
+			`count_over_time({team!="search", app=~"api|web", env="prod"}[1m])`,
+		},
+		"by placement": {
+			`sum by (job, app) (rate({app="api"}[5m]))`,
+			`sum(rate({app="api"}[5m])) by (job, app)`,
+		},
+		"unparsable expressions": {
+			"sum by (job) (\n  rate({app=\"api\"} |= \"error\" [5m] offset)\n)",
+			`sum by(job)(rate({app="api"} |= "error"[5m] offset))`,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		a, b := normalizeLogQL(test.a), normalizeLogQL(test.b)
+		if a != b {
+			t.Errorf("Expected %q and %q to normalize equally, got: %q and %q", test.a, test.b, a, b)
+		}
+	}
+
+	different := map[string]struct {
+		a string
+		b string
+	}{
+		"string literals": {
+			`{app="api"} |= "two  spaces ( )"`,
+			`{app="api"} |= "two spaces ()"`,
+		},
+		"label values": {
+			`{app="api", env="prod"}`,
+			`{app="prod", env="api"}`,
+		},
+		"grouping labels": {
+			`sum by (job) (rate({app="api"}[5m]))`,
+			`sum by (app) (rate({app="api"}[5m]))`,
+		},
+	}
+	for testName, test := range different {
+		t.Logf("Running test case, %q...", testName)
+		if a, b := normalizeLogQL(test.a), normalizeLogQL(test.b); a == b {
+			t.Errorf("Expected %q and %q to differ, got: %q", test.a, test.b, a)
+		}
+	}
+
+	literal := "{app=\"api\"} |= \"two  spaces ( )\" |~ `a   b` offset"
+	expected := "{app=\"api\"} |= \"two  spaces ( )\" |~ `a   b` offset"
+	if got := normalizeLogQL(literal); got != expected {
+		t.Errorf("Expected string literals of unparsable expressions to be left untouched, got: %q", got)
+	}
+}
+
+func TestSortMatchers(t *testing.T) {
+	expr := `sum(count_over_time({team="a,b",app="}"} |= "{z=\"1\",a=\"2\"}"[1m])) / sum(count_over_time({b="1",a="2"}[1m]))`
+	expected := `sum(count_over_time({app="}",team="a,b"} |= "{z=\"1\",a=\"2\"}"[1m])) / sum(count_over_time({a="2",b="1"}[1m]))`
+	if got := sortMatchers(expr); got != expected {
+		t.Errorf("Expected %q, got: %q", expected, got)
+	}
+}
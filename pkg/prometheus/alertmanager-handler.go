@@ -0,0 +1,175 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/mitchellh/mapstructure"
+)
+
+// AlertmanagerHandler is a Grizzly Provider for Cortex/Mimir Alertmanager configuration
+type AlertmanagerHandler struct {
+	endpoint *grizzly.Endpoint
+}
+
+// NewAlertmanagerHandler returns configuration defining a new Alertmanager Provider
+func NewAlertmanagerHandler(endpoint *grizzly.Endpoint) *AlertmanagerHandler {
+	return &AlertmanagerHandler{endpoint: endpoint}
+}
+
+// GetName returns the name for this provider
+func (h *AlertmanagerHandler) GetName() string {
+	return "alertmanager"
+}
+
+// GetFullName returns the name for this provider
+func (h *AlertmanagerHandler) GetFullName() string {
+	return "prometheus.alertmanager"
+}
+
+const alertmanagerPath = "prometheusAlertmanager"
+
+// GetJSONPaths returns paths within Jsonnet output that this provider will consume
+func (h *AlertmanagerHandler) GetJSONPaths() []string {
+	return []string{
+		alertmanagerPath,
+	}
+}
+
+// GetExtension returns the file name extension for an Alertmanager configuration
+func (h *AlertmanagerHandler) GetExtension() string {
+	return "yaml"
+}
+
+// Configured returns why the Alertmanager is not configured, if it is not
+func (h *AlertmanagerHandler) Configured() error {
+	_, err := getCortexURL(h.endpoint, "")
+	return err
+}
+
+func (h *AlertmanagerHandler) newAlertmanagerResource(path string, config AlertmanagerConfig) grizzly.Resource {
+	resource := grizzly.Resource{
+		UID:      config.UID(),
+		Filename: config.UID(),
+		Handler:  h,
+		Detail:   config,
+		JSONPath: path,
+	}
+	return resource
+}
+
+// ParseSpec parses the spec of an envelope, which holds the configuration
+// of the tenant, as its path does
+func (h *AlertmanagerHandler) ParseSpec(name string, spec interface{}) (grizzly.ResourceList, error) {
+	return h.Parse(alertmanagerPath, spec)
+}
+
+// Parse parses an interface{} object into a struct for this resource type
+func (h *AlertmanagerHandler) Parse(path string, i interface{}) (grizzly.ResourceList, error) {
+	resources := grizzly.ResourceList{}
+	if msi, ok := i.(map[string]interface{}); ok && len(msi) == 0 {
+		// the path is always present, empty when no configuration is given
+		return resources, nil
+	}
+	config := AlertmanagerConfig{}
+	err := mapstructure.Decode(i, &config)
+	if err != nil {
+		return nil, err
+	}
+	if config.TemplateFiles == nil {
+		config.TemplateFiles = map[string]string{}
+	}
+	if config.Config == nil {
+		return nil, fmt.Errorf("%s requires an alertmanager_config", path)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	resource := h.newAlertmanagerResource(path, config)
+	resources[resource.Key()] = resource
+	return resources, nil
+}
+
+// Validate checks an Alertmanager configuration and its templates
+func (h *AlertmanagerHandler) Validate(resource grizzly.Resource) []error {
+	c := resource.Detail.(AlertmanagerConfig)
+	if err := c.validate(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
+func (h *AlertmanagerHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// Prepare gets a resource ready for dispatch to the remote endpoint
+func (h *AlertmanagerHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Resource {
+	return &resource
+}
+
+// GetByUID retrieves JSON for a resource from an endpoint, by UID
+func (h *AlertmanagerHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	resource, err := h.GetRemote(ctx, UID)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving Alertmanager configuration %s: %v", UID, err)
+	}
+	return resource, nil
+}
+
+// GetRepresentation renders a resource as JSON or YAML as appropriate
+func (h *AlertmanagerHandler) GetRepresentation(uid string, resource grizzly.Resource) (string, error) {
+	c := resource.Detail.(AlertmanagerConfig)
+	return c.toYAML()
+}
+
+// GetRemoteRepresentation retrieves an Alertmanager configuration as YAML
+func (h *AlertmanagerHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	config, err := getRemoteAlertmanagerConfig(ctx, h.endpoint)
+	if err != nil {
+		return "", err
+	}
+	return config.toYAML()
+}
+
+// GetRemote retrieves an Alertmanager configuration as a Resource
+func (h *AlertmanagerHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	if uid != alertmanagerUID {
+		return nil, grizzly.ErrNotFound
+	}
+	config, err := getRemoteAlertmanagerConfig(ctx, h.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	resource := h.newAlertmanagerResource(alertmanagerPath, *config)
+	return &resource, nil
+}
+
+// Add pushes an Alertmanager configuration via the API
+func (h *AlertmanagerHandler) Add(ctx context.Context, resource grizzly.Resource) error {
+	return writeAlertmanagerConfig(ctx, h.endpoint, resource.Detail.(AlertmanagerConfig))
+}
+
+// Update pushes an Alertmanager configuration via the API
+func (h *AlertmanagerHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
+	return writeAlertmanagerConfig(ctx, h.endpoint, resource.Detail.(AlertmanagerConfig))
+}
+
+// Delete removes the Alertmanager configuration via the API
+func (h *AlertmanagerHandler) Delete(ctx context.Context, UID string) error {
+	return deleteAlertmanagerConfig(ctx, h.endpoint)
+}
+
+// Preview validates an Alertmanager configuration and its templates, as
+// Alertmanager would when loading it, without pushing it
+func (h *AlertmanagerHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	c := resource.Detail.(AlertmanagerConfig)
+	if err := c.validate(); err != nil {
+		notifier.Error(&resource, "invalid configuration: "+err.Error())
+		return fmt.Errorf("Alertmanager configuration %s is invalid", resource.UID)
+	}
+	notifier.Info(&resource, "configuration valid")
+	return nil
+}
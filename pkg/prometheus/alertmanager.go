@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	amconfig "github.com/prometheus/alertmanager/config"
+	amtemplate "github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * The Cortex/Mimir Alertmanager API stores a single configuration per tenant,
+ * made of the Alertmanager configuration itself (as a YAML string) and a set
+ * of named template files. Locally, the configuration is a Jsonnet object.
+ */
+
+const alertmanagerAPIPath = "api/v1/alerts"
+
+// AlertmanagerConfig encapsulates the Alertmanager configuration of a tenant
+type AlertmanagerConfig struct {
+	TemplateFiles map[string]string      `yaml:"template_files" mapstructure:"template_files"`
+	Config        map[string]interface{} `yaml:"alertmanager_config" mapstructure:"alertmanager_config"`
+}
+
+// alertmanagerUID identifies the (only) Alertmanager configuration
+const alertmanagerUID = "alertmanager"
+
+// UID retrieves the UID from an Alertmanager configuration
+func (c *AlertmanagerConfig) UID() string {
+	return alertmanagerUID
+}
+
+// toYAML returns YAML for an Alertmanager configuration
+func (c *AlertmanagerConfig) toYAML() (string, error) {
+	y, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return string(y), nil
+}
+
+// validate checks an Alertmanager configuration the way Alertmanager does when
+// loading it, e.g. that routes only refer to defined receivers, and that its
+// templates parse
+func (c *AlertmanagerConfig) validate() error {
+	config, err := yaml.Marshal(c.Config)
+	if err != nil {
+		return err
+	}
+	if _, err := amconfig.Load(string(config)); err != nil {
+		return fmt.Errorf("Invalid Alertmanager configuration: %v", err)
+	}
+	names := []string{}
+	for name := range c.TemplateFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tmpl := template.New(name).Option("missingkey=zero").Funcs(template.FuncMap(amtemplate.DefaultFuncs))
+		if _, err := tmpl.Parse(c.TemplateFiles[name]); err != nil {
+			return fmt.Errorf("Invalid Alertmanager template %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// configYAML returns the Alertmanager configuration as expected by the API
+func (c *AlertmanagerConfig) configYAML() (string, error) {
+	config, err := yaml.Marshal(c.Config)
+	if err != nil {
+		return "", err
+	}
+	body := struct {
+		TemplateFiles map[string]string `yaml:"template_files"`
+		Config        string            `yaml:"alertmanager_config"`
+	}{
+		TemplateFiles: c.TemplateFiles,
+		Config:        string(config),
+	}
+	y, err := yaml.Marshal(body)
+	if err != nil {
+		return "", err
+	}
+	return string(y), nil
+}
+
+// getRemoteAlertmanagerConfig retrieves the Alertmanager configuration
+func getRemoteAlertmanagerConfig(ctx context.Context, endpoint *grizzly.Endpoint) (*AlertmanagerConfig, error) {
+	out, err := cortexRequest(ctx, endpoint, "GET", alertmanagerAPIPath, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		TemplateFiles map[string]string `yaml:"template_files"`
+		Config        string            `yaml:"alertmanager_config"`
+	}
+	if err := yaml.Unmarshal(out, &body); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	config := AlertmanagerConfig{
+		TemplateFiles: body.TemplateFiles,
+		Config:        map[string]interface{}{},
+	}
+	if config.TemplateFiles == nil {
+		config.TemplateFiles = map[string]string{}
+	}
+	if err := yaml.Unmarshal([]byte(body.Config), &config.Config); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: []byte(body.Config)}
+	}
+	return &config, nil
+}
+
+func writeAlertmanagerConfig(ctx context.Context, endpoint *grizzly.Endpoint, config AlertmanagerConfig) error {
+	out, err := config.configYAML()
+	if err != nil {
+		return err
+	}
+	if _, err := cortexRequest(ctx, endpoint, "POST", alertmanagerAPIPath, "", []byte(out)); err != nil {
+		return fmt.Errorf("Error while applying Alertmanager configuration: %v", err)
+	}
+	return nil
+}
+
+func deleteAlertmanagerConfig(ctx context.Context, endpoint *grizzly.Endpoint) error {
+	if _, err := cortexRequest(ctx, endpoint, "DELETE", alertmanagerAPIPath, "", nil); err != nil {
+		return fmt.Errorf("Error while deleting Alertmanager configuration: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package prometheus
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+func TestValidateAlertmanagerConfig(t *testing.T) {
+	route := map[string]interface{}{"receiver": "default"}
+	receivers := []interface{}{map[string]interface{}{"name": "default"}}
+	tests := map[string]struct {
+		config    map[string]interface{}
+		templates map[string]string
+		err       string
+	}{
+		"valid": {
+			config:    map[string]interface{}{"route": route, "receivers": receivers},
+			templates: map[string]string{"default.tmpl": `{{ define "title" }}{{ .CommonLabels.alertname | toUpper }}{{ end }}`},
+		},
+		"no route": {
+			config: map[string]interface{}{"receivers": receivers},
+			err:    "no routes provided",
+		},
+		"undefined receiver": {
+			config: map[string]interface{}{"route": map[string]interface{}{"receiver": "team-a"}, "receivers": receivers},
+			err:    `undefined receiver "team-a"`,
+		},
+		"unknown field": {
+			config: map[string]interface{}{"route": route, "receivers": receivers, "routes": []interface{}{}},
+			err:    "field routes not found",
+		},
+		"invalid template": {
+			config:    map[string]interface{}{"route": route, "receivers": receivers},
+			templates: map[string]string{"default.tmpl": `{{ define "title" }}`},
+			err:       "Invalid Alertmanager template default.tmpl",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		config := AlertmanagerConfig{Config: test.config, TemplateFiles: test.templates}
+		err := config.validate()
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error validating Alertmanager configuration: %s", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Expected error containing %q, got: %v", test.err, err)
+		}
+	}
+}
+
+func TestPreviewAlertmanagerConfig(t *testing.T) {
+	route := map[string]interface{}{"receiver": "default"}
+	receivers := []interface{}{map[string]interface{}{"name": "default"}}
+	tests := map[string]struct {
+		config map[string]interface{}
+		err    string
+	}{
+		"valid": {
+			config: map[string]interface{}{"route": route, "receivers": receivers},
+		},
+		"undefined receiver": {
+			config: map[string]interface{}{"route": map[string]interface{}{"receiver": "team-a"}, "receivers": receivers},
+			err:    "Alertmanager configuration alertmanager is invalid",
+		},
+	}
+	h := NewAlertmanagerHandler(nil)
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		resource := h.newAlertmanagerResource(alertmanagerPath, AlertmanagerConfig{Config: test.config, TemplateFiles: map[string]string{}})
+		err := h.Preview(context.Background(), resource, grizzly.Notifier{}, nil)
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error previewing Alertmanager configuration: %s", err)
+		}
+		if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Expected error %q, got: %v", test.err, err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * Rule groups used to be pushed by running the cortextool binary. This is
+ * deprecated in favour of the ruler API, which needs no binary on the PATH,
+ * but remains available, with PROMETHEUS_RULER_API=cortextool, so that
+ * existing setups keep working while they migrate. Setting CORTEXTOOL_PATH,
+ * as these setups did, selects it too. cortextool is given the address,
+ * tenant and token of the ruler via its CORTEX_* environment variables.
+ */
+
+// cortextoolRulerAPI selects the deprecated cortextool binary over the ruler API
+const cortextoolRulerAPI = "cortextool"
+
+// getCortextoolRuleGroup retrieves a rule group with cortextool
+func getCortextoolRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, tenant, namespace, name string) (*RuleGroup, error) {
+	groups, err := listCortextoolRuleGroups(ctx, endpoint, tenant)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Namespace == namespace && group.Name == name {
+			return &group, nil
+		}
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+// listCortextoolRuleGroups retrieves all rule groups of a tenant with cortextool
+func listCortextoolRuleGroups(ctx context.Context, endpoint *grizzly.Endpoint, tenant string) ([]RuleGroup, error) {
+	out, err := cortextool(ctx, endpoint, tenant, "rules", "print", "--disable-color")
+	if err != nil {
+		return nil, err
+	}
+	namespaces := map[string][]RuleGroup{}
+	if err := yaml.Unmarshal(out, &namespaces); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	groups := []RuleGroup{}
+	for namespace, nsGroups := range namespaces {
+		for _, group := range nsGroups {
+			group.Namespace = namespace
+			group.Tenant = tenant
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// cortextoolRuleFile is a rule file as loaded by cortextool, which names the
+// namespace of its groups
+type cortextoolRuleFile struct {
+	Namespace string      `yaml:"namespace"`
+	Groups    []RuleGroup `yaml:"groups"`
+}
+
+// writeCortextoolRuleGroup pushes a rule group with cortextool, from a rule
+// file holding just this group
+func writeCortextoolRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, group RuleGroup) error {
+	out, err := yaml.Marshal(cortextoolRuleFile{
+		Namespace: group.Namespace,
+		Groups:    []RuleGroup{group},
+	})
+	if err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile("", "cortextool-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(out)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := cortextool(ctx, endpoint, group.Tenant, "rules", "load", file.Name()); err != nil {
+		return fmt.Errorf("Error while applying rule group '%s': %v", group.UID(), err)
+	}
+	return nil
+}
+
+// deleteCortextoolRuleGroup deletes a rule group with cortextool
+func deleteCortextoolRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, group RuleGroup) error {
+	if _, err := cortextool(ctx, endpoint, group.Tenant, "rules", "delete", group.Namespace, group.Name); err != nil {
+		return fmt.Errorf("Error while deleting rule group '%s': %v", group.UID(), err)
+	}
+	return nil
+}
+
+// cortextool runs cortextool, found at CORTEXTOOL_PATH or on the PATH, on
+// behalf of a tenant. An empty tenant falls back to PROMETHEUS_TENANT_ID.
+func cortextool(ctx context.Context, endpoint *grizzly.Endpoint, tenant string, args ...string) ([]byte, error) {
+	path := os.Getenv("CORTEXTOOL_PATH")
+	if path == "" {
+		var err error
+		if path, err = exec.LookPath("cortextool"); err != nil {
+			return nil, fmt.Errorf("cortextool not found, set CORTEXTOOL_PATH or use the ruler API: %v", err)
+		}
+	}
+	address, err := getCortexURL(endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	if tenant == "" {
+		tenant = os.Getenv("PROMETHEUS_TENANT_ID")
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = append(os.Environ(),
+		"CORTEX_ADDRESS="+strings.TrimSuffix(address, "/"),
+		"CORTEX_TENANT_ID="+tenant,
+		"CORTEX_API_KEY="+os.Getenv("PROMETHEUS_TOKEN"),
+	)
+	if user, exists := os.LookupEnv("PROMETHEUS_USER"); exists {
+		cmd.Env = append(cmd.Env, "CORTEX_API_USER="+user)
+	}
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("cortextool %s failed: %v: %s", strings.Join(args[:2], " "), err, strings.TrimSpace(string(exitErr.Stderr)))
+	} else if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
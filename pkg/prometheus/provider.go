@@ -2,8 +2,11 @@ package prometheus
 
 import "github.com/grafana/grizzly/pkg/grizzly"
 
-// Provider defines a Cortex Provider
-type Provider struct{}
+// Provider defines a Cortex Provider. Its handlers send requests to Endpoint
+// if set, or as configured by environment variables.
+type Provider struct {
+	Endpoint *grizzly.Endpoint
+}
 
 // NewProvider returns a new Cortex Provider
 func NewProvider() *Provider {
@@ -18,6 +21,7 @@ func (p *Provider) GetName() string {
 // GetHandlers identifies the handlers for the Cortex provider
 func (p *Provider) GetHandlers() []grizzly.Handler {
 	return []grizzly.Handler{
-		&RuleHandler{},
+		NewRuleHandler(p.Endpoint),
+		NewAlertmanagerHandler(p.Endpoint),
 	}
 }
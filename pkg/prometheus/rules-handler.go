@@ -1,18 +1,22 @@
 package prometheus
 
 import (
+	"context"
 	"fmt"
+	"sort"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
 	"github.com/mitchellh/mapstructure"
 )
 
 // RuleHandler is a Grizzly Provider for Grafana datasources
-type RuleHandler struct{}
+type RuleHandler struct {
+	endpoint *grizzly.Endpoint
+}
 
 // NewRuleHandler returns configuration defining a new Grafana Provider
-func NewRuleHandler() *RuleHandler {
-	return &RuleHandler{}
+func NewRuleHandler(endpoint *grizzly.Endpoint) *RuleHandler {
+	return &RuleHandler{endpoint: endpoint}
 }
 
 // GetName returns the name for this provider
@@ -41,6 +45,12 @@ func (h *RuleHandler) GetExtension() string {
 	return "yaml"
 }
 
+// Configured returns why the ruler is not configured, if it is not
+func (h *RuleHandler) Configured() error {
+	_, err := getCortexURL(h.endpoint, "")
+	return err
+}
+
 func (h *RuleHandler) newRuleGroupingResource(path string, group RuleGroup) grizzly.Resource {
 	resource := grizzly.Resource{
 		UID:      group.UID(),
@@ -62,16 +72,43 @@ func (h *RuleHandler) Parse(path string, i interface{}) (grizzly.ResourceList, e
 		return nil, err
 	}
 	for k, grouping := range groupings {
+		if grouping.Tenant != "" && len(grouping.Tenants) > 0 {
+			return nil, fmt.Errorf("Namespace %s sets both tenant and tenants", k)
+		}
 		for _, group := range grouping.Groups {
 			group.Namespace = k
-			resource := h.newRuleGroupingResource(path, group)
-			key := resource.Key()
-			resources[key] = resource
+			group.Tenant = grouping.Tenant
+			groups := []RuleGroup{group}
+			if len(grouping.Tenants) > 0 {
+				groups = []RuleGroup{}
+				for _, tenant := range grouping.Tenants {
+					groups = append(groups, group.forTenant(tenant))
+				}
+			}
+			for _, group := range groups {
+				if err := group.validate(); err != nil {
+					return nil, err
+				}
+				resource := h.newRuleGroupingResource(path, group)
+				resource.Labels = grouping.Labels
+				if err := resources.Add(resource); err != nil {
+					return nil, err
+				}
+			}
 		}
 	}
 	return resources, nil
 }
 
+// Validate checks a rule group as `promtool check rules` does
+func (h *RuleHandler) Validate(resource grizzly.Resource) []error {
+	g := resource.Detail.(RuleGroup)
+	if err := g.validate(); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
 // Unprepare removes unnecessary elements from a remote resource ready for presentation/comparison
 func (h *RuleHandler) Unprepare(resource grizzly.Resource) *grizzly.Resource {
 	return &resource
@@ -83,8 +120,8 @@ func (h *RuleHandler) Prepare(existing, resource grizzly.Resource) *grizzly.Reso
 }
 
 // GetByUID retrieves JSON for a resource from an endpoint, by UID
-func (h *RuleHandler) GetByUID(UID string) (*grizzly.Resource, error) {
-	group, err := getRemoteRuleGroup(UID)
+func (h *RuleHandler) GetByUID(ctx context.Context, UID string) (*grizzly.Resource, error) {
+	group, err := getRemoteRuleGroup(ctx, h.endpoint, UID)
 	if err != nil {
 		return nil, fmt.Errorf("Error retrieving datasource %s: %v", UID, err)
 	}
@@ -99,8 +136,8 @@ func (h *RuleHandler) GetRepresentation(uid string, resource grizzly.Resource) (
 }
 
 // GetRemoteRepresentation retrieves a datasource as JSON
-func (h *RuleHandler) GetRemoteRepresentation(uid string) (string, error) {
-	group, err := getRemoteRuleGroup(uid)
+func (h *RuleHandler) GetRemoteRepresentation(ctx context.Context, uid string) (string, error) {
+	group, err := getRemoteRuleGroup(ctx, h.endpoint, uid)
 	if err != nil {
 		return "", err
 	}
@@ -108,8 +145,8 @@ func (h *RuleHandler) GetRemoteRepresentation(uid string) (string, error) {
 }
 
 // GetRemote retrieves a datasource as a Resource
-func (h *RuleHandler) GetRemote(uid string) (*grizzly.Resource, error) {
-	group, err := getRemoteRuleGroup(uid)
+func (h *RuleHandler) GetRemote(ctx context.Context, uid string) (*grizzly.Resource, error) {
+	group, err := getRemoteRuleGroup(ctx, h.endpoint, uid)
 	if err != nil {
 		return nil, err
 	}
@@ -118,18 +155,121 @@ func (h *RuleHandler) GetRemote(uid string) (*grizzly.Resource, error) {
 }
 
 // Add pushes a datasource to Grafana via the API
-func (h *RuleHandler) Add(resource grizzly.Resource) error {
+func (h *RuleHandler) Add(ctx context.Context, resource grizzly.Resource) error {
 	g := resource.Detail.(RuleGroup)
-	return writeRuleGroup(g)
+	return writeRuleGroup(ctx, h.endpoint, g)
 }
 
 // Update pushes a datasource to Grafana via the API
-func (h *RuleHandler) Update(existing, resource grizzly.Resource) error {
+func (h *RuleHandler) Update(ctx context.Context, existing, resource grizzly.Resource) error {
 	g := resource.Detail.(RuleGroup)
-	return writeRuleGroup(g)
+	return writeRuleGroup(ctx, h.endpoint, g)
+}
+
+// Delete removes a rule group from the ruler
+func (h *RuleHandler) Delete(ctx context.Context, UID string) error {
+	tenant, namespace, name, err := parseRuleGroupUID(UID)
+	if err != nil {
+		return err
+	}
+	return deleteRuleGroup(ctx, h.endpoint, RuleGroup{Tenant: tenant, Namespace: namespace, Name: name})
+}
+
+// ListRemote retrieves the rule groups of all tenants that local rule groups are pushed to
+func (h *RuleHandler) ListRemote(ctx context.Context, resources grizzly.ResourceList) (grizzly.ResourceList, error) {
+	tenants := map[string]bool{}
+	for _, resource := range resources {
+		tenants[resource.Detail.(RuleGroup).Tenant] = true
+	}
+	remote := grizzly.ResourceList{}
+	for tenant := range tenants {
+		groups, err := listRuleGroups(ctx, h.endpoint, tenant)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			resource := h.newRuleGroupingResource("", group)
+			remote[resource.Key()] = resource
+		}
+	}
+	return remote, nil
+}
+
+// ListAll retrieves a summary of all rule groups of the default tenant
+func (h *RuleHandler) ListAll(ctx context.Context) ([]grizzly.ResourceSummary, error) {
+	groups, err := listRuleGroups(ctx, h.endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	summaries := []grizzly.ResourceSummary{}
+	for _, group := range groups {
+		summaries = append(summaries, grizzly.ResourceSummary{UID: group.UID(), Title: group.Name, Folder: group.Namespace})
+	}
+	return summaries, nil
 }
 
-// Preview renders Jsonnet then pushes them to the endpoint if previews are possible
-func (h *RuleHandler) Preview(resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
-	return grizzly.ErrNotImplemented
+// GetFolder returns the namespace of a rule group
+func (h *RuleHandler) GetFolder(resource grizzly.Resource, resources grizzly.ResourceList) string {
+	return resource.Detail.(RuleGroup).Namespace
+}
+
+// Preview runs the unit tests of a rule group, which may only test the group
+// itself
+func (h *RuleHandler) Preview(ctx context.Context, resource grizzly.Resource, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	return h.PreviewList(ctx, resource, grizzly.ResourceList{resource.Key(): resource}, notifier, opts)
+}
+
+// PreviewList runs the unit tests of a rule group, which may test it together
+// with the other rule groups parsed with it
+func (h *RuleHandler) PreviewList(ctx context.Context, resource grizzly.Resource, resourceList grizzly.ResourceList, notifier grizzly.Notifier, opts *grizzly.PreviewOpts) error {
+	parsed := map[string]RuleGroup{}
+	for _, r := range resourceList {
+		if group, ok := r.Detail.(RuleGroup); ok {
+			parsed[group.UID()] = group
+		}
+	}
+	files, err := getRuleTestFiles()
+	if err != nil {
+		return err
+	}
+	filenames := []string{}
+	for filename, f := range files {
+		if uids := f.ruleGroupUIDs(); len(uids) > 0 && uids[0] == resource.UID {
+			filenames = append(filenames, filename)
+		}
+	}
+	if len(filenames) == 0 {
+		notifier.Warn(&resource, "no unit tests")
+		return nil
+	}
+	sort.Strings(filenames)
+
+	failed := false
+	for _, filename := range filenames {
+		f := files[filename]
+		groups := []RuleGroup{}
+		for _, uid := range f.ruleGroupUIDs() {
+			group, ok := parsed[uid]
+			if !ok {
+				return fmt.Errorf("Rule group %s, tested by %s, not found", uid, filename)
+			}
+			groups = append(groups, group)
+		}
+		failures, err := runRuleTests(f, groups)
+		if err != nil {
+			return fmt.Errorf("Error running unit tests %s: %v", filename, err)
+		}
+		if len(failures) == 0 {
+			notifier.Info(&resource, "unit tests passed: "+filename)
+			continue
+		}
+		failed = true
+		for _, failure := range failures {
+			notifier.Error(&resource, fmt.Sprintf("unit test failed: %s: %v", filename, failure))
+		}
+	}
+	if failed {
+		return fmt.Errorf("Unit tests of rule group %s failed", resource.UID)
+	}
+	return nil
 }
@@ -0,0 +1,414 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	yaml "gopkg.in/yaml.v2"
+)
+
+/*
+ * Rule groups can be unit tested the way `promtool test rules` does. Test files
+ * are read from the directory given by PROMETHEUS_RULE_TESTS (`tests` by
+ * default) and follow the promtool format, except that `rule_files` name rule
+ * groups by UID. As files exported by `grr export` are named after their UID,
+ * e.g. `prometheus/first_rules-grizzly_alerts.yaml`, paths to those are
+ * accepted too. A test file is run when previewing the first rule group it
+ * names; other rule groups it names must be part of the same Jsonnet.
+ *
+ * The test runner is adapted from promtool (Copyright 2018 The Prometheus
+ * Authors, Apache License 2.0).
+ */
+
+const defaultRuleTestsDir = "tests"
+
+// ruleTestFile holds the contents of a single unit test file
+type ruleTestFile struct {
+	RuleFiles          []string        `yaml:"rule_files"`
+	EvaluationInterval model.Duration  `yaml:"evaluation_interval,omitempty"`
+	GroupEvalOrder     []string        `yaml:"group_eval_order"`
+	Tests              []ruleTestGroup `yaml:"tests"`
+}
+
+// ruleTestGroup is a group of input series and the tests run against them
+type ruleTestGroup struct {
+	Interval        model.Duration   `yaml:"interval"`
+	InputSeries     []ruleTestSeries `yaml:"input_series"`
+	AlertRuleTests  []alertTestCase  `yaml:"alert_rule_test,omitempty"`
+	PromqlExprTests []promqlTestCase `yaml:"promql_expr_test,omitempty"`
+	ExternalLabels  labels.Labels    `yaml:"external_labels,omitempty"`
+}
+
+type ruleTestSeries struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+type alertTestCase struct {
+	EvalTime  model.Duration  `yaml:"eval_time"`
+	Alertname string          `yaml:"alertname"`
+	ExpAlerts []expectedAlert `yaml:"exp_alerts"`
+}
+
+type expectedAlert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+type promqlTestCase struct {
+	Expr       string           `yaml:"expr"`
+	EvalTime   model.Duration   `yaml:"eval_time"`
+	ExpSamples []expectedSample `yaml:"exp_samples"`
+}
+
+type expectedSample struct {
+	Labels string  `yaml:"labels"`
+	Value  float64 `yaml:"value"`
+}
+
+// ruleGroupUIDs returns the UIDs of the rule groups a test file refers to
+func (f *ruleTestFile) ruleGroupUIDs() []string {
+	uids := []string{}
+	for _, rf := range f.RuleFiles {
+		uid := filepath.Base(rf)
+		for _, ext := range []string{".yaml", ".yml"} {
+			uid = strings.TrimSuffix(uid, ext)
+		}
+		uids = append(uids, uid)
+	}
+	return uids
+}
+
+// getRuleTestFiles reads all unit test files, by file name
+func getRuleTestFiles() (map[string]ruleTestFile, error) {
+	dir, exists := os.LookupEnv("PROMETHEUS_RULE_TESTS")
+	if !exists {
+		dir = defaultRuleTestsDir
+	}
+	files := map[string]ruleTestFile{}
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range matches {
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			var f ruleTestFile
+			if err := yaml.UnmarshalStrict(b, &f); err != nil {
+				return nil, fmt.Errorf("Error parsing rule test file %s: %v", filename, err)
+			}
+			files[filename] = f
+		}
+	}
+	return files, nil
+}
+
+// runRuleTests runs a unit test file against the given rule groups, and
+// returns the failures
+func runRuleTests(f ruleTestFile, groups []RuleGroup) ([]error, error) {
+	dir, err := ioutil.TempDir("", "grizzly-rules")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	ruleFiles := []string{}
+	for _, group := range groups {
+		content, err := group.toRuleFile()
+		if err != nil {
+			return nil, err
+		}
+		filename := filepath.Join(dir, group.UID()+".yaml")
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+		ruleFiles = append(ruleFiles, filename)
+	}
+
+	if f.EvaluationInterval == 0 {
+		f.EvaluationInterval = model.Duration(time.Minute)
+	}
+	evalInterval := time.Duration(f.EvaluationInterval)
+	mint := time.Unix(0, 0).UTC()
+	var maxd time.Duration
+	for _, tg := range f.Tests {
+		if d := tg.maxEvalTime(); d > maxd {
+			maxd = d
+		}
+	}
+	// Round to the first evaluation after the last test
+	maxt := mint.Add(maxd).Add(evalInterval / 2).Round(evalInterval)
+
+	groupOrder := map[string]int{}
+	for i, name := range f.GroupEvalOrder {
+		if _, ok := groupOrder[name]; ok {
+			return nil, fmt.Errorf("Group name repeated in evaluation order: %s", name)
+		}
+		groupOrder[name] = i
+	}
+
+	var failures []error
+	for _, tg := range f.Tests {
+		failures = append(failures, tg.test(mint, maxt, evalInterval, groupOrder, ruleFiles)...)
+	}
+	return failures, nil
+}
+
+// test evaluates the rules against the input series, and checks the alerts
+// firing and the results of PromQL expressions at the given times
+func (tg *ruleTestGroup) test(mint, maxt time.Time, evalInterval time.Duration, groupOrder map[string]int, ruleFiles []string) []error {
+	suite, err := promql.NewLazyLoader(nil, tg.seriesLoadingString())
+	if err != nil {
+		return []error{err}
+	}
+	defer suite.Close()
+
+	opts := &rules.ManagerOptions{
+		QueryFunc:  rules.EngineQueryFunc(suite.QueryEngine(), suite.Storage()),
+		Appendable: suite.Storage(),
+		Context:    context.Background(),
+		NotifyFunc: func(ctx context.Context, expr string, alerts ...*rules.Alert) {},
+		Logger:     log.NewNopLogger(),
+	}
+	m := rules.NewManager(opts)
+	groupsMap, errs := m.LoadGroups(time.Duration(tg.Interval), tg.ExternalLabels, ruleFiles...)
+	if errs != nil {
+		return errs
+	}
+	groups := make([]*rules.Group, 0, len(groupsMap))
+	for _, g := range groupsMap {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groupOrder[groups[i].Name()] < groupOrder[groups[j].Name()]
+	})
+
+	// Alert tests by evaluation time, so that alerts are checked as the rules
+	// are evaluated rather than kept in memory
+	alertTests := map[model.Duration][]alertTestCase{}
+	alertEvalTimes := []model.Duration{}
+	for _, alert := range tg.AlertRuleTests {
+		if _, ok := alertTests[alert.EvalTime]; !ok {
+			alertEvalTimes = append(alertEvalTimes, alert.EvalTime)
+		}
+		alertTests[alert.EvalTime] = append(alertTests[alert.EvalTime], alert)
+	}
+	sort.Slice(alertEvalTimes, func(i, j int) bool {
+		return alertEvalTimes[i] < alertEvalTimes[j]
+	})
+
+	curr := 0
+	for ts := mint; ts.Before(maxt); ts = ts.Add(evalInterval) {
+		suite.WithSamplesTill(ts, func(err error) {
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			for _, g := range groups {
+				g.Eval(suite.Context(), ts)
+				for _, r := range g.Rules() {
+					if r.LastError() != nil {
+						errs = append(errs, fmt.Errorf("rule: %s, time: %s, err: %v", r.Name(), ts.Sub(mint), r.LastError()))
+					}
+				}
+			}
+		})
+		if len(errs) > 0 {
+			return errs
+		}
+
+		// Check the alerts of tests with ts <= eval_time < ts+evalInterval
+		for ; curr < len(alertEvalTimes); curr++ {
+			t := alertEvalTimes[curr]
+			if time.Duration(t) < ts.Sub(mint) || time.Duration(t) >= ts.Add(evalInterval).Sub(mint) {
+				break
+			}
+			got := map[string]labelsAndAnnotations{}
+			for _, g := range groups {
+				for _, r := range g.Rules() {
+					ar, ok := r.(*rules.AlertingRule)
+					if !ok {
+						continue
+					}
+					for _, a := range ar.ActiveAlerts() {
+						if a.State == rules.StateFiring {
+							got[ar.Name()] = append(got[ar.Name()], labelAndAnnotation{
+								Labels:      append(labels.Labels{}, a.Labels...),
+								Annotations: append(labels.Labels{}, a.Annotations...),
+							})
+						}
+					}
+				}
+			}
+			for _, testcase := range alertTests[t] {
+				gotAlerts := got[testcase.Alertname]
+				expAlerts := labelsAndAnnotations{}
+				for _, a := range testcase.ExpAlerts {
+					// The alertname label is added by Prometheus when evaluating
+					expLabels := map[string]string{labels.AlertName: testcase.Alertname}
+					for k, v := range a.ExpLabels {
+						expLabels[k] = v
+					}
+					expAlerts = append(expAlerts, labelAndAnnotation{
+						Labels:      labels.FromMap(expLabels),
+						Annotations: labels.FromMap(a.ExpAnnotations),
+					})
+				}
+				sort.Sort(gotAlerts)
+				sort.Sort(expAlerts)
+				if len(gotAlerts) != len(expAlerts) || (len(expAlerts) > 0 && !reflect.DeepEqual(expAlerts, gotAlerts)) {
+					errs = append(errs, fmt.Errorf("alertname: %s, time: %s,\n    exp: %s,\n    got: %s",
+						testcase.Alertname, testcase.EvalTime, expAlerts, gotAlerts))
+				}
+			}
+		}
+	}
+
+	for _, testcase := range tg.PromqlExprTests {
+		if err := testcase.check(suite, mint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// check compares the result of an expression with the expected samples
+func (tc *promqlTestCase) check(suite *promql.LazyLoader, mint time.Time) error {
+	got, err := query(suite.Context(), tc.Expr, mint.Add(time.Duration(tc.EvalTime)), suite.QueryEngine(), suite.Queryable())
+	if err != nil {
+		return fmt.Errorf("expr: %q, time: %s, err: %v", tc.Expr, tc.EvalTime, err)
+	}
+	gotSamples := []parsedSample{}
+	for _, s := range got {
+		gotSamples = append(gotSamples, parsedSample{Labels: s.Metric.Copy(), Value: s.V})
+	}
+	expSamples := []parsedSample{}
+	for _, s := range tc.ExpSamples {
+		lb, err := parser.ParseMetric(s.Labels)
+		if err != nil {
+			return fmt.Errorf("expr: %q, time: %s, err: labels %q: %v", tc.Expr, tc.EvalTime, s.Labels, err)
+		}
+		expSamples = append(expSamples, parsedSample{Labels: lb, Value: s.Value})
+	}
+	for _, samples := range [][]parsedSample{gotSamples, expSamples} {
+		sort.Slice(samples, func(i, j int) bool {
+			return labels.Compare(samples[i].Labels, samples[j].Labels) <= 0
+		})
+	}
+	if !reflect.DeepEqual(expSamples, gotSamples) {
+		return fmt.Errorf("expr: %q, time: %s,\n    exp: %s\n    got: %s", tc.Expr, tc.EvalTime, parsedSamplesString(expSamples), parsedSamplesString(gotSamples))
+	}
+	return nil
+}
+
+// seriesLoadingString returns the input series in PromQL test notation
+func (tg *ruleTestGroup) seriesLoadingString() string {
+	result := fmt.Sprintf("load %v\n", tg.Interval)
+	for _, is := range tg.InputSeries {
+		result += fmt.Sprintf("  %v %v\n", is.Series, is.Values)
+	}
+	return result
+}
+
+// maxEvalTime returns the latest evaluation time of all tests
+func (tg *ruleTestGroup) maxEvalTime() time.Duration {
+	var maxd model.Duration
+	for _, alert := range tg.AlertRuleTests {
+		if alert.EvalTime > maxd {
+			maxd = alert.EvalTime
+		}
+	}
+	for _, pet := range tg.PromqlExprTests {
+		if pet.EvalTime > maxd {
+			maxd = pet.EvalTime
+		}
+	}
+	return time.Duration(maxd)
+}
+
+func query(ctx context.Context, qs string, t time.Time, engine *promql.Engine, qu storage.Queryable) (promql.Vector, error) {
+	q, err := engine.NewInstantQuery(qu, qs, t)
+	if err != nil {
+		return nil, err
+	}
+	res := q.Exec(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	switch v := res.Value.(type) {
+	case promql.Vector:
+		return v, nil
+	case promql.Scalar:
+		return promql.Vector{promql.Sample{
+			Point:  promql.Point(v),
+			Metric: labels.Labels{},
+		}}, nil
+	}
+	return nil, fmt.Errorf("Rule result is not a vector or scalar")
+}
+
+type labelAndAnnotation struct {
+	Labels      labels.Labels
+	Annotations labels.Labels
+}
+
+func (la labelAndAnnotation) String() string {
+	return "Labels:" + la.Labels.String() + " Annotations:" + la.Annotations.String()
+}
+
+type labelsAndAnnotations []labelAndAnnotation
+
+func (la labelsAndAnnotations) Len() int      { return len(la) }
+func (la labelsAndAnnotations) Swap(i, j int) { la[i], la[j] = la[j], la[i] }
+func (la labelsAndAnnotations) Less(i, j int) bool {
+	if diff := labels.Compare(la[i].Labels, la[j].Labels); diff != 0 {
+		return diff < 0
+	}
+	return labels.Compare(la[i].Annotations, la[j].Annotations) < 0
+}
+
+func (la labelsAndAnnotations) String() string {
+	s := []string{}
+	for _, l := range la {
+		s = append(s, l.String())
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+// parsedSample is a sample with parsed labels
+type parsedSample struct {
+	Labels labels.Labels
+	Value  float64
+}
+
+func (ps parsedSample) String() string {
+	return ps.Labels.String() + " " + strconv.FormatFloat(ps.Value, 'E', -1, 64)
+}
+
+func parsedSamplesString(pss []parsedSample) string {
+	if len(pss) == 0 {
+		return "nil"
+	}
+	s := []string{}
+	for _, ps := range pss {
+		s = append(s, ps.String())
+	}
+	return strings.Join(s, ", ")
+}
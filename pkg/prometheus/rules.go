@@ -1,57 +1,131 @@
 package prometheus
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
+	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
 	"gopkg.in/yaml.v3"
 )
 
-// getRemoteRuleGrouping retrieves a datasource object from Grafana
-func getRemoteRuleGroup(uid string) (*RuleGroup, error) {
-	parts := strings.SplitN(uid, "-", 2)
-	namespace := parts[0]
-	name := parts[1]
+/*
+ * Rule groups are pushed to a Cortex/Mimir compatible ruler API. Requests are
+ * sent on behalf of a tenant via the X-Scope-OrgID header. The tenant defaults
+ * to PROMETHEUS_TENANT_ID, and can be overridden per namespace with a `tenant`
+ * field next to its `groups`. Rule groups with an overridden tenant carry it in
+ * their UID, e.g. `team-a:namespace-group`, so that the same group can be
+ * pushed to several tenants.
+ *
+ * With a `tenants` list instead, the groups of a namespace are pushed to each
+ * of the tenants listed, e.g. by operators of a managed service. `$__tenant`
+ * in the strings of their rules is replaced by the tenant.
+ */
+
+const rulerAPIPath = "api/v1/rules"
 
-	out, err := cortexTool("rules", "print", "--disable-color")
+// getRemoteRuleGroup retrieves a rule group from the ruler
+func getRemoteRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, uid string) (*RuleGroup, error) {
+	tenant, namespace, name, err := parseRuleGroupUID(uid)
 	if err != nil {
 		return nil, err
 	}
-	groupings := map[string][]RuleGroup{}
-	err = yaml.Unmarshal(out, &groupings)
+	api, err := rulerAPI()
 	if err != nil {
 		return nil, err
+	} else if api == thanosRulerAPI {
+		return getThanosRuleGroup(ctx, endpoint, tenant, namespace, name)
+	} else if api == cortextoolRulerAPI {
+		return getCortextoolRuleGroup(ctx, endpoint, tenant, namespace, name)
 	}
-	for key, grouping := range groupings {
-		if key == namespace {
-			for _, group := range grouping {
-				if group.Name == name {
-					group.Namespace = namespace
-					return &group, nil
-				}
-			}
-		}
+	urlPath := fmt.Sprintf("%s/%s/%s", rulerAPIPath, url.PathEscape(namespace), url.PathEscape(name))
+	out, err := cortexRequest(ctx, endpoint, "GET", urlPath, tenant, nil)
+	if err != nil {
+		return nil, err
+	}
+	var group RuleGroup
+	if err := yaml.Unmarshal(out, &group); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	group.Namespace = namespace
+	group.Tenant = tenant
+	return &group, nil
+}
+
+// parseRuleGroupUID splits a UID into tenant (if any), namespace and group name
+func parseRuleGroupUID(uid string) (tenant, namespace, name string, err error) {
+	if i := strings.Index(uid, ":"); i >= 0 {
+		tenant = uid[:i]
+		uid = uid[i+1:]
+	}
+	parts := strings.SplitN(uid, "-", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("Rule group UID must be [<tenant>:]<namespace>-<name>: %s", uid)
 	}
-	return nil, grizzly.ErrNotFound
+	return tenant, parts[0], parts[1], nil
 }
 
 // RuleGroup encapsulates a list of rules
 type RuleGroup struct {
 	Namespace string                   `yaml:"-"`
+	Tenant    string                   `yaml:"-"`
 	Name      string                   `yaml:"name"`
 	Rules     []map[string]interface{} `yaml:"rules"`
 }
 
 // UID retrieves the UID from a rule group
 func (g *RuleGroup) UID() string {
+	if g.Tenant != "" {
+		return fmt.Sprintf("%s:%s-%s", g.Tenant, g.Namespace, g.Name)
+	}
 	return fmt.Sprintf("%s-%s", g.Namespace, g.Name)
 }
 
+// tenantPlaceholder is replaced by the tenant in the rules of groups pushed to
+// several tenants
+const tenantPlaceholder = "$__tenant"
+
+// forTenant returns a copy of a rule group to push to a tenant, replacing the
+// tenant placeholder in its rules
+func (g RuleGroup) forTenant(tenant string) RuleGroup {
+	g.Tenant = tenant
+	rules := make([]map[string]interface{}, len(g.Rules))
+	for i, rule := range g.Rules {
+		rules[i] = withTenant(rule, tenant).(map[string]interface{})
+	}
+	g.Rules = rules
+	return g
+}
+
+// withTenant returns a copy of a value with the tenant placeholder replaced
+// in its strings
+func withTenant(v interface{}, tenant string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return strings.ReplaceAll(v, tenantPlaceholder, tenant)
+	case map[string]interface{}:
+		replaced := map[string]interface{}{}
+		for k, value := range v {
+			replaced[k] = withTenant(value, tenant)
+		}
+		return replaced
+	case []interface{}:
+		replaced := make([]interface{}, len(v))
+		for i, value := range v {
+			replaced[i] = withTenant(value, tenant)
+		}
+		return replaced
+	}
+	return v
+}
+
 // toYAML returns YAML for a rule group
 func (g *RuleGroup) toYAML() (string, error) {
 	y, err := yaml.Marshal(g)
@@ -61,46 +135,212 @@ func (g *RuleGroup) toYAML() (string, error) {
 	return string(y), nil
 }
 
+// toRuleFile returns a Prometheus rule file holding just this rule group
+func (g *RuleGroup) toRuleFile() (string, error) {
+	y, err := g.toYAML()
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(strings.TrimSuffix(y, "\n"), "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = "- " + line
+		} else {
+			lines[i] = "  " + line
+		}
+	}
+	return "groups:\n" + strings.Join(lines, "\n") + "\n", nil
+}
+
+// validate checks a rule group the way `promtool check rules` does: expressions
+// must parse, rule, label and annotation names must be valid, and rules must not
+// be duplicated. Errors mention the line and column within a rule file holding
+// just this group, i.e. following a `groups:` line.
+func (g *RuleGroup) validate() error {
+	file, err := g.toRuleFile()
+	if err != nil {
+		return err
+	}
+	_, errs := rulefmt.Parse([]byte(file))
+	errs = append(errs, g.duplicateRules()...)
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := []string{}
+	for _, err := range errs {
+		msgs = append(msgs, "  "+err.Error())
+	}
+	return fmt.Errorf("Rule group %s is invalid:\n%s", g.UID(), strings.Join(msgs, "\n"))
+}
+
+// duplicateRules reports rules sharing their name and labels with an earlier
+// rule of the group, as these would produce conflicting series
+func (g *RuleGroup) duplicateRules() []error {
+	errs := []error{}
+	seen := map[string]bool{}
+	for i, rule := range g.Rules {
+		name, ok := rule["record"]
+		if !ok {
+			name, ok = rule["alert"]
+		}
+		if !ok {
+			continue
+		}
+		key := fmt.Sprint(name, rule["labels"])
+		if seen[key] {
+			errs = append(errs, fmt.Errorf("group %q, rule %d, %q: duplicate rule with the same name and labels", g.Name, i, name))
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
 // RuleGrouping encapsulates a set of named rule groups
 type RuleGrouping struct {
 	Namespace string      `json:"namespace"`
+	Tenant    string      `json:"tenant"`
+	Tenants   []string    `json:"tenants"`
 	Groups    []RuleGroup `json:"groups"`
+	// Labels are the grizzly labels of the rule groups in this namespace
+	Labels map[string]string `json:"grizzlyLabels,omitempty" mapstructure:"grizzlyLabels"`
 }
 
-func writeRuleGroup(group RuleGroup) error {
-	tmpfile, err := ioutil.TempFile("", "cortextool-*")
-	newGroup := RuleGroup{
-		Name:  group.Name,
-		Rules: group.Rules,
-	}
-	grouping := RuleGrouping{
-		Namespace: group.Namespace,
-		Groups:    []RuleGroup{newGroup},
+func writeRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, group RuleGroup) error {
+	api, err := rulerAPI()
+	if err != nil {
+		return err
+	} else if api == thanosRulerAPI {
+		return errThanosReadOnly
+	} else if api == cortextoolRulerAPI {
+		return writeCortextoolRuleGroup(ctx, endpoint, group)
 	}
-	out, err := yaml.Marshal(grouping)
+	out, err := group.toYAML()
 	if err != nil {
 		return err
 	}
-	ioutil.WriteFile(tmpfile.Name(), out, 0644)
-	output, err := cortexTool("rules", "load", tmpfile.Name())
+	urlPath := fmt.Sprintf("%s/%s", rulerAPIPath, url.PathEscape(group.Namespace))
+	_, err = cortexRequest(ctx, endpoint, "POST", urlPath, group.Tenant, []byte(out))
+	if err != nil {
+		return fmt.Errorf("Error while applying rule group '%s': %v", group.UID(), err)
+	}
+	return nil
+}
+
+// deleteRuleGroup deletes a rule group from the ruler
+func deleteRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, group RuleGroup) error {
+	api, err := rulerAPI()
 	if err != nil {
-		log.Println("OUTPUT", output)
 		return err
+	} else if api == thanosRulerAPI {
+		return errThanosReadOnly
+	} else if api == cortextoolRulerAPI {
+		return deleteCortextoolRuleGroup(ctx, endpoint, group)
+	}
+	urlPath := fmt.Sprintf("%s/%s/%s", rulerAPIPath, url.PathEscape(group.Namespace), url.PathEscape(group.Name))
+	_, err = cortexRequest(ctx, endpoint, "DELETE", urlPath, group.Tenant, nil)
+	if err != nil {
+		return fmt.Errorf("Error while deleting rule group '%s': %v", group.UID(), err)
 	}
-	os.Remove(tmpfile.Name())
-	return err
+	return nil
 }
 
-func cortexTool(args ...string) ([]byte, error) {
-	path := os.Getenv("CORTEXTOOL_PATH")
-	if path == "" {
-		var err error
-		path, err = exec.LookPath("cortextool")
-		if err != nil {
-			return nil, err
-		} else if path == "" {
-			return nil, fmt.Errorf("cortextool not found")
+// listRuleGroups retrieves all rule groups of a tenant from the ruler
+func listRuleGroups(ctx context.Context, endpoint *grizzly.Endpoint, tenant string) ([]RuleGroup, error) {
+	api, err := rulerAPI()
+	if err != nil {
+		return nil, err
+	} else if api == thanosRulerAPI {
+		if tenant != "" {
+			return nil, fmt.Errorf("The Thanos ruler does not support tenants: %s", tenant)
+		}
+		return listThanosRuleGroups(ctx, endpoint)
+	} else if api == cortextoolRulerAPI {
+		return listCortextoolRuleGroups(ctx, endpoint, tenant)
+	}
+	out, err := cortexRequest(ctx, endpoint, "GET", rulerAPIPath, tenant, nil)
+	if err == grizzly.ErrNotFound {
+		// the ruler responds with 404 when a tenant has no rule groups
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	namespaces := map[string][]RuleGroup{}
+	if err := yaml.Unmarshal(out, &namespaces); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	groups := []RuleGroup{}
+	for namespace, nsGroups := range namespaces {
+		for _, group := range nsGroups {
+			group.Namespace = namespace
+			group.Tenant = tenant
+			groups = append(groups, group)
 		}
 	}
-	return exec.Command(path, args...).Output()
+	return groups, nil
+}
+
+func getCortexURL(endpoint *grizzly.Endpoint, urlPath string) (string, error) {
+	if endpoint != nil {
+		return endpoint.JoinURL(urlPath)
+	}
+	address, exists := os.LookupEnv("PROMETHEUS_ADDRESS")
+	if !exists {
+		return "", fmt.Errorf("Require PROMETHEUS_ADDRESS (optionally PROMETHEUS_TENANT_ID & PROMETHEUS_TOKEN)")
+	}
+	if _, err := url.Parse(address); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(address, "/") + "/" + urlPath, nil
+}
+
+// cortexRequest sends a request to the ruler or Alertmanager on behalf of a
+// tenant. An empty tenant falls back to PROMETHEUS_TENANT_ID.
+func cortexRequest(ctx context.Context, endpoint *grizzly.Endpoint, method, urlPath, tenant string, body []byte) ([]byte, error) {
+	rulerURL, err := getCortexURL(endpoint, urlPath)
+	if err != nil {
+		return nil, err
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rulerURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/yaml")
+
+	defaultTenant := os.Getenv("PROMETHEUS_TENANT_ID")
+	if tenant == "" {
+		tenant = defaultTenant
+	}
+	if api, _ := rulerAPI(); tenant != "" && api != thanosRulerAPI {
+		req.Header.Add("X-Scope-OrgID", tenant)
+	}
+	if err := grizzly.SetAuthFromEnv(req, "PROMETHEUS", defaultTenant); err != nil {
+		return nil, err
+	}
+
+	var resp *http.Response
+	if endpoint != nil {
+		resp, err = endpoint.Do(req)
+	} else {
+		resp, err = grizzly.HTTPClientFromEnv("PROMETHEUS").Do(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, grizzly.ErrNotFound
+	case resp.StatusCode >= 400:
+		return nil, fmt.Errorf("Non-200 response from %s: %s: %s", urlPath, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
 }
@@ -0,0 +1,399 @@
+package prometheus
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+	"github.com/prometheus/common/model"
+)
+
+func TestParseRuleGroupUID(t *testing.T) {
+	tests := map[string]struct {
+		uid       string
+		tenant    string
+		namespace string
+		name      string
+		err       bool
+	}{
+		"default tenant": {
+			"first_rules-grizzly_alerts",
+			"",
+			"first_rules",
+			"grizzly_alerts",
+			false,
+		},
+		"tenant override": {
+			"team-a:first_rules-grizzly-alerts",
+			"team-a",
+			"first_rules",
+			"grizzly-alerts",
+			false,
+		},
+		"no group name": {
+			"first_rules",
+			"",
+			"",
+			"",
+			true,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		tenant, namespace, name, err := parseRuleGroupUID(test.uid)
+		if err != nil && !test.err {
+			t.Errorf("Unexpected error parsing UID: %s", err)
+		}
+		if err == nil && test.err {
+			t.Errorf("Expected error parsing UID %s", test.uid)
+		}
+		if tenant != test.tenant || namespace != test.namespace || name != test.name {
+			t.Errorf("Expected %q/%q/%q, got: %q/%q/%q", test.tenant, test.namespace, test.name, tenant, namespace, name)
+		}
+		group := RuleGroup{Tenant: tenant, Namespace: namespace, Name: name}
+		if !test.err && group.UID() != test.uid {
+			t.Errorf("Expected UID %s, got: %s", test.uid, group.UID())
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := map[float64]string{
+		0:      "0s",
+		30:     "30s",
+		300:    "5m",
+		5400:   "1h30m",
+		86400:  "1d",
+		0.5:    "500ms",
+		694800: "1w1d1h",
+	}
+	for seconds, expected := range tests {
+		if got := formatDuration(seconds); got != expected {
+			t.Errorf("Expected %s for %v seconds, got: %s", expected, seconds, got)
+		}
+	}
+}
+
+func TestValidateRuleGroup(t *testing.T) {
+	tests := map[string]struct {
+		rules []map[string]interface{}
+		err   string
+	}{
+		"valid": {
+			rules: []map[string]interface{}{
+				{"record": "job:up:sum", "expr": "sum by (job) (up)"},
+				{"alert": "Down", "expr": "up == 0", "for": "5m", "labels": map[string]interface{}{"severity": "critical"}},
+				{"alert": "Down", "expr": "up == 0", "labels": map[string]interface{}{"severity": "warning"}},
+			},
+		},
+		"invalid expression": {
+			rules: []map[string]interface{}{
+				{"record": "job:up:sum", "expr": "sum by (job) (up"},
+			},
+			err: `4:15: group "alerts", rule 1, "job:up:sum": could not parse expression`,
+		},
+		"invalid label name": {
+			rules: []map[string]interface{}{
+				{"alert": "Down", "expr": "up == 0", "labels": map[string]interface{}{"sev-erity": "critical"}},
+			},
+			err: "invalid label name: sev-erity",
+		},
+		"duplicate rule": {
+			rules: []map[string]interface{}{
+				{"record": "job:up:sum", "expr": "sum by (job) (up)"},
+				{"record": "job:up:sum", "expr": "sum by (job) (up)"},
+			},
+			err: `group "alerts", rule 1, "job:up:sum": duplicate rule`,
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		group := RuleGroup{Namespace: "first_rules", Name: "alerts", Rules: test.rules}
+		err := group.validate()
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error validating rule group: %s", err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("Expected error containing %q, got: %v", test.err, err)
+		}
+	}
+}
+
+func TestParseTenants(t *testing.T) {
+	tests := map[string]struct {
+		grouping map[string]interface{}
+		exprs    map[string]string
+		err      string
+	}{
+		"default tenant": {
+			grouping: map[string]interface{}{},
+			exprs:    map[string]string{"prometheus/first_rules-alerts": `up{tenant="$__tenant"} == 0`},
+		},
+		"tenants": {
+			grouping: map[string]interface{}{"tenants": []interface{}{"team-a", "team-b"}},
+			exprs: map[string]string{
+				"prometheus/team-a:first_rules-alerts": `up{tenant="team-a"} == 0`,
+				"prometheus/team-b:first_rules-alerts": `up{tenant="team-b"} == 0`,
+			},
+		},
+		"tenant and tenants": {
+			grouping: map[string]interface{}{"tenant": "team-a", "tenants": []interface{}{"team-b"}},
+			err:      "Namespace first_rules sets both tenant and tenants",
+		},
+	}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		test.grouping["groups"] = []interface{}{
+			map[string]interface{}{
+				"name":  "alerts",
+				"rules": []interface{}{map[string]interface{}{"alert": "Down", "expr": `up{tenant="$__tenant"} == 0`}},
+			},
+		}
+		h := NewRuleHandler(nil)
+		resources, err := h.Parse(prometheusAlertsPath, map[string]interface{}{"first_rules": test.grouping})
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Expected error %q, got: %v", test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error parsing rule groups: %s", err)
+		}
+		if len(resources) != len(test.exprs) {
+			t.Errorf("Expected %d rule groups, got: %d", len(test.exprs), len(resources))
+		}
+		for key, expr := range test.exprs {
+			resource, ok := resources[key]
+			if !ok {
+				t.Errorf("Expected rule group %s, got: %v", key, resources)
+				continue
+			}
+			if actual := resource.Detail.(RuleGroup).Rules[0]["expr"]; actual != expr {
+				t.Errorf("Expected %s, got: %s", expr, actual)
+			}
+		}
+	}
+}
+
+func TestRunRuleTests(t *testing.T) {
+	group := RuleGroup{
+		Namespace: "first_rules",
+		Name:      "alerts",
+		Rules: []map[string]interface{}{
+			{"alert": "Down", "expr": "up == 0", "for": "1m"},
+		},
+	}
+	testGroup := func(expected int) ruleTestGroup {
+		alerts := []expectedAlert{}
+		for i := 0; i < expected; i++ {
+			alerts = append(alerts, expectedAlert{ExpLabels: map[string]string{"job": "api"}})
+		}
+		return ruleTestGroup{
+			Interval:    model.Duration(time.Minute),
+			InputSeries: []ruleTestSeries{{Series: `up{job="api"}`, Values: "0 0 0"}},
+			AlertRuleTests: []alertTestCase{
+				{EvalTime: model.Duration(2 * time.Minute), Alertname: "Down", ExpAlerts: alerts},
+			},
+		}
+	}
+	f := ruleTestFile{
+		RuleFiles: []string{"prometheus/first_rules-alerts.yaml"},
+		Tests:     []ruleTestGroup{testGroup(1), testGroup(0)},
+	}
+	if uids := f.ruleGroupUIDs(); len(uids) != 1 || uids[0] != group.UID() {
+		t.Errorf("Expected rule group UIDs [%s], got: %v", group.UID(), uids)
+	}
+	failures, err := runRuleTests(f, []RuleGroup{group})
+	if err != nil {
+		t.Fatalf("Unexpected error running rule tests: %s", err)
+	}
+	if len(failures) != 1 || !strings.Contains(failures[0].Error(), "alertname: Down") {
+		t.Errorf("Expected the second test to fail, got: %v", failures)
+	}
+}
+
+func TestCortexRequestAuth(t *testing.T) {
+	tests := map[string]struct {
+		env     map[string]string
+		auth    string
+		headers http.Header
+		err     bool
+	}{
+		"no auth": {
+			map[string]string{},
+			"",
+			http.Header{},
+			false,
+		},
+		"basic auth as tenant": {
+			map[string]string{"PROMETHEUS_TENANT_ID": "1234", "PROMETHEUS_TOKEN": "token"},
+			"Basic MTIzNDp0b2tlbg==",
+			http.Header{},
+			false,
+		},
+		"basic auth as user": {
+			map[string]string{"PROMETHEUS_TENANT_ID": "1234", "PROMETHEUS_USER": "user", "PROMETHEUS_TOKEN": "token"},
+			"Basic dXNlcjp0b2tlbg==",
+			http.Header{},
+			false,
+		},
+		"bearer token": {
+			map[string]string{"PROMETHEUS_BEARER_TOKEN": "token"},
+			"Bearer token",
+			http.Header{},
+			false,
+		},
+		"extra headers": {
+			map[string]string{"PROMETHEUS_HEADERS": "X-Team=payments, X-Env=prod"},
+			"",
+			http.Header{"X-Team": {"payments"}, "X-Env": {"prod"}},
+			false,
+		},
+		"both tokens": {
+			map[string]string{"PROMETHEUS_TOKEN": "token", "PROMETHEUS_BEARER_TOKEN": "token"},
+			"",
+			nil,
+			true,
+		},
+		"invalid headers": {
+			map[string]string{"PROMETHEUS_HEADERS": "X-Team"},
+			"",
+			nil,
+			true,
+		},
+	}
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer server.Close()
+	vars := []string{"PROMETHEUS_TENANT_ID", "PROMETHEUS_USER", "PROMETHEUS_TOKEN", "PROMETHEUS_BEARER_TOKEN", "PROMETHEUS_HEADERS"}
+	for testName, test := range tests {
+		t.Logf("Running test case, %q...", testName)
+		os.Setenv("PROMETHEUS_ADDRESS", server.URL)
+		for _, name := range vars {
+			os.Unsetenv(name)
+		}
+		for name, value := range test.env {
+			os.Setenv(name, value)
+		}
+		got = nil
+		_, err := cortexRequest(context.Background(), nil, "GET", "api/v1/rules", "", nil)
+		if err != nil && !test.err {
+			t.Errorf("Unexpected error sending request: %s", err)
+		}
+		if err == nil && test.err {
+			t.Errorf("Expected error sending request")
+		}
+		if test.err {
+			continue
+		}
+		if auth := got.Header.Get("Authorization"); auth != test.auth {
+			t.Errorf("Expected Authorization %q, got: %q", test.auth, auth)
+		}
+		for name := range test.headers {
+			if got.Header.Get(name) != test.headers.Get(name) {
+				t.Errorf("Expected header %s %q, got: %q", name, test.headers.Get(name), got.Header.Get(name))
+			}
+		}
+	}
+	os.Unsetenv("PROMETHEUS_ADDRESS")
+	for _, name := range vars {
+		os.Unsetenv(name)
+	}
+}
+
+func TestCortexRequestEndpoint(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer server.Close()
+	os.Unsetenv("PROMETHEUS_ADDRESS")
+
+	endpoint := &grizzly.Endpoint{
+		URL:    server.URL + "/prometheus",
+		Header: http.Header{"Authorization": {"Bearer token"}},
+	}
+	if _, err := cortexRequest(context.Background(), endpoint, "GET", "api/v1/rules", "team-a", nil); err != nil {
+		t.Fatalf("Unexpected error sending request: %s", err)
+	}
+	if got.URL.Path != "/prometheus/api/v1/rules" {
+		t.Errorf("Expected path /prometheus/api/v1/rules, got: %s", got.URL.Path)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer token" {
+		t.Errorf("Expected Authorization %q, got: %q", "Bearer token", auth)
+	}
+	if tenant := got.Header.Get("X-Scope-OrgID"); tenant != "team-a" {
+		t.Errorf("Expected tenant team-a, got: %q", tenant)
+	}
+}
+
+func TestCortextoolRuleGroups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grizzly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// the fake cortextool records its tenant and arguments, and prints a rule
+	// group
+	calls := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$CORTEX_ADDRESS $CORTEX_TENANT_ID $*" >> ` + calls + `
+if [ "$2" = print ]; then
+  printf 'first_rules:\n  - name: grizzly_alerts\n    rules:\n      - alert: Down\n        expr: up == 0\n'
+fi
+`
+	path := filepath.Join(dir, "cortextool")
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CORTEXTOOL_PATH", path)
+	os.Setenv("PROMETHEUS_ADDRESS", "http://ruler/")
+	os.Setenv("PROMETHEUS_TENANT_ID", "1234")
+	defer os.Unsetenv("CORTEXTOOL_PATH")
+	defer os.Unsetenv("PROMETHEUS_ADDRESS")
+	defer os.Unsetenv("PROMETHEUS_TENANT_ID")
+
+	group, err := getRemoteRuleGroup(context.Background(), nil, "first_rules-grizzly_alerts")
+	if err != nil {
+		t.Fatalf("Unexpected error getting rule group: %s", err)
+	}
+	if group.Name != "grizzly_alerts" || len(group.Rules) != 1 {
+		t.Errorf("Expected rule group grizzly_alerts with 1 rule, got: %v", group)
+	}
+	if _, err := getRemoteRuleGroup(context.Background(), nil, "first_rules-missing"); err != grizzly.ErrNotFound {
+		t.Errorf("Expected missing rule group not to be found, got: %v", err)
+	}
+	group.Tenant = "team-a"
+	if err := writeRuleGroup(context.Background(), nil, *group); err != nil {
+		t.Fatalf("Unexpected error writing rule group: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected := []string{
+		"http://ruler 1234 rules print --disable-color",
+		"http://ruler 1234 rules print --disable-color",
+		"http://ruler team-a rules load ",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d calls to cortextool, got: %v", len(expected), lines)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, expected[i]) {
+			t.Errorf("Expected call %q, got: %q", expected[i], line)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/grafana/grizzly/pkg/grizzly"
+)
+
+/*
+ * The Thanos ruler loads rules from files and only offers the read-only
+ * Prometheus rules API, which returns rules in a different (JSON) format and
+ * does not support tenants. In Thanos mode, rule groups can be compared with
+ * what the ruler has loaded, but must be delivered as files, e.g. via
+ * `grr export`. The namespace of a group is the name of the file it was loaded
+ * from, without its extension.
+ */
+
+const (
+	cortexRulerAPI = "cortex"
+	thanosRulerAPI = "thanos"
+)
+
+// rulerAPI returns the type of ruler API configured via PROMETHEUS_RULER_API.
+// Without it, setting CORTEXTOOL_PATH selects the deprecated cortextool.
+func rulerAPI() (string, error) {
+	api, exists := os.LookupEnv("PROMETHEUS_RULER_API")
+	if !exists || api == "" {
+		if os.Getenv("CORTEXTOOL_PATH") != "" {
+			return cortextoolRulerAPI, nil
+		}
+		return cortexRulerAPI, nil
+	}
+	switch api {
+	case cortexRulerAPI, thanosRulerAPI, cortextoolRulerAPI:
+		return api, nil
+	}
+	return "", fmt.Errorf("PROMETHEUS_RULER_API must be %s, %s or %s, got: %s", cortexRulerAPI, thanosRulerAPI, cortextoolRulerAPI, api)
+}
+
+// errThanosReadOnly is returned when attempting to write rules to a Thanos ruler
+var errThanosReadOnly = fmt.Errorf("The Thanos ruler does not support writing rules via its API. Use `grr export` to write rule files instead")
+
+type thanosRule struct {
+	Type        string            `json:"type"`
+	Name        string            `json:"name"`
+	Query       string            `json:"query"`
+	Duration    float64           `json:"duration"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type thanosRuleGroup struct {
+	Name  string       `json:"name"`
+	File  string       `json:"file"`
+	Rules []thanosRule `json:"rules"`
+}
+
+// getThanosRuleGroup retrieves a rule group from the Prometheus rules API of a Thanos ruler
+func getThanosRuleGroup(ctx context.Context, endpoint *grizzly.Endpoint, tenant, namespace, name string) (*RuleGroup, error) {
+	if tenant != "" {
+		return nil, fmt.Errorf("The Thanos ruler does not support tenants: %s", tenant)
+	}
+	groups, err := listThanosRuleGroups(ctx, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Namespace == namespace && group.Name == name {
+			return &group, nil
+		}
+	}
+	return nil, grizzly.ErrNotFound
+}
+
+// listThanosRuleGroups retrieves all rule groups from the Prometheus rules API of a Thanos ruler
+func listThanosRuleGroups(ctx context.Context, endpoint *grizzly.Endpoint) ([]RuleGroup, error) {
+	out, err := cortexRequest(ctx, endpoint, "GET", rulerAPIPath, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Groups []thanosRuleGroup `json:"groups"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return nil, grizzly.APIErr{Err: err, Body: out}
+	}
+	groups := []RuleGroup{}
+	for _, g := range resp.Data.Groups {
+		file := filepath.Base(g.File)
+		group := RuleGroup{
+			Namespace: strings.TrimSuffix(file, filepath.Ext(file)),
+			Name:      g.Name,
+			Rules:     []map[string]interface{}{},
+		}
+		for _, r := range g.Rules {
+			group.Rules = append(group.Rules, r.toRule())
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// toRule converts a rule from the Prometheus API format into the rule file format
+func (r thanosRule) toRule() map[string]interface{} {
+	rule := map[string]interface{}{
+		"expr": r.Query,
+	}
+	if r.Type == "alerting" {
+		rule["alert"] = r.Name
+		if r.Duration > 0 {
+			rule["for"] = formatDuration(r.Duration)
+		}
+		if len(r.Annotations) > 0 {
+			rule["annotations"] = r.Annotations
+		}
+	} else {
+		rule["record"] = r.Name
+	}
+	if len(r.Labels) > 0 {
+		rule["labels"] = r.Labels
+	}
+	return rule
+}
+
+// formatDuration formats seconds the way Prometheus does in rule files, e.g. 1h30m
+func formatDuration(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+	}
+	var b strings.Builder
+	for _, unit := range units {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.name)
+			d -= n * unit.size
+		}
+	}
+	if b.Len() == 0 {
+		return "0s"
+	}
+	return b.String()
+}
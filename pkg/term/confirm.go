@@ -0,0 +1,43 @@
+package term
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrAborted is returned when the user does not confirm an action
+var ErrAborted = errors.New("Aborted")
+
+// Confirm asks the user to confirm an action by typing approve. The action is
+// aborted if the context is canceled while waiting, e.g. on interrupt.
+func Confirm(ctx context.Context, msg, approve string) error {
+	fmt.Println(msg)
+	fmt.Printf("Please type '%s' to confirm: ", approve)
+	type answer struct {
+		read string
+		err  error
+	}
+	answers := make(chan answer, 1)
+	go func() {
+		read, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		answers <- answer{read, err}
+	}()
+	var a answer
+	select {
+	case a = <-answers:
+	case <-ctx.Done():
+		fmt.Println()
+		return ErrAborted
+	}
+	if a.err != nil {
+		return a.err
+	}
+	if strings.TrimSpace(a.read) != approve {
+		return ErrAborted
+	}
+	return nil
+}
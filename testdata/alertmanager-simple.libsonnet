@@ -0,0 +1,14 @@
+{
+  prometheusAlertmanager: {
+    template_files: {},
+    alertmanager_config: {
+      route: {
+        receiver: 'default',
+        group_by: ['alertname'],
+      },
+      receivers: [
+        { name: 'default' },
+      ],
+    },
+  },
+}
@@ -0,0 +1,25 @@
+{
+  lokiAlerts+: {
+    api_logs: {
+      groups: [
+        {
+          name: 'api_errors',
+          rules: [
+            {
+              alert: 'APIErrorsHigh',
+              expr: |||
+                sum by (job) (
+                  rate({app="api"} |= "error" [5m])
+                ) > 10
+              |||,
+              'for': '5m',
+              labels: {
+                severity: 'warning',
+              },
+            },
+          ],
+        },
+      ],
+    },
+  },
+}
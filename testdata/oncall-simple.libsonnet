@@ -0,0 +1,20 @@
+{
+  grafanaOnCallEscalationChains+:: {
+    primary: {
+      name: 'primary',
+    },
+  },
+  grafanaOnCallSchedules+:: {
+    primary: {
+      name: 'primary',
+      type: 'web',
+      time_zone: 'UTC',
+    },
+  },
+  grafanaOnCallIntegrations+:: {
+    alertmanager: {
+      name: 'alertmanager',
+      type: 'alertmanager',
+    },
+  },
+}
@@ -0,0 +1,9 @@
+{
+  grafanaPlugins+:: {
+    'grafana-kubernetes-app': {
+      enabled: true,
+      pinned: true,
+      jsonData: {},
+    },
+  },
+}
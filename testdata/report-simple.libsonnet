@@ -0,0 +1,25 @@
+{
+  grafanaReports+:: {
+    'weekly-overview': {
+      name: 'Weekly Overview',
+      dashboardUid: 'prod-overview',
+      recipients: 'team@example.com',
+      replyTo: '',
+      message: 'Weekly production overview',
+      schedule: {
+        frequency: 'weekly',
+        day: 'monday',
+        hour: 8,
+        minute: 0,
+        timeZone: 'UTC',
+      },
+      options: {
+        orientation: 'landscape',
+        layout: 'grid',
+      },
+      templateVars: {},
+      enableDashboardUrl: true,
+      enableCsv: false,
+    },
+  },
+}
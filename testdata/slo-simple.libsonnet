@@ -0,0 +1,30 @@
+{
+  grafanaSLOs+:: {
+    'api-availability': {
+      name: 'API availability',
+      description: 'Share of API requests served without errors',
+      query: {
+        type: 'ratio',
+        ratio: {
+          successMetric: 'http_requests_total{code!~"5.."}',
+          totalMetric: 'http_requests_total',
+          groupByLabels: ['cluster'],
+        },
+      },
+      objectives: [
+        { value: 0.995, window: '28d' },
+      ],
+      labels: [
+        { key: 'team', value: 'api' },
+      ],
+      alerting: {
+        fastBurn: {
+          labels: [{ key: 'severity', value: 'critical' }],
+        },
+        slowBurn: {
+          labels: [{ key: 'severity', value: 'warning' }],
+        },
+      },
+    },
+  },
+}
@@ -0,0 +1,14 @@
+{
+  grafanaUsers+:: {
+    alice: {
+      login: 'alice',
+      email: 'alice@example.com',
+      name: 'Alice',
+      password: 'changeme',
+      isGrafanaAdmin: false,
+      orgs: [
+        { orgId: 1, role: 'Editor' },
+      ],
+    },
+  },
+}